@@ -11,7 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/logging"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 )
 
 const (
@@ -40,6 +43,24 @@ type responseWrapper struct {
 // library. `assetsDirectory` contains HTML templates and other UI assets. If empty, no UI will be
 // served, and only REST endpoints under `/api/` will be served.
 func ServeAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory string, development bool) {
+	ServeSecureAdminConsole(a, mux, assetsDirectory, development, nil, nil, nil)
+}
+
+// ServeSecureAdminConsole serves up an admin console like ServeAdminConsole, authenticating requests
+// to the UI and REST endpoints with `authenticator` and authorizing them against `policy`. If
+// `authenticator` is nil, requests are neither authenticated nor authorized. If `policy` is nil,
+// every authenticated principal is allowed everything. Requests from `proxies` are attributed to
+// the client and user they forward.
+func ServeSecureAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory string, development bool,
+	authenticator Authenticator, policy *Policy, proxies TrustedProxies) {
+	secure := func(next http.Handler) http.Handler {
+		if authenticator != nil {
+			next = authHandler(authenticator, policy, next)
+		}
+
+		return proxiesHandler(proxies, next)
+	}
+
 	if assetsDirectory != "" {
 		msg := "Serving assets from %s"
 
@@ -50,7 +71,7 @@ func ServeAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory stri
 		logging.Printf(msg, assetsDirectory)
 
 		mux.Handle("/", loggingHandler(http.RedirectHandler("/admin/", 301)))
-		mux.Handle("/admin/", loggingHandler(newUIHandler(a, assetsDirectory, development)))
+		mux.Handle("/admin/", loggingHandler(secure(newUIHandler(a, assetsDirectory, development))))
 		mux.Handle("/js/", loggingHandler(http.FileServer(http.Dir(assetsDirectory))))
 		mux.Handle("/favicon.ico", http.NotFoundHandler())
 	} else {
@@ -63,9 +84,11 @@ func ServeAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory stri
 
 	apiHandler := loggingHandler(
 		jsonResponseHandler(
-			apiVersionHandler(
-				a,
-				apiRequestHandler(namespacesHandler, bucketsHandler),
+			secure(
+				apiVersionHandler(
+					a,
+					apiRequestHandler(namespacesHandler, bucketsHandler),
+				),
 			),
 		),
 	)
@@ -73,13 +96,25 @@ func ServeAdminConsole(a Administrable, mux *http.ServeMux, assetsDirectory stri
 	mux.Handle("/api", apiHandler)
 	mux.Handle("/api/", apiHandler)
 
-	statsHandler := loggingHandler(jsonResponseHandler(newStatsAPIHandler(a)))
+	statsHandler := loggingHandler(jsonResponseHandler(secure(newStatsAPIHandler(a))))
 	mux.Handle("/api/stats", statsHandler)
 	mux.Handle("/api/stats/", statsHandler)
 
-	configsHandler := loggingHandler(jsonResponseHandler(newConfigsAPIHandler(a)))
+	configsHandler := loggingHandler(jsonResponseHandler(secure(newConfigsAPIHandler(a))))
 	mux.Handle("/api/configs", configsHandler)
 	mux.Handle("/api/configs/", configsHandler)
+
+	boostsHandler := loggingHandler(jsonResponseHandler(secure(newBoostsAPIHandler(a))))
+	mux.Handle("/api/boosts", boostsHandler)
+	mux.Handle("/api/boosts/", boostsHandler)
+
+	rolloutHandler := loggingHandler(jsonResponseHandler(secure(newRolloutAPIHandler(a))))
+	mux.Handle("/api/rollout", rolloutHandler)
+	mux.Handle("/api/rollout/", rolloutHandler)
+
+	auditHandler := loggingHandler(jsonResponseHandler(secure(newAuditAPIHandler(a))))
+	mux.Handle("/api/audit", auditHandler)
+	mux.Handle("/api/audit/", auditHandler)
 }
 
 func (r *responseWrapper) Write(p []byte) (int, error) {
@@ -154,14 +189,9 @@ func apiRequestHandler(namespacesHandler, bucketsHandler http.Handler) http.Hand
 
 func loggingHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientIP := r.RemoteAddr
-		if colon := strings.LastIndex(clientIP, ":"); colon != -1 {
-			clientIP = clientIP[:colon]
-		}
-
 		response := &responseWrapper{
 			ResponseWriter: w,
-			ip:             clientIP,
+			ip:             clientIP(r),
 			time:           time.Time{},
 			method:         r.Method,
 			uri:            r.RequestURI,
@@ -179,10 +209,56 @@ func loggingHandler(next http.Handler) http.Handler {
 	})
 }
 
-func getUsername(r *http.Request) string {
-	if username, exists := r.Header["X-Forwarded-User"]; exists {
-		return username[0]
+// requestedConfigs returns the service config as declared or, if the request has effective=true,
+// as it is served, with buckets inheriting unset fields from bucket defaults.
+func requestedConfigs(a Administrable, r *http.Request) (*pb.ServiceConfig, *httpError) {
+	param := r.URL.Query().Get("effective")
+	if param == "" {
+		return a.Configs(), nil
+	}
+
+	effective, err := strconv.ParseBool(param)
+	if err != nil {
+		return nil, &httpError{"Invalid effective " + param, http.StatusBadRequest}
+	}
+
+	if !effective {
+		return a.Configs(), nil
+	}
+
+	cfg, err := config.EffectiveConfig(a.Configs())
+	if err != nil {
+		return nil, &httpError{err.Error(), http.StatusInternalServerError}
+	}
+
+	return cfg, nil
+}
+
+// getActor identifies who made a request, and from where, for attributing the changes it makes.
+// Authenticated requests are attributed to their principal, and others to the X-Forwarded-User
+// header set by a trusted proxy in front of the admin API.
+func getActor(r *http.Request) audit.Actor {
+	actor := audit.Actor{User: "quotaservice", SourceIP: clientIP(r)}
+
+	if s, authenticated := r.Context().Value(sessionKey).(*session); authenticated {
+		actor.User = s.principal
+	} else if user := forwardedUser(r); user != "" {
+		actor.User = user
+	}
+
+	if forwarded := forwardedFor(r); forwarded != "" {
+		actor.SourceIP = forwarded
+	}
+
+	return actor
+}
+
+// clientIP returns the address a request was sent from, without its port.
+func clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if colon := strings.LastIndex(ip, ":"); colon != -1 {
+		ip = ip[:colon]
 	}
 
-	return "quotaservice"
+	return ip
 }
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/mian-qin/qqs/quotaservice/audit"
 	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/test/helpers"
 )
@@ -96,6 +97,64 @@ func TestNamespacesGetBadVersion(t *testing.T) {
 	}
 }
 
+func TestGetActor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/ns", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+
+	if actor := getActor(r); actor.User != "quotaservice" || actor.SourceIP != "10.0.0.1" {
+		t.Errorf("Expected the default user from 10.0.0.1, got %+v", actor)
+	}
+
+	// Forwarding headers are ignored unless the request comes from a trusted proxy.
+	r.Header.Set("X-Forwarded-User", "alice")
+	r.Header.Set("X-Forwarded-For", "192.168.1.1, 10.0.0.2")
+
+	if actor := getActor(r); actor.User != "quotaservice" || actor.SourceIP != "10.0.0.1" {
+		t.Errorf("Expected forwarding headers to be ignored, got %+v", actor)
+	}
+}
+
+func TestGetActorTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/24", "172.16.0.1")
+	helpers.CheckError(t, err)
+
+	actorOf := func(remoteAddr, user string, forwardedFor ...string) audit.Actor {
+		var actor audit.Actor
+		handler := proxiesHandler(proxies, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor = getActor(r)
+		}))
+
+		r := httptest.NewRequest(http.MethodPost, "/api/ns", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-User", user)
+		for _, f := range forwardedFor {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return actor
+	}
+
+	expected := audit.Actor{User: "alice", SourceIP: "192.168.1.1"}
+	if actor := actorOf("10.0.0.1:4321", "alice", "192.168.1.1"); actor != expected {
+		t.Errorf("Expected %+v, got %+v", expected, actor)
+	}
+
+	// The client is the last address not added by a trusted proxy, as earlier ones can be forged.
+	if actor := actorOf("10.0.0.1:4321", "alice", "6.6.6.6, 192.168.1.1", "172.16.0.1"); actor != expected {
+		t.Errorf("Expected %+v, got %+v", expected, actor)
+	}
+
+	expected = audit.Actor{User: "quotaservice", SourceIP: "10.0.1.1"}
+	if actor := actorOf("10.0.1.1:4321", "alice", "192.168.1.1"); actor != expected {
+		t.Errorf("Expected headers from an untrusted address to be ignored, got %+v", actor)
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("Expected an invalid network to fail")
+	}
+}
+
 func TestUnmarshalBucketConfig(t *testing.T) {
 	c := config.NewDefaultBucketConfig("Blah 123")
 	c.FillRate = 12345
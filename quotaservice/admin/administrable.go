@@ -4,6 +4,8 @@
 package admin
 
 import (
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/config"
 	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 	"github.com/mian-qin/qqs/quotaservice/stats"
 )
@@ -11,17 +13,29 @@ import (
 // Administrable defines something that can be administered via this package.
 type Administrable interface {
 	Configs() *pb.ServiceConfig
-	HistoricalConfigs() ([]*pb.ServiceConfig, error)
+	HistoricalConfigs(config.HistoryPage) ([]*pb.ServiceConfig, error)
 
-	UpdateConfig(*pb.ServiceConfig, string) error
+	UpdateConfig(*pb.ServiceConfig, audit.Actor) error
+	UpdateConfigIfVersion(*pb.ServiceConfig, int32, audit.Actor) error
+	Rollback(int32, audit.Actor) error
+	MigrateHistory() (int, error)
+	AuditRecords(audit.Filter) ([]*audit.Record, error)
 
-	DeleteBucket(string, string, string) error
-	AddBucket(string, *pb.BucketConfig, string) error
-	UpdateBucket(string, *pb.BucketConfig, string) error
+	DeleteBucket(string, string, audit.Actor) error
+	AddBucket(string, *pb.BucketConfig, audit.Actor) error
+	UpdateBucket(string, *pb.BucketConfig, audit.Actor) error
 
-	DeleteNamespace(string, string) error
-	AddNamespace(*pb.NamespaceConfig, string) error
-	UpdateNamespace(*pb.NamespaceConfig, string) error
+	DeleteNamespace(string, audit.Actor) error
+	AddNamespace(*pb.NamespaceConfig, audit.Actor) error
+	UpdateNamespace(*pb.NamespaceConfig, audit.Actor) error
+
+	AddBoost(*pb.BucketBoost, audit.Actor) error
+	DeleteBoost(string, string, audit.Actor) error
+
+	StageConfig(*pb.ServiceConfig, *pb.Rollout, audit.Actor) error
+	PromoteRollout(audit.Actor) error
+	RollBackRollout(audit.Actor) error
+	FleetHealth() ([]*stats.NodeHealth, error)
 
 	TopDynamicHits(string) []*stats.BucketScore
 	TopDynamicMisses(string) []*stats.BucketScore
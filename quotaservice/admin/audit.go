@@ -0,0 +1,99 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mian-qin/qqs/quotaservice/audit"
+)
+
+// defaultAuditPageSize is the number of audit records returned when no limit is requested.
+const defaultAuditPageSize = 100
+
+type auditAPIHandler struct {
+	a Administrable
+}
+
+func newAuditAPIHandler(admin Administrable) (a *auditAPIHandler) {
+	return &auditAPIHandler{a: admin}
+}
+
+type auditResponse struct {
+	Records []*audit.Record `json:"records"`
+}
+
+func (a *auditAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/audit" && r.URL.Path != "/api/audit/" {
+		writeJSONError(w, &httpError{"", http.StatusNotFound})
+		return
+	}
+
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	if !authorized(w, r, "", RoleAdmin) {
+		return
+	}
+
+	f, httpErr := auditFilter(r)
+
+	if httpErr != nil {
+		writeJSONError(w, httpErr)
+		return
+	}
+
+	records, err := a.a.AuditRecords(f)
+
+	if err == audit.ErrNoSink {
+		writeJSONError(w, &httpError{err.Error(), http.StatusNotImplemented})
+		return
+	}
+
+	if err != nil {
+		writeJSONError(w, &httpError{"Error reading audit records " + err.Error(), http.StatusInternalServerError})
+		return
+	}
+
+	writeJSON(w, &auditResponse{records})
+}
+
+// auditFilter reads the filter requested with the user, operation, namespace, bucket, since, until
+// and limit query parameters.
+func auditFilter(r *http.Request) (audit.Filter, *httpError) {
+	query := r.URL.Query()
+	f := audit.Filter{
+		User:      query.Get("user"),
+		Operation: query.Get("operation"),
+		Namespace: query.Get("namespace"),
+		Bucket:    query.Get("bucket"),
+		Limit:     defaultAuditPageSize}
+
+	for name, field := range map[string]*int64{"since": &f.Since, "until": &f.Until} {
+		if param := query.Get(name); param != "" {
+			v, err := strconv.ParseInt(param, 10, 64)
+
+			if err != nil || v <= 0 {
+				return f, &httpError{"Invalid " + name + " " + param, http.StatusBadRequest}
+			}
+
+			*field = v
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+
+		if err != nil || v <= 0 {
+			return f, &httpError{"Invalid limit " + limit, http.StatusBadRequest}
+		}
+
+		f.Limit = v
+	}
+
+	return f, nil
+}
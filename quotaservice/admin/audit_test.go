@@ -0,0 +1,76 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuditGet(t *testing.T) {
+	response := &auditResponse{}
+	doAuditRequest(t, NewMockAdministrable(), response, "/api/audit?user=alice&operation=AddBucket&namespace=ns&bucket=b&since=10")
+
+	if len(response.Records) != 1 {
+		t.Fatalf("Received invalid audit response: %+v", response)
+	}
+
+	r := response.Records[0]
+	if r.User != "alice" || r.Operation != "AddBucket" || r.Namespace != "ns" || r.Bucket != "b" || r.Time != 10 ||
+		r.Version != defaultAuditPageSize {
+		t.Errorf("Expected the query parameters to be passed as a filter, got %+v", r)
+	}
+
+	response = &auditResponse{}
+	doAuditRequest(t, NewMockAdministrable(), response, "/api/audit/?limit=5")
+
+	if len(response.Records) != 1 || response.Records[0].Version != 5 {
+		t.Errorf("Expected a limit of 5, got %+v", response)
+	}
+}
+
+func TestAuditInvalid(t *testing.T) {
+	for _, path := range []string{"/api/audit?since=yesterday", "/api/audit?until=-1", "/api/audit?limit=0"} {
+		jsonResponse := make(map[string]string)
+		doAuditRequest(t, NewMockAdministrable(), &jsonResponse, path)
+
+		if jsonResponse["error"] != http.StatusText(http.StatusBadRequest) {
+			t.Errorf("Received \"%s\" from %+v for %v instead of a bad request", jsonResponse["error"], jsonResponse, path)
+		}
+	}
+
+	jsonResponse := make(map[string]string)
+	doAuditRequest(t, NewMockAdministrable(), &jsonResponse, "/api/audit/ns")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusNotFound) {
+		t.Errorf("Received \"%s\" from %+v instead of not found", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestAuditNotRecorded(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doAuditRequest(t, NewMockErrorAdministrable(), &jsonResponse, "/api/audit")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusNotImplemented) {
+		t.Errorf("Received \"%s\" from %+v instead of not implemented", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func doAuditRequest(t *testing.T, a Administrable, object interface{}, path string) {
+	// t.Helper()
+
+	ts := httptest.NewServer(newAuditAPIHandler(a))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshalJSON(res.Body, &object)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
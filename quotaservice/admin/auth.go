@@ -0,0 +1,241 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnauthenticated is returned by Authenticators for requests without valid credentials.
+var ErrUnauthenticated = errors.New("No valid credentials")
+
+// Authenticator identifies the principal making a request to the admin API.
+type Authenticator interface {
+	// Authenticate returns the name of the principal making a request, or ErrUnauthenticated.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// challenger is implemented by Authenticators that tell clients how to authenticate, in the
+// WWW-Authenticate header of 401 responses.
+type challenger interface {
+	challenge() string
+}
+
+type tokenAuthenticator struct {
+	// Principals keyed by token
+	principals map[string]string
+}
+
+// NewTokenAuthenticator creates an Authenticator for static bearer tokens, passed in the
+// Authorization header as "Bearer {token}". tokens maps each token to the principal it identifies.
+func NewTokenAuthenticator(tokens map[string]string) Authenticator {
+	principals := make(map[string]string, len(tokens))
+	for token, principal := range tokens {
+		principals[token] = principal
+	}
+
+	return &tokenAuthenticator{principals}
+}
+
+func (t *tokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", ErrUnauthenticated
+	}
+
+	token := []byte(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	principal := ""
+
+	// Every token is compared, so the time taken doesn't depend on which one matches.
+	for candidate, p := range t.principals {
+		if subtle.ConstantTimeCompare(token, []byte(candidate)) == 1 {
+			principal = p
+		}
+	}
+
+	if principal == "" {
+		return "", ErrUnauthenticated
+	}
+
+	return principal, nil
+}
+
+func (t *tokenAuthenticator) challenge() string {
+	return `Bearer realm="quotaservice"`
+}
+
+type clientCertAuthenticator struct{}
+
+// NewClientCertAuthenticator creates an Authenticator for TLS client certificates, identifying the
+// principal by the common name of the certificate's subject. Only certificates verified by the
+// http.Server's TLS config are accepted, so it must set ClientCAs and a ClientAuth of at least
+// tls.VerifyClientCertIfGiven.
+func NewClientCertAuthenticator() Authenticator {
+	return &clientCertAuthenticator{}
+}
+
+func (c *clientCertAuthenticator) Authenticate(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", ErrUnauthenticated
+	}
+
+	principal := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if principal == "" {
+		return "", ErrUnauthenticated
+	}
+
+	return principal, nil
+}
+
+type basicAuthenticator struct {
+	// bcrypt hashes keyed by user
+	hashes map[string][]byte
+}
+
+// NewBasicAuthenticator creates an Authenticator for HTTP basic authentication, checking passwords
+// against an htpasswd file of bcrypt hashes, as written by "htpasswd -B". The file is read once.
+func NewBasicAuthenticator(path string) (Authenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = f.Close() }()
+
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(f)
+
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%v:%v: expected user:hash", path, line)
+		}
+
+		if _, err := bcrypt.Cost([]byte(parts[1])); err != nil {
+			return nil, fmt.Errorf("%v:%v: hash for %v isn't bcrypt: %v", path, line, parts[0], err)
+		}
+
+		hashes[parts[0]] = []byte(parts[1])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &basicAuthenticator{hashes}, nil
+}
+
+func (b *basicAuthenticator) Authenticate(r *http.Request) (string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+
+	hash, exists := b.hashes[user]
+	if !exists || bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return "", ErrUnauthenticated
+	}
+
+	return user, nil
+}
+
+func (b *basicAuthenticator) challenge() string {
+	return `Basic realm="quotaservice"`
+}
+
+type chainAuthenticator []Authenticator
+
+// NewChainAuthenticator creates an Authenticator accepting the credentials of any of the given
+// Authenticators, tried in turn.
+func NewChainAuthenticator(authenticators ...Authenticator) Authenticator {
+	return chainAuthenticator(authenticators)
+}
+
+func (c chainAuthenticator) Authenticate(r *http.Request) (string, error) {
+	for _, a := range c {
+		principal, err := a.Authenticate(r)
+		if err != ErrUnauthenticated {
+			return principal, err
+		}
+	}
+
+	return "", ErrUnauthenticated
+}
+
+func (c chainAuthenticator) challenge() string {
+	challenges := make([]string, 0, len(c))
+	for _, a := range c {
+		if ch, ok := a.(challenger); ok {
+			challenges = append(challenges, ch.challenge())
+		}
+	}
+
+	return strings.Join(challenges, ", ")
+}
+
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	// proxiesKey holds the TrustedProxies of requests sent by a trusted proxy.
+	proxiesKey
+)
+
+// session is the principal making a request, and the policy their requests are authorized against.
+type session struct {
+	principal string
+	policy    *Policy
+}
+
+// authHandler authenticates requests before passing them on, rejecting those without valid
+// credentials with a 401.
+func authHandler(authenticator Authenticator, policy *Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticator.Authenticate(r)
+
+		if err != nil {
+			if ch, ok := authenticator.(challenger); ok && ch.challenge() != "" {
+				w.Header().Set("WWW-Authenticate", ch.challenge())
+			}
+
+			writeJSONError(w, &httpError{err.Error(), http.StatusUnauthorized})
+			return
+		}
+
+		s := &session{principal: principal, policy: policy}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionKey, s)))
+	})
+}
+
+// authorized returns true if the principal making a request holds a role in a namespace, or across
+// the service if namespace is empty, and otherwise rejects the request with a 403. Requests are
+// always authorized if the admin API doesn't authenticate them.
+func authorized(w http.ResponseWriter, r *http.Request, namespace string, role Role) bool {
+	s, authenticated := r.Context().Value(sessionKey).(*session)
+	if !authenticated || s.policy.Allows(s.principal, namespace, role) {
+		return true
+	}
+
+	scope := "in namespace " + namespace
+	if namespace == "" {
+		scope = "across the service"
+	}
+
+	writeJSONError(w, &httpError{fmt.Sprintf("%v doesn't have role %v %v", s.principal, role, scope), http.StatusForbidden})
+	return false
+}
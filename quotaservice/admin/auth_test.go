@@ -0,0 +1,209 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := NewTokenAuthenticator(map[string]string{"s3cret": "alice"})
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+
+	if _, err := a.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("Expected a request without a token to be unauthenticated, got %v", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	if _, err := a.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("Expected a request with a wrong token to be unauthenticated, got %v", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer s3cret")
+	if principal, err := a.Authenticate(r); err != nil || principal != "alice" {
+		t.Errorf("Expected alice, got %v and %v", principal, err)
+	}
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_test_auth")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	helpers.CheckError(t, err)
+
+	path := filepath.Join(dir, "htpasswd")
+	helpers.CheckError(t, ioutil.WriteFile(path, []byte("# Admins\nbob:"+string(hash)+"\n"), 0600))
+
+	a, err := NewBasicAuthenticator(path)
+	helpers.CheckError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+	r.SetBasicAuth("bob", "wrong")
+
+	if _, err := a.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("Expected a wrong password to be unauthenticated, got %v", err)
+	}
+
+	r.SetBasicAuth("bob", "hunter2")
+	if principal, err := a.Authenticate(r); err != nil || principal != "bob" {
+		t.Errorf("Expected bob, got %v and %v", principal, err)
+	}
+
+	helpers.CheckError(t, ioutil.WriteFile(path, []byte("bob:plaintext\n"), 0600))
+	if _, err := NewBasicAuthenticator(path); err == nil {
+		t.Error("Expected a file without bcrypt hashes to fail")
+	}
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	a := NewClientCertAuthenticator()
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+
+	if _, err := a.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("Expected a request without TLS to be unauthenticated, got %v", err)
+	}
+
+	// Certificates the server didn't verify aren't trusted.
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "deployer"}}
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	if _, err := a.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("Expected an unverified certificate to be unauthenticated, got %v", err)
+	}
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	if principal, err := a.Authenticate(r); err != nil || principal != "deployer" {
+		t.Errorf("Expected deployer, got %v and %v", principal, err)
+	}
+}
+
+func TestChainAuthenticator(t *testing.T) {
+	a := NewChainAuthenticator(NewClientCertAuthenticator(), NewTokenAuthenticator(map[string]string{"s3cret": "alice"}))
+	r := httptest.NewRequest(http.MethodGet, "/api", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+
+	if principal, err := a.Authenticate(r); err != nil || principal != "alice" {
+		t.Errorf("Expected alice, got %v and %v", principal, err)
+	}
+
+	if challenge := a.(challenger).challenge(); challenge != `Bearer realm="quotaservice"` {
+		t.Errorf("Unexpected challenge %v", challenge)
+	}
+}
+
+func TestSecureAdminConsole(t *testing.T) {
+	a := NewMockAdministrable()
+	helpers.CheckError(t, config.AddNamespace(a.cfg, config.NewDefaultNamespaceConfig("payments")))
+
+	authenticator := NewTokenAuthenticator(map[string]string{"a": "alice", "b": "bob", "c": "carol"})
+	policy := NewPolicy(
+		Grant{Principal: "alice", Role: RoleAdmin},
+		Grant{Principal: "bob", Role: RoleNamespaceEditor, Namespace: "payments"},
+		Grant{Principal: "carol", Role: RoleViewer, Namespace: "payments"})
+
+	mux := http.NewServeMux()
+	ServeSecureAdminConsole(a, mux, "", false, authenticator, policy, nil)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		method, path, token string
+		expected            int
+	}{
+		{"GET", "/api/payments", "", http.StatusUnauthorized},
+		{"GET", "/api/payments", "wrong", http.StatusUnauthorized},
+		{"GET", "/api/payments", "c", http.StatusOK},
+		{"GET", "/api", "c", http.StatusForbidden},
+		{"GET", "/api", "a", http.StatusOK},
+		{"PUT", "/api/payments/b", "c", http.StatusForbidden},
+		{"PUT", "/api/payments/b", "b", http.StatusOK},
+		{"PUT", "/api/other/b", "b", http.StatusForbidden},
+		{"DELETE", "/api/payments", "b", http.StatusForbidden},
+		{"DELETE", "/api/payments", "a", http.StatusOK},
+		{"POST", "/api", "b", http.StatusForbidden},
+		{"GET", "/api/configs", "b", http.StatusForbidden},
+		{"POST", "/api/configs/1/rollback", "a", http.StatusOK},
+		{"POST", "/api/boosts/payments/b", "c", http.StatusForbidden},
+		{"GET", "/api/stats/other", "c", http.StatusForbidden},
+		{"GET", "/api/audit", "b", http.StatusForbidden},
+		{"POST", "/api/rollout/promote", "b", http.StatusForbidden}} {
+		request, err := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		helpers.CheckError(t, err)
+
+		request.Header.Set("Version", "0")
+		if tc.token != "" {
+			request.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+
+		res, err := http.DefaultClient.Do(request)
+		helpers.CheckError(t, err)
+		_ = res.Body.Close()
+
+		if res.StatusCode != tc.expected {
+			t.Errorf("Expected %v %v with token %q to respond %v, got %v", tc.method, tc.path, tc.token, tc.expected, res.StatusCode)
+		}
+
+		if res.StatusCode == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") != `Bearer realm="quotaservice"` {
+			t.Errorf("Expected a challenge responding to %v %v, got %v", tc.method, tc.path, res.Header)
+		}
+	}
+}
+
+func TestNamespaceNameMismatch(t *testing.T) {
+	a := NewMockAdministrable()
+	helpers.CheckError(t, config.AddNamespace(a.cfg, config.NewDefaultNamespaceConfig("payments")))
+
+	authenticator := NewTokenAuthenticator(map[string]string{"b": "bob"})
+	policy := NewPolicy(Grant{Principal: "bob", Role: RoleNamespaceEditor, Namespace: "payments"})
+
+	mux := http.NewServeMux()
+	ServeSecureAdminConsole(a, mux, "", false, authenticator, policy, nil)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// An editor of payments can't write another namespace by naming it in the body.
+	request, err := http.NewRequest("PUT", ts.URL+"/api/payments", strings.NewReader(`{"name": "other"}`))
+	helpers.CheckError(t, err)
+	request.Header.Set("Authorization", "Bearer b")
+
+	res, err := http.DefaultClient.Do(request)
+	helpers.CheckError(t, err)
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a namespace not matching the path to respond %v, got %v", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestGetActorAuthenticated(t *testing.T) {
+	var actor string
+	handler := authHandler(NewTokenAuthenticator(map[string]string{"a": "alice"}), nil,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor = getActor(r).User
+		}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/ns", nil)
+	r.Header.Set("Authorization", "Bearer a")
+	r.Header.Set("X-Forwarded-User", "mallory")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if actor != "alice" {
+		t.Errorf("Expected changes to be attributed to the authenticated principal, got %v", actor)
+	}
+}
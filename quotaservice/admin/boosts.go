@@ -0,0 +1,81 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+type boostsAPIHandler struct {
+	a Administrable
+}
+
+func newBoostsAPIHandler(admin Administrable) (a *boostsAPIHandler) {
+	return &boostsAPIHandler{a: admin}
+}
+
+type boostsResponse struct {
+	Boosts []*pb.BucketBoost `json:"boosts"`
+}
+
+func (a *boostsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/boosts"), "/"), "/")
+
+	if params[0] == "" {
+		if r.Method != "GET" {
+			writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+			return
+		}
+
+		if !authorized(w, r, "", RoleViewer) {
+			return
+		}
+
+		writeJSON(w, &boostsResponse{a.a.Configs().Boosts})
+		return
+	}
+
+	// [{namespace}, {bucket}]
+	if len(params) != 2 {
+		writeJSONError(w, &httpError{"", http.StatusNotFound})
+		return
+	}
+
+	namespace, bucket := params[0], params[1]
+	actor := getActor(r)
+
+	if !authorized(w, r, namespace, RoleNamespaceEditor) {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		b := &pb.BucketBoost{}
+
+		if err := unmarshalJSON(r.Body, b); err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		b.Namespace = namespace
+		b.BucketName = bucket
+
+		if err := a.a.AddBoost(b, actor); err != nil {
+			writeJSONUpdateError(w, err, http.StatusBadRequest)
+		} else {
+			writeJSONOk(w)
+		}
+	case "DELETE":
+		if err := a.a.DeleteBoost(namespace, bucket, actor); err != nil {
+			writeJSONUpdateError(w, err, http.StatusBadRequest)
+		} else {
+			writeJSONOk(w)
+		}
+	default:
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	}
+}
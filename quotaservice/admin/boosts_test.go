@@ -0,0 +1,96 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+func TestBoostsGet(t *testing.T) {
+	a := NewMockAdministrable()
+	a.cfg.Boosts = []*pb.BucketBoost{{Namespace: "ns", BucketName: "b", Config: &pb.BucketConfig{Size: 10}, Expires: 1}}
+
+	boostsResponse := &boostsResponse{}
+	doBoostsRequest(t, a, boostsResponse, "GET", "/api/boosts", "")
+
+	if len(boostsResponse.Boosts) != 1 || boostsResponse.Boosts[0].Config.Size != 10 {
+		t.Errorf("Received invalid boosts response: %+v", boostsResponse)
+	}
+}
+
+func TestBoostsPost(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doBoostsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/boosts/ns/b", `{"config":{"size":10},"expires":1}`)
+
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received error %+v", jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doBoostsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/boosts/ns/b", `{"expires":1}`)
+
+	if jsonResponse["description"] != "AddBoost" {
+		t.Errorf("Received \"%s\" from %+v instead of \"AddBoost\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doBoostsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/boosts/ns/b", `{"expires":`)
+
+	if jsonResponse["error"] != http.StatusText(http.StatusBadRequest) {
+		t.Errorf("Received \"%s\" from %+v instead of a bad request", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestBoostsDelete(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doBoostsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "DELETE", "/api/boosts/ns/b", "")
+
+	if jsonResponse["description"] != "DeleteBoost" {
+		t.Errorf("Received \"%s\" from %+v instead of \"DeleteBoost\"", jsonResponse["description"], jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doBoostsRequest(t, NewMockConflictAdministrable(), &jsonResponse, "DELETE", "/api/boosts/ns/b", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusConflict) {
+		t.Errorf("Received \"%s\" from %+v instead of a conflict", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestBoostsNotFound(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doBoostsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/boosts/ns", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusNotFound) {
+		t.Errorf("Received \"%s\" from %+v instead of not found", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func doBoostsRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
+	// t.Helper()
+
+	ts := httptest.NewServer(newBoostsAPIHandler(a))
+	defer ts.Close()
+
+	client := &http.Client{}
+	request, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshalJSON(res.Body, &object)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/mian-qin/qqs/quotaservice/config"
 	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 )
 
@@ -23,30 +22,39 @@ func newBucketsAPIHandler(admin Administrable) (a *bucketsAPIHandler) {
 func (a *bucketsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	params := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 3)
 	namespace, bucket := params[1], params[2]
-	user := getUsername(r)
+	actor := getActor(r)
+
+	role := RoleNamespaceEditor
+	if r.Method == "GET" {
+		role = RoleViewer
+	}
+
+	if !authorized(w, r, namespace, role) {
+		return
+	}
 
 	switch r.Method {
 	case "GET":
-		err := writeBucket(a, w, namespace, bucket)
+		err := writeBucket(a, w, r, namespace, bucket)
 
 		if err != nil {
 			writeJSONError(w, err)
 		}
 	case "DELETE":
-		err := a.a.DeleteBucket(namespace, bucket, user)
+		err := a.a.DeleteBucket(namespace, bucket, actor)
 
 		if err != nil {
-			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			writeJSONUpdateError(w, err, http.StatusBadRequest)
 		} else {
 			writeJSONOk(w)
 		}
 	case "PUT":
 		changeBucket(w, r, bucket, func(c *pb.BucketConfig) error {
-			return a.a.UpdateBucket(namespace, c, user)
+			return a.a.UpdateBucket(namespace, c, actor)
 		})
 	case "POST":
 		changeBucket(w, r, bucket, func(c *pb.BucketConfig) error {
-			return a.a.AddBucket(namespace, c, user)
+			return a.a.AddBucket(namespace, c, actor)
 		})
 	default:
 		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
@@ -61,28 +69,37 @@ func changeBucket(w http.ResponseWriter, r *http.Request, bucket string, updater
 		return
 	}
 
+	// Requests are authorized against the bucket in the path, so they can't change another one.
 	if c.Name == "" {
 		c.Name = bucket
+	} else if c.Name != bucket {
+		writeJSONError(w, &httpError{"Bucket " + c.Name + " doesn't match " + bucket, http.StatusBadRequest})
+		return
 	}
 
 	e = updater(c)
 
 	if e != nil {
-		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
+		writeJSONUpdateError(w, e, http.StatusInternalServerError)
 	} else {
 		writeJSONOk(w)
 	}
 }
 
 func getBucketConfig(r io.Reader) (*pb.BucketConfig, error) {
+	// Unset fields are left to be inherited from bucket defaults.
 	c := &pb.BucketConfig{}
-	config.ApplyBucketDefaults(c)
 	err := unmarshalJSON(r, c)
 	return c, err
 }
 
-func writeBucket(a *bucketsAPIHandler, w http.ResponseWriter, namespace, bucket string) *httpError {
-	namespaceConfig, exists := a.a.Configs().Namespaces[namespace]
+func writeBucket(a *bucketsAPIHandler, w http.ResponseWriter, r *http.Request, namespace, bucket string) *httpError {
+	cfgs, err := requestedConfigs(a.a, r)
+	if err != nil {
+		return err
+	}
+
+	namespaceConfig, exists := cfgs.Namespaces[namespace]
 
 	if !exists {
 		return &httpError{"Unable to locate namespace " + namespace, http.StatusNotFound}
@@ -6,6 +6,7 @@ package admin
 import (
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -48,11 +49,41 @@ func TestBucketsGet(t *testing.T) {
 	configResponse := &pb.BucketConfig{}
 	doBucketsRequest(t, a, configResponse, "GET", "/api/test/bucket", "")
 
-	if *bucket != *configResponse {
+	if !reflect.DeepEqual(bucket, configResponse) {
 		t.Errorf("Received \"%+v\" but was expecting \"%+v\"", configResponse, bucket)
 	}
 }
 
+func TestBucketsGetEffective(t *testing.T) {
+	a := NewMockAdministrable()
+
+	testNamespace := config.NewDefaultNamespaceConfig("test")
+	testNamespace.BucketDefaults = &pb.BucketConfig{MaxDebtMillis: 5000}
+	a.Configs().Namespaces["test"] = testNamespace
+	testNamespace.Buckets["bucket"] = &pb.BucketConfig{Name: "bucket", Size: 10}
+
+	configResponse := &pb.BucketConfig{}
+	doBucketsRequest(t, a, configResponse, "GET", "/api/test/bucket", "")
+
+	if configResponse.Size != 10 || configResponse.MaxDebtMillis != 0 {
+		t.Errorf("Expected the bucket as declared, got %+v", configResponse)
+	}
+
+	configResponse = &pb.BucketConfig{}
+	doBucketsRequest(t, a, configResponse, "GET", "/api/test/bucket?effective=true", "")
+
+	if configResponse.Size != 10 || configResponse.MaxDebtMillis != 5000 || configResponse.FillRate != 50 {
+		t.Errorf("Expected the bucket as served, got %+v", configResponse)
+	}
+
+	jsonResponse := make(map[string]string)
+	doBucketsRequest(t, a, &jsonResponse, "GET", "/api/test/bucket?effective=maybe", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusBadRequest) {
+		t.Errorf("Received \"%s\" from %+v instead of a bad request", jsonResponse["error"], jsonResponse)
+	}
+}
+
 func TestBucketsPost(t *testing.T) {
 	jsonResponse := make(map[string]string)
 	doBucketsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/test/newbucket", "")
@@ -89,6 +120,24 @@ func TestBucketsPutError(t *testing.T) {
 	}
 }
 
+func TestBucketsPutConflict(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doBucketsRequest(t, NewMockConflictAdministrable(), &jsonResponse, "PUT", "/api/ns/newbucket", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusConflict) {
+		t.Errorf("Received \"%s\" from %+v instead of a conflict", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestBucketsPutNameMismatch(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doBucketsRequest(t, NewMockAdministrable(), &jsonResponse, "PUT", "/api/test/newbucket", `{"name": "other"}`)
+
+	if jsonResponse["description"] != "Bucket other doesn't match newbucket" {
+		t.Errorf("Received \"%s\" from %+v instead of a bad request", jsonResponse["description"], jsonResponse)
+	}
+}
+
 func TestBucketsDeleteError(t *testing.T) {
 	jsonResponse := make(map[string]string)
 	doBucketsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "DELETE", "/api/ns/bucket", "")
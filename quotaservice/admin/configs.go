@@ -5,7 +5,10 @@ package admin
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/mian-qin/qqs/quotaservice/config"
 	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 )
 
@@ -17,21 +20,201 @@ func newConfigsAPIHandler(admin Administrable) (a *configsAPIHandler) {
 	return &configsAPIHandler{a: admin}
 }
 
+// defaultConfigsPageSize is the number of configs returned when no limit is requested.
+const defaultConfigsPageSize = 20
+
 type configsResponse struct {
 	Configs []*pb.ServiceConfig `json:"configs"`
+
+	// Version to pass as before to read the next page, if there may be more configs
+	Next int32 `json:"next,omitempty"`
+}
+
+type migrateResponse struct {
+	// Number of historical configs upgraded
+	Migrated      int   `json:"migrated"`
+	SchemaVersion int32 `json:"schema_version"`
 }
 
 func (a *configsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/configs"), "/"), "/")
+
+	// History is read across the service, and only admins change it.
+	role := RoleAdmin
+	if r.Method == "GET" {
+		role = RoleViewer
+	}
+
+	if !authorized(w, r, "", role) {
+		return
+	}
+
+	if len(params) == 1 && params[0] == "diff" {
+		a.diff(w, r)
+		return
+	}
+
+	if len(params) == 1 && params[0] == "migrate" {
+		a.migrate(w, r)
+		return
+	}
+
+	// [{version}, rollback]
+	if len(params) == 2 && params[1] == "rollback" {
+		a.rollback(w, r, params[0])
+		return
+	}
+
+	if params[0] != "" {
+		writeJSONError(w, &httpError{"", http.StatusNotFound})
+		return
+	}
+
 	if r.Method != "GET" {
 		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
 		return
 	}
 
-	configs, err := a.a.HistoricalConfigs()
+	page, httpErr := historyPage(r)
+
+	if httpErr != nil {
+		writeJSONError(w, httpErr)
+		return
+	}
+
+	configs, err := a.a.HistoricalConfigs(page)
 
 	if err != nil {
 		writeJSONError(w, &httpError{"Error reading configs " + err.Error(), http.StatusInternalServerError})
+		return
+	}
+
+	response := &configsResponse{Configs: configs}
+
+	if len(configs) == page.Limit {
+		response.Next = configs[len(configs)-1].Version
+	}
+
+	writeJSON(w, response)
+}
+
+// historyPage reads the page of configs requested with the before and limit query parameters.
+func historyPage(r *http.Request) (config.HistoryPage, *httpError) {
+	query := r.URL.Query()
+	page := config.HistoryPage{Limit: defaultConfigsPageSize}
+
+	if before := query.Get("before"); before != "" {
+		v, err := strconv.ParseInt(before, 10, 32)
+
+		if err != nil || v <= 0 {
+			return page, &httpError{"Invalid before version " + before, http.StatusBadRequest}
+		}
+
+		page.Before = int32(v)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+
+		if err != nil || v <= 0 {
+			return page, &httpError{"Invalid limit " + limit, http.StatusBadRequest}
+		}
+
+		page.Limit = v
+	}
+
+	return page, nil
+}
+
+func (a *configsAPIHandler) rollback(w http.ResponseWriter, r *http.Request, version string) {
+	if r.Method != "POST" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	v, err := strconv.ParseInt(version, 10, 32)
+
+	if err != nil {
+		writeJSONError(w, &httpError{"Invalid version " + version, http.StatusBadRequest})
+		return
+	}
+
+	err = a.a.Rollback(int32(v), getActor(r))
+
+	if err == config.ErrNoSuchVersion {
+		writeJSONError(w, &httpError{"Unable to locate config version " + version, http.StatusNotFound})
+	} else if err != nil {
+		writeJSONUpdateError(w, err, http.StatusBadRequest)
 	} else {
-		writeJSON(w, &configsResponse{configs})
+		writeJSONOk(w)
+	}
+}
+
+func (a *configsAPIHandler) migrate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
+	}
+
+	migrated, err := a.a.MigrateHistory()
+
+	if err == config.ErrHistoryNotRewritable {
+		writeJSONError(w, &httpError{err.Error(), http.StatusNotImplemented})
+		return
+	}
+
+	if err != nil {
+		writeJSONUpdateError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, &migrateResponse{migrated, config.CurrentSchemaVersion})
+}
+
+func (a *configsAPIHandler) diff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+		return
 	}
+
+	query := r.URL.Query()
+	from, err := strconv.ParseInt(query.Get("from"), 10, 32)
+
+	if err != nil {
+		writeJSONError(w, &httpError{"Invalid from version " + query.Get("from"), http.StatusBadRequest})
+		return
+	}
+
+	to, err := strconv.ParseInt(query.Get("to"), 10, 32)
+
+	if err != nil {
+		writeJSONError(w, &httpError{"Invalid to version " + query.Get("to"), http.StatusBadRequest})
+		return
+	}
+
+	configs, err := a.a.HistoricalConfigs(config.AllHistory)
+
+	if err != nil {
+		writeJSONError(w, &httpError{"Error reading configs " + err.Error(), http.StatusInternalServerError})
+		return
+	}
+
+	var fromCfg, toCfg *pb.ServiceConfig
+
+	for _, c := range configs {
+		if c.Version == int32(from) {
+			fromCfg = c
+		}
+
+		if c.Version == int32(to) {
+			toCfg = c
+		}
+	}
+
+	if fromCfg == nil || toCfg == nil {
+		writeJSONError(w, &httpError{"Unable to locate config versions " + query.Get("from") + " and " + query.Get("to"), http.StatusNotFound})
+		return
+	}
+
+	writeJSON(w, config.Diff(fromCfg, toCfg))
 }
@@ -8,6 +8,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/config"
 )
 
 func TestConfigsGet(t *testing.T) {
@@ -21,6 +23,36 @@ func TestConfigsGet(t *testing.T) {
 	}
 }
 
+func TestConfigsGetPage(t *testing.T) {
+	a := NewMockAdministrable()
+	a.cfg.Version = 5
+
+	configResponse := &configsResponse{}
+	doConfigsRequest(t, a, configResponse, "GET", "/api/configs?limit=1", "")
+
+	if len(configResponse.Configs) != 1 || configResponse.Next != 5 {
+		t.Errorf("Received invalid configs response: %+v", configResponse)
+	}
+
+	configResponse = &configsResponse{}
+	doConfigsRequest(t, a, configResponse, "GET", "/api/configs?before=5&limit=1", "")
+
+	if len(configResponse.Configs) != 0 || configResponse.Next != 0 {
+		t.Errorf("Received invalid configs response: %+v", configResponse)
+	}
+}
+
+func TestConfigsGetInvalidPage(t *testing.T) {
+	for _, query := range []string{"limit=abc", "limit=0", "before=abc", "before=-1"} {
+		jsonResponse := make(map[string]string)
+		doConfigsRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/configs?"+query, "")
+
+		if jsonResponse["error"] != http.StatusText(http.StatusBadRequest) {
+			t.Errorf("Received \"%s\" from %+v for %v instead of a bad request", jsonResponse["error"], jsonResponse, query)
+		}
+	}
+}
+
 func TestConfigsGetError(t *testing.T) {
 	a := NewMockErrorAdministrable()
 
@@ -45,6 +77,91 @@ func TestConfigsPut(t *testing.T) {
 	}
 }
 
+func TestConfigsRollback(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/configs/3/rollback", "")
+
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestConfigsRollbackError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/configs/3/rollback", "")
+
+	if jsonResponse["description"] != "Rollback" {
+		t.Errorf("Received \"%s\" from %+v instead of Rollback", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestConfigsRollbackMissingVersion(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/configs/101/rollback", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusNotFound) {
+		t.Errorf("Received \"%s\" from %+v instead of a not found", jsonResponse["error"], jsonResponse)
+	}
+
+	if jsonResponse["description"] != "Unable to locate config version 101" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Unable to locate config version 101\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestConfigsRollbackInvalidVersion(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/configs/abc/rollback", "")
+
+	if jsonResponse["description"] != "Invalid version abc" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Invalid version abc\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestConfigsMigrate(t *testing.T) {
+	response := &migrateResponse{}
+	doConfigsRequest(t, NewMockAdministrable(), response, "POST", "/api/configs/migrate", "")
+
+	if response.Migrated != 1 || response.SchemaVersion != config.CurrentSchemaVersion {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+func TestConfigsMigrateError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockConflictAdministrable(), &jsonResponse, "POST", "/api/configs/migrate", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusConflict) {
+		t.Errorf("Received \"%s\" from %+v instead of Conflict", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestConfigsDiff(t *testing.T) {
+	diff := &config.ConfigDiff{}
+	doConfigsRequest(t, NewMockAdministrable(), diff, "GET", "/api/configs/diff?from=0&to=0", "")
+
+	if !diff.Empty() {
+		t.Errorf("Received non-empty diff %+v", diff)
+	}
+}
+
+func TestConfigsDiffNotFound(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/configs/diff?from=0&to=1", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusNotFound) {
+		t.Errorf("Received \"%s\" from %+v instead of Not Found", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestConfigsDiffInvalidVersion(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doConfigsRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/configs/diff?from=abc&to=1", "")
+
+	if jsonResponse["description"] != "Invalid from version abc" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Invalid from version abc\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
 func doConfigsRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
 	// t.Helper()
 
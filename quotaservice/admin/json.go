@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 
+	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/logging"
 )
 
@@ -35,6 +36,32 @@ func writeJSONError(w http.ResponseWriter, err *httpError) {
 	writeJSON(w, response)
 }
 
+// writeJSONUpdateError writes an error updating configs with the given status, unless the update
+// conflicted with a concurrent one, which is reported as a 409, or the resulting config is invalid,
+// which is reported as a 400 listing every problem found.
+func writeJSONUpdateError(w http.ResponseWriter, err error, status int) {
+	if err == config.ErrConcurrentUpdate {
+		writeJSONError(w, &httpError{err.Error(), http.StatusConflict})
+		return
+	}
+
+	errs, ok := err.(config.ValidationErrors)
+	if !ok {
+		writeJSONError(w, &httpError{err.Error(), status})
+		return
+	}
+
+	response := map[string]interface{}{
+		"error":       http.StatusText(http.StatusBadRequest),
+		"description": err.Error(),
+		"errors":      errs}
+
+	logging.Printf("Response error: %+v", response)
+
+	w.WriteHeader(http.StatusBadRequest)
+	writeJSON(w, response)
+}
+
 func writeJSONOk(w http.ResponseWriter) {
 	if _, e := w.Write(emptyJSONResponse); e != nil {
 		logging.Printf("Error writing JSON! %+v", e)
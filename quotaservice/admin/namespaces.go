@@ -6,6 +6,7 @@ package admin
 import (
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/mian-qin/qqs/quotaservice/config"
@@ -22,11 +23,21 @@ func newNamespacesAPIHandler(admin Administrable) (a *namespacesAPIHandler) {
 
 func (a *namespacesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ns := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
-	user := getUsername(r)
+	actor := getActor(r)
+
+	// The global namespace is served as the whole service config.
+	scope := ns
+	if scope == config.GlobalNamespace {
+		scope = ""
+	}
 
 	switch r.Method {
 	case "GET":
-		err := writeNamespace(a, w, ns)
+		if !authorized(w, r, scope, RoleViewer) {
+			return
+		}
+
+		err := writeNamespace(a, w, r, ns)
 
 		if err != nil {
 			writeJSONError(w, err)
@@ -37,10 +48,14 @@ func (a *namespacesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		err := a.a.DeleteNamespace(ns, user)
+		if !authorized(w, r, scope, RoleAdmin) {
+			return
+		}
+
+		err := a.a.DeleteNamespace(ns, actor)
 
 		if err != nil {
-			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			writeJSONUpdateError(w, err, http.StatusBadRequest)
 		} else {
 			writeJSONOk(w)
 		}
@@ -50,15 +65,23 @@ func (a *namespacesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		if !authorized(w, r, scope, RoleNamespaceEditor) {
+			return
+		}
+
 		changeNamespace(w, r, ns, func(c *pb.NamespaceConfig) error {
-			return a.a.UpdateNamespace(c, user)
+			return a.a.UpdateNamespace(c, actor)
 		})
 	case "POST":
+		if !authorized(w, r, scope, RoleAdmin) {
+			return
+		}
+
 		if ns == "" {
 			updateConfig(a, w, r)
 		} else {
 			changeNamespace(w, r, ns, func(c *pb.NamespaceConfig) error {
-				return a.a.AddNamespace(c, user)
+				return a.a.AddNamespace(c, actor)
 			})
 		}
 	default:
@@ -66,12 +89,27 @@ func (a *namespacesAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func writeNamespace(a *namespacesAPIHandler, w http.ResponseWriter, namespace string) *httpError {
+// writeNamespace writes the config of a namespace, or of the whole service if namespace is empty.
+// The whole service config only holds the namespaces matching the request's labels, if any.
+func writeNamespace(a *namespacesAPIHandler, w http.ResponseWriter, r *http.Request, namespace string) *httpError {
 	var object interface{}
-	cfgs := a.a.Configs()
+	cfgs, err := requestedConfigs(a.a, r)
+	if err != nil {
+		return err
+	}
 
 	if namespace == "" || namespace == config.GlobalNamespace {
 		object = cfgs
+		labels := r.URL.Query()["label"]
+
+		if len(labels) > 0 {
+			selector, err := config.ParseLabelSelector(labels)
+			if err != nil {
+				return &httpError{err.Error(), http.StatusBadRequest}
+			}
+
+			object = config.FilterNamespaces(cfgs, selector)
+		}
 	} else {
 		if _, exists := cfgs.Namespaces[namespace]; !exists {
 			return &httpError{"Unable to locate namespace " + namespace, http.StatusNotFound}
@@ -93,10 +131,22 @@ func updateConfig(a *namespacesAPIHandler, w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	e = a.a.UpdateConfig(c, getUsername(r))
+	if versionHeader := r.Header.Get("Version"); versionHeader != "" {
+		// Make sure the config is only replaced if it hasn't changed since the client last saw it.
+		version, err := strconv.ParseInt(versionHeader, 10, 32)
+
+		if err != nil {
+			writeJSONError(w, &httpError{"Invalid version " + versionHeader, http.StatusBadRequest})
+			return
+		}
+
+		e = a.a.UpdateConfigIfVersion(c, int32(version), getActor(r))
+	} else {
+		e = a.a.UpdateConfig(c, getActor(r))
+	}
 
 	if e != nil {
-		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
+		writeJSONUpdateError(w, e, http.StatusInternalServerError)
 	} else {
 		writeJSONOk(w)
 	}
@@ -110,14 +160,18 @@ func changeNamespace(w http.ResponseWriter, r *http.Request, namespace string, u
 		return
 	}
 
+	// Requests are authorized against the namespace in the path, so they can't change another one.
 	if c.Name == "" {
 		c.Name = namespace
+	} else if c.Name != namespace {
+		writeJSONError(w, &httpError{"Namespace " + c.Name + " doesn't match " + namespace, http.StatusBadRequest})
+		return
 	}
 
 	e = updater(c)
 
 	if e != nil {
-		writeJSONError(w, &httpError{e.Error(), http.StatusInternalServerError})
+		writeJSONUpdateError(w, e, http.StatusInternalServerError)
 	} else {
 		writeJSONOk(w)
 	}
@@ -44,6 +44,35 @@ func TestNamespacesGet(t *testing.T) {
 	}
 }
 
+func TestNamespacesGetByLabel(t *testing.T) {
+	a := NewMockAdministrable()
+
+	for name, team := range map[string]string{"payments": "money", "search": "discovery"} {
+		ns := config.NewDefaultNamespaceConfig(name)
+		ns.Owner = team
+		ns.Labels = map[string]string{"team": team}
+		a.Configs().Namespaces[name] = ns
+	}
+
+	configResponse := &pb.ServiceConfig{}
+	doNamespacesRequest(t, a, configResponse, "GET", "/api/?label=team%3Dmoney", "")
+
+	if len(configResponse.Namespaces) != 1 || configResponse.Namespaces["payments"].GetOwner() != "money" {
+		t.Errorf("Expected only the payments namespace, got %+v", configResponse.Namespaces)
+	}
+
+	if len(a.Configs().Namespaces) != 2 {
+		t.Errorf("Filtering should not change the config: %+v", a.Configs().Namespaces)
+	}
+
+	jsonResponse := make(map[string]string)
+	doNamespacesRequest(t, a, &jsonResponse, "GET", "/api/?label=%3Dmoney", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusBadRequest) {
+		t.Errorf("Received \"%s\" from %+v instead of a bad request", jsonResponse["error"], jsonResponse)
+	}
+}
+
 func TestNamespacesPost(t *testing.T) {
 	jsonResponse := make(map[string]string)
 	doNamespacesRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/test", "")
@@ -98,7 +127,44 @@ func TestNamespacesDelete(t *testing.T) {
 	}
 }
 
-func doNamespacesRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
+func TestNamespacesPostConfig(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doNamespacesRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/", "{}", "Version", "0")
+
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received non-empty response \"%+v\"", jsonResponse)
+	}
+}
+
+func TestNamespacesPostConfigStaleVersion(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doNamespacesRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/", "{}", "Version", "3")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusConflict) {
+		t.Errorf("Received \"%s\" from %+v instead of a conflict", jsonResponse["error"], jsonResponse)
+	}
+}
+
+func TestNamespacesPostInvalidConfig(t *testing.T) {
+	var jsonResponse struct {
+		Error  string                   `json:"error"`
+		Errors []config.ValidationError `json:"errors"`
+	}
+
+	body := `{"namespaces": {"ns": {"buckets": {"b": {"size": -1, "fill_rate": -1}}}}}`
+	doNamespacesRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/", body)
+
+	if jsonResponse.Error != http.StatusText(http.StatusBadRequest) {
+		t.Errorf("Received \"%s\" from %+v instead of a bad request", jsonResponse.Error, jsonResponse)
+	}
+
+	if len(jsonResponse.Errors) != 2 || jsonResponse.Errors[0].Path != "namespaces.ns.buckets.b.size" {
+		t.Errorf("Expected errors for size and fill rate, got %+v", jsonResponse.Errors)
+	}
+}
+
+// doNamespacesRequest makes a request to the namespaces API, with headers given as name/value pairs.
+func doNamespacesRequest(t *testing.T, a Administrable, object interface{}, method, path, body string, headers ...string) {
 	// t.Helper()
 
 	apiHandler := newNamespacesAPIHandler(a)
@@ -107,6 +173,10 @@ func doNamespacesRequest(t *testing.T, a Administrable, object interface{}, meth
 
 	client := &http.Client{}
 	request, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
 	res, err := client.Do(request)
 
 	if err != nil {
@@ -118,3 +188,12 @@ func doNamespacesRequest(t *testing.T, a Administrable, object interface{}, meth
 		t.Fatal(err)
 	}
 }
+
+func TestNamespacesPutConflict(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doNamespacesRequest(t, NewMockConflictAdministrable(), &jsonResponse, "PUT", "/api/test", "")
+
+	if jsonResponse["error"] != http.StatusText(http.StatusConflict) {
+		t.Errorf("Received \"%s\" from %+v instead of a conflict", jsonResponse["error"], jsonResponse)
+	}
+}
@@ -0,0 +1,105 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the networks of proxies in front of the admin API, whose X-Forwarded-For and
+// X-Forwarded-User headers identify who made a request. The headers of requests from anywhere else
+// are ignored, as anyone could set them.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses networks in CIDR notation, such as "10.0.0.0/8", or single addresses.
+func ParseTrustedProxies(networks ...string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(networks))
+	for _, n := range networks {
+		if ip := net.ParseIP(n); ip != nil {
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q", n)
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies, nil
+}
+
+// trusts returns true if addr, with or without a port, is the address of a trusted proxy.
+func (t TrustedProxies) trusts(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxiesHandler marks requests sent by a trusted proxy, so their forwarding headers are honoured.
+func proxiesHandler(proxies TrustedProxies, next http.Handler) http.Handler {
+	if len(proxies) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if proxies.trusts(r.RemoteAddr) {
+			r = r.WithContext(context.WithValue(r.Context(), proxiesKey, proxies))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the address a request forwarded by trusted proxies came from: the last
+// address in X-Forwarded-For that isn't a trusted proxy itself. Returns an empty string if the
+// request wasn't sent by a trusted proxy, or the header isn't set.
+func forwardedFor(r *http.Request) string {
+	proxies, trusted := r.Context().Value(proxiesKey).(TrustedProxies)
+	if !trusted {
+		return ""
+	}
+
+	var addrs []string
+	for _, h := range r.Header["X-Forwarded-For"] {
+		addrs = append(addrs, strings.Split(h, ",")...)
+	}
+
+	for i := len(addrs) - 1; i >= 0; i-- {
+		if addr := strings.TrimSpace(addrs[i]); addr != "" && (i == 0 || !proxies.trusts(addr)) {
+			return addr
+		}
+	}
+
+	return ""
+}
+
+// forwardedUser returns the user a trusted proxy authenticated a request as, from X-Forwarded-User.
+// Returns an empty string if the request wasn't sent by a trusted proxy, or the header isn't set.
+func forwardedUser(r *http.Request) string {
+	if _, trusted := r.Context().Value(proxiesKey).(TrustedProxies); !trusted {
+		return ""
+	}
+
+	return r.Header.Get("X-Forwarded-User")
+}
@@ -0,0 +1,125 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Role is a set of permissions on the admin API. Each role holds the permissions of the roles
+// before it.
+type Role int
+
+const (
+	// RoleViewer reads configs, stats, boosts and rollouts.
+	RoleViewer Role = iota + 1
+	// RoleNamespaceEditor changes the buckets, defaults and boosts of existing namespaces.
+	RoleNamespaceEditor
+	// RoleAdmin adds and deletes namespaces. Across the service, admins also replace the whole
+	// config, roll it back, migrate its history, stage rollouts and read the audit log.
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleViewer:          "viewer",
+	RoleNamespaceEditor: "namespace-editor",
+	RoleAdmin:           "admin"}
+
+func (r Role) String() string {
+	if name, exists := roleNames[r]; exists {
+		return name
+	}
+
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns the role with the given name.
+func ParseRole(name string) (Role, error) {
+	for r, n := range roleNames {
+		if n == name {
+			return r, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown role %q", name)
+}
+
+// AnyPrincipal is the principal of grants held by every authenticated principal.
+const AnyPrincipal = "*"
+
+// Grant gives a principal a role in a namespace, or across the service if Namespace is empty.
+type Grant struct {
+	Principal string
+	Role      Role
+	Namespace string
+}
+
+// Policy authorizes principals according to the roles granted to them.
+type Policy struct {
+	grants []Grant
+}
+
+// NewPolicy creates a policy from grants. Principals not granted any role are denied everything.
+func NewPolicy(grants ...Grant) *Policy {
+	return &Policy{grants: grants}
+}
+
+type policyYAML struct {
+	Grants []struct {
+		Principal string `yaml:"principal"`
+		Role      string `yaml:"role"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"grants"`
+}
+
+// PolicyFromYAML reads a policy from YAML, listing grants as:
+//
+//	grants:
+//	  - principal: alice
+//	    role: admin
+//	  - principal: bob
+//	    role: namespace-editor
+//	    namespace: payments
+func PolicyFromYAML(y []byte) (*Policy, error) {
+	parsed := &policyYAML{}
+	if err := yaml.UnmarshalStrict(y, parsed); err != nil {
+		return nil, err
+	}
+
+	grants := make([]Grant, len(parsed.Grants))
+	for i, g := range parsed.Grants {
+		if g.Principal == "" {
+			return nil, fmt.Errorf("grants.%v.principal: must be set", i)
+		}
+
+		role, err := ParseRole(g.Role)
+		if err != nil {
+			return nil, fmt.Errorf("grants.%v.role: %v", i, err)
+		}
+
+		grants[i] = Grant{Principal: g.Principal, Role: role, Namespace: g.Namespace}
+	}
+
+	return NewPolicy(grants...), nil
+}
+
+// Allows returns true if a principal holds a role, or one holding its permissions, in a namespace,
+// or across the service if namespace is empty. Roles granted across the service hold in every
+// namespace. A nil policy allows every principal everything.
+func (p *Policy) Allows(principal, namespace string, role Role) bool {
+	if p == nil {
+		return true
+	}
+
+	for _, g := range p.grants {
+		if (g.Principal == principal || g.Principal == AnyPrincipal) && g.Role >= role &&
+			(g.Namespace == "" || g.Namespace == namespace) {
+			return true
+		}
+	}
+
+	return false
+}
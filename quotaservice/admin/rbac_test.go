@@ -0,0 +1,65 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	p, err := PolicyFromYAML([]byte(`
+grants:
+  - principal: alice
+    role: admin
+  - principal: bob
+    role: namespace-editor
+    namespace: payments
+  - principal: "*"
+    role: viewer
+    namespace: public
+`))
+	helpers.CheckError(t, err)
+
+	for _, tc := range []struct {
+		principal, namespace string
+		role                 Role
+		expected             bool
+	}{
+		{"alice", "", RoleAdmin, true},
+		{"alice", "payments", RoleNamespaceEditor, true},
+		{"bob", "payments", RoleNamespaceEditor, true},
+		{"bob", "payments", RoleViewer, true},
+		{"bob", "payments", RoleAdmin, false},
+		{"bob", "orders", RoleViewer, false},
+		{"bob", "", RoleViewer, false},
+		{"carol", "public", RoleViewer, true},
+		{"carol", "public", RoleNamespaceEditor, false},
+		{"carol", "payments", RoleViewer, false}} {
+		if allowed := p.Allows(tc.principal, tc.namespace, tc.role); allowed != tc.expected {
+			t.Errorf("Expected %v being a %v of %q to be %v", tc.principal, tc.role, tc.namespace, tc.expected)
+		}
+	}
+
+	var nilPolicy *Policy
+	if !nilPolicy.Allows("anyone", "", RoleAdmin) {
+		t.Error("Expected a nil policy to allow everything")
+	}
+}
+
+func TestPolicyFromYAMLInvalid(t *testing.T) {
+	for name, y := range map[string]string{
+		"unknown role":      "grants: [{principal: alice, role: owner}]",
+		"missing principal": "grants: [{role: admin}]",
+		"unknown field":     "grants: [{principal: alice, role: admin, namespaces: [a]}]"} {
+		if _, err := PolicyFromYAML([]byte(y)); err == nil {
+			t.Errorf("Expected a policy with an %v to fail", name)
+		}
+	}
+
+	if r, err := ParseRole("namespace-editor"); err != nil || r != RoleNamespaceEditor || r.String() != "namespace-editor" {
+		t.Errorf("Expected namespace-editor, got %v and %v", r, err)
+	}
+}
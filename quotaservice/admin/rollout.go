@@ -0,0 +1,105 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/stats"
+)
+
+type rolloutAPIHandler struct {
+	a Administrable
+}
+
+func newRolloutAPIHandler(admin Administrable) (a *rolloutAPIHandler) {
+	return &rolloutAPIHandler{a: admin}
+}
+
+type rolloutResponse struct {
+	// Version of the running config
+	Version int32       `json:"version"`
+	Rollout *pb.Rollout `json:"rollout,omitempty"`
+	// Name of the rollout's stage
+	Stage string              `json:"stage,omitempty"`
+	Nodes []*stats.NodeHealth `json:"nodes"`
+}
+
+type rolloutRequest struct {
+	Config  *pb.ServiceConfig `json:"config"`
+	Rollout *pb.Rollout       `json:"rollout"`
+}
+
+func (a *rolloutAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/rollout"), "/")
+	actor := getActor(r)
+
+	role := RoleAdmin
+	if r.Method == "GET" {
+		role = RoleViewer
+	}
+
+	if !authorized(w, r, "", role) {
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		a.status(w)
+	case action == "" && r.Method == "POST":
+		request := &rolloutRequest{}
+
+		if err := unmarshalJSON(r.Body, request); err != nil {
+			writeJSONError(w, &httpError{err.Error(), http.StatusBadRequest})
+			return
+		}
+
+		if request.Config == nil {
+			writeJSONError(w, &httpError{"No config to roll out", http.StatusBadRequest})
+			return
+		}
+
+		writeRolloutResult(w, a.a.StageConfig(request.Config, request.Rollout, actor))
+	case action == "promote" && r.Method == "POST":
+		writeRolloutResult(w, a.a.PromoteRollout(actor))
+	case action == "rollback" && r.Method == "POST":
+		writeRolloutResult(w, a.a.RollBackRollout(actor))
+	case action == "" || action == "promote" || action == "rollback":
+		writeJSONError(w, &httpError{"Unknown method " + r.Method, http.StatusBadRequest})
+	default:
+		writeJSONError(w, &httpError{"", http.StatusNotFound})
+	}
+}
+
+func (a *rolloutAPIHandler) status(w http.ResponseWriter) {
+	nodes, err := a.a.FleetHealth()
+
+	if err != nil {
+		writeJSONError(w, &httpError{"Error reading fleet health " + err.Error(), http.StatusInternalServerError})
+		return
+	}
+
+	cfg := a.a.Configs()
+	response := &rolloutResponse{Version: cfg.Version, Rollout: cfg.Rollout, Nodes: nodes}
+
+	if cfg.Rollout != nil {
+		response.Stage = cfg.Rollout.Stage.String()
+	}
+
+	if response.Nodes == nil {
+		response.Nodes = make([]*stats.NodeHealth, 0)
+	}
+
+	writeJSON(w, response)
+}
+
+func writeRolloutResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeJSONUpdateError(w, err, http.StatusBadRequest)
+	} else {
+		writeJSONOk(w)
+	}
+}
@@ -0,0 +1,95 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+func TestRolloutGet(t *testing.T) {
+	a := NewMockAdministrable()
+	a.cfg.Version = 3
+	a.cfg.Rollout = &pb.Rollout{Stage: pb.Rollout_PROMOTED, StableVersion: 2}
+
+	response := &rolloutResponse{}
+	doRolloutRequest(t, a, response, "GET", "/api/rollout", "")
+
+	if response.Version != 3 || response.Stage != "PROMOTED" || response.Rollout.StableVersion != 2 ||
+		len(response.Nodes) != 1 || !response.Nodes[0].Canary {
+		t.Errorf("Received invalid rollout response: %+v", response)
+	}
+}
+
+func TestRolloutGetError(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doRolloutRequest(t, NewMockErrorAdministrable(), &jsonResponse, "GET", "/api/rollout", "")
+
+	if jsonResponse["description"] != "Error reading fleet health FleetHealth" {
+		t.Errorf("Received \"%s\" from %+v instead of \"Error reading fleet health FleetHealth\"",
+			jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestRolloutStage(t *testing.T) {
+	jsonResponse := make(map[string]string)
+	doRolloutRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/rollout",
+		`{"config":{"namespaces":{}},"rollout":{"bake_millis":60000}}`)
+
+	if len(jsonResponse) != 0 {
+		t.Errorf("Received error %+v", jsonResponse)
+	}
+
+	jsonResponse = make(map[string]string)
+	doRolloutRequest(t, NewMockAdministrable(), &jsonResponse, "POST", "/api/rollout", `{"rollout":{}}`)
+
+	if jsonResponse["description"] != "No config to roll out" {
+		t.Errorf("Received \"%s\" from %+v instead of \"No config to roll out\"", jsonResponse["description"], jsonResponse)
+	}
+}
+
+func TestRolloutPromoteAndRollBack(t *testing.T) {
+	for action, expected := range map[string]string{"promote": "PromoteRollout", "rollback": "RollBackRollout"} {
+		jsonResponse := make(map[string]string)
+		doRolloutRequest(t, NewMockErrorAdministrable(), &jsonResponse, "POST", "/api/rollout/"+action, "")
+
+		if jsonResponse["description"] != expected {
+			t.Errorf("Received \"%s\" from %+v instead of \"%s\"", jsonResponse["description"], jsonResponse, expected)
+		}
+
+		jsonResponse = make(map[string]string)
+		doRolloutRequest(t, NewMockAdministrable(), &jsonResponse, "GET", "/api/rollout/"+action, "")
+
+		if jsonResponse["description"] != "Unknown method GET" {
+			t.Errorf("Received \"%s\" from %+v instead of \"Unknown method GET\"", jsonResponse["description"], jsonResponse)
+		}
+	}
+}
+
+func doRolloutRequest(t *testing.T, a Administrable, object interface{}, method, path, body string) {
+	// t.Helper()
+
+	ts := httptest.NewServer(newRolloutAPIHandler(a))
+	defer ts.Close()
+
+	client := &http.Client{}
+	request, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshalJSON(res.Body, &object)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -37,6 +37,10 @@ func (a *statsAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !authorized(w, r, strings.SplitN(ns, "/", 2)[0], RoleViewer) {
+		return
+	}
+
 	err := writeStats(a, w, ns)
 
 	if err != nil {
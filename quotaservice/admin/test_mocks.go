@@ -6,82 +6,157 @@ package admin
 import (
 	"errors"
 
+	"github.com/mian-qin/qqs/quotaservice/audit"
 	"github.com/mian-qin/qqs/quotaservice/config"
 	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 	"github.com/mian-qin/qqs/quotaservice/stats"
 )
 
+const maxMockVersion = 100
+
 type MockAdministrable struct {
-	cfg    *pb.ServiceConfig
-	errors bool
+	cfg       *pb.ServiceConfig
+	errors    bool
+	conflicts bool
 }
 
 func NewMockErrorAdministrable() *MockAdministrable {
-	return &MockAdministrable{config.NewDefaultServiceConfig(), true}
+	return &MockAdministrable{cfg: config.NewDefaultServiceConfig(), errors: true}
+}
+
+// NewMockConflictAdministrable returns a MockAdministrable whose config updates all conflict with a
+// concurrent update.
+func NewMockConflictAdministrable() *MockAdministrable {
+	return &MockAdministrable{cfg: config.NewDefaultServiceConfig(), conflicts: true}
 }
 
 func NewMockAdministrable() *MockAdministrable {
-	return &MockAdministrable{config.NewDefaultServiceConfig(), false}
+	return &MockAdministrable{cfg: config.NewDefaultServiceConfig()}
+}
+
+func (m *MockAdministrable) updateError(method string) error {
+	if m.conflicts {
+		return config.ErrConcurrentUpdate
+	}
+
+	if m.errors {
+		return errors.New(method)
+	}
+
+	return nil
 }
 
 func (m *MockAdministrable) Configs() *pb.ServiceConfig {
 	return m.cfg
 }
 
-func (m *MockAdministrable) UpdateConfig(config *pb.ServiceConfig, user string) error {
-	if m.errors {
-		return errors.New("UpdateConfig")
+func (m *MockAdministrable) UpdateConfig(c *pb.ServiceConfig, actor audit.Actor) error {
+	if err := config.Validate(c); err != nil {
+		return err
 	}
 
-	return nil
+	return m.updateError("UpdateConfig")
 }
 
-func (m *MockAdministrable) DeleteBucket(namespace, name, user string) error {
-	if m.errors {
-		return errors.New("DeleteBucket")
+func (m *MockAdministrable) UpdateConfigIfVersion(c *pb.ServiceConfig, expected int32, actor audit.Actor) error {
+	if expected != m.cfg.Version {
+		return config.ErrConcurrentUpdate
 	}
 
-	return nil
+	if err := config.Validate(c); err != nil {
+		return err
+	}
+
+	return m.updateError("UpdateConfigIfVersion")
 }
 
-func (m *MockAdministrable) AddBucket(namespace string, b *pb.BucketConfig, user string) error {
-	if m.errors {
-		return errors.New("AddBucket")
+// Rollback fails with config.ErrNoSuchVersion for versions newer than the mock's history, which
+// only runs to maxMockVersion.
+func (m *MockAdministrable) Rollback(version int32, actor audit.Actor) error {
+	if version > maxMockVersion {
+		return config.ErrNoSuchVersion
 	}
 
-	return nil
+	return m.updateError("Rollback")
 }
 
-func (m *MockAdministrable) UpdateBucket(namespace string, b *pb.BucketConfig, user string) error {
-	if m.errors {
-		return errors.New("UpdateBucket")
+func (m *MockAdministrable) MigrateHistory() (int, error) {
+	if err := m.updateError("MigrateHistory"); err != nil {
+		return 0, err
 	}
 
-	return nil
+	return 1, nil
 }
 
-func (m *MockAdministrable) DeleteNamespace(namespace, user string) error {
+// AuditRecords returns a single record, made of the filter's fields so they can be checked.
+func (m *MockAdministrable) AuditRecords(f audit.Filter) ([]*audit.Record, error) {
 	if m.errors {
-		return errors.New("DeleteNamespace")
+		return nil, audit.ErrNoSink
 	}
 
-	return nil
+	return []*audit.Record{{
+		Time:      f.Since,
+		Actor:     audit.Actor{User: f.User},
+		Operation: f.Operation,
+		Namespace: f.Namespace,
+		Bucket:    f.Bucket,
+		Version:   int32(f.Limit)}}, nil
 }
 
-func (m *MockAdministrable) AddNamespace(n *pb.NamespaceConfig, user string) error {
-	if m.errors {
-		return errors.New("AddNamespace")
+func (m *MockAdministrable) DeleteBucket(namespace, name string, actor audit.Actor) error {
+	return m.updateError("DeleteBucket")
+}
+
+func (m *MockAdministrable) AddBucket(namespace string, b *pb.BucketConfig, actor audit.Actor) error {
+	return m.updateError("AddBucket")
+}
+
+func (m *MockAdministrable) UpdateBucket(namespace string, b *pb.BucketConfig, actor audit.Actor) error {
+	return m.updateError("UpdateBucket")
+}
+
+func (m *MockAdministrable) DeleteNamespace(namespace string, actor audit.Actor) error {
+	return m.updateError("DeleteNamespace")
+}
+
+func (m *MockAdministrable) AddNamespace(n *pb.NamespaceConfig, actor audit.Actor) error {
+	return m.updateError("AddNamespace")
+}
+
+func (m *MockAdministrable) UpdateNamespace(n *pb.NamespaceConfig, actor audit.Actor) error {
+	return m.updateError("UpdateNamespace")
+}
+
+func (m *MockAdministrable) AddBoost(b *pb.BucketBoost, actor audit.Actor) error {
+	return m.updateError("AddBoost")
+}
+
+func (m *MockAdministrable) DeleteBoost(namespace, name string, actor audit.Actor) error {
+	return m.updateError("DeleteBoost")
+}
+
+func (m *MockAdministrable) StageConfig(c *pb.ServiceConfig, r *pb.Rollout, actor audit.Actor) error {
+	if err := config.Validate(c); err != nil {
+		return err
 	}
 
-	return nil
+	return m.updateError("StageConfig")
+}
+
+func (m *MockAdministrable) PromoteRollout(actor audit.Actor) error {
+	return m.updateError("PromoteRollout")
 }
 
-func (m *MockAdministrable) UpdateNamespace(n *pb.NamespaceConfig, user string) error {
+func (m *MockAdministrable) RollBackRollout(actor audit.Actor) error {
+	return m.updateError("RollBackRollout")
+}
+
+func (m *MockAdministrable) FleetHealth() ([]*stats.NodeHealth, error) {
 	if m.errors {
-		return errors.New("UpdateNamespace")
+		return nil, errors.New("FleetHealth")
 	}
 
-	return nil
+	return []*stats.NodeHealth{{Node: "canary", Canary: true, Version: m.cfg.Version}}, nil
 }
 
 func (m *MockAdministrable) TopDynamicHits(namespace string) []*stats.BucketScore {
@@ -108,10 +183,14 @@ func (m *MockAdministrable) DynamicBucketStats(namespace, bucket string) *stats.
 	return &stats.BucketScores{Hits: 0, Misses: 0}
 }
 
-func (m *MockAdministrable) HistoricalConfigs() ([]*pb.ServiceConfig, error) {
+func (m *MockAdministrable) HistoricalConfigs(page config.HistoryPage) ([]*pb.ServiceConfig, error) {
 	if m.errors {
 		return nil, errors.New("HistoricalConfigs")
 	}
 
-	return make([]*pb.ServiceConfig, 1), nil
+	if (page.Before > 0 && m.cfg.Version >= page.Before) {
+		return nil, nil
+	}
+
+	return []*pb.ServiceConfig{m.cfg}, nil
 }
@@ -36,6 +36,10 @@ func newUIHandler(admin Administrable, assetsDirectory string, development bool)
 }
 
 func (h *uiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r, "", RoleViewer) {
+		return
+	}
+
 	if h.development {
 		if err := h.loadTemplates(); err != nil {
 			logging.Printf("Caught error %v reloading templates", err)
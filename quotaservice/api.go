@@ -6,6 +6,8 @@ package quotaservice
 import (
 	"net/http"
 
+	"github.com/mian-qin/qqs/quotaservice/admin"
+	"github.com/mian-qin/qqs/quotaservice/audit"
 	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/events"
 	"github.com/mian-qin/qqs/quotaservice/logging"
@@ -20,6 +22,19 @@ type Server interface {
 	ServeAdminConsole(*http.ServeMux, string, bool)
 	SetListener(listener events.Listener, eventQueueBufSize int)
 	SetStatsListener(listener stats.Listener)
+	// SetRolloutNode identifies this node to staged rollouts. Canary nodes serve staged configs
+	// first, and every node reports its health to the store so canaries can be compared against
+	// the rest of the fleet.
+	SetRolloutNode(node string, canary bool, store stats.HealthStore)
+	// SetAuditSink records every change made to the config in sink, queryable through the admin
+	// API. Changes aren't recorded unless a sink is set.
+	SetAuditSink(sink audit.Sink)
+	// SetAdminAuth authenticates requests to the admin console served by ServeAdminConsole, and
+	// authorizes them against policy. It must be called before ServeAdminConsole.
+	SetAdminAuth(authenticator admin.Authenticator, policy *admin.Policy)
+	// SetAdminProxies trusts the proxies in front of the admin console to identify the users and
+	// addresses of the requests they forward. It must be called before ServeAdminConsole.
+	SetAdminProxies(proxies admin.TrustedProxies)
 }
 
 // NewWithDefaultConfig creates a new quotaservice server with an empty in-memory config and default reaper.
@@ -0,0 +1,108 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package audit records changes made to the quotaservice's config, and who made them.
+package audit
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/mian-qin/qqs/quotaservice/config"
+)
+
+// ErrNoSink is returned when querying records of a server that doesn't record them.
+var ErrNoSink = errors.New("Audit records are not being recorded")
+
+// Actor identifies who made a change, and from where.
+type Actor struct {
+	User     string `json:"user"`
+	SourceIP string `json:"source_ip,omitempty"`
+}
+
+// Record describes a single change to the config. Diff compares the config as it was served
+// before and after the change.
+type Record struct {
+	// Unix timestamp, in seconds, of the change
+	Time int64 `json:"time"`
+	Actor
+	Operation string             `json:"operation"`
+	Namespace string             `json:"namespace,omitempty"`
+	Bucket    string             `json:"bucket,omitempty"`
+	Version   int32              `json:"version"`
+	Diff      *config.ConfigDiff `json:"diff"`
+}
+
+// Filter selects records. Empty fields select any value.
+type Filter struct {
+	User      string
+	Operation string
+	Namespace string
+	Bucket    string
+
+	// Since and Until bound the time of the records selected, inclusively, if positive.
+	Since int64
+	Until int64
+
+	// Limit is the maximum number of records to select, if positive.
+	Limit int
+}
+
+// Matches returns true if a record satisfies every field of the filter, other than Limit.
+func (f Filter) Matches(r *Record) bool {
+	return (f.User == "" || f.User == r.User) &&
+		(f.Operation == "" || f.Operation == r.Operation) &&
+		(f.Namespace == "" || f.Namespace == r.Namespace) &&
+		(f.Bucket == "" || f.Bucket == r.Bucket) &&
+		(f.Since <= 0 || r.Time >= f.Since) &&
+		(f.Until <= 0 || r.Time <= f.Until)
+}
+
+// Sink stores records, and queries them.
+type Sink interface {
+	Write(*Record) error
+	// Query returns the records selected by a filter, newest first.
+	Query(Filter) ([]*Record, error)
+}
+
+// filter returns the records, which must be ordered oldest first, selected by f, newest first.
+func filter(records []*Record, f Filter) []*Record {
+	selected := make([]*Record, 0)
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(selected) == f.Limit {
+			break
+		}
+
+		if f.Matches(records[i]) {
+			selected = append(selected, records[i])
+		}
+	}
+
+	return selected
+}
+
+type memorySink struct {
+	records      []*Record
+	sync.RWMutex // Embedded mutex
+}
+
+// NewMemorySink creates a sink that keeps records in memory, for tests and single processes.
+func NewMemorySink() Sink {
+	return &memorySink{}
+}
+
+func (s *memorySink) Write(r *Record) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memorySink) Query(f Filter) ([]*Record, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return filter(s.records, f), nil
+}
@@ -0,0 +1,86 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+var records = []*Record{
+	{Time: 100, Actor: Actor{User: "alice", SourceIP: "10.0.0.1"}, Operation: "AddNamespace", Namespace: "ns", Version: 1,
+		Diff: &config.ConfigDiff{FromVersion: 0, ToVersion: 1, NamespacesAdded: []string{"ns"}}},
+	{Time: 200, Actor: Actor{User: "bob"}, Operation: "AddBucket", Namespace: "ns", Bucket: "b", Version: 2},
+	{Time: 300, Actor: Actor{User: "alice"}, Operation: "DeleteBucket", Namespace: "ns", Bucket: "b", Version: 3}}
+
+func checkQueries(t *testing.T, s Sink) {
+	// t.Helper()
+
+	for _, r := range records {
+		helpers.CheckError(t, s.Write(r))
+	}
+
+	for name, tc := range map[string]struct {
+		f        Filter
+		expected []int32
+	}{
+		"everything":      {Filter{}, []int32{3, 2, 1}},
+		"user":            {Filter{User: "alice"}, []int32{3, 1}},
+		"operation":       {Filter{Operation: "AddBucket"}, []int32{2}},
+		"bucket":          {Filter{Namespace: "ns", Bucket: "b"}, []int32{3, 2}},
+		"time":            {Filter{Since: 200, Until: 300}, []int32{3, 2}},
+		"limit":           {Filter{Limit: 2}, []int32{3, 2}},
+		"limited matches": {Filter{User: "alice", Limit: 1}, []int32{3}},
+		"nothing":         {Filter{User: "carol"}, []int32{}}} {
+		selected, err := s.Query(tc.f)
+		helpers.CheckError(t, err)
+
+		versions := make([]int32, len(selected))
+		for i, r := range selected {
+			versions[i] = r.Version
+		}
+
+		if !reflect.DeepEqual(versions, tc.expected) {
+			t.Errorf("Expected versions %v selecting %v, got %v", tc.expected, name, versions)
+		}
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	checkQueries(t, NewMemorySink())
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_test_audit")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	s, err := NewFileSink(path)
+	helpers.CheckError(t, err)
+	checkQueries(t, s)
+
+	// Records are kept across sinks, and unreadable lines are skipped.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	helpers.CheckError(t, err)
+	_, err = f.WriteString("{not json\n")
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, f.Close())
+
+	s, err = NewFileSink(path)
+	helpers.CheckError(t, err)
+
+	selected, err := s.Query(Filter{})
+	helpers.CheckError(t, err)
+
+	if len(selected) != 3 || !reflect.DeepEqual(selected[2], records[0]) {
+		t.Errorf("Expected the records written to be read back, got %+v", selected)
+	}
+}
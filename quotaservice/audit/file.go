@@ -0,0 +1,88 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+)
+
+type fileSink struct {
+	path       string
+	sync.Mutex // Embedded mutex
+}
+
+// NewFileSink creates a sink that appends records to a file as JSON, one per line. The file is
+// created if it doesn't exist.
+func NewFileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	return &fileSink{path: path}, nil
+}
+
+func (s *fileSink) Write(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *fileSink) Query(f Filter) ([]*Record, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	var records []*Record
+	scanner := bufio.NewScanner(file)
+	// Diffs of large changes make for long lines.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			logging.Printf("Skipping unreadable audit record in %v: %v", s.path, err)
+			continue
+		}
+
+		records = append(records, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return filter(records, f), nil
+}
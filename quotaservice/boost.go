@@ -0,0 +1,89 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/clock"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// boostCheckInterval is how often the config is checked for boosts that have expired.
+const boostCheckInterval = 10 * time.Second
+
+// AddBoost temporarily overrides the limits of a bucket until the boost expires, when it is
+// reverted by whichever server notices first.
+func (s *server) AddBoost(b *pb.BucketBoost, actor audit.Actor) error {
+	if now := s.reaperClock().Now(); b.Expires <= now.Unix() {
+		return fmt.Errorf("Boost must expire in the future, expires %v", time.Unix(b.Expires, 0))
+	}
+
+	b.User = actor.User
+	change := &audit.Record{Actor: actor, Operation: "AddBoost", Namespace: b.Namespace, Bucket: b.BucketName}
+	return s.updateConfig(change, func(clonedCfg *pb.ServiceConfig) error {
+		return config.AddBoost(clonedCfg, b)
+	})
+}
+
+// DeleteBoost reverts the boost of a bucket before it expires.
+func (s *server) DeleteBoost(namespace, name string, actor audit.Actor) error {
+	change := &audit.Record{Actor: actor, Operation: "DeleteBoost", Namespace: namespace, Bucket: name}
+	return s.updateConfig(change, func(clonedCfg *pb.ServiceConfig) error {
+		return config.DeleteBoost(clonedCfg, namespace, name)
+	})
+}
+
+// reaperClock returns the clock configured for the reaper, which also drives boost expiry.
+func (s *server) reaperClock() clock.Clock {
+	if s.reaperConfig.Clock == nil {
+		return clock.System
+	}
+
+	return s.reaperConfig.Clock
+}
+
+func (s *server) revertBoosts() {
+	c := s.reaperClock()
+	ticker := c.NewTicker(boostCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.removeExpiredBoosts(c.Now())
+		case <-s.stopper:
+			return
+		}
+	}
+}
+
+// removeExpiredBoosts reverts the boosts that have expired by now, as a new config version. If
+// another server updates the config first, the boosts are left for it to revert.
+func (s *server) removeExpiredBoosts(now time.Time) {
+	cfg := s.Configs()
+	if cfg == nil || len(config.ExpiredBoosts(cfg, now)) == 0 {
+		return
+	}
+
+	version := cfg.Version
+	change := &audit.Record{Actor: audit.Actor{User: serverUser}, Operation: "RevertBoosts"}
+	err := s.updateConfigIfVersion(change, &version, func(clonedCfg *pb.ServiceConfig) error {
+		for _, b := range config.ExpiredBoosts(clonedCfg, now) {
+			logging.Printf("Reverting boost of bucket %v, which expired at %v",
+				config.FullyQualifiedName(b.Namespace, b.BucketName), time.Unix(b.Expires, 0))
+		}
+
+		config.RemoveExpiredBoosts(clonedCfg, now)
+		return nil
+	})
+
+	if err != nil && err != config.ErrConcurrentUpdate {
+		logging.Printf("Unable to revert expired boosts: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestBoost(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("partners")
+	helpers.CheckError(t, config.AddBucket(ns, config.NewDefaultBucketConfig("batch")))
+	helpers.CheckError(t, config.AddNamespace(cfg, ns))
+
+	r := NewReaperConfigForTests()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	r.Clock = helpers.NewFakeClock(now)
+	s := New(&MockBucketFactory{}, config.NewMemoryConfig(cfg), r, 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	checkInfo := func(expectedSize, expectedFillRate int64) {
+		size, fillRate, _, _, err := s.GetInfo("partners", "batch")
+		helpers.CheckError(t, err)
+
+		if size != expectedSize || fillRate != expectedFillRate {
+			t.Errorf("Expected size %v and fill rate %v, got %v and %v", expectedSize, expectedFillRate, size, fillRate)
+		}
+	}
+
+	if err := s.AddBoost(&pb.BucketBoost{Namespace: "partners", BucketName: "batch",
+		Config: &pb.BucketConfig{Size: 1000}, Expires: now.Unix()}, audit.Actor{User: "test"}); err == nil {
+		t.Error("Expected a boost that has already expired to be rejected")
+	}
+
+	helpers.CheckError(t, s.AddBoost(&pb.BucketBoost{Namespace: "partners", BucketName: "batch",
+		Config: &pb.BucketConfig{Size: 1000, FillRate: 500}, Expires: now.Add(time.Hour).Unix(), Reason: "backfill"}, audit.Actor{User: "booster"}))
+	waitForVersion(t, s, 1)
+	checkInfo(1000, 500)
+
+	if b := s.Configs().Boosts[0]; b.User != "booster" || b.Reason != "backfill" {
+		t.Errorf("Expected the boost to record the user and reason, got %+v", b)
+	}
+
+	// The declared config is unchanged.
+	if s.Configs().Namespaces["partners"].Buckets["batch"].Size != 100 {
+		t.Errorf("Boost should not change the declared bucket: %+v", s.Configs().Namespaces["partners"])
+	}
+
+	s.removeExpiredBoosts(now.Add(time.Hour - time.Second))
+	if s.Configs().Version != 1 {
+		t.Fatalf("Expected the boost not to be reverted before it expires, got version %v", s.Configs().Version)
+	}
+
+	s.removeExpiredBoosts(now.Add(time.Hour))
+	waitForVersion(t, s, 2)
+	checkInfo(100, 50)
+
+	// Both the boost and its revert are in the history.
+	configs, err := s.HistoricalConfigs(config.AllHistory)
+	helpers.CheckError(t, err)
+
+	if len(configs) != 3 || configs[0].User != "quotaservice" || len(configs[0].Boosts) != 0 ||
+		configs[1].User != "booster" || len(configs[1].Boosts) != 1 {
+		t.Errorf("Expected the history to record the boost and its revert, got %+v", configs)
+	}
+}
+
+func TestDeleteBoost(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	cfg.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+
+	s := New(&MockBucketFactory{}, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.AddBoost(&pb.BucketBoost{Namespace: config.GlobalNamespace, BucketName: config.DefaultBucketName,
+		Config: &pb.BucketConfig{FillRate: 500}, Expires: time.Now().Add(time.Hour).Unix()}, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 1)
+
+	// Buckets in unknown namespaces are served by the global default bucket.
+	s.RLock()
+	b, err := s.bucketContainer.FindBucket("other", "other")
+	s.RUnlock()
+	helpers.CheckError(t, err)
+
+	if b.Config().FillRate != 500 {
+		t.Errorf("Expected the global default bucket to be boosted, got %+v", b.Config())
+	}
+
+	helpers.CheckError(t, s.DeleteBoost(config.GlobalNamespace, config.DefaultBucketName, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 2)
+
+	s.RLock()
+	b, err = s.bucketContainer.FindBucket("other", "other")
+	s.RUnlock()
+	helpers.CheckError(t, err)
+
+	if b.Config().FillRate != 50 {
+		t.Errorf("Expected the boost to be reverted, got %+v", b.Config())
+	}
+
+	if err := s.DeleteBoost(config.GlobalNamespace, config.DefaultBucketName, audit.Actor{User: "test"}); err == nil {
+		t.Error("Expected reverting a boost that doesn't exist to fail")
+	}
+}
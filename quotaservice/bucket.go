@@ -26,6 +26,7 @@ type bucketContainer struct {
 	namespaces    map[string]*namespace
 	defaultBucket Bucket
 	r             *reaper
+	s             *scheduler
 	sync.RWMutex  // Embedded mutex
 }
 
@@ -61,6 +62,16 @@ type Bucket interface {
 	ReportActivity()
 }
 
+// ReconfigurableBucket is implemented by buckets that can switch to a new config in place, such as
+// when a schedule rule becomes active, without losing the tokens they have accumulated.
+type ReconfigurableBucket interface {
+	Bucket
+	// Reconfigure switches the bucket to cfg, which only differs from its current config in size
+	// and fill rate. Accumulated tokens are kept, up to the new size. Returns false if the bucket
+	// can't be reconfigured, in which case it is replaced by a new bucket.
+	Reconfigure(cfg *pbconfig.BucketConfig) bool
+}
+
 type DefaultBucket struct {
 }
 
@@ -127,6 +138,7 @@ func NewBucketContainer(bf BucketFactory, n notifier, r config.ReaperConfig) (bc
 		namespaces: make(map[string]*namespace)}
 
 	bc.r = newReaper(bc, r)
+	bc.s = newScheduler(bc, r.Clock)
 
 	return
 }
@@ -162,7 +174,7 @@ func (bc *bucketContainer) initLocked(cfg *pbconfig.ServiceConfig) {
 func (bc *bucketContainer) createNamespaceLocked(nsCfg *pbconfig.NamespaceConfig) {
 	nsp := &namespace{n: bc.n, name: nsCfg.Name, cfg: nsCfg, buckets: make(map[string]Bucket)}
 	if nsCfg.DefaultBucket != nil {
-		nsp.defaultBucket = bc.bf.NewBucket(nsCfg.Name, config.DefaultBucketName, nsCfg.DefaultBucket, false)
+		nsp.defaultBucket = bc.bf.NewBucket(nsCfg.Name, config.DefaultBucketName, bc.s.scheduledConfig(nsCfg.DefaultBucket), false)
 	}
 
 	nsp.Lock()
@@ -176,7 +188,7 @@ func (bc *bucketContainer) createNamespaceLocked(nsCfg *pbconfig.NamespaceConfig
 }
 
 func (bc *bucketContainer) createGlobalDefaultBucketLocked(cfg *pbconfig.BucketConfig) {
-	bc.defaultBucket = bc.bf.NewBucket(config.GlobalNamespace, config.DefaultBucketName, cfg, false)
+	bc.defaultBucket = bc.bf.NewBucket(config.GlobalNamespace, config.DefaultBucketName, bc.s.scheduledConfig(cfg), false)
 }
 
 // FindBucket locates a bucket for a given name and namespace. If the namespace doesn't exist, and
@@ -268,7 +280,7 @@ func (bc *bucketContainer) countDynamicBuckets(namespace string) int32 {
 func (bc *bucketContainer) createNewNamedBucketFromCfg(namespace, bucketName string, ns *namespace, bCfg *pbconfig.BucketConfig, dyn bool) Bucket {
 	bc.n.Emit(events.NewBucketCreatedEvent(namespace, bucketName, dyn))
 	var bucket Bucket
-	bucket = bc.bf.NewBucket(namespace, bucketName, bCfg, dyn)
+	bucket = bc.bf.NewBucket(namespace, bucketName, bc.s.scheduledConfig(bCfg), dyn)
 
 	if bucket == nil {
 		// TODO(manik) why would this ever happen? Should we panic?
@@ -370,4 +382,5 @@ func (bc *bucketContainer) String() string {
 
 func (bc *bucketContainer) Stop() {
 	bc.r.stop()
+	bc.s.stop()
 }
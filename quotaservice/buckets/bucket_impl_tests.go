@@ -57,16 +57,19 @@ func TestGC(t *testing.T, factory quotaservice.BucketFactory, impl string) {
 	cfg := config.NewDefaultServiceConfig()
 	nsCfg := config.NewDefaultNamespaceConfig("n")
 	tpl := config.NewDefaultBucketConfig("")
-	// Times out every 250 millis.
+	// Times out every 250 millis, as seen by the fake clock.
 	tpl.MaxIdleMillis = 250
 	config.SetDynamicBucketTemplate(nsCfg, tpl)
 	helpers.CheckError(t, config.AddNamespace(cfg, nsCfg))
 
 	eventsEmitter := &quotaservice.MockEmitter{Events: make(chan events.Event, 100)}
-	container := quotaservice.NewBucketContainer(factory, eventsEmitter, quotaservice.NewReaperConfigForTests())
+	clk := helpers.NewFakeClock(time.Now())
+	reaperCfg := quotaservice.NewReaperConfigForTests()
+	reaperCfg.Clock = clk
+	container := quotaservice.NewBucketContainer(factory, eventsEmitter, reaperCfg)
 	container.Init(cfg)
 
-	// No GC should happen here as long as we are in use.
+	// No GC can happen here, since time stands still.
 	for i := 0; i < 10; i++ {
 		for j := 0; j < 10; j++ {
 			bName := strconv.Itoa(j)
@@ -87,7 +90,7 @@ func TestGC(t *testing.T, factory quotaservice.BucketFactory, impl string) {
 		bucketNames[i] = strconv.Itoa(i)
 	}
 
-	waitForGC(eventsEmitter.Events, "n", bucketNames)
+	waitForGC(clk, eventsEmitter.Events, "n", bucketNames)
 
 	for _, bName := range bucketNames {
 		// Check that the bucket has been GC'd
@@ -97,14 +100,24 @@ func TestGC(t *testing.T, factory quotaservice.BucketFactory, impl string) {
 	}
 }
 
-func waitForGC(eventsChan <-chan events.Event, namespace string, buckets []string) {
+// waitForGC moves the clock forward until all buckets have been removed. The reaper runs
+// asynchronously, so the clock is only moved forward when no events have been seen for a while.
+func waitForGC(clk *helpers.FakeClock, eventsChan <-chan events.Event, namespace string, buckets []string) {
 	logging.Println("Waiting for GC")
 	bucketMap := make(map[string]bool)
 	for _, b := range buckets {
 		bucketMap[b] = true
 	}
 
-	for e := range eventsChan {
+	for {
+		var e events.Event
+		select {
+		case e = <-eventsChan:
+		case <-time.After(5 * time.Millisecond):
+			clk.Advance(100 * time.Millisecond)
+			continue
+		}
+
 		if e.EventType() == events.EVENT_BUCKET_REMOVED && e.Namespace() == namespace {
 			bucketMap[e.BucketName()] = false
 		}
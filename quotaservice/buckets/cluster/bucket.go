@@ -0,0 +1,497 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package cluster implements token buckets sharded across a cluster of quota service nodes. Each
+// bucket is owned by a single node, picked by consistent hashing on the bucket's fully qualified
+// name, which holds the bucket in memory. Other nodes forward calls to Take() to the owner over gRPC.
+// When cluster membership changes, buckets that move to a new owner have their state handed over.
+//
+// If the owner of a bucket can't be reached, nodes fall back to serving the bucket locally, which
+// degrades to per-node limits until the owner is reachable again.
+package cluster
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+
+	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/buckets/memory"
+	"github.com/mian-qin/qqs/quotaservice/clock"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/cluster"
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+const (
+	DefaultVirtualNodes   = 128
+	DefaultForwardTimeout = 500 * time.Millisecond
+	DefaultReapInterval   = time.Minute
+)
+
+// Options configure a cluster bucket factory.
+type Options struct {
+	// Self is the address other nodes use to reach this node. It must be one of Peers.
+	Self string
+	// Peers holds the addresses of all nodes in the cluster, including this one.
+	Peers []string
+	// VirtualNodes is the number of points each node occupies on the hash ring.
+	VirtualNodes int
+	// ForwardTimeout is how long a forwarded call may take, on top of the maximum wait time.
+	ForwardTimeout time.Duration
+	// ReapInterval is how often owned buckets are checked for idleness.
+	ReapInterval time.Duration
+	// DialOptions are used to connect to other nodes. Defaults to insecure connections.
+	DialOptions []grpc.DialOption
+	// Clock drives owned buckets and the reaping of idle ones. Defaults to clock.System.
+	Clock clock.Clock
+}
+
+// BucketFactory creates buckets that are sharded across the cluster. Besides implementing
+// quotaservice.BucketFactory, it needs to Serve() requests from other nodes.
+type BucketFactory struct {
+	opts  Options
+	local quotaservice.BucketFactory
+
+	// ring, owned, fallback and conns are protected by the embedded mutex. fallback holds buckets
+	// served locally while their owner can't be reached. They are never handed over, since the
+	// owner holds the authoritative state.
+	ring     *ring
+	owned    map[string]*ownedBucket
+	fallback map[string]*ownedBucket
+	conns    map[string]*grpc.ClientConn
+
+	server  *grpc.Server
+	stopper chan struct{}
+	wg      sync.WaitGroup
+	sync.RWMutex
+}
+
+// ownedBucket is a bucket owned by this node, held in memory on behalf of the whole cluster. cfg is
+// protected by the factory's mutex. inflight counts the callers that acquired the bucket and haven't
+// released it yet; it is only destroyed once they all have.
+type ownedBucket struct {
+	namespace, bucketName string
+	dynamic               bool
+	cfg                   *pbconfig.BucketConfig
+	bucket                quotaservice.Bucket
+	lastActiveNanos       int64
+	inflight              sync.WaitGroup
+	clock                 clock.Clock
+}
+
+func (ob *ownedBucket) matches(cfg *pbconfig.BucketConfig, dyn bool) bool {
+	return ob.dynamic == dyn && (ob.cfg == cfg || proto.Equal(ob.cfg, cfg))
+}
+
+func (ob *ownedBucket) take(numTokens int64, maxWaitTime time.Duration) (time.Duration, bool) {
+	atomic.StoreInt64(&ob.lastActiveNanos, ob.clock.Now().UnixNano())
+	return ob.bucket.Take(numTokens, maxWaitTime)
+}
+
+func (ob *ownedBucket) release() {
+	ob.inflight.Done()
+}
+
+// retire destroys a bucket that has been removed from the factory, once all callers that acquired
+// it have released it.
+func (ob *ownedBucket) retire() {
+	ob.inflight.Wait()
+	ob.bucket.Destroy()
+}
+
+func (ob *ownedBucket) tooIdle(now time.Time) bool {
+	maxIdle := time.Duration(ob.cfg.MaxIdleMillis) * time.Millisecond
+	return maxIdle > 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&ob.lastActiveNanos))) > maxIdle
+}
+
+// NewBucketFactory creates a cluster bucket factory. Call Serve() to start accepting requests
+// from other nodes, and Stop() to release resources.
+func NewBucketFactory(opts *Options) *BucketFactory {
+	o := *opts
+	if o.VirtualNodes <= 0 {
+		o.VirtualNodes = DefaultVirtualNodes
+	}
+
+	if o.ForwardTimeout <= 0 {
+		o.ForwardTimeout = DefaultForwardTimeout
+	}
+
+	if o.ReapInterval <= 0 {
+		o.ReapInterval = DefaultReapInterval
+	}
+
+	if o.DialOptions == nil {
+		o.DialOptions = []grpc.DialOption{grpc.WithInsecure()}
+	}
+
+	if o.Clock == nil {
+		o.Clock = clock.System
+	}
+
+	bf := &BucketFactory{
+		opts:     o,
+		local:    memory.NewBucketFactoryWithClock(o.Clock),
+		ring:     newRing(o.Peers, o.VirtualNodes),
+		owned:    make(map[string]*ownedBucket),
+		fallback: make(map[string]*ownedBucket),
+		conns:    make(map[string]*grpc.ClientConn),
+		stopper:  make(chan struct{})}
+
+	// The ticker is created up front, so no time that passes on the clock is missed.
+	ticker := o.Clock.NewTicker(o.ReapInterval)
+	bf.wg.Add(1)
+	go bf.reapLoop(ticker)
+
+	return bf
+}
+
+func (bf *BucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.local.Init(cfg)
+}
+
+func (bf *BucketFactory) Client() interface{} {
+	return nil
+}
+
+func (bf *BucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	return &clusterBucket{
+		factory:    bf,
+		namespace:  namespace,
+		bucketName: bucketName,
+		fullName:   config.FullyQualifiedName(namespace, bucketName),
+		cfg:        cfg,
+		dynamic:    dyn}
+}
+
+// Serve accepts requests from other nodes on lis. It blocks until Stop() is called.
+func (bf *BucketFactory) Serve(lis net.Listener) error {
+	bf.Lock()
+	bf.server = grpc.NewServer()
+	pb.RegisterClusterServer(bf.server, &clusterServer{bf})
+	s := bf.server
+	bf.Unlock()
+
+	return s.Serve(lis)
+}
+
+// Stop stops serving other nodes, closes connections to other nodes and destroys all buckets owned
+// by this node.
+func (bf *BucketFactory) Stop() {
+	close(bf.stopper)
+	bf.wg.Wait()
+
+	bf.Lock()
+	if bf.server != nil {
+		bf.server.Stop()
+	}
+
+	for peer, conn := range bf.conns {
+		if err := conn.Close(); err != nil {
+			logging.Printf("Unable to close connection to %v: %v", peer, err)
+		}
+	}
+
+	var retired []*ownedBucket
+	for _, buckets := range []map[string]*ownedBucket{bf.owned, bf.fallback} {
+		for name, ob := range buckets {
+			retired = append(retired, ob)
+			delete(buckets, name)
+		}
+	}
+	bf.Unlock()
+
+	for _, ob := range retired {
+		ob.retire()
+	}
+}
+
+// SetPeers updates cluster membership. Buckets owned by this node that are owned by a different
+// node under the new membership are handed over to their new owners. Fallback buckets for buckets
+// now owned by this node are discarded.
+func (bf *BucketFactory) SetPeers(peers []string) {
+	bf.Lock()
+	bf.ring = newRing(peers, bf.opts.VirtualNodes)
+
+	moving := make(map[string][]*ownedBucket)
+	for name, ob := range bf.owned {
+		if owner := bf.ring.owner(name); owner != bf.opts.Self {
+			moving[owner] = append(moving[owner], ob)
+			delete(bf.owned, name)
+		}
+	}
+
+	var discarded []*ownedBucket
+	for name, ob := range bf.fallback {
+		if bf.ring.owner(name) == bf.opts.Self {
+			discarded = append(discarded, ob)
+			delete(bf.fallback, name)
+		}
+	}
+
+	for peer, conn := range bf.conns {
+		if !bf.ring.contains(peer) {
+			_ = conn.Close()
+			delete(bf.conns, peer)
+		}
+	}
+	bf.Unlock()
+
+	for _, ob := range discarded {
+		go ob.retire()
+	}
+
+	logging.Printf("Cluster membership changed to %v; handing over %v buckets", peers, countBuckets(moving))
+
+	for owner, buckets := range moving {
+		// Let in-flight requests finish, so their tokens are accounted for in the state handed over.
+		for _, ob := range buckets {
+			ob.inflight.Wait()
+		}
+
+		if err := bf.transfer(owner, buckets); err != nil {
+			logging.Printf("Unable to hand over buckets to %v: %v", owner, err)
+		}
+
+		for _, ob := range buckets {
+			ob.bucket.Destroy()
+		}
+	}
+}
+
+func countBuckets(buckets map[string][]*ownedBucket) int {
+	count := 0
+	for _, b := range buckets {
+		count += len(b)
+	}
+
+	return count
+}
+
+func (bf *BucketFactory) transfer(owner string, buckets []*ownedBucket) error {
+	req := &pb.TransferRequest{}
+	for _, ob := range buckets {
+		state := memory.ReadState(ob.bucket)
+		if state == nil {
+			continue
+		}
+
+		req.Buckets = append(req.Buckets, &pb.BucketState{
+			Namespace:                ob.namespace,
+			BucketName:               ob.bucketName,
+			Dynamic:                  ob.dynamic,
+			BucketConfig:             ob.cfg,
+			TokensNextAvailableNanos: state.TokensNextAvailableNanos,
+			AccumulatedTokens:        state.AccumulatedTokens})
+	}
+
+	client, err := bf.client(owner)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bf.opts.ForwardTimeout)
+	defer cancel()
+
+	_, err = client.Transfer(ctx, req)
+	return err
+}
+
+// owner returns the address of the node owning the bucket with the given fully qualified name.
+func (bf *BucketFactory) owner(fullName string) string {
+	bf.RLock()
+	defer bf.RUnlock()
+
+	return bf.ring.owner(fullName)
+}
+
+func (bf *BucketFactory) client(peer string) (pb.ClusterClient, error) {
+	bf.RLock()
+	conn, exists := bf.conns[peer]
+	bf.RUnlock()
+
+	if !exists {
+		bf.Lock()
+		defer bf.Unlock()
+
+		conn, exists = bf.conns[peer]
+		if !exists {
+			var err error
+			conn, err = grpc.Dial(peer, bf.opts.DialOptions...)
+			if err != nil {
+				return nil, err
+			}
+
+			bf.conns[peer] = conn
+		}
+	}
+
+	return pb.NewClusterClient(conn), nil
+}
+
+// acquire returns the bucket held by this node in buckets, either owned or fallback, creating it if
+// needed, which must be released once the caller is done with it. If the bucket exists but its config
+// has changed, it is reconfigured in place. Buckets that can't be reconfigured are replaced, carrying
+// over their state.
+func (bf *BucketFactory) acquire(buckets map[string]*ownedBucket, namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) *ownedBucket {
+	fullName := config.FullyQualifiedName(namespace, bucketName)
+
+	bf.RLock()
+	ob := buckets[fullName]
+	if ob != nil && ob.matches(cfg, dyn) {
+		ob.inflight.Add(1)
+		bf.RUnlock()
+		return ob
+	}
+	bf.RUnlock()
+
+	bf.Lock()
+	defer bf.Unlock()
+
+	ob = buckets[fullName]
+	if ob != nil && !ob.matches(cfg, dyn) {
+		if rb, ok := ob.bucket.(quotaservice.ReconfigurableBucket); ok && ob.dynamic == dyn && rb.Reconfigure(cfg) {
+			ob.cfg = cfg
+		} else {
+			bf.replace(buckets, fullName, ob, cfg, dyn)
+		}
+	}
+
+	if ob = buckets[fullName]; ob == nil {
+		ob = bf.newOwnedBucket(namespace, bucketName, cfg, dyn)
+		buckets[fullName] = ob
+	}
+
+	ob.inflight.Add(1)
+	return ob
+}
+
+func (bf *BucketFactory) newOwnedBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) *ownedBucket {
+	return &ownedBucket{
+		namespace:       namespace,
+		bucketName:      bucketName,
+		dynamic:         dyn,
+		cfg:             cfg,
+		bucket:          bf.local.NewBucket(namespace, bucketName, cfg, dyn),
+		lastActiveNanos: bf.opts.Clock.Now().UnixNano(),
+		clock:           bf.opts.Clock}
+}
+
+// replace swaps an owned bucket for a new one with the same state. The old bucket is destroyed once
+// it has been released. Must be called with the embedded mutex held.
+func (bf *BucketFactory) replace(buckets map[string]*ownedBucket, fullName string, old *ownedBucket, cfg *pbconfig.BucketConfig, dyn bool) {
+	ob := bf.newOwnedBucket(old.namespace, old.bucketName, cfg, dyn)
+	if state := memory.ReadState(old.bucket); state != nil {
+		memory.WriteState(ob.bucket, state)
+	}
+
+	buckets[fullName] = ob
+	go old.retire()
+}
+
+// reapLoop periodically destroys owned buckets that have been idle for longer than their
+// MaxIdleMillis. Buckets are reaped independently of the buckets in any node's BucketContainer,
+// since owned buckets are shared by all nodes.
+func (bf *BucketFactory) reapLoop(ticker clock.Ticker) {
+	defer bf.wg.Done()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C():
+			bf.reapIdle(now)
+		case <-bf.stopper:
+			return
+		}
+	}
+}
+
+func (bf *BucketFactory) reapIdle(now time.Time) {
+	var idle []*ownedBucket
+
+	bf.Lock()
+	for _, buckets := range []map[string]*ownedBucket{bf.owned, bf.fallback} {
+		for name, ob := range buckets {
+			if ob.tooIdle(now) {
+				idle = append(idle, ob)
+				delete(buckets, name)
+			}
+		}
+	}
+	bf.Unlock()
+
+	for _, ob := range idle {
+		ob.retire()
+	}
+}
+
+// clusterBucket is a handle on a bucket that may be owned by this or another node.
+type clusterBucket struct {
+	factory    *BucketFactory
+	namespace  string
+	bucketName string
+	fullName   string
+	cfg        *pbconfig.BucketConfig
+	dynamic    bool
+	quotaservice.DefaultBucket
+}
+
+func (b *clusterBucket) Take(numTokens int64, maxWaitTime time.Duration) (time.Duration, bool) {
+	owner := b.factory.owner(b.fullName)
+	if owner == b.factory.opts.Self || owner == "" {
+		return b.takeLocal(b.factory.owned, numTokens, maxWaitTime)
+	}
+
+	waitTime, success, err := b.forward(owner, numTokens, maxWaitTime)
+	if err != nil {
+		logging.Printf("Unable to forward request for bucket %v to %v, serving locally: %v", b.fullName, owner, err)
+		return b.takeLocal(b.factory.fallback, numTokens, maxWaitTime)
+	}
+
+	return waitTime, success
+}
+
+func (b *clusterBucket) takeLocal(buckets map[string]*ownedBucket, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool) {
+	ob := b.factory.acquire(buckets, b.namespace, b.bucketName, b.cfg, b.dynamic)
+	defer ob.release()
+
+	return ob.take(numTokens, maxWaitTime)
+}
+
+func (b *clusterBucket) forward(owner string, numTokens int64, maxWaitTime time.Duration) (time.Duration, bool, error) {
+	client, err := b.factory.client(owner)
+	if err != nil {
+		return 0, false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxWaitTime+b.factory.opts.ForwardTimeout)
+	defer cancel()
+
+	rsp, err := client.Take(ctx, &pb.TakeRequest{
+		Namespace:    b.namespace,
+		BucketName:   b.bucketName,
+		Dynamic:      b.dynamic,
+		BucketConfig: b.cfg,
+		NumTokens:    numTokens,
+		MaxWaitNanos: maxWaitTime.Nanoseconds()})
+	if err != nil {
+		return 0, false, err
+	}
+
+	return time.Duration(rsp.WaitNanos), rsp.Success, nil
+}
+
+func (b *clusterBucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *clusterBucket) Dynamic() bool {
+	return b.dynamic
+}
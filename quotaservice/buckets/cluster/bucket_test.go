@@ -0,0 +1,300 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package cluster
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/mian-qin/qqs/quotaservice/buckets"
+	"github.com/mian-qin/qqs/quotaservice/buckets/memory"
+	"github.com/mian-qin/qqs/quotaservice/clock"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+func TestTokenAcquisition(t *testing.T) {
+	nodes := startCluster(t, 3)
+	defer stopCluster(nodes)
+
+	// Owned by the node the bucket is created on.
+	name := bucketOwnedBy(nodes[0], nodes[0].opts.Self)
+	buckets.TestTokenAcquisition(t, nodes[0].NewBucket("cluster", name, config.NewDefaultBucketConfig(""), false))
+
+	// Owned by another node.
+	name = bucketOwnedBy(nodes[0], nodes[1].opts.Self)
+	buckets.TestTokenAcquisition(t, nodes[0].NewBucket("cluster", name, config.NewDefaultBucketConfig(""), false))
+}
+
+func TestGC(t *testing.T) {
+	nodes := startCluster(t, 1)
+	defer stopCluster(nodes)
+
+	nodes[0].Init(config.NewDefaultServiceConfig())
+	buckets.TestGC(t, nodes[0], "cluster")
+}
+
+func TestSharedLimits(t *testing.T) {
+	nodes := startCluster(t, 3)
+	defer stopCluster(nodes)
+
+	name := bucketOwnedBy(nodes[0], nodes[2].opts.Self)
+	cfg := config.NewDefaultBucketConfig("")
+
+	// Taking more than the bucket holds puts it into five seconds of debt.
+	if _, ok := nodes[0].NewBucket("cluster", name, cfg, false).Take(cfg.Size+5*cfg.FillRate, 0); !ok {
+		t.Fatal("Expected to drain the bucket")
+	}
+
+	for i, node := range nodes {
+		if _, ok := node.NewBucket("cluster", name, cfg, false).Take(1, 0); ok {
+			t.Fatalf("Expected bucket to be empty when seen from node %v", i)
+		}
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	nodes := startCluster(t, 3)
+	defer stopCluster(nodes)
+
+	// Start with a cluster of the first two nodes.
+	initial := []string{nodes[0].opts.Self, nodes[1].opts.Self}
+	all := []string{nodes[0].opts.Self, nodes[1].opts.Self, nodes[2].opts.Self}
+	for _, node := range nodes {
+		node.SetPeers(initial)
+	}
+
+	// Find a bucket that moves to the third node once it joins.
+	var name string
+	for i := 0; name == ""; i++ {
+		candidate := "b" + strconv.Itoa(i)
+		fullName := config.FullyQualifiedName("cluster", candidate)
+		if newRing(all, DefaultVirtualNodes).owner(fullName) == nodes[2].opts.Self {
+			name = candidate
+		}
+	}
+
+	cfg := config.NewDefaultBucketConfig("")
+	if _, ok := nodes[1].NewBucket("cluster", name, cfg, false).Take(cfg.Size+5*cfg.FillRate, 0); !ok {
+		t.Fatal("Expected to drain the bucket")
+	}
+
+	for _, node := range nodes {
+		node.SetPeers(all)
+	}
+
+	if owner := nodes[0].owner(config.FullyQualifiedName("cluster", name)); owner != nodes[2].opts.Self {
+		t.Fatalf("Expected bucket to be owned by %v, was %v", nodes[2].opts.Self, owner)
+	}
+
+	if _, ok := nodes[0].NewBucket("cluster", name, cfg, false).Take(1, 0); ok {
+		t.Fatal("Expected bucket state to be handed over to the new owner")
+	}
+}
+
+func TestConfigFlap(t *testing.T) {
+	nodes := startCluster(t, 1)
+	defer stopCluster(nodes)
+
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.FillRate = 1
+	cfg.MaxDebtMillis = 0
+
+	// Forwarders disagreeing on the config, such as while a config change rolls out.
+	flapped := proto.Clone(cfg).(*pbconfig.BucketConfig)
+	flapped.FillRate = 2
+
+	if _, ok := nodes[0].NewBucket("cluster", "flap", cfg, false).Take(cfg.Size, 0); !ok {
+		t.Fatal("Expected to drain the bucket")
+	}
+
+	for i := 0; i < 4; i++ {
+		c := cfg
+		if i%2 == 0 {
+			c = flapped
+		}
+
+		if _, ok := nodes[0].NewBucket("cluster", "flap", c, false).Take(1, 0); ok {
+			t.Fatalf("Expected the bucket to stay empty after %v config changes", i+1)
+		}
+	}
+}
+
+func TestReapDuringTake(t *testing.T) {
+	nodes := startCluster(t, 1)
+	defer stopCluster(nodes)
+
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.MaxIdleMillis = 1
+
+	// Hold on to the bucket as an in-flight request would.
+	ob := nodes[0].acquire(nodes[0].owned, "cluster", "reaped", cfg, false)
+
+	reaped := make(chan struct{})
+	go func() {
+		nodes[0].reapIdle(time.Now().Add(time.Hour))
+		close(reaped)
+	}()
+
+	taken := make(chan bool)
+	go func() {
+		_, ok := ob.take(1, 0)
+		taken <- ok
+	}()
+
+	select {
+	case ok := <-taken:
+		if !ok {
+			t.Fatal("Expected to take a token from a bucket being reaped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a bucket to serve requests until it is released")
+	}
+
+	ob.release()
+
+	select {
+	case <-reaped:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the bucket to be reaped once released")
+	}
+
+	if memory.ReadState(ob.bucket) != nil {
+		t.Fatal("Expected the reaped bucket to be destroyed")
+	}
+}
+
+func TestFallbackNotHandedOver(t *testing.T) {
+	nodes := startCluster(t, 2)
+	defer stopCluster(nodes)
+
+	// A node that no longer listens.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.CheckError(t, err)
+	unreachable := lis.Addr().String()
+	helpers.CheckError(t, lis.Close())
+
+	// Find a bucket owned by the second node, that the first node briefly thinks is owned by the
+	// unreachable node.
+	stale := []string{nodes[0].opts.Self, unreachable}
+	var name string
+	for i := 0; name == ""; i++ {
+		candidate := "b" + strconv.Itoa(i)
+		fullName := config.FullyQualifiedName("cluster", candidate)
+		if nodes[0].owner(fullName) == nodes[1].opts.Self && newRing(stale, DefaultVirtualNodes).owner(fullName) == unreachable {
+			name = candidate
+		}
+	}
+
+	cfg := config.NewDefaultBucketConfig("")
+	if _, ok := nodes[1].NewBucket("cluster", name, cfg, false).Take(cfg.Size+5*cfg.FillRate, 0); !ok {
+		t.Fatal("Expected to drain the bucket")
+	}
+
+	nodes[0].SetPeers(stale)
+	if _, ok := nodes[0].NewBucket("cluster", name, cfg, false).Take(1, 0); !ok {
+		t.Fatal("Expected the bucket to be served locally while its owner is unreachable")
+	}
+
+	// The fallback bucket's state isn't handed over to the actual owner.
+	nodes[0].SetPeers([]string{nodes[0].opts.Self, nodes[1].opts.Self})
+	if _, ok := nodes[1].NewBucket("cluster", name, cfg, false).Take(1, 0); ok {
+		t.Fatal("Expected the owner to keep its bucket drained")
+	}
+}
+
+func TestReapWithClock(t *testing.T) {
+	clk := helpers.NewFakeClock(time.Now())
+	nodes := startClusterWithClock(t, 1, clk)
+	defer stopCluster(nodes)
+
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.MaxIdleMillis = 1
+	if _, ok := nodes[0].NewBucket("cluster", "idle", cfg, false).Take(1, 0); !ok {
+		t.Fatal("Expected to take a token")
+	}
+
+	// Several reap intervals pass, but not on the clock.
+	time.Sleep(50 * time.Millisecond)
+	if !isOwned(nodes[0], "idle") {
+		t.Fatal("Expected the bucket to be kept until it is idle on the clock")
+	}
+
+	clk.Advance(time.Second)
+	deadline := time.Now().Add(time.Second)
+	for isOwned(nodes[0], "idle") {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the bucket to be reaped once idle on the clock")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startCluster starts n nodes in this process, listening on random local ports.
+func startCluster(t *testing.T, n int) []*BucketFactory {
+	// t.Helper()
+
+	return startClusterWithClock(t, n, clock.System)
+}
+
+func startClusterWithClock(t *testing.T, n int, c clock.Clock) []*BucketFactory {
+	// t.Helper()
+
+	listeners := make([]net.Listener, n)
+	peers := make([]string, n)
+	for i := range listeners {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		helpers.CheckError(t, err)
+		listeners[i] = lis
+		peers[i] = lis.Addr().String()
+	}
+
+	nodes := make([]*BucketFactory, n)
+	for i, lis := range listeners {
+		nodes[i] = NewBucketFactory(&Options{
+			Self:           peers[i],
+			Peers:          peers,
+			ForwardTimeout: 5 * time.Second,
+			ReapInterval:   10 * time.Millisecond,
+			Clock:          c})
+		nodes[i].Init(config.NewDefaultServiceConfig())
+
+		go func(node *BucketFactory, lis net.Listener) {
+			_ = node.Serve(lis)
+		}(nodes[i], lis)
+	}
+
+	return nodes
+}
+
+func stopCluster(nodes []*BucketFactory) {
+	for _, node := range nodes {
+		node.Stop()
+	}
+}
+
+// bucketOwnedBy finds the name of a bucket in the "cluster" namespace that is owned by peer.
+func bucketOwnedBy(node *BucketFactory, peer string) string {
+	for i := 0; ; i++ {
+		name := "b" + strconv.Itoa(i)
+		if node.owner(config.FullyQualifiedName("cluster", name)) == peer {
+			return name
+		}
+	}
+}
+
+func isOwned(node *BucketFactory, name string) bool {
+	node.RLock()
+	defer node.RUnlock()
+
+	_, ok := node.owned[config.FullyQualifiedName("cluster", name)]
+	return ok
+}
@@ -0,0 +1,67 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package cluster
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// ring is an immutable consistent hash ring, mapping keys to peers. Each peer occupies a number of
+// virtual nodes on the ring, so keys are spread evenly and only a small fraction of keys change
+// owners when a peer joins or leaves.
+type ring struct {
+	hashes []uint32
+	owners map[uint32]string
+	peers  map[string]bool
+}
+
+func newRing(peers []string, virtualNodes int) *ring {
+	r := &ring{
+		owners: make(map[uint32]string),
+		peers:  make(map[string]bool)}
+
+	for _, peer := range peers {
+		r.peers[peer] = true
+		for i := 0; i < virtualNodes; i++ {
+			h := hash(fmt.Sprintf("%v#%v", peer, i))
+			if _, exists := r.owners[h]; exists {
+				// Extremely unlikely collision; the first peer keeps the point.
+				continue
+			}
+
+			r.owners[h] = peer
+			r.hashes = append(r.hashes, h)
+		}
+	}
+
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// owner returns the peer that owns key, or an empty string if the ring has no peers.
+func (r *ring) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.owners[r.hashes[i]]
+}
+
+func (r *ring) contains(peer string) bool {
+	return r.peers[peer]
+}
+
+func hash(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
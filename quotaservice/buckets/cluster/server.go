@@ -0,0 +1,46 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/buckets/memory"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/cluster"
+)
+
+// clusterServer serves requests from other nodes in the cluster.
+type clusterServer struct {
+	bf *BucketFactory
+}
+
+// Take serves a request forwarded by another node. Requests are always served, even if membership
+// has changed and this node no longer owns the bucket, so that nodes with a stale view of the
+// cluster still see consistent limits.
+func (s *clusterServer) Take(ctx context.Context, req *pb.TakeRequest) (*pb.TakeResponse, error) {
+	ob := s.bf.acquire(s.bf.owned, req.Namespace, req.BucketName, req.BucketConfig, req.Dynamic)
+	defer ob.release()
+
+	waitTime, success := ob.take(req.NumTokens, time.Duration(req.MaxWaitNanos))
+
+	return &pb.TakeResponse{Success: success, WaitNanos: waitTime.Nanoseconds()}, nil
+}
+
+// Transfer accepts the state of buckets this node has become the owner of.
+func (s *clusterServer) Transfer(ctx context.Context, req *pb.TransferRequest) (*pb.TransferResponse, error) {
+	for _, b := range req.Buckets {
+		ob := s.bf.acquire(s.bf.owned, b.Namespace, b.BucketName, b.BucketConfig, b.Dynamic)
+		if !memory.WriteState(ob.bucket, &memory.State{
+			TokensNextAvailableNanos: b.TokensNextAvailableNanos,
+			AccumulatedTokens:        b.AccumulatedTokens}) {
+			logging.Printf("Unable to restore state of bucket %v:%v", b.Namespace, b.BucketName)
+		}
+		ob.release()
+	}
+
+	return &pb.TransferResponse{}, nil
+}
@@ -0,0 +1,205 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package hybrid implements token buckets that serve most requests from a local cache of tokens,
+// leasing batches of tokens asynchronously from a shared, remote bucket such as the ones in
+// buckets/redis. This trades accuracy for latency: each node may hold on to at most one lease worth
+// of tokens that other nodes can't use, but the vast majority of calls to Take() never leave the
+// process. Requests that can't be served from the local cache fall through to the remote bucket.
+package hybrid
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// DefaultLeaseFraction is the default size of a lease, as a fraction of a bucket's size.
+const DefaultLeaseFraction = 0.1
+
+type bucketFactory struct {
+	remote        quotaservice.BucketFactory
+	leaseFraction float64
+}
+
+// NewBucketFactory creates a bucket factory that caches tokens leased from buckets created by the
+// remote bucket factory. leaseFraction is the size of each lease as a fraction of the bucket's size,
+// and bounds how many tokens a single node may hold at any point in time. If leaseFraction isn't in
+// the range (0, 1], DefaultLeaseFraction is used.
+func NewBucketFactory(remote quotaservice.BucketFactory, leaseFraction float64) quotaservice.BucketFactory {
+	if leaseFraction <= 0 || leaseFraction > 1 {
+		leaseFraction = DefaultLeaseFraction
+	}
+
+	return &bucketFactory{remote: remote, leaseFraction: leaseFraction}
+}
+
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	bf.remote.Init(cfg)
+}
+
+// Client returns the remote bucket factory's client.
+func (bf *bucketFactory) Client() interface{} {
+	return bf.remote.Client()
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	remote := bf.remote.NewBucket(namespace, bucketName, cfg, dyn)
+	if remote == nil {
+		return nil
+	}
+
+	return &cachingBucket{
+		Bucket:        remote,
+		leaseFraction: bf.leaseFraction,
+		closer:        make(chan struct{})}
+}
+
+// cachingBucket serves tokens from a local cache, falling back to the remote bucket it decorates.
+// The local cache is refilled asynchronously when it drops to or below half a lease.
+type cachingBucket struct {
+	quotaservice.Bucket
+	leaseFraction float64
+
+	// leaseMu serializes calls to the remote bucket and the completion of leases, so an in-flight
+	// lease is never granted on top of a request that had to go to the remote bucket. It also guards
+	// closing closer, so no lease is taken from a destroyed remote bucket. It is always acquired
+	// before mu.
+	leaseMu sync.Mutex
+	closer  chan struct{}
+
+	// localTokens and refilling are protected by mu.
+	localTokens int64
+	refilling   bool
+	mu          sync.Mutex
+}
+
+// leaseSize is the number of tokens leased at a time by a bucket configured with cfg.
+func (b *cachingBucket) leaseSize(cfg *pbconfig.BucketConfig) int64 {
+	leaseSize := int64(float64(cfg.Size) * b.leaseFraction)
+	if leaseSize < 1 {
+		leaseSize = 1
+	}
+
+	return leaseSize
+}
+
+func (b *cachingBucket) Take(numTokens int64, maxWaitTime time.Duration) (time.Duration, bool) {
+	if b.takeLocal(numTokens) {
+		return 0, true
+	}
+
+	b.leaseMu.Lock()
+	defer b.leaseMu.Unlock()
+
+	// A lease may have completed while we were waiting.
+	if b.takeLocal(numTokens) {
+		return 0, true
+	}
+
+	// Reserve whatever is left locally, so it isn't handed out again while the remote bucket is
+	// asked for the rest. Leases only complete under leaseMu, so fromLocal is less than numTokens.
+	b.mu.Lock()
+	fromLocal := b.localTokens
+	b.localTokens = 0
+	b.mu.Unlock()
+
+	waitTime, success := b.Bucket.Take(numTokens-fromLocal, maxWaitTime)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !success {
+		b.localTokens += fromLocal
+		return 0, false
+	}
+
+	b.maybeRefillLocked()
+
+	return waitTime, true
+}
+
+// takeLocal claims tokens from the local cache, if enough are available.
+func (b *cachingBucket) takeLocal(numTokens int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.localTokens < numTokens {
+		return false
+	}
+
+	b.localTokens -= numTokens
+	b.maybeRefillLocked()
+	return true
+}
+
+func (b *cachingBucket) maybeRefillLocked() {
+	if b.refilling || b.localTokens > b.leaseSize(b.Config())/2 {
+		return
+	}
+
+	b.refilling = true
+	go b.refill()
+}
+
+func (b *cachingBucket) localTokensAvailable() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.localTokens
+}
+
+// refill leases a batch of tokens from the remote bucket. Leases are only granted if they are
+// immediately available, so the cache never holds tokens other nodes would have to wait for.
+func (b *cachingBucket) refill() {
+	leaseSize := b.leaseSize(b.Config())
+	success := false
+
+	b.leaseMu.Lock()
+	defer b.leaseMu.Unlock()
+
+	select {
+	case <-b.closer:
+		// Destroyed, the remote bucket may no longer serve requests.
+	default:
+		_, success = b.Bucket.Take(leaseSize, 0)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.localTokens += leaseSize
+	}
+
+	b.refilling = false
+}
+
+// Reconfigure is forwarded to the remote bucket, if it can be reconfigured. Tokens held beyond the
+// new lease size are given up.
+func (b *cachingBucket) Reconfigure(cfg *pbconfig.BucketConfig) bool {
+	rb, ok := b.Bucket.(quotaservice.ReconfigurableBucket)
+	if !ok || !rb.Reconfigure(cfg) {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if leaseSize := b.leaseSize(cfg); b.localTokens > leaseSize {
+		b.localTokens = leaseSize
+	}
+
+	return true
+}
+
+func (b *cachingBucket) Destroy() {
+	b.leaseMu.Lock()
+	close(b.closer)
+	b.leaseMu.Unlock()
+
+	b.Bucket.Destroy()
+}
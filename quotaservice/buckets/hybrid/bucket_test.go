@@ -0,0 +1,169 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package hybrid
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/buckets"
+	"github.com/mian-qin/qqs/quotaservice/buckets/memory"
+	"github.com/mian-qin/qqs/quotaservice/config"
+)
+
+var factory = NewBucketFactory(memory.NewBucketFactory(), DefaultLeaseFraction)
+
+func TestMain(m *testing.M) {
+	setUp()
+	r := m.Run()
+	os.Exit(r)
+}
+
+func setUp() {
+	factory.Init(config.NewDefaultServiceConfig())
+}
+
+func TestTokenAcquisition(t *testing.T) {
+	bucket := factory.NewBucket("hybrid", "hybrid", config.NewDefaultBucketConfig(""), false)
+	buckets.TestTokenAcquisition(t, bucket)
+}
+
+func TestGC(t *testing.T) {
+	buckets.TestGC(t, factory, "hybrid")
+}
+
+func TestLocalLease(t *testing.T) {
+	bucket := factory.NewBucket("hybrid", "lease", config.NewDefaultBucketConfig(""), false).(*cachingBucket)
+
+	if _, ok := bucket.Take(1, 0); !ok {
+		t.Fatal("Expected to acquire a token")
+	}
+
+	// Wait for the asynchronous lease to complete.
+	deadline := time.Now().Add(time.Second)
+	leaseSize := bucket.leaseSize(bucket.Config())
+	for bucket.localTokensAvailable() != leaseSize {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %v tokens to be leased, found %v", leaseSize, bucket.localTokensAvailable())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Draining the remote bucket doesn't affect tokens already leased.
+	if _, ok := bucket.Bucket.Take(100, 0); !ok {
+		t.Fatal("Expected to drain the remote bucket")
+	}
+
+	if w, ok := bucket.Take(leaseSize, 0); !ok || w != 0 {
+		t.Fatalf("Expected to be served from the local cache, got wait=%v success=%v", w, ok)
+	}
+
+	if _, ok := bucket.Take(1, 0); ok {
+		t.Fatal("Expected to be rejected once the local cache and remote bucket are empty")
+	}
+}
+
+func TestRefillAfterDestroy(t *testing.T) {
+	bucket := factory.NewBucket("hybrid", "destroyed", config.NewDefaultBucketConfig(""), false).(*cachingBucket)
+	bucket.Destroy()
+
+	refilled := make(chan struct{})
+	go func() {
+		bucket.refill()
+		close(refilled)
+	}()
+
+	select {
+	case <-refilled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected refilling a destroyed bucket to return")
+	}
+
+	if tokens := bucket.localTokensAvailable(); tokens != 0 {
+		t.Fatalf("Expected no tokens to be leased, found %v", tokens)
+	}
+}
+
+func TestReconfigureLeaseSize(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	bucket := factory.NewBucket("hybrid", "reconfigured", cfg, false).(*cachingBucket)
+	defer bucket.Destroy()
+
+	bucket.refill()
+	if tokens := bucket.localTokensAvailable(); tokens != 10 {
+		t.Fatalf("Expected 10 tokens to be leased, found %v", tokens)
+	}
+
+	smaller := config.NewDefaultBucketConfig("")
+	smaller.Size = 40
+	if !bucket.Reconfigure(smaller) {
+		t.Fatal("Expected the bucket to be reconfigured")
+	}
+
+	// Tokens beyond the new lease size are given up.
+	if tokens := bucket.localTokensAvailable(); tokens != 4 {
+		t.Fatalf("Expected 4 tokens to be kept, found %v", tokens)
+	}
+
+	if leaseSize := bucket.leaseSize(smaller); leaseSize != 4 {
+		t.Fatalf("Expected a lease size of 4, found %v", leaseSize)
+	}
+}
+
+// slowBucket widens the window in which local tokens may be spent during a call to the remote bucket.
+type slowBucket struct {
+	quotaservice.Bucket
+}
+
+func (b *slowBucket) Take(numTokens int64, maxWaitTime time.Duration) (time.Duration, bool) {
+	time.Sleep(time.Millisecond)
+	return b.Bucket.Take(numTokens, maxWaitTime)
+}
+
+func TestConcurrentTakes(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.Size = 1000
+	cfg.FillRate = 1
+	cfg.MaxDebtMillis = 0
+	remote := memory.NewBucketFactory()
+	remote.Init(config.NewDefaultServiceConfig())
+	bucket := &cachingBucket{
+		Bucket:        &slowBucket{remote.NewBucket("hybrid", "concurrent", cfg, false)},
+		leaseFraction: DefaultLeaseFraction,
+		closer:        make(chan struct{})}
+	defer bucket.Destroy()
+
+	start := time.Now()
+	var granted int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		// Most requests are served locally, while a few need more than is held locally.
+		numTokens := int64(1)
+		if i%10 == 0 {
+			numTokens = 30
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, ok := bucket.Take(numTokens, 0); ok {
+					atomic.AddInt64(&granted, numTokens)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every token granted was taken from the remote bucket, which refills one token a second. Tokens
+	// still held locally were leased, but not granted.
+	refilled := int64(time.Since(start)/time.Second) + 1
+	if limit := cfg.Size + refilled - bucket.localTokensAvailable(); granted > limit {
+		t.Fatalf("Expected at most %v tokens to be granted, got %v", limit, granted)
+	}
+}
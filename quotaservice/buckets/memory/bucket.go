@@ -9,9 +9,11 @@
 package memory
 
 import (
+	"sync"
 	"time"
 
 	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/clock"
 	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/logging"
 
@@ -19,11 +21,22 @@ import (
 )
 
 type bucketFactory struct {
-	cfg *pbconfig.ServiceConfig
+	cfg   *pbconfig.ServiceConfig
+	clock clock.Clock
+
+	// snapshotter is optional, and if set, all live buckets are tracked in buckets so their state
+	// can be periodically persisted. buckets is protected by the embedded mutex.
+	snapshotter *Snapshotter
+	buckets     map[string]*tokenBucket
+	sync.Mutex
 }
 
 func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
 	bf.cfg = cfg
+
+	if bf.snapshotter != nil {
+		bf.snapshotter.start(bf)
+	}
 }
 
 func (bf *bucketFactory) Client() interface{} {
@@ -39,22 +52,74 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 		accumulatedTokens:  cfg.Size, // Start full
 		fullName:           config.FullyQualifiedName(namespace, bucketName),
 		waitTimer:          make(chan *waitTimeReq),
-		closer:             make(chan struct{})}
+		stateReqs:          make(chan chan *State),
+		stateWrites:        make(chan *State),
+		reconfigs:          make(chan *pbconfig.BucketConfig),
+		closer:             make(chan struct{}),
+		clock:              bf.clock}
+
+	if bf.snapshotter != nil {
+		bucket.factory = bf
+		bf.snapshotter.restore(bucket)
+
+		bf.Lock()
+		bf.buckets[bucket.fullName] = bucket
+		bf.Unlock()
+	}
 
 	go bucket.waitTimeLoop()
 
 	return bucket
 }
 
+// liveBuckets returns all buckets created by this factory that haven't been destroyed yet.
+func (bf *bucketFactory) liveBuckets() []*tokenBucket {
+	bf.Lock()
+	defer bf.Unlock()
+
+	buckets := make([]*tokenBucket, 0, len(bf.buckets))
+	for _, b := range bf.buckets {
+		buckets = append(buckets, b)
+	}
+
+	return buckets
+}
+
+func (bf *bucketFactory) removeBucket(b *tokenBucket) {
+	bf.Lock()
+	defer bf.Unlock()
+
+	// A bucket may have been replaced by a newer instance with the same name.
+	if bf.buckets[b.fullName] == b {
+		delete(bf.buckets, b.fullName)
+	}
+}
+
 func NewBucketFactory() quotaservice.BucketFactory {
-	return &bucketFactory{}
+	return NewBucketFactoryWithClock(clock.System)
+}
+
+// NewBucketFactoryWithClock creates a bucket factory whose buckets tell the time using c.
+func NewBucketFactoryWithClock(c clock.Clock) quotaservice.BucketFactory {
+	return &bucketFactory{clock: c}
+}
+
+// NewBucketFactoryWithSnapshotter creates a bucket factory whose bucket state is periodically
+// persisted by the Snapshotter passed in, and restored when the factory is first initialized.
+// Buckets tell the time using c.
+func NewBucketFactoryWithSnapshotter(s *Snapshotter, c clock.Clock) quotaservice.BucketFactory {
+	return &bucketFactory{
+		clock:       c,
+		snapshotter: s,
+		buckets:     make(map[string]*tokenBucket)}
 }
 
 // tokenBucket is a single-threaded implementation. A single goroutine updates the values of
 // tokensNextAvailable and accumulatedTokens. When requesting tokens, Take() puts a request on
 // the waitTimer channel, and listens on the response channel in the request for a result. The
 // goroutine is shut down when Destroy() is called on this bucket. In-flight requests will be
-// served, but new requests will not.
+// served, but new requests will not. The goroutine also reconfigures the bucket; cfg is guarded by
+// the embedded mutex so it can be read from other goroutines.
 type tokenBucket struct {
 	dynamic                    bool
 	cfg                        *pbconfig.BucketConfig
@@ -63,8 +128,21 @@ type tokenBucket struct {
 	accumulatedTokens          int64
 	fullName                   string
 	waitTimer                  chan *waitTimeReq
+	stateReqs                  chan chan *State
+	stateWrites                chan *State
+	reconfigs                  chan *pbconfig.BucketConfig
 	closer                     chan struct{}
+	factory                    *bucketFactory
+	clock                      clock.Clock
 	quotaservice.DefaultBucket // Extension for default methods on interface
+	sync.RWMutex               // Embedded mutex
+}
+
+// State is a point-in-time copy of the mutable state of a memory bucket. It can be read from one
+// bucket and applied to another, for example to move a bucket between processes.
+type State struct {
+	TokensNextAvailableNanos int64
+	AccumulatedTokens        int64
 }
 
 // waitTimeReq is a request that you put on the channel for the waitTimer goroutine to pick up and
@@ -89,7 +167,7 @@ func (b *tokenBucket) Take(numTokens int64, maxWaitTime time.Duration) (time.Dur
 
 // calcWaitTime is designed to run in a single event loop and is not thread-safe.
 func (b *tokenBucket) calcWaitTime(requested, maxWaitTimeNanos int64) (waitTimeNanos int64) {
-	currentTimeNanos := time.Now().UnixNano()
+	currentTimeNanos := b.clock.Now().UnixNano()
 	tna := b.tokensNextAvailableNanos
 	ac := b.accumulatedTokens
 
@@ -132,6 +210,13 @@ func (b *tokenBucket) waitTimeLoop() {
 		select {
 		case req := <-b.waitTimer:
 			req.response <- b.calcWaitTime(req.requested, req.maxWaitTimeNanos)
+		case rsp := <-b.stateReqs:
+			rsp <- &State{b.tokensNextAvailableNanos, b.accumulatedTokens}
+		case s := <-b.stateWrites:
+			b.tokensNextAvailableNanos = s.TokensNextAvailableNanos
+			b.accumulatedTokens = s.AccumulatedTokens
+		case cfg := <-b.reconfigs:
+			b.reconfigure(cfg)
 		case <-b.closer:
 			logging.Printf("Garbage collecting bucket %v", b.fullName)
 			// TODO(manik) properly notify goroutines who are currently trying to write to waitTimer
@@ -140,7 +225,38 @@ func (b *tokenBucket) waitTimeLoop() {
 	}
 }
 
+// reconfigure is designed to run in a single event loop. Tokens accumulated at the old fill rate
+// are kept, up to the new size.
+func (b *tokenBucket) reconfigure(cfg *pbconfig.BucketConfig) {
+	currentTimeNanos := b.clock.Now().UnixNano()
+
+	if currentTimeNanos > b.tokensNextAvailableNanos {
+		freshTokens := (currentTimeNanos - b.tokensNextAvailableNanos) / b.nanosBetweenTokens
+		b.accumulatedTokens = min(b.cfg.Size, b.accumulatedTokens+freshTokens)
+		b.tokensNextAvailableNanos = currentTimeNanos
+	}
+
+	b.accumulatedTokens = min(cfg.Size, b.accumulatedTokens)
+	b.nanosBetweenTokens = 1e9 / cfg.FillRate
+
+	b.Lock()
+	b.cfg = cfg
+	b.Unlock()
+}
+
+// Reconfigure switches the bucket to a new size and fill rate, keeping its accumulated tokens.
+func (b *tokenBucket) Reconfigure(cfg *pbconfig.BucketConfig) bool {
+	select {
+	case b.reconfigs <- cfg:
+		return true
+	case <-b.closer:
+		return false
+	}
+}
+
 func (b *tokenBucket) Config() *pbconfig.BucketConfig {
+	b.RLock()
+	defer b.RUnlock()
 	return b.cfg
 }
 
@@ -148,7 +264,54 @@ func (b *tokenBucket) Dynamic() bool {
 	return b.dynamic
 }
 
+// state reads the current state of the bucket from its event loop. Returns nil if the bucket has
+// been destroyed.
+func (b *tokenBucket) state() *State {
+	rsp := make(chan *State, 1)
+	select {
+	case b.stateReqs <- rsp:
+		return <-rsp
+	case <-b.closer:
+		return nil
+	}
+}
+
+// setState replaces the state of the bucket from its event loop. Returns false if the bucket has
+// been destroyed.
+func (b *tokenBucket) setState(s *State) bool {
+	select {
+	case b.stateWrites <- s:
+		return true
+	case <-b.closer:
+		return false
+	}
+}
+
+// ReadState returns the state of a bucket created by a memory bucket factory, or nil if the bucket
+// isn't a memory bucket or has been destroyed.
+func ReadState(b quotaservice.Bucket) *State {
+	if tb, ok := b.(*tokenBucket); ok {
+		return tb.state()
+	}
+
+	return nil
+}
+
+// WriteState replaces the state of a bucket created by a memory bucket factory. Returns false if the
+// bucket isn't a memory bucket or has been destroyed.
+func WriteState(b quotaservice.Bucket, s *State) bool {
+	if tb, ok := b.(*tokenBucket); ok {
+		return tb.setState(s)
+	}
+
+	return false
+}
+
 func (b *tokenBucket) Destroy() {
+	if b.factory != nil {
+		b.factory.removeBucket(b)
+	}
+
 	// Signal the waitTimeLoop to exit
 	close(b.closer)
 }
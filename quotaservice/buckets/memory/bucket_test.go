@@ -6,9 +6,12 @@ package memory
 import (
 	"os"
 	"testing"
+	"time"
 
+	"github.com/mian-qin/qqs/quotaservice"
 	"github.com/mian-qin/qqs/quotaservice/buckets"
 	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
 )
 
 var factory = NewBucketFactory()
@@ -31,3 +34,52 @@ func TestTokenAcquisition(t *testing.T) {
 func TestGC(t *testing.T) {
 	buckets.TestGC(t, factory, "memory")
 }
+
+func TestReconfigure(t *testing.T) {
+	clk := helpers.NewFakeClock(time.Now())
+	f := NewBucketFactoryWithClock(clk)
+	f.Init(config.NewDefaultServiceConfig())
+
+	b := f.NewBucket("n", "b", config.NewDefaultBucketConfig("b"), false)
+	defer b.Destroy()
+
+	if _, ok := b.Take(60, 0); !ok {
+		t.Fatal("Expected to take tokens from a full bucket")
+	}
+
+	// Growing the bucket keeps the tokens left...
+	bigger := config.NewDefaultBucketConfig("b")
+	bigger.Size = 1000
+	bigger.FillRate = 500
+
+	if !b.(quotaservice.ReconfigurableBucket).Reconfigure(bigger) {
+		t.Fatal("Expected bucket to be reconfigured")
+	}
+
+	if s := ReadState(b); s.AccumulatedTokens != 40 {
+		t.Errorf("Expected 40 tokens to be kept, got %v", s.AccumulatedTokens)
+	}
+
+	if b.Config().Size != 1000 {
+		t.Errorf("Expected new config, got %+v", b.Config())
+	}
+
+	// ... and fills at the new rate.
+	clk.Advance(time.Second)
+	if w, ok := b.Take(500, 0); !ok || w != 0 {
+		t.Fatalf("Expected 540 tokens to be available, waited %v", w)
+	}
+
+	// Shrinking the bucket caps the tokens accumulated.
+	clk.Advance(time.Second)
+	smaller := config.NewDefaultBucketConfig("b")
+	smaller.Size = 10
+
+	if !b.(quotaservice.ReconfigurableBucket).Reconfigure(smaller) {
+		t.Fatal("Expected bucket to be reconfigured")
+	}
+
+	if s := ReadState(b); s.AccumulatedTokens != 10 {
+		t.Errorf("Expected tokens to be capped at 10, got %v", s.AccumulatedTokens)
+	}
+}
@@ -0,0 +1,214 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// snapshot is the on-disk representation of the state of all buckets in a bucket factory.
+type snapshot struct {
+	TakenAtNanos int64             `json:"taken_at_nanos"`
+	Buckets      []*bucketSnapshot `json:"buckets"`
+}
+
+// bucketSnapshot is the on-disk representation of the state of a single bucket.
+type bucketSnapshot struct {
+	Name                     string `json:"name"`
+	Fingerprint              string `json:"fingerprint"`
+	Dynamic                  bool   `json:"dynamic"`
+	TokensNextAvailableNanos int64  `json:"tokens_next_available_nanos"`
+	AccumulatedTokens        int64  `json:"accumulated_tokens"`
+}
+
+// Snapshotter periodically writes the state of every bucket created by a memory bucket factory to a
+// local file, so that buckets don't all start full after a restart. When the bucket factory is
+// first initialized, state is read back from the file and applied to newly created buckets, as long
+// as the bucket's config hasn't changed and the snapshot isn't older than maxStaleness.
+type Snapshotter struct {
+	path         string
+	interval     time.Duration
+	maxStaleness time.Duration
+
+	// restored holds bucket state read from disk, keyed by fully qualified bucket name, waiting to
+	// be claimed by newly created buckets. Protected by the embedded mutex.
+	restored map[string]*bucketSnapshot
+	takenAt  time.Time
+
+	bf      *bucketFactory
+	stopper chan struct{}
+	wg      sync.WaitGroup
+	sync.Mutex
+}
+
+// NewSnapshotter creates a Snapshotter that writes to path every interval. Snapshots older than
+// maxStaleness are ignored when restoring.
+func NewSnapshotter(path string, interval, maxStaleness time.Duration) *Snapshotter {
+	return &Snapshotter{
+		path:         path,
+		interval:     interval,
+		maxStaleness: maxStaleness,
+		restored:     make(map[string]*bucketSnapshot),
+		stopper:      make(chan struct{})}
+}
+
+// start loads any existing snapshot and starts the periodic snapshot goroutine. Only the first call
+// has any effect; subsequent calls happen whenever the bucket factory sees a new config.
+func (s *Snapshotter) start(bf *bucketFactory) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.bf != nil {
+		return
+	}
+
+	s.bf = bf
+	if err := s.loadLocked(); err != nil {
+		logging.Printf("Unable to restore bucket snapshot from %v: %v", s.path, err)
+	}
+
+	s.wg.Add(1)
+	go s.snapshotLoop()
+}
+
+// Stop stops taking periodic snapshots, and writes a final snapshot.
+func (s *Snapshotter) Stop() error {
+	s.Lock()
+	started := s.bf != nil
+	s.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	close(s.stopper)
+	s.wg.Wait()
+
+	return s.Save()
+}
+
+func (s *Snapshotter) snapshotLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Save(); err != nil {
+				logging.Printf("Unable to write bucket snapshot to %v: %v", s.path, err)
+			}
+		case <-s.stopper:
+			return
+		}
+	}
+}
+
+// Save writes the current state of all live buckets to disk.
+func (s *Snapshotter) Save() error {
+	s.Lock()
+	bf := s.bf
+	s.Unlock()
+
+	if bf == nil {
+		return nil
+	}
+
+	snap := &snapshot{TakenAtNanos: bf.clock.Now().UnixNano()}
+	for _, b := range bf.liveBuckets() {
+		state := b.state()
+		if state == nil {
+			// Destroyed while we were looking.
+			continue
+		}
+
+		snap.Buckets = append(snap.Buckets, &bucketSnapshot{
+			Name:                     b.fullName,
+			Fingerprint:              fingerprint(b.Config()),
+			Dynamic:                  b.dynamic,
+			TokensNextAvailableNanos: state.TokensNextAvailableNanos,
+			AccumulatedTokens:        state.AccumulatedTokens})
+	}
+
+	bytes, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so a crash never leaves a partially written snapshot.
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, bytes, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *Snapshotter) loadLocked() error {
+	bytes, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	snap := &snapshot{}
+	if err := json.Unmarshal(bytes, snap); err != nil {
+		return err
+	}
+
+	s.takenAt = time.Unix(0, snap.TakenAtNanos)
+	for _, b := range snap.Buckets {
+		s.restored[b.Name] = b
+	}
+
+	logging.Printf("Read state for %v buckets from snapshot taken at %v", len(snap.Buckets), s.takenAt)
+	return nil
+}
+
+// restore applies previously snapshotted state to a newly created bucket, if available. State is
+// only ever applied once per bucket.
+func (s *Snapshotter) restore(b *tokenBucket) {
+	s.Lock()
+	defer s.Unlock()
+
+	snap, exists := s.restored[b.fullName]
+	if !exists {
+		return
+	}
+
+	delete(s.restored, b.fullName)
+
+	if b.clock.Now().Sub(s.takenAt) > s.maxStaleness {
+		logging.Printf("Not restoring state for bucket %v; snapshot taken at %v is too old", b.fullName, s.takenAt)
+		return
+	}
+
+	if snap.Dynamic != b.dynamic || snap.Fingerprint != fingerprint(b.cfg) {
+		logging.Printf("Not restoring state for bucket %v; config has changed", b.fullName)
+		return
+	}
+
+	b.tokensNextAvailableNanos = snap.TokensNextAvailableNanos
+	b.accumulatedTokens = snap.AccumulatedTokens
+}
+
+// fingerprint identifies the settings of a bucket config that affect the meaning of its state.
+func fingerprint(cfg *pbconfig.BucketConfig) string {
+	return config.HashConfig([]byte(fmt.Sprintf("%v:%v:%v:%v:%v:%v",
+		cfg.Size, cfg.FillRate, cfg.WaitTimeoutMillis, cfg.MaxIdleMillis, cfg.MaxDebtMillis, cfg.MaxTokensPerRequest)))
+}
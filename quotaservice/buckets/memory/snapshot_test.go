@@ -0,0 +1,113 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package memory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/clock"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	path := snapshotPath(t)
+	defer func() { _ = os.RemoveAll(filepath.Dir(path)) }()
+
+	drainBucket(t, path)
+
+	s := NewSnapshotter(path, time.Hour, time.Hour)
+	f := NewBucketFactoryWithSnapshotter(s, clock.System)
+	f.Init(config.NewDefaultServiceConfig())
+	defer func() { helpers.CheckError(t, s.Stop()) }()
+
+	b := f.NewBucket("n", "b", config.NewDefaultBucketConfig("b"), false)
+	if !empty(b) {
+		t.Fatal("Expected restored bucket to be empty")
+	}
+
+	// State is only ever restored once.
+	b = f.NewBucket("n", "b", config.NewDefaultBucketConfig("b"), false)
+	if empty(b) {
+		t.Fatal("Expected recreated bucket to be full")
+	}
+}
+
+func TestSnapshotChangedConfig(t *testing.T) {
+	path := snapshotPath(t)
+	defer func() { _ = os.RemoveAll(filepath.Dir(path)) }()
+
+	drainBucket(t, path)
+
+	s := NewSnapshotter(path, time.Hour, time.Hour)
+	f := NewBucketFactoryWithSnapshotter(s, clock.System)
+	f.Init(config.NewDefaultServiceConfig())
+	defer func() { helpers.CheckError(t, s.Stop()) }()
+
+	cfg := config.NewDefaultBucketConfig("b")
+	cfg.Size = 200
+	b := f.NewBucket("n", "b", cfg, false)
+	if empty(b) {
+		t.Fatal("Expected bucket with changed config to be full")
+	}
+}
+
+func TestSnapshotTooStale(t *testing.T) {
+	path := snapshotPath(t)
+	defer func() { _ = os.RemoveAll(filepath.Dir(path)) }()
+
+	drainBucket(t, path)
+
+	// Restore an hour into the future.
+	clk := helpers.NewFakeClock(time.Now().Add(time.Hour))
+	s := NewSnapshotter(path, time.Hour, time.Minute)
+	f := NewBucketFactoryWithSnapshotter(s, clk)
+	f.Init(config.NewDefaultServiceConfig())
+	defer func() { helpers.CheckError(t, s.Stop()) }()
+
+	b := f.NewBucket("n", "b", config.NewDefaultBucketConfig("b"), false)
+	if empty(b) {
+		t.Fatal("Expected bucket restored from a stale snapshot to be full")
+	}
+}
+
+// drainBucket creates a bucket, consumes all its tokens and writes a snapshot to path.
+func drainBucket(t *testing.T, path string) {
+	// t.Helper()
+
+	s := NewSnapshotter(path, time.Hour, time.Hour)
+	f := NewBucketFactoryWithSnapshotter(s, clock.System)
+	f.Init(config.NewDefaultServiceConfig())
+
+	b := f.NewBucket("n", "b", config.NewDefaultBucketConfig("b"), false)
+	if _, ok := b.Take(100, 0); !ok {
+		t.Fatal("Expected to drain a full bucket")
+	}
+
+	helpers.CheckError(t, s.Stop())
+}
+
+// empty tells you if a bucket had no tokens accumulated. Taking tokens from an empty bucket succeeds
+// by going into debt, so the next request without a wait time will fail.
+func empty(b quotaservice.Bucket) bool {
+	if _, ok := b.Take(10, 0); !ok {
+		return true
+	}
+
+	_, ok := b.Take(1, 0)
+	return !ok
+}
+
+func snapshotPath(t *testing.T) string {
+	// t.Helper()
+
+	dir, err := ioutil.TempDir("", "qs_snapshot")
+	helpers.CheckError(t, err)
+	return filepath.Join(dir, "buckets.snapshot")
+}
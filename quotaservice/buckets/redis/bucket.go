@@ -44,7 +44,7 @@ func (a *abstractBucket) Config() *pbconfig.BucketConfig {
 }
 
 func (a *abstractBucket) Take(requested int64, maxWaitTime time.Duration) (time.Duration, bool) {
-	currentTimeNanos := strconv.FormatInt(time.Now().UnixNano(), 10)
+	currentTimeNanos := strconv.FormatInt(a.factory.clock.Now().UnixNano(), 10)
 
 	args := []interface{}{currentTimeNanos, a.nanosBetweenTokens, a.maxTokensToAccumulate,
 		strconv.FormatInt(requested, 10), strconv.FormatInt(maxWaitTime.Nanoseconds(), 10),
@@ -95,8 +95,10 @@ func (s *staticBucket) Dynamic() bool {
 }
 
 // dynamicBucket is an implementation of a redisBucket for use with dynamic buckets created from a template.
+// sharedKey identifies the shared configAttributes it references.
 type dynamicBucket struct {
 	*abstractBucket
+	sharedKey string
 }
 
 func (d *dynamicBucket) Dynamic() bool {
@@ -107,15 +109,15 @@ func (d *dynamicBucket) Destroy() {
 	// decrease ref-count common
 	d.factory.Lock()
 	defer d.factory.Unlock()
-	d.factory.refcounts[d.cfg.Namespace]--
+	d.factory.refcounts[d.sharedKey]--
 
-	if d.factory.refcounts[d.cfg.Namespace] < 0 {
-		logging.Fatalf("Ref counts for %v went negative! refcounts=%+v sharedAttributes=%+v", d.cfg.Namespace, d.factory.refcounts, d.factory.sharedAttributes)
+	if d.factory.refcounts[d.sharedKey] < 0 {
+		logging.Fatalf("Ref counts for %v went negative! refcounts=%+v sharedAttributes=%+v", d.sharedKey, d.factory.refcounts, d.factory.sharedAttributes)
 	}
 
 	// If ref-count hits 0, remove common bucket fields
-	if d.factory.refcounts[d.cfg.Namespace] == 0 {
-		delete(d.factory.sharedAttributes, d.cfg.Namespace)
-		delete(d.factory.refcounts, d.cfg.Namespace)
+	if d.factory.refcounts[d.sharedKey] == 0 {
+		delete(d.factory.sharedAttributes, d.sharedKey)
+		delete(d.factory.refcounts, d.sharedKey)
 	}
 }
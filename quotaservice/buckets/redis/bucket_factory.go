@@ -12,6 +12,7 @@ import (
 	"gopkg.in/redis.v5"
 
 	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/clock"
 	"github.com/mian-qin/qqs/quotaservice/logging"
 
 	"sync"
@@ -31,18 +32,19 @@ var defaultBucket = &quotaservice.DefaultBucket{}
 
 // bucketFactory holds an instance of the Redis client, and constructs staticBucket and dynamicBucket instances for use
 // with Redis. Contains an embedded mutex which should be used when reading or updating the reference to the Redis
-// client. Also holds references to configAttributes for each namespace and refcounts of usage of commonAttributes,
-// both also guarded by this mutex.
+// client. Also holds references to configAttributes shared by the dynamic buckets of each namespace and config, and
+// refcounts of their usage, both also guarded by this mutex.
 type bucketFactory struct {
 	// Embedded mutex
 	sync.Mutex
 
-	// Refcounts of configAttributes instances used by dynamic buckets for each namespace, protected by the
-	// embedded mutex.
+	// Refcounts of configAttributes instances used by dynamic buckets, keyed by sharedAttributesKey and protected
+	// by the embedded mutex.
 	refcounts map[string]int
 
-	// sharedAttributes are instances of configAttributes used by dynamic buckets for each namespace, protected by
-	// the embedded mutex.
+	// sharedAttributes are instances of configAttributes used by dynamic buckets, keyed by sharedAttributesKey and
+	// protected by the embedded mutex. Buckets of the same namespace share attributes as long as they have the same
+	// config, which differs while a schedule rule is switching them to new limits.
 	sharedAttributes map[string]*configAttributes
 
 	cfg               *pbconfig.ServiceConfig
@@ -51,12 +53,19 @@ type bucketFactory struct {
 	scriptSHA         string
 	connectionRetries int
 	flushdbCommand    string
+	clock             clock.Clock
 }
 
 // NewBucketFactory creates a new bucketFactory instance.
 // flushdbCommand specifies the name of the Flushdb command. "flushdb"
 // is used if it's empty.
 func NewBucketFactory(redisOpts *redis.Options, connectionRetries int, flushdbCommand string) quotaservice.BucketFactory {
+	return NewBucketFactoryWithClock(redisOpts, connectionRetries, flushdbCommand, clock.System)
+}
+
+// NewBucketFactoryWithClock creates a new bucketFactory instance, whose buckets tell the time
+// using c.
+func NewBucketFactoryWithClock(redisOpts *redis.Options, connectionRetries int, flushdbCommand string, c clock.Clock) quotaservice.BucketFactory {
 	if connectionRetries < 1 {
 		connectionRetries = 1
 	}
@@ -69,7 +78,8 @@ func NewBucketFactory(redisOpts *redis.Options, connectionRetries int, flushdbCo
 		connectionRetries: connectionRetries,
 		sharedAttributes:  make(map[string]*configAttributes),
 		refcounts:         make(map[string]int),
-		flushdbCommand:    flushdbCommand}
+		flushdbCommand:    flushdbCommand,
+		clock:             c}
 }
 
 // Init initializes a bucketFactory for use, implementing Init() on the quotaservice.BucketFactory interface
@@ -185,18 +195,19 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 		toRedisKey(namespace, bucketName, accumulatedTokensSuffix)}
 
 	if dyn {
-		var exists bool
 		bf.Lock()
 		defer bf.Unlock()
 
-		var attribs *configAttributes
+		attribs := newConfigAttributes(cfg, idle, dyn)
+		key := sharedAttributesKey(namespace, attribs)
 
-		if attribs, exists = bf.sharedAttributes[namespace]; !exists {
-			attribs = newConfigAttributes(cfg, idle, dyn)
-			bf.sharedAttributes[namespace] = attribs
-			bf.refcounts[namespace] = 0
+		if shared, exists := bf.sharedAttributes[key]; exists {
+			attribs = shared
+		} else {
+			bf.sharedAttributes[key] = attribs
+			bf.refcounts[key] = 0
 		}
-		bf.refcounts[namespace]++
+		bf.refcounts[key]++
 
 		// Create a dynamicBucket with a reference to the appropriate shared configAttributes instance
 		return &dynamicBucket{
@@ -204,7 +215,8 @@ func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.B
 				attribs,
 				cfg,
 				bf,
-				keys}}
+				keys},
+			key}
 	} else {
 		// Create a staticBucket with its own non-shared configAttributes
 		return &staticBucket{
@@ -226,6 +238,13 @@ func newConfigAttributes(cfg *pbconfig.BucketConfig, idle string, dyn bool) *con
 		defaultBucket}
 }
 
+// sharedAttributesKey identifies the configAttributes shared by dynamic buckets of a namespace with the same
+// attributes.
+func sharedAttributesKey(namespace string, attribs *configAttributes) string {
+	return namespace + ":" + attribs.nanosBetweenTokens + ":" + attribs.maxTokensToAccumulate + ":" +
+		attribs.maxIdleTimeMillis + ":" + attribs.maxDebtNanos
+}
+
 func toRedisKey(namespace, bucketName, suffix string) string {
 	return namespace + ":" + bucketName + ":" + suffix
 }
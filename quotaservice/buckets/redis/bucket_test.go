@@ -5,8 +5,10 @@ package redis
 
 import (
 	"os"
+	"strconv"
 	"testing"
 
+	"github.com/golang/protobuf/proto"
 	"gopkg.in/redis.v5"
 
 	"fmt"
@@ -89,13 +91,13 @@ func TestRefCountsForDynamic(t *testing.T) {
 
 	// Create a dynamic bucket - the cast will ensure it is the right type
 	b1 := factory.NewBucket("dynNs", "b1", cfg.Namespaces["dynNs"].DynamicBucketTemplate, true).(*dynamicBucket)
-	assertRefCounts("dynNs", 1, t)
+	assertRefCounts(b1.sharedKey, 1, t)
 	if b1.maxDebtNanos != dynMaxDebtNanos {
 		t.Fatalf("Expected maxDebtNanos on dynamic bucket to be %v but was %v", dynMaxDebtNanos, b1.maxDebtNanos)
 	}
 
 	b2 := factory.NewBucket("dynNs", "b2", cfg.Namespaces["dynNs"].DynamicBucketTemplate, true).(*dynamicBucket)
-	assertRefCounts("dynNs", 2, t)
+	assertRefCounts(b1.sharedKey, 2, t)
 
 	// Check that b1 and b2 point to the same shared attributes
 	if b1.abstractBucket.configAttributes != b2.abstractBucket.configAttributes {
@@ -103,7 +105,7 @@ func TestRefCountsForDynamic(t *testing.T) {
 	}
 
 	b2.Destroy()
-	assertRefCounts("dynNs", 1, t)
+	assertRefCounts(b1.sharedKey, 1, t)
 
 	b3 := factory.NewBucket("dynNs", "b3", cfg.Namespaces["dynNs"].DynamicBucketTemplate, true).(*dynamicBucket)
 	// Check that b1 and b3 point to the same shared attributes
@@ -111,7 +113,7 @@ func TestRefCountsForDynamic(t *testing.T) {
 		t.Fatalf("b1 and b3 point to different configAttributes. b1 points to %p and b3 points to %p", b1.abstractBucket.configAttributes, b3.abstractBucket.configAttributes)
 	}
 
-	assertRefCounts("dynNs", 2, t)
+	assertRefCounts(b1.sharedKey, 2, t)
 
 	b1.Destroy()
 	b3.Destroy()
@@ -119,6 +121,42 @@ func TestRefCountsForDynamic(t *testing.T) {
 	assertNoSharedAttribs(t)
 }
 
+func TestScheduledDynamicBuckets(t *testing.T) {
+	assertNoSharedAttribs(t)
+
+	tpl := cfg.Namespaces["dynNs"].DynamicBucketTemplate
+	b1 := factory.NewBucket("dynNs", "b1", tpl, true).(*dynamicBucket)
+
+	// A schedule rule switching buckets to new limits replaces them before the old ones are destroyed.
+	scheduled := proto.Clone(tpl).(*quotaservice_configs.BucketConfig)
+	scheduled.Size = tpl.Size * 2
+	scheduled.FillRate = tpl.FillRate * 2
+
+	b2 := factory.NewBucket("dynNs", "b1", scheduled, true).(*dynamicBucket)
+	if b2.maxTokensToAccumulate != strconv.FormatInt(scheduled.Size, 10) {
+		t.Fatalf("Expected the scheduled size %v to be enforced, was %v", scheduled.Size, b2.maxTokensToAccumulate)
+	}
+
+	if b2.nanosBetweenTokens != strconv.FormatInt(1e9/scheduled.FillRate, 10) {
+		t.Fatalf("Expected the scheduled fill rate %v to be enforced, was %v tokens apart", scheduled.FillRate, b2.nanosBetweenTokens)
+	}
+
+	b1.Destroy()
+
+	// New buckets created with the scheduled config share its attributes.
+	b3 := factory.NewBucket("dynNs", "b3", scheduled, true).(*dynamicBucket)
+	if b2.configAttributes != b3.configAttributes {
+		t.Fatalf("b2 and b3 point to different configAttributes. b2 points to %p and b3 points to %p", b2.configAttributes, b3.configAttributes)
+	}
+
+	assertRefCounts(b2.sharedKey, 2, t)
+
+	b2.Destroy()
+	b3.Destroy()
+
+	assertNoSharedAttribs(t)
+}
+
 func assertNoSharedAttribs(t *testing.T) {
 	// t.Helper()
 
@@ -131,18 +169,18 @@ func assertNoSharedAttribs(t *testing.T) {
 	}
 }
 
-func assertRefCounts(ns string, expected int, t *testing.T) {
+func assertRefCounts(key string, expected int, t *testing.T) {
 	// t.Helper()
 
-	if _, exists := factory.sharedAttributes[ns]; !exists {
-		t.Fatalf("Expected shared attributes for namespace %v but found %+v", ns, factory.sharedAttributes)
+	if _, exists := factory.sharedAttributes[key]; !exists {
+		t.Fatalf("Expected shared attributes for %v but found %+v", key, factory.sharedAttributes)
 	}
 
-	if counts, exists := factory.refcounts[ns]; !exists {
-		t.Fatalf("Expected ref counts for namespace %v but found %+v", ns, factory.refcounts)
+	if counts, exists := factory.refcounts[key]; !exists {
+		t.Fatalf("Expected ref counts for %v but found %+v", key, factory.refcounts)
 	} else {
 		if counts != expected {
-			t.Fatalf("Expected ref counts for namespace %v to be %v but found %v", ns, expected, counts)
+			t.Fatalf("Expected ref counts for %v to be %v but found %v", key, expected, counts)
 		}
 	}
 }
@@ -0,0 +1,333 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package sql implements token buckets backed by a SQL database, using the same algorithm as the
+// memory and Redis implementations. The state of each bucket is stored in a row, which is updated
+// atomically with a compare-and-swap on a version column, so any number of quota service nodes can
+// share a database. PostgreSQL and SQLite are supported; call Migrate to create the schema.
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/clock"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// Dialect identifies the flavor of SQL spoken by a database.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite3"
+)
+
+// rebind rewrites a query using ? placeholders into the placeholder style of the dialect.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String()
+}
+
+const (
+	flushedAtVersionKey = "flushed_at_version"
+
+	// maxConflicts is the number of times a Take() is retried when the row it is updating is
+	// concurrently updated by someone else.
+	maxConflicts = 100
+)
+
+var errTooManyConflicts = errors.New("too many conflicting updates")
+
+// bucketFactory creates buckets whose state is stored in db.
+type bucketFactory struct {
+	db      *sql.DB
+	dialect Dialect
+
+	selectQuery string
+	insertQuery string
+	updateQuery string
+
+	clock clock.Clock
+	cfg   *pbconfig.ServiceConfig
+	sync.Mutex
+}
+
+// NewBucketFactory creates a bucket factory storing bucket state in db, which must have been
+// prepared with Migrate. When using SQLite, consider limiting db to a single open connection, as
+// SQLite doesn't support concurrent writers.
+func NewBucketFactory(db *sql.DB, dialect Dialect) quotaservice.BucketFactory {
+	return NewBucketFactoryWithClock(db, dialect, clock.System)
+}
+
+// NewBucketFactoryWithClock creates a bucket factory like NewBucketFactory, whose buckets tell the
+// time using c.
+func NewBucketFactoryWithClock(db *sql.DB, dialect Dialect, c clock.Clock) quotaservice.BucketFactory {
+	return &bucketFactory{
+		db:      db,
+		dialect: dialect,
+		clock:   c,
+		selectQuery: dialect.rebind(`SELECT tokens_next_available_nanos, accumulated_tokens, expires_at_nanos, version
+			FROM quotaservice_buckets WHERE name = ?`),
+		insertQuery: dialect.rebind(`INSERT INTO quotaservice_buckets
+			(name, tokens_next_available_nanos, accumulated_tokens, expires_at_nanos, version) VALUES (?, ?, ?, ?, 1)`),
+		updateQuery: dialect.rebind(`UPDATE quotaservice_buckets
+			SET tokens_next_available_nanos = ?, accumulated_tokens = ?, expires_at_nanos = ?, version = version + 1
+			WHERE name = ? AND version = ?`)}
+}
+
+// Init initializes the bucket factory. Like the Redis implementation, bucket state is discarded the
+// first time any node sees a new version of the configuration.
+func (bf *bucketFactory) Init(cfg *pbconfig.ServiceConfig) {
+	logging.Printf("Initializing sql.bucketFactory for config version %v", cfg.Version)
+	bf.Lock()
+	defer bf.Unlock()
+
+	bf.cfg = cfg
+
+	start := bf.clock.Now()
+	if err := bf.flushIfNeeded(cfg.Version); err != nil {
+		logging.Printf("Unable to flush SQL bucket state: %v", err)
+	}
+	logging.Printf("Verified SQL bucket state (including any flushes, if necessary) in %v", bf.clock.Now().Sub(start))
+}
+
+// flushIfNeeded removes all bucket state if it was last flushed for an older config version, and
+// removes expired bucket state otherwise.
+func (bf *bucketFactory) flushIfNeeded(version int32) error {
+	var flushedAt int64
+	err := bf.db.QueryRow(bf.dialect.rebind(`SELECT value FROM quotaservice_metadata WHERE name = ?`),
+		flushedAtVersionKey).Scan(&flushedAt)
+	if err == sql.ErrNoRows {
+		logging.Print("flushedAtVersion not set")
+		flushedAt = -1
+	} else if err != nil {
+		return err
+	}
+
+	if flushedAt >= int64(version) {
+		logging.Printf("No need to flush since SQL bucket state has already been flushedAtVersion %v", flushedAt)
+		_, err = bf.db.Exec(bf.dialect.rebind(`DELETE FROM quotaservice_buckets
+			WHERE expires_at_nanos > 0 AND expires_at_nanos < ?`), bf.clock.Now().UnixNano())
+		return err
+	}
+
+	tx, err := bf.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM quotaservice_buckets`); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	res, err := tx.Exec(bf.dialect.rebind(`UPDATE quotaservice_metadata SET value = ? WHERE name = ?`),
+		version, flushedAtVersionKey)
+	if err == nil {
+		var updated int64
+		if updated, err = res.RowsAffected(); err == nil && updated == 0 {
+			_, err = tx.Exec(bf.dialect.rebind(`INSERT INTO quotaservice_metadata (name, value) VALUES (?, ?)`),
+				flushedAtVersionKey, version)
+		}
+	}
+
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Client returns the underlying *sql.DB.
+func (bf *bucketFactory) Client() interface{} {
+	return bf.db
+}
+
+func (bf *bucketFactory) NewBucket(namespace, bucketName string, cfg *pbconfig.BucketConfig, dyn bool) quotaservice.Bucket {
+	var maxIdleNanos int64
+	if cfg.MaxIdleMillis > 0 {
+		maxIdleNanos = int64(cfg.MaxIdleMillis) * 1e6
+	}
+
+	return &sqlBucket{
+		factory:            bf,
+		name:               config.FullyQualifiedName(namespace, bucketName),
+		cfg:                cfg,
+		dynamic:            dyn,
+		nanosBetweenTokens: 1e9 / cfg.FillRate,
+		maxDebtNanos:       cfg.MaxDebtMillis * 1e6,
+		maxIdleNanos:       maxIdleNanos}
+}
+
+// sqlBucket is a bucket whose state is stored in a row of the quotaservice_buckets table.
+type sqlBucket struct {
+	factory            *bucketFactory
+	name               string
+	cfg                *pbconfig.BucketConfig
+	dynamic            bool
+	nanosBetweenTokens int64
+	maxDebtNanos       int64
+	maxIdleNanos       int64
+	quotaservice.DefaultBucket
+}
+
+// bucketState is the state of a bucket, as stored in a row.
+type bucketState struct {
+	tokensNextAvailableNanos int64
+	accumulatedTokens        int64
+}
+
+func (b *sqlBucket) Take(requested int64, maxWaitTime time.Duration) (time.Duration, bool) {
+	waitTimeNanos, err := b.take(requested, maxWaitTime.Nanoseconds())
+	if err != nil {
+		logging.Printf("Unable to take tokens from bucket %v: %v", b.name, err)
+		return 0, false
+	}
+
+	if waitTimeNanos < 0 {
+		// Timed out
+		return 0, false
+	}
+
+	return time.Duration(waitTimeNanos) * time.Nanosecond, true
+}
+
+// take reads the bucket's row, applies the request and writes the row back, provided nobody else
+// has updated the row in the meantime. Otherwise, the whole operation is retried.
+func (b *sqlBucket) take(requested, maxWaitTimeNanos int64) (int64, error) {
+	for attempt := 0; attempt < maxConflicts; attempt++ {
+		state := &bucketState{}
+		var expiresAtNanos, version int64
+		err := b.factory.db.QueryRow(b.factory.selectQuery, b.name).Scan(
+			&state.tokensNextAvailableNanos, &state.accumulatedTokens, &expiresAtNanos, &version)
+		exists := err == nil
+
+		// Read the time after the row, so successful updates never see time going backwards.
+		currentTimeNanos := b.factory.clock.Now().UnixNano()
+		if err == sql.ErrNoRows || (exists && expiresAtNanos > 0 && expiresAtNanos < currentTimeNanos) {
+			// Missing or idle for too long; start full.
+			state = &bucketState{accumulatedTokens: b.cfg.Size}
+		} else if err != nil {
+			return 0, err
+		}
+
+		waitTimeNanos := b.calcWaitTime(state, currentTimeNanos, requested, maxWaitTimeNanos)
+		if waitTimeNanos < 0 {
+			return waitTimeNanos, nil
+		}
+
+		expiresAtNanos = 0
+		if b.maxIdleNanos > 0 {
+			expiresAtNanos = currentTimeNanos + b.maxIdleNanos
+		}
+
+		var res sql.Result
+		if exists {
+			res, err = b.factory.db.Exec(b.factory.updateQuery, state.tokensNextAvailableNanos,
+				state.accumulatedTokens, expiresAtNanos, b.name, version)
+		} else {
+			res, err = b.factory.db.Exec(b.factory.insertQuery, b.name, state.tokensNextAvailableNanos,
+				state.accumulatedTokens, expiresAtNanos)
+			if isDuplicateKey(err) {
+				// Created concurrently by someone else.
+				continue
+			}
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if updated, err := res.RowsAffected(); err != nil {
+			return 0, err
+		} else if updated == 1 {
+			return waitTimeNanos, nil
+		}
+	}
+
+	return 0, errTooManyConflicts
+}
+
+// isDuplicateKey returns true if err is a unique constraint violation, as reported by the SQLite or
+// PostgreSQL drivers.
+func isDuplicateKey(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		return e.SQLState() == "23505"
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") || strings.Contains(msg, "duplicate key value")
+}
+
+// calcWaitTime applies a request for tokens to state, using the same algorithm as the memory
+// implementation. State is only modified if the request succeeds. Returns -1 if the request can't
+// be satisfied within maxWaitTimeNanos.
+func (b *sqlBucket) calcWaitTime(state *bucketState, currentTimeNanos, requested, maxWaitTimeNanos int64) (waitTimeNanos int64) {
+	tna := state.tokensNextAvailableNanos
+	ac := state.accumulatedTokens
+
+	if currentTimeNanos > tna {
+		freshTokens := (currentTimeNanos - tna) / b.nanosBetweenTokens
+		ac = min(b.cfg.Size, ac+freshTokens)
+		tna = currentTimeNanos
+	}
+
+	waitTimeNanos = tna - currentTimeNanos
+	accumulatedTokensUsed := min(ac, requested)
+	tokensToWaitFor := requested - accumulatedTokensUsed
+	futureWaitNanos := tokensToWaitFor * b.nanosBetweenTokens
+
+	tna += futureWaitNanos
+	ac -= accumulatedTokensUsed
+
+	if (tna-currentTimeNanos > b.maxDebtNanos) || (waitTimeNanos > 0 && waitTimeNanos > maxWaitTimeNanos) {
+		return -1
+	}
+
+	state.tokensNextAvailableNanos = tna
+	state.accumulatedTokens = ac
+	return waitTimeNanos
+}
+
+func min(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func (b *sqlBucket) Config() *pbconfig.BucketConfig {
+	return b.cfg
+}
+
+func (b *sqlBucket) Dynamic() bool {
+	return b.dynamic
+}
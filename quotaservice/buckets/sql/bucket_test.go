@@ -0,0 +1,255 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package sql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/mian-qin/qqs/quotaservice/buckets"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+var factory *bucketFactory
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "qs_sql")
+	helpers.PanicError(err)
+
+	db := openDB(dir)
+	factory = NewBucketFactory(db, SQLite).(*bucketFactory)
+	factory.Init(config.NewDefaultServiceConfig())
+
+	r := m.Run()
+
+	_ = db.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(r)
+}
+
+func openDB(dir string) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "buckets.db"))
+	helpers.PanicError(err)
+	db.SetMaxOpenConns(1)
+	helpers.PanicError(Migrate(db, SQLite))
+	return db
+}
+
+func TestTokenAcquisition(t *testing.T) {
+	clearBucket(t, "sql", "sql")
+	bucket := factory.NewBucket("sql", "sql", config.NewDefaultBucketConfig(""), false)
+	buckets.TestTokenAcquisition(t, bucket)
+}
+
+func TestGC(t *testing.T) {
+	buckets.TestGC(t, factory, "sql")
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	helpers.CheckError(t, Migrate(factory.db, SQLite))
+
+	var version int
+	helpers.CheckError(t, factory.db.QueryRow(`SELECT MAX(version) FROM quotaservice_schema_migrations`).Scan(&version))
+	if version != len(migrations) {
+		t.Fatalf("Expected schema version %v, was %v", len(migrations), version)
+	}
+}
+
+func TestConcurrentTakes(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.FillRate = 1
+	cfg.MaxDebtMillis = 0
+	clearBucket(t, "sql", "concurrent")
+	bucket := factory.NewBucket("sql", "concurrent", cfg, false)
+
+	var granted int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, ok := bucket.Take(1, 0); ok {
+					atomic.AddInt64(&granted, 1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if granted != cfg.Size {
+		t.Fatalf("Expected %v tokens to be granted, was %v", cfg.Size, granted)
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	cfg := config.NewDefaultBucketConfig("")
+	cfg.FillRate = 1
+	cfg.MaxDebtMillis = 0
+	cfg.MaxIdleMillis = 50
+	clearBucket(t, "sql", "idle")
+
+	clk := helpers.NewFakeClock(time.Now())
+	bucket := NewBucketFactoryWithClock(factory.db, SQLite, clk).NewBucket("sql", "idle", cfg, false)
+
+	if _, ok := bucket.Take(cfg.Size, 0); !ok {
+		t.Fatal("Expected to drain the bucket")
+	}
+
+	if _, ok := bucket.Take(1, 0); ok {
+		t.Fatal("Expected the bucket to be empty")
+	}
+
+	clk.Advance(51 * time.Millisecond)
+
+	if _, ok := bucket.Take(cfg.Size, 0); !ok {
+		t.Fatal("Expected an idle bucket to start full")
+	}
+}
+
+func TestFlushOnNewVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_sql")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	db := openDB(dir)
+	defer func() { _ = db.Close() }()
+
+	cfg := config.NewDefaultServiceConfig()
+	f := NewBucketFactory(db, SQLite)
+	f.Init(cfg)
+
+	bCfg := config.NewDefaultBucketConfig("")
+	bCfg.FillRate = 1
+	bCfg.MaxDebtMillis = 0
+	if _, ok := f.NewBucket("sql", "flush", bCfg, false).Take(bCfg.Size, 0); !ok {
+		t.Fatal("Expected to drain the bucket")
+	}
+
+	// Same version; state is kept.
+	f.Init(cfg)
+	if _, ok := f.NewBucket("sql", "flush", bCfg, false).Take(1, 0); ok {
+		t.Fatal("Expected the bucket to be empty")
+	}
+
+	cfg.Version++
+	f.Init(cfg)
+	if _, ok := f.NewBucket("sql", "flush", bCfg, false).Take(bCfg.Size, 0); !ok {
+		t.Fatal("Expected the bucket to be full after flushing")
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	clearBucket(t, "sql", "duplicate")
+	insert := func() error {
+		_, err := factory.db.Exec(factory.insertQuery, config.FullyQualifiedName("sql", "duplicate"), 0, 0, 0)
+		return err
+	}
+
+	helpers.CheckError(t, insert())
+	if err := insert(); !isDuplicateKey(err) {
+		t.Fatalf("Expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestFailingInsert(t *testing.T) {
+	d := &failingDriver{err: errors.New("connection reset by peer")}
+	sql.Register("failing", d)
+
+	db, err := sql.Open("failing", "")
+	helpers.CheckError(t, err)
+	defer func() { _ = db.Close() }()
+
+	b := NewBucketFactory(db, SQLite).NewBucket("sql", "failing", config.NewDefaultBucketConfig(""), false).(*sqlBucket)
+	if _, err := b.take(1, 0); err != d.err {
+		t.Fatalf("Expected %v, got %v", d.err, err)
+	}
+
+	if execs := atomic.LoadInt32(&d.execs); execs != 1 {
+		t.Fatalf("Expected the insert to be attempted once, was attempted %v times", execs)
+	}
+}
+
+// failingDriver is a database/sql driver that finds no rows, and fails every insert or update.
+type failingDriver struct {
+	err   error
+	execs int32
+}
+
+func (d *failingDriver) Open(string) (driver.Conn, error) {
+	return &failingConn{d}, nil
+}
+
+type failingConn struct {
+	d *failingDriver
+}
+
+func (c *failingConn) Prepare(string) (driver.Stmt, error) {
+	return &failingStmt{c.d}, nil
+}
+
+func (c *failingConn) Close() error {
+	return nil
+}
+
+func (c *failingConn) Begin() (driver.Tx, error) {
+	return nil, c.d.err
+}
+
+type failingStmt struct {
+	d *failingDriver
+}
+
+func (s *failingStmt) Close() error {
+	return nil
+}
+
+func (s *failingStmt) NumInput() int {
+	return -1
+}
+
+func (s *failingStmt) Exec([]driver.Value) (driver.Result, error) {
+	atomic.AddInt32(&s.d.execs, 1)
+	return nil, s.d.err
+}
+
+func (s *failingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (r *emptyRows) Columns() []string {
+	return []string{"tokens_next_available_nanos", "accumulated_tokens", "expires_at_nanos", "version"}
+}
+
+func (r *emptyRows) Close() error {
+	return nil
+}
+
+func (r *emptyRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+// clearBucket removes any state left behind for a bucket by previous runs.
+func clearBucket(t *testing.T, namespace, bucketName string) {
+	// t.Helper()
+
+	_, err := factory.db.Exec(`DELETE FROM quotaservice_buckets WHERE name = ?`,
+		config.FullyQualifiedName(namespace, bucketName))
+	helpers.CheckError(t, err)
+}
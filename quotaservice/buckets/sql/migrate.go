@@ -0,0 +1,69 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package sql
+
+import (
+	"database/sql"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+)
+
+// migrations holds the schema used by the SQL bucket factory, as an ordered list of statements.
+// Statements are only ever appended to this list; a database at schema version N has had the first
+// N statements applied.
+var migrations = []string{
+	`CREATE TABLE quotaservice_buckets (
+		name VARCHAR(255) NOT NULL PRIMARY KEY,
+		tokens_next_available_nanos BIGINT NOT NULL,
+		accumulated_tokens BIGINT NOT NULL,
+		expires_at_nanos BIGINT NOT NULL,
+		version BIGINT NOT NULL)`,
+	`CREATE INDEX quotaservice_buckets_expires_at ON quotaservice_buckets (expires_at_nanos)`,
+	`CREATE TABLE quotaservice_metadata (
+		name VARCHAR(255) NOT NULL PRIMARY KEY,
+		value BIGINT NOT NULL)`,
+}
+
+// Migrate creates or upgrades the tables used by the SQL bucket factory. It is safe to call
+// Migrate on a database that is already up to date.
+func Migrate(db *sql.DB, dialect Dialect) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS quotaservice_schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM quotaservice_schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		if err := applyMigration(db, dialect, version); err != nil {
+			return err
+		}
+
+		logging.Printf("Applied SQL bucket schema migration %v", version)
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, dialect Dialect, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(migrations[version-1]); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(dialect.rebind(`INSERT INTO quotaservice_schema_migrations (version) VALUES (?)`), version); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
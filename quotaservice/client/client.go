@@ -2,11 +2,16 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/mian-qin/qqs/quotaservice/protos"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 // Client is a QuotaService client class, adding syntactic sugar over the raw gRPC calls.
@@ -83,6 +88,42 @@ func New(target string, opts ...grpc.DialOption) (*Client, error) {
 	return &Client{conn, quotaservice.NewQuotaServiceClient(conn)}, nil
 }
 
+// NewTLS creates a new client connected to a single server over TLS, configured by tlsConfig.
+// NewTLSConfig creates one from PEM files.
+func NewTLS(target string, tlsConfig *tls.Config, opts ...grpc.DialOption) (*Client, error) {
+	return New(target, append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))...)
+}
+
+// NewTLSConfig creates a TLS config trusting the CAs in caFile, or the system's CAs if it is empty.
+// If certFile and keyFile are set, their certificate is presented to servers requiring client
+// certificates.
+func NewTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %v", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
 // New creates a new client with context
 func NewWithContext(ctx context.Context, target string, opts ...grpc.DialOption) (*Client, error) {
 	conn, err := grpc.DialContext(ctx, target, opts...)
@@ -92,3 +133,21 @@ func NewWithContext(ctx context.Context, target string, opts ...grpc.DialOption)
 
 	return &Client{conn, quotaservice.NewQuotaServiceClient(conn)}, nil
 }
+
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity is false so tokens can also be sent to endpoints that don't serve TLS,
+// such as in tests. Tokens sent in plaintext can be read by anyone on the network.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// WithToken returns a grpc.DialOption authenticating every RPC with a token, for servers
+// authenticating callers with a token Authenticator.
+func WithToken(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(tokenCredentials(token))
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"io/ioutil"
 	"math"
 	"os"
 	"testing"
@@ -13,6 +14,8 @@ import (
 	qsgrpc "github.com/mian-qin/qqs/quotaservice/rpc/grpc"
 	"github.com/mian-qin/qqs/quotaservice/test/helpers"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const target = "localhost:10990"
@@ -101,3 +104,108 @@ func TestBlockingClient(t *testing.T) {
 	}
 
 }
+
+func TestClientAuth(t *testing.T) {
+	cfg := config.NewDefaultServiceConfig()
+	helpers.CheckError(t, config.AddNamespace(cfg, config.NewDefaultNamespaceConfig("payments")))
+	helpers.CheckError(t, config.AddNamespace(cfg, config.NewDefaultNamespaceConfig("orders")))
+
+	endpoint := qsgrpc.New("127.0.0.1:0", qsgrpc.WithAuth(qsgrpc.NewTokenAuthenticator(map[string]string{"s3cret": "checkout"}),
+		&qsgrpc.ACL{Allow: map[string][]string{"checkout": {"payments"}}}))
+
+	s := quotaservice.New(memory.NewBucketFactory(), config.NewMemoryConfig(cfg),
+		quotaservice.NewReaperConfigForTests(), 0, endpoint)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer func() { _, _ = s.Stop() }()
+	authTarget := endpoint.Addr()
+
+	client, err := New(authTarget, grpc.WithInsecure(), WithToken("s3cret"))
+	helpers.CheckError(t, err)
+	defer func() { _ = client.Close() }()
+
+	// Buckets are missing, but the call is permitted.
+	resp, err := client.Allow(&pb.AllowRequest{Namespace: "payments", BucketName: "b"})
+	helpers.CheckError(t, err)
+	if resp.Status != pb.AllowResponse_REJECTED_NO_BUCKET {
+		t.Errorf("Expected REJECTED_NO_BUCKET. Was %v", resp.Status)
+	}
+
+	resp, err = client.Allow(&pb.AllowRequest{Namespace: "orders", BucketName: "b"})
+	helpers.CheckError(t, err)
+	if resp.Status != pb.AllowResponse_REJECTED_PERMISSION_DENIED {
+		t.Errorf("Expected REJECTED_PERMISSION_DENIED. Was %v", resp.Status)
+	}
+
+	anonymous, err := New(authTarget, grpc.WithInsecure())
+	helpers.CheckError(t, err)
+	defer func() { _ = anonymous.Close() }()
+
+	if _, err := anonymous.Allow(&pb.AllowRequest{Namespace: "payments", BucketName: "b"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected an unauthenticated caller to be rejected. Got %v", err)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_test_tls")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ca := helpers.NewTestCA(t, dir)
+	serverCert, serverKey := ca.Issue(t, "localhost")
+	checkoutCert, checkoutKey := ca.Issue(t, "checkout")
+	batchCert, batchKey := ca.Issue(t, "batch")
+
+	cfg := config.NewDefaultServiceConfig()
+	cfg.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+
+	// Callers are identified by their client certificates.
+	endpoint := qsgrpc.New("127.0.0.1:0",
+		qsgrpc.WithTLS(serverCert, serverKey),
+		qsgrpc.WithClientCAs(ca.CertFile),
+		qsgrpc.WithAuth(qsgrpc.NewPeerCertAuthenticator(), &qsgrpc.ACL{Allow: map[string][]string{"checkout": {qsgrpc.Any}}}))
+
+	s := quotaservice.New(memory.NewBucketFactory(), config.NewMemoryConfig(cfg),
+		quotaservice.NewReaperConfigForTests(), 0, endpoint)
+	_, err = s.Start()
+	helpers.CheckError(t, err)
+	defer func() { _, _ = s.Stop() }()
+	tlsTarget := endpoint.Addr()
+
+	allow := func(certFile, keyFile string) (*pb.AllowResponse, error) {
+		tlsConfig, err := NewTLSConfig(ca.CertFile, certFile, keyFile)
+		helpers.CheckError(t, err)
+
+		client, err := NewTLS(tlsTarget, tlsConfig)
+		helpers.CheckError(t, err)
+		defer func() { _ = client.Close() }()
+
+		return client.Allow(&pb.AllowRequest{Namespace: "payments", BucketName: "b", TokensRequested: 1})
+	}
+
+	resp, err := allow(checkoutCert, checkoutKey)
+	helpers.CheckError(t, err)
+	if resp.Status != pb.AllowResponse_OK {
+		t.Errorf("Expected OK. Was %v", resp.Status)
+	}
+
+	resp, err = allow(batchCert, batchKey)
+	helpers.CheckError(t, err)
+	if resp.Status != pb.AllowResponse_REJECTED_PERMISSION_DENIED {
+		t.Errorf("Expected REJECTED_PERMISSION_DENIED. Was %v", resp.Status)
+	}
+
+	if _, err := allow("", ""); err == nil {
+		t.Error("Expected a client without a certificate to be rejected")
+	}
+
+	// Certificates from other CAs aren't trusted.
+	otherDir, err := ioutil.TempDir("", "qs_test_tls")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(otherDir) }()
+
+	otherCert, otherKey := helpers.NewTestCA(t, otherDir).Issue(t, "checkout")
+	if _, err := allow(otherCert, otherKey); err == nil {
+		t.Error("Expected a certificate from another CA to be rejected")
+	}
+}
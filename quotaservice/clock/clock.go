@@ -0,0 +1,41 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+// Package clock abstracts access to the current time, so components that depend on the passage of
+// time - token buckets and the bucket reaper - can be tested without sleeping.
+package clock
+
+import "time"
+
+// Clock tells the time, and creates tickers driven by that time.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// System is the Clock backed by the system's wall clock.
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return &systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t *systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,142 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// boostedBucket locates the bucket a boost applies to, or returns nil if it doesn't exist. The
+// global default bucket is in GlobalNamespace, and namespaces' default buckets and dynamic bucket
+// templates go by DefaultBucketName and DynamicBucketTemplateName.
+func boostedBucket(cfg *pbconfig.ServiceConfig, namespace, name string) *pbconfig.BucketConfig {
+	if namespace == GlobalNamespace {
+		if name != DefaultBucketName {
+			return nil
+		}
+
+		return cfg.GlobalDefaultBucket
+	}
+
+	ns := cfg.Namespaces[namespace]
+	if ns == nil {
+		return nil
+	}
+
+	switch name {
+	case DefaultBucketName:
+		return ns.DefaultBucket
+	case DynamicBucketTemplateName:
+		return ns.DynamicBucketTemplate
+	default:
+		return ns.Buckets[name]
+	}
+}
+
+// applyBoost overrides the fields of b set by a boost. Schedules don't apply to boosted buckets.
+func applyBoost(b *pbconfig.BucketConfig, boost *pbconfig.BucketBoost) {
+	c := boost.GetConfig()
+
+	if c.GetSize() != 0 {
+		b.Size = c.Size
+	}
+
+	if c.GetFillRate() != 0 {
+		b.FillRate = c.FillRate
+	}
+
+	if c.GetWaitTimeoutMillis() != 0 {
+		b.WaitTimeoutMillis = c.WaitTimeoutMillis
+	}
+
+	if c.GetMaxDebtMillis() != 0 {
+		b.MaxDebtMillis = c.MaxDebtMillis
+	}
+
+	if c.GetMaxTokensPerRequest() != 0 {
+		b.MaxTokensPerRequest = c.MaxTokensPerRequest
+	}
+
+	b.Schedule = nil
+}
+
+// applyBoosts applies every boost to the bucket it boosts. Boosts of buckets that don't exist are
+// ignored.
+func applyBoosts(cfg *pbconfig.ServiceConfig) {
+	for _, boost := range cfg.Boosts {
+		if b := boostedBucket(cfg, boost.GetNamespace(), boost.GetBucketName()); b != nil {
+			applyBoost(b, boost)
+		}
+	}
+}
+
+// AddBoost adds a boost to a config, replacing any existing boost of the same bucket.
+func AddBoost(clonedCfg *pbconfig.ServiceConfig, boost *pbconfig.BucketBoost) error {
+	if boostedBucket(clonedCfg, boost.Namespace, boost.BucketName) == nil {
+		return fmt.Errorf("No such bucket %v", FullyQualifiedName(boost.Namespace, boost.BucketName))
+	}
+
+	removeBoost(clonedCfg, boost.Namespace, boost.BucketName)
+	clonedCfg.Boosts = append(clonedCfg.Boosts, boost)
+
+	return nil
+}
+
+// DeleteBoost reverts the boost of a bucket before it expires.
+func DeleteBoost(clonedCfg *pbconfig.ServiceConfig, namespace, name string) error {
+	if !removeBoost(clonedCfg, namespace, name) {
+		return errors.New("No boost of bucket " + FullyQualifiedName(namespace, name))
+	}
+
+	return nil
+}
+
+// removeBoost removes the boost of a bucket, returning true if there was one.
+func removeBoost(clonedCfg *pbconfig.ServiceConfig, namespace, name string) bool {
+	return filterBoosts(clonedCfg, func(b *pbconfig.BucketBoost) bool {
+		return b.Namespace == namespace && b.BucketName == name
+	}) > 0
+}
+
+// ExpiredBoosts returns the boosts of a config that have expired by now.
+func ExpiredBoosts(cfg *pbconfig.ServiceConfig, now time.Time) []*pbconfig.BucketBoost {
+	var expired []*pbconfig.BucketBoost
+	for _, b := range cfg.Boosts {
+		if b.Expires <= now.Unix() {
+			expired = append(expired, b)
+		}
+	}
+
+	return expired
+}
+
+// RemoveExpiredBoosts removes the boosts of a config that have expired by now, returning how many
+// were removed.
+func RemoveExpiredBoosts(clonedCfg *pbconfig.ServiceConfig, now time.Time) int {
+	return filterBoosts(clonedCfg, func(b *pbconfig.BucketBoost) bool {
+		return b.Expires <= now.Unix()
+	})
+}
+
+// filterBoosts removes the boosts matching remove, returning how many were removed.
+func filterBoosts(clonedCfg *pbconfig.ServiceConfig, remove func(*pbconfig.BucketBoost) bool) int {
+	kept := make([]*pbconfig.BucketBoost, 0, len(clonedCfg.Boosts))
+	for _, b := range clonedCfg.Boosts {
+		if !remove(b) {
+			kept = append(kept, b)
+		}
+	}
+
+	removed := len(clonedCfg.Boosts) - len(kept)
+	if len(kept) == 0 {
+		kept = nil
+	}
+
+	clonedCfg.Boosts = kept
+	return removed
+}
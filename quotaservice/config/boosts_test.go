@@ -0,0 +1,149 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+var boostExpiry = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func boostedConfig(t *testing.T) *pbconfig.ServiceConfig {
+	// t.Helper()
+
+	cfg := NewDefaultServiceConfig()
+	cfg.GlobalDefaultBucket = NewDefaultBucketConfig(DefaultBucketName)
+	ns := NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, AddBucket(ns, NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, AddNamespace(cfg, ns))
+
+	helpers.CheckError(t, AddBoost(cfg, &pbconfig.BucketBoost{
+		Namespace:  "ns",
+		BucketName: "b",
+		Config:     &pbconfig.BucketConfig{Size: 1000, FillRate: 500},
+		Expires:    boostExpiry.Unix()}))
+
+	helpers.CheckError(t, AddBoost(cfg, &pbconfig.BucketBoost{
+		Namespace:  GlobalNamespace,
+		BucketName: DefaultBucketName,
+		Config:     &pbconfig.BucketConfig{FillRate: 1000},
+		Expires:    boostExpiry.Add(time.Hour).Unix()}))
+
+	return cfg
+}
+
+func TestAddBoost(t *testing.T) {
+	cfg := boostedConfig(t)
+
+	if err := AddBoost(cfg, &pbconfig.BucketBoost{Namespace: "ns", BucketName: "other"}); err == nil {
+		t.Error("Expected boosting a bucket that doesn't exist to fail")
+	}
+
+	if err := AddBoost(cfg, &pbconfig.BucketBoost{Namespace: "other", BucketName: DefaultBucketName}); err == nil {
+		t.Error("Expected boosting a namespace that doesn't exist to fail")
+	}
+
+	// Boosting a bucket again replaces its boost.
+	helpers.CheckError(t, AddBoost(cfg, &pbconfig.BucketBoost{
+		Namespace:  "ns",
+		BucketName: "b",
+		Config:     &pbconfig.BucketConfig{Size: 2000},
+		Expires:    boostExpiry.Unix()}))
+
+	if len(cfg.Boosts) != 2 || cfg.Boosts[1].Config.Size != 2000 {
+		t.Errorf("Expected the boost to be replaced, got %+v", cfg.Boosts)
+	}
+
+	helpers.CheckError(t, Validate(cfg))
+}
+
+func TestDeleteBoost(t *testing.T) {
+	cfg := boostedConfig(t)
+
+	helpers.CheckError(t, DeleteBoost(cfg, "ns", "b"))
+
+	if len(cfg.Boosts) != 1 || cfg.Boosts[0].Namespace != GlobalNamespace {
+		t.Errorf("Expected only the global default bucket's boost to remain, got %+v", cfg.Boosts)
+	}
+
+	if err := DeleteBoost(cfg, "ns", "b"); err == nil {
+		t.Error("Expected deleting a boost that doesn't exist to fail")
+	}
+
+	// Boosts are removed along with their bucket.
+	cfg = boostedConfig(t)
+	helpers.CheckError(t, DeleteBucket(cfg, "ns", "b"))
+
+	if len(cfg.Boosts) != 1 {
+		t.Errorf("Expected the deleted bucket's boost to be removed, got %+v", cfg.Boosts)
+	}
+}
+
+func TestRemoveExpiredBoosts(t *testing.T) {
+	cfg := boostedConfig(t)
+
+	if removed := RemoveExpiredBoosts(cfg, boostExpiry.Add(-time.Second)); removed != 0 {
+		t.Errorf("Expected no boosts to have expired, removed %v", removed)
+	}
+
+	if expired := ExpiredBoosts(cfg, boostExpiry); len(expired) != 1 || expired[0].BucketName != "b" {
+		t.Errorf("Expected the boost of ns:b to have expired, got %+v", expired)
+	}
+
+	if removed := RemoveExpiredBoosts(cfg, boostExpiry); removed != 1 || len(cfg.Boosts) != 1 {
+		t.Errorf("Expected one boost to be removed, removed %v leaving %+v", removed, cfg.Boosts)
+	}
+
+	if removed := RemoveExpiredBoosts(cfg, boostExpiry.Add(time.Hour)); removed != 1 || cfg.Boosts != nil {
+		t.Errorf("Expected the last boost to be removed, removed %v leaving %+v", removed, cfg.Boosts)
+	}
+}
+
+func TestEffectiveConfigBoosted(t *testing.T) {
+	cfg := boostedConfig(t)
+	cfg.Namespaces["ns"].Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", NotBefore: 1, Size: 10}}
+
+	effective, err := EffectiveConfig(cfg)
+	helpers.CheckError(t, err)
+
+	b := effective.Namespaces["ns"].Buckets["b"]
+	if b.Size != 1000 || b.FillRate != 500 || b.WaitTimeoutMillis != 1000 || len(b.Schedule) != 0 {
+		t.Errorf("Expected the boosted size and fill rate without a schedule, got %+v", b)
+	}
+
+	if d := effective.GlobalDefaultBucket; d.FillRate != 1000 || d.Size != 100 {
+		t.Errorf("Expected the boosted fill rate, got %+v", d)
+	}
+
+	if declared := cfg.Namespaces["ns"].Buckets["b"]; declared.Size != 100 || len(declared.Schedule) != 1 {
+		t.Errorf("Declared config was modified: %+v", declared)
+	}
+}
+
+func TestValidateInvalidBoosts(t *testing.T) {
+	for name, breaker := range map[string]func(*pbconfig.BucketBoost){
+		"no config":       func(b *pbconfig.BucketBoost) { b.Config = nil },
+		"no bucket name":  func(b *pbconfig.BucketBoost) { b.BucketName = "" },
+		"no expiry":       func(b *pbconfig.BucketBoost) { b.Expires = 0 },
+		"negative size":   func(b *pbconfig.BucketBoost) { b.Config.Size = -1 },
+		"too many tokens": func(b *pbconfig.BucketBoost) { b.Config.MaxTokensPerRequest = 1001 },
+		"boosted schedule": func(b *pbconfig.BucketBoost) {
+			b.Config.Schedule = []*pbconfig.ScheduleRule{{Name: "r", NotBefore: 1, Size: 10}}
+		},
+		"duplicate boost": func(b *pbconfig.BucketBoost) {
+			b.Namespace = GlobalNamespace
+			b.BucketName = DefaultBucketName
+		}} {
+		cfg := boostedConfig(t)
+		breaker(cfg.Boosts[0])
+
+		if Validate(cfg) == nil {
+			t.Errorf("Expected config with %v to be invalid", name)
+		}
+	}
+}
@@ -54,9 +54,21 @@ type DatastoreConfigPersister struct {
 	*config.Notifier
 	version     int
 	newVersions chan int
+	retention   config.RetentionPolicy
 }
 
 func (p *DatastoreConfigPersister) PersistAndNotify(r io.Reader) error {
+	return p.persist(r, nil)
+}
+
+// PersistIfVersion persists a configuration, provided the latest configuration is at the expected
+// version. As configurations are keyed by version, this fails with config.ErrConcurrentUpdate if any
+// configuration newer than the expected version has already been stored.
+func (p *DatastoreConfigPersister) PersistIfVersion(expected int32, r io.Reader) error {
+	return p.persist(r, &expected)
+}
+
+func (p *DatastoreConfigPersister) persist(r io.Reader, expected *int32) error {
 	// Persist...
 	b, e := ioutil.ReadAll(r)
 	if e != nil {
@@ -68,16 +80,31 @@ func (p *DatastoreConfigPersister) PersistAndNotify(r io.Reader) error {
 		return e
 	}
 
+	if expected != nil && cfg.Version <= *expected {
+		return fmt.Errorf("Attempting to write configuration with version %v, which isn't newer than the expected version %v.", cfg.Version, *expected)
+	}
+
 	s := &storedEntity{Contents: b,
 		Version: cfg.Version,
 		Date:    time.Unix(cfg.Date, 0),
 		User:    cfg.User,
 		Hash:    config.HashConfig(b)}
 
-	k := datastore.NameKey(p.entity, fmt.Sprintf("version:%v", cfg.Version), nil)
-	k.Namespace = p.namespace
+	k := p.key(cfg.Version)
 
 	_, e = p.client.RunInTransaction(context.Background(), func(tx *datastore.Transaction) error {
+		if expected != nil {
+			// Any version between the expected one and this one means someone else got there first.
+			for v := *expected + 1; v < cfg.Version; v++ {
+				e := tx.Get(p.key(v), &storedEntity{})
+				if e == nil {
+					return config.ErrConcurrentUpdate
+				} else if e != datastore.ErrNoSuchEntity {
+					return e
+				}
+			}
+		}
+
 		existing := &storedEntity{}
 		e := tx.Get(k, existing)
 		if e != nil && e != datastore.ErrNoSuchEntity {
@@ -86,6 +113,10 @@ func (p *DatastoreConfigPersister) PersistAndNotify(r io.Reader) error {
 
 		if e == nil {
 			if existing.Hash != s.Hash {
+				if expected != nil {
+					return config.ErrConcurrentUpdate
+				}
+
 				// Hashes don't match, likely to be a bug.
 				return fmt.Errorf("Attempting to write configuration with version %v and hash %v. Datastore already contains a configuration with the same version, with hash %v.", cfg.Version, s.Hash, existing.Hash)
 			}
@@ -107,12 +138,79 @@ func (p *DatastoreConfigPersister) PersistAndNotify(r io.Reader) error {
 		return e
 	}
 
+	// The stable version of a rollout this config stages is still served by most of the fleet.
+	retained := []*datastore.Key{k}
+	if stable, staged := config.StableVersion(cfg); staged {
+		retained = append(retained, p.key(stable))
+	}
+
+	if e := p.prune(retained...); e != nil {
+		logging.Printf("Unable to prune historical configurations: %v", e)
+	}
+
 	// ... and notify.
 	p.Notify()
 
 	return nil
 }
 
+// prune deletes configurations that aren't retained, other than the ones with the given keys.
+func (p *DatastoreConfigPersister) prune(retained ...*datastore.Key) error {
+	var queries []*datastore.Query
+
+	if p.retention.MaxVersions > 0 {
+		queries = append(queries, datastore.NewQuery(p.entity).
+			Namespace(p.namespace).
+			Order("-Version").
+			Offset(p.retention.MaxVersions).
+			KeysOnly())
+	}
+
+	if p.retention.MaxAge > 0 {
+		queries = append(queries, datastore.NewQuery(p.entity).
+			Namespace(p.namespace).
+			Filter("Date <", time.Now().Add(-p.retention.MaxAge)).
+			KeysOnly())
+	}
+
+	for _, q := range queries {
+		keys, e := p.client.GetAll(context.Background(), q, nil)
+		if e != nil {
+			return e
+		}
+
+		var expired []*datastore.Key
+		for _, k := range keys {
+			if !containsKey(retained, k) {
+				expired = append(expired, k)
+			}
+		}
+
+		if e := p.client.DeleteMulti(context.Background(), expired); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func containsKey(keys []*datastore.Key, k *datastore.Key) bool {
+	for _, key := range keys {
+		if key.Equal(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// key returns the key of the configuration with the given version.
+func (p *DatastoreConfigPersister) key(version int32) *datastore.Key {
+	k := datastore.NameKey(p.entity, fmt.Sprintf("version:%v", version), nil)
+	k.Namespace = p.namespace
+	return k
+}
+
 func (p *DatastoreConfigPersister) ConfigChangedWatcher() <-chan struct{} {
 	return p.Notifier.Watcher
 }
@@ -152,14 +250,23 @@ func (p *DatastoreConfigPersister) getLatest(keyOnly bool) (*datastore.Key, *sto
 	return keys[0], entities[0], nil
 }
 
-func (p *DatastoreConfigPersister) ReadHistoricalConfigs() ([]io.Reader, error) {
+// ReadHistoricalConfigs returns the configurations selected by page, newest first.
+func (p *DatastoreConfigPersister) ReadHistoricalConfigs(page config.HistoryPage) ([]io.Reader, error) {
 	var entities []*storedEntity
 
-	if _, e := p.client.GetAll(context.Background(),
-		datastore.NewQuery(p.entity).
-			Namespace(p.namespace).
-			Order("-Version"),
-		&entities); e != nil {
+	q := datastore.NewQuery(p.entity).
+		Namespace(p.namespace).
+		Order("-Version")
+
+	if page.Before > 0 {
+		q = q.Filter("Version <", page.Before)
+	}
+
+	if page.Limit > 0 {
+		q = q.Limit(page.Limit)
+	}
+
+	if _, e := p.client.GetAll(context.Background(), q, &entities); e != nil {
 		return nil, e
 	}
 
@@ -172,6 +279,61 @@ func (p *DatastoreConfigPersister) ReadHistoricalConfigs() ([]io.Reader, error)
 	return res, nil
 }
 
+// RewriteHistoricalConfigs replaces each configuration with the configuration rewrite returns for it,
+// if that is different. Configurations are keyed by version, so they are replaced under the same
+// key, failing with config.ErrConcurrentUpdate if a configuration changed meanwhile.
+func (p *DatastoreConfigPersister) RewriteHistoricalConfigs(rewrite func([]byte) ([]byte, error)) (int, error) {
+	var entities []*storedEntity
+
+	q := datastore.NewQuery(p.entity).
+		Namespace(p.namespace).
+		Order("-Version")
+
+	keys, e := p.client.GetAll(context.Background(), q, &entities)
+	if e != nil {
+		return 0, e
+	}
+
+	rewritten := 0
+
+	for i, s := range entities {
+		b, e := rewrite(s.Contents)
+		if e != nil {
+			return rewritten, e
+		}
+
+		if bytes.Equal(b, s.Contents) {
+			continue
+		}
+
+		oldHash := s.Hash
+		s.Contents = b
+		s.Hash = config.HashConfig(b)
+
+		_, e = p.client.RunInTransaction(context.Background(), func(tx *datastore.Transaction) error {
+			existing := &storedEntity{}
+			if e := tx.Get(keys[i], existing); e != nil {
+				return e
+			}
+
+			if existing.Hash != oldHash {
+				return config.ErrConcurrentUpdate
+			}
+
+			_, e := tx.Put(keys[i], s)
+			return e
+		})
+
+		if e != nil {
+			return rewritten, e
+		}
+
+		rewritten++
+	}
+
+	return rewritten, nil
+}
+
 func (p *DatastoreConfigPersister) poll(pollingDuration time.Duration) {
 	t := time.NewTicker(pollingDuration)
 	for {
@@ -199,6 +361,13 @@ func versionOf(k *datastore.Key) int {
 }
 
 func New(projectId, credentialsFile, namespace, entity string, pollingDuration time.Duration) (*DatastoreConfigPersister, error) {
+	return NewWithRetention(projectId, credentialsFile, namespace, entity, pollingDuration, config.KeepAll)
+}
+
+// NewWithRetention creates a DatastoreConfigPersister like New, which deletes configurations according
+// to retention whenever it persists a configuration.
+func NewWithRetention(projectId, credentialsFile, namespace, entity string, pollingDuration time.Duration,
+	retention config.RetentionPolicy) (*DatastoreConfigPersister, error) {
 	ctx := context.Background()
 	o := option.WithServiceAccountFile(credentialsFile)
 	client, err := datastore.NewClient(ctx, projectId, o)
@@ -213,7 +382,8 @@ func New(projectId, credentialsFile, namespace, entity string, pollingDuration t
 		entity:      entity,
 		client:      client,
 		Notifier:    config.NewNotifier(),
-		newVersions: make(chan int)}
+		newVersions: make(chan int),
+		retention:   retention}
 
 	go p.poll(pollingDuration)
 
@@ -63,7 +63,7 @@ func main() {
 
 	time.Sleep(time.Second * 10)
 
-	cfgs, e := dp.ReadHistoricalConfigs()
+	cfgs, e := dp.ReadHistoricalConfigs(config.AllHistory)
 	checkNoErrors(e)
 
 	for i, c := range cfgs {
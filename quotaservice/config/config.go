@@ -23,19 +23,24 @@ const (
 	GlobalNamespace           = "___GLOBAL___"
 	DefaultBucketName         = "___DEFAULT_BUCKET___"
 	DynamicBucketTemplateName = "___DYNAMIC_BUCKET_TPL___"
+	BucketDefaultsName        = "___BUCKET_DEFAULTS___"
 	initialVersion            = 0
 )
 
-func ApplyDefaults(sc *pb.ServiceConfig) {
+// ApplyDefaults fills in unset fields of a config, resolving it to the config that is served.
+// Unset fields of buckets are inherited from their namespace's bucket defaults, then from the
+// service's bucket defaults, and finally from ApplyBucketDefaults. Returns an error if a namespace
+// has both a default bucket and a dynamic bucket template.
+func ApplyDefaults(sc *pb.ServiceConfig) error {
 	if sc.GlobalDefaultBucket != nil {
-		ApplyBucketDefaults(sc.GlobalDefaultBucket)
+		applyInheritedDefaults(sc.GlobalDefaultBucket, sc.BucketDefaults)
 		sc.GlobalDefaultBucket.Name = DefaultBucketName
 	}
 
 	for name, ns := range sc.Namespaces {
 		ns.Name = name
 		if ns.DefaultBucket != nil && ns.DynamicBucketTemplate != nil {
-			panic(fmt.Sprintf("Namespace %v is not allowed to have a default bucket as well as allow dynamic buckets.", name))
+			return fmt.Errorf("Namespace %v is not allowed to have a default bucket as well as allow dynamic buckets.", name)
 		}
 
 		// Ensure the namespace's bucket map exists.
@@ -44,23 +49,72 @@ func ApplyDefaults(sc *pb.ServiceConfig) {
 		}
 
 		if ns.DefaultBucket != nil {
-			ApplyBucketDefaults(ns.DefaultBucket)
+			applyInheritedDefaults(ns.DefaultBucket, ns.BucketDefaults, sc.BucketDefaults)
 			ns.DefaultBucket.Name = DefaultBucketName
 			ns.DefaultBucket.Namespace = ns.Name
 		}
 
 		if ns.DynamicBucketTemplate != nil {
-			ApplyBucketDefaults(ns.DynamicBucketTemplate)
+			applyInheritedDefaults(ns.DynamicBucketTemplate, ns.BucketDefaults, sc.BucketDefaults)
 			ns.DynamicBucketTemplate.Name = DynamicBucketTemplateName
 			ns.DynamicBucketTemplate.Namespace = ns.Name
 		}
 
 		for n, b := range ns.Buckets {
-			ApplyBucketDefaults(b)
+			applyInheritedDefaults(b, ns.BucketDefaults, sc.BucketDefaults)
 			b.Name = n
 			b.Namespace = ns.Name
 		}
 	}
+
+	return nil
+}
+
+// EffectiveConfig returns a copy of a config with its boosts and defaults applied, as it is served.
+func EffectiveConfig(sc *pb.ServiceConfig) (*pb.ServiceConfig, error) {
+	effective := proto.Clone(sc).(*pb.ServiceConfig)
+	applyBoosts(effective)
+	if err := ApplyDefaults(effective); err != nil {
+		return nil, err
+	}
+
+	return effective, nil
+}
+
+// applyInheritedDefaults fills in unset fields of a bucket from each of defaults in turn, skipping
+// nil ones, and then from ApplyBucketDefaults.
+func applyInheritedDefaults(b *pb.BucketConfig, defaults ...*pb.BucketConfig) {
+	for _, d := range defaults {
+		if d == nil {
+			continue
+		}
+
+		if b.Size == 0 {
+			b.Size = d.Size
+		}
+
+		if b.FillRate == 0 {
+			b.FillRate = d.FillRate
+		}
+
+		if b.WaitTimeoutMillis == 0 {
+			b.WaitTimeoutMillis = d.WaitTimeoutMillis
+		}
+
+		if b.MaxIdleMillis == 0 {
+			b.MaxIdleMillis = d.MaxIdleMillis
+		}
+
+		if b.MaxDebtMillis == 0 {
+			b.MaxDebtMillis = d.MaxDebtMillis
+		}
+
+		if b.MaxTokensPerRequest == 0 {
+			b.MaxTokensPerRequest = d.MaxTokensPerRequest
+		}
+	}
+
+	ApplyBucketDefaults(b)
 }
 
 func NamespaceNames(sc *pb.ServiceConfig) []string {
@@ -76,6 +130,7 @@ func NamespaceNames(sc *pb.ServiceConfig) []string {
 	return names
 }
 
+// ApplyBucketDefaults fills in unset fields of a bucket with the service's built-in defaults.
 func ApplyBucketDefaults(b *pb.BucketConfig) {
 	if b.Size == 0 {
 		b.Size = 100
@@ -111,33 +166,66 @@ func FQN(b *pb.BucketConfig) string {
 	return FullyQualifiedName(b.Namespace, b.Name)
 }
 
-func ReadConfigFromFile(filename string) *pb.ServiceConfig {
+// ReadConfigFromFile reads a config from a YAML file, applying defaults. Returns an error if it can't
+// be read or is invalid.
+func ReadConfigFromFile(filename string) (*pb.ServiceConfig, error) {
 	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
-		panic(fmt.Sprintf("Unable to open file %v. Error: %v", filename, err))
+		return nil, fmt.Errorf("Unable to open file %v. Error: %v", filename, err)
 	}
 
 	return readConfigFromBytes(bytes)
 }
 
-func ReadConfig(yamlStream io.Reader) *pb.ServiceConfig {
+// ReadConfig reads a config from a YAML stream, applying defaults. Returns an error if it can't be
+// read or is invalid.
+func ReadConfig(yamlStream io.Reader) (*pb.ServiceConfig, error) {
 	bytes, err := ioutil.ReadAll(yamlStream)
 	if err != nil {
-		panic(fmt.Sprintf("Unable to open reader. Error: %v", err))
+		return nil, fmt.Errorf("Unable to open reader. Error: %v", err)
 	}
 
 	return readConfigFromBytes(bytes)
 }
 
-func readConfigFromBytes(bytes []byte) *pb.ServiceConfig {
+func readConfigFromBytes(bytes []byte) (*pb.ServiceConfig, error) {
+	cfg, err := FromYAML(bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ApplyDefaults(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// FromYAML parses a config from YAML, migrating it from its schema_version if that isn't current.
+// Defaults aren't applied, so buckets keep inheriting unset fields from bucket defaults; use
+// EffectiveConfig to resolve them.
+func FromYAML(y []byte) (*pb.ServiceConfig, error) {
 	cfg := NewDefaultServiceConfig()
 	cfg.GlobalDefaultBucket = nil
-	if err := yaml.Unmarshal(bytes, cfg); err != nil {
-		panic(fmt.Sprintf("Unable to read YAML. Error: %v", err))
+	cfg.SchemaVersion = 0
+	if err := yaml.Unmarshal(y, cfg); err != nil {
+		return nil, fmt.Errorf("Unable to read YAML. Error: %v", err)
+	}
+
+	if _, err := Migrate(cfg); err != nil {
+		return nil, err
 	}
 
-	ApplyDefaults(cfg)
-	return cfg
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ToYAML renders a config as YAML, which FromYAML reads back.
+func ToYAML(cfg *pb.ServiceConfig) ([]byte, error) {
+	return yaml.Marshal(cfg)
 }
 
 func NewDefaultServiceConfig() *pb.ServiceConfig {
@@ -146,7 +234,8 @@ func NewDefaultServiceConfig() *pb.ServiceConfig {
 		Namespaces:          make(map[string]*pb.NamespaceConfig),
 		User:                "quotaservice",
 		Date:                time.Now().Unix(),
-		Version:             initialVersion}
+		Version:             initialVersion,
+		SchemaVersion:       CurrentSchemaVersion}
 }
 
 func NewDefaultNamespaceConfig(name string) *pb.NamespaceConfig {
@@ -268,7 +357,8 @@ func DifferentBucketConfigs(c1, c2 *pb.BucketConfig) bool {
 		c1.WaitTimeoutMillis != c2.WaitTimeoutMillis ||
 		c1.MaxIdleMillis != c2.MaxIdleMillis ||
 		c1.MaxDebtMillis != c2.MaxDebtMillis ||
-		c1.MaxTokensPerRequest != c2.MaxTokensPerRequest
+		c1.MaxTokensPerRequest != c2.MaxTokensPerRequest ||
+		!SameSchedule(c1.Schedule, c2.Schedule)
 }
 
 func DifferentNamespaceConfigs(c1, c2 *pb.NamespaceConfig) bool {
@@ -38,7 +38,8 @@ const cfgYaml = `namespaces:
 `
 
 func TestConfig(t *testing.T) {
-	cfg := ReadConfig(strings.NewReader(cfgYaml))
+	cfg, err := ReadConfig(strings.NewReader(cfgYaml))
+	helpers.CheckError(t, err)
 
 	if cfg.GlobalDefaultBucket != nil {
 		t.Fatal("Did not configure a global default bucket")
@@ -132,8 +133,93 @@ func assertBucket(t *testing.T, name, namespace string, b *pbconfig.BucketConfig
 	}
 }
 
+func TestBucketDefaults(t *testing.T) {
+	cfg, err := FromYAML([]byte(`bucket_defaults:
+  max_debt_millis: 20000
+  max_idle_millis: 60000
+global_default_bucket:
+  size: 10
+namespaces:
+  with_defaults:
+    bucket_defaults:
+      wait_timeout_millis: 5000
+      max_tokens_per_request: 10
+    buckets:
+      inherits:
+        fill_rate: 30
+      overrides:
+        wait_timeout_millis: 100
+        max_debt_millis: 200
+        max_tokens_per_request: 20
+  without_defaults:
+    dynamic_bucket_template:
+      size: 300
+`))
+	helpers.CheckError(t, err)
+
+	// Defaults aren't applied to the config as declared...
+	if cfg.Namespaces["with_defaults"].Buckets["inherits"].WaitTimeoutMillis != 0 {
+		t.Fatalf("Expected inherited fields to be unset: %+v", cfg)
+	}
+
+	// ... but are in the effective config.
+	effective, err := EffectiveConfig(cfg)
+	helpers.CheckError(t, err)
+
+	if cfg.Namespaces["with_defaults"].Buckets["inherits"].WaitTimeoutMillis != 0 {
+		t.Fatalf("EffectiveConfig should not change the config: %+v", cfg)
+	}
+
+	ns := effective.Namespaces["with_defaults"]
+	assertBucket(t, DefaultBucketName, "", effective.GlobalDefaultBucket, 10, 50, 1000, 60000, 20000, 50)
+	assertBucket(t, "inherits", "with_defaults", ns.Buckets["inherits"], 100, 30, 5000, 60000, 20000, 10)
+	assertBucket(t, "overrides", "with_defaults", ns.Buckets["overrides"], 100, 50, 100, 60000, 200, 20)
+
+	ns = effective.Namespaces["without_defaults"]
+	assertBucket(t, DynamicBucketTemplateName, "without_defaults", ns.DynamicBucketTemplate, 300, 50, 1000, 60000, 20000, 50)
+}
+
 func TestNonexistentFile(t *testing.T) {
-	helpers.ExpectingPanic(t, func() {
-		_ = ReadConfigFromFile("/does/not/exist")
-	})
+	if _, err := ReadConfigFromFile("/does/not/exist"); err == nil {
+		t.Fatal("Expected a nonexistent file to fail")
+	}
+}
+
+func TestReadInvalidConfig(t *testing.T) {
+	if _, err := ReadConfig(strings.NewReader("global_default_bucket:\n  size: -1\n")); err == nil {
+		t.Fatal("Expected an invalid config to fail")
+	}
+}
+
+func TestApplyDefaultsRejectsDefaultAndDynamicBuckets(t *testing.T) {
+	cfg := NewDefaultServiceConfig()
+	ns := NewDefaultNamespaceConfig("ns")
+	ns.DefaultBucket = NewDefaultBucketConfig("")
+	ns.DynamicBucketTemplate = NewDefaultBucketConfig("")
+	cfg.Namespaces["ns"] = ns
+
+	if err := ApplyDefaults(cfg); err == nil {
+		t.Fatal("Expected a namespace with a default bucket and dynamic buckets to fail")
+	}
+
+	if _, err := EffectiveConfig(cfg); err == nil {
+		t.Fatal("Expected the effective config of an invalid config to fail")
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	cfg, err := FromYAML([]byte(cfgYaml))
+	helpers.CheckError(t, err)
+
+	if len(cfg.Namespaces) == 0 {
+		t.Fatalf("Expected namespaces to be read, got %+v", cfg)
+	}
+
+	if _, err := FromYAML([]byte("namespaces: [")); err == nil {
+		t.Fatal("Expected invalid YAML to fail")
+	}
+
+	if _, err := FromYAML([]byte("global_default_bucket:\n  size: -1\n")); err == nil {
+		t.Fatal("Expected an invalid config to fail")
+	}
 }
@@ -0,0 +1,188 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// ConfigDiff describes what changed between two versions of a service config. Buckets are
+// identified by their fully qualified names, including default buckets, dynamic bucket templates
+// and bucket defaults.
+type ConfigDiff struct {
+	FromVersion       int32          `json:"from_version"`
+	ToVersion         int32          `json:"to_version"`
+	NamespacesAdded   []string       `json:"namespaces_added,omitempty"`
+	NamespacesRemoved []string       `json:"namespaces_removed,omitempty"`
+	BucketsAdded      []string       `json:"buckets_added,omitempty"`
+	BucketsRemoved    []string       `json:"buckets_removed,omitempty"`
+	Changes           []*FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is a change to a single field of a namespace, or of a bucket if Bucket is set. A
+// change to a bucket's schedule is reported as its number of rules.
+type FieldChange struct {
+	Namespace string `json:"namespace"`
+	Bucket    string `json:"bucket,omitempty"`
+	Field     string `json:"field"`
+	From      int64  `json:"from"`
+	To        int64  `json:"to"`
+}
+
+// bucketFields are the fields compared by DifferentBucketConfigs, other than names.
+var bucketFields = []struct {
+	name  string
+	value func(*pbconfig.BucketConfig) int64
+}{
+	{"size", func(b *pbconfig.BucketConfig) int64 { return b.Size }},
+	{"fill_rate", func(b *pbconfig.BucketConfig) int64 { return b.FillRate }},
+	{"wait_timeout_millis", func(b *pbconfig.BucketConfig) int64 { return b.WaitTimeoutMillis }},
+	{"max_idle_millis", func(b *pbconfig.BucketConfig) int64 { return b.MaxIdleMillis }},
+	{"max_debt_millis", func(b *pbconfig.BucketConfig) int64 { return b.MaxDebtMillis }},
+	{"max_tokens_per_request", func(b *pbconfig.BucketConfig) int64 { return b.MaxTokensPerRequest }},
+}
+
+// Diff returns the differences between two configs.
+func Diff(from, to *pbconfig.ServiceConfig) *ConfigDiff {
+	d := &ConfigDiff{FromVersion: from.Version, ToVersion: to.Version}
+
+	d.diffBucket(GlobalNamespace, BucketDefaultsName, from.BucketDefaults, to.BucketDefaults)
+	d.diffBucket(GlobalNamespace, DefaultBucketName, from.GlobalDefaultBucket, to.GlobalDefaultBucket)
+
+	for _, name := range sortedNamespaceNames(from, to) {
+		fromNs, toNs := from.Namespaces[name], to.Namespaces[name]
+
+		switch {
+		case toNs == nil:
+			d.NamespacesRemoved = append(d.NamespacesRemoved, name)
+		case fromNs == nil:
+			d.NamespacesAdded = append(d.NamespacesAdded, name)
+		default:
+			d.diffNamespace(name, fromNs, toNs)
+		}
+	}
+
+	return d
+}
+
+func (d *ConfigDiff) diffNamespace(name string, from, to *pbconfig.NamespaceConfig) {
+	if from.MaxDynamicBuckets != to.MaxDynamicBuckets {
+		d.Changes = append(d.Changes, &FieldChange{
+			Namespace: name,
+			Field:     "max_dynamic_buckets",
+			From:      int64(from.MaxDynamicBuckets),
+			To:        int64(to.MaxDynamicBuckets)})
+	}
+
+	d.diffBucket(name, BucketDefaultsName, from.BucketDefaults, to.BucketDefaults)
+	d.diffBucket(name, DefaultBucketName, from.DefaultBucket, to.DefaultBucket)
+	d.diffBucket(name, DynamicBucketTemplateName, from.DynamicBucketTemplate, to.DynamicBucketTemplate)
+
+	names := make([]string, 0, len(from.Buckets)+len(to.Buckets))
+	for n := range from.Buckets {
+		names = append(names, n)
+	}
+
+	for n := range to.Buckets {
+		if _, exists := from.Buckets[n]; !exists {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, n := range names {
+		d.diffBucket(name, n, from.Buckets[n], to.Buckets[n])
+	}
+}
+
+func (d *ConfigDiff) diffBucket(namespace, name string, from, to *pbconfig.BucketConfig) {
+	switch {
+	case from == nil && to == nil:
+		return
+	case to == nil:
+		d.BucketsRemoved = append(d.BucketsRemoved, FullyQualifiedName(namespace, name))
+	case from == nil:
+		d.BucketsAdded = append(d.BucketsAdded, FullyQualifiedName(namespace, name))
+	default:
+		for _, f := range bucketFields {
+			if f.value(from) != f.value(to) {
+				d.Changes = append(d.Changes, &FieldChange{
+					Namespace: namespace,
+					Bucket:    name,
+					Field:     f.name,
+					From:      f.value(from),
+					To:        f.value(to)})
+			}
+		}
+
+		if !SameSchedule(from.Schedule, to.Schedule) {
+			d.Changes = append(d.Changes, &FieldChange{
+				Namespace: namespace,
+				Bucket:    name,
+				Field:     "schedule",
+				From:      int64(len(from.Schedule)),
+				To:        int64(len(to.Schedule))})
+		}
+	}
+}
+
+func sortedNamespaceNames(from, to *pbconfig.ServiceConfig) []string {
+	names := NamespaceNames(from)
+	for n := range to.Namespaces {
+		if _, exists := from.Namespaces[n]; !exists {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Empty returns true if there are no differences.
+func (d *ConfigDiff) Empty() bool {
+	return len(d.NamespacesAdded) == 0 && len(d.NamespacesRemoved) == 0 &&
+		len(d.BucketsAdded) == 0 && len(d.BucketsRemoved) == 0 && len(d.Changes) == 0
+}
+
+// String returns a human-readable representation of the diff, one change per line.
+func (d *ConfigDiff) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Config version %v -> %v\n", d.FromVersion, d.ToVersion)
+
+	if d.Empty() {
+		b.WriteString("No changes\n")
+		return b.String()
+	}
+
+	for _, n := range d.NamespacesAdded {
+		fmt.Fprintf(&b, "+ namespace %v\n", n)
+	}
+
+	for _, n := range d.NamespacesRemoved {
+		fmt.Fprintf(&b, "- namespace %v\n", n)
+	}
+
+	for _, n := range d.BucketsAdded {
+		fmt.Fprintf(&b, "+ bucket %v\n", n)
+	}
+
+	for _, n := range d.BucketsRemoved {
+		fmt.Fprintf(&b, "- bucket %v\n", n)
+	}
+
+	for _, c := range d.Changes {
+		if c.Bucket == "" {
+			fmt.Fprintf(&b, "~ namespace %v %v: %v -> %v\n", c.Namespace, c.Field, c.From, c.To)
+		} else {
+			fmt.Fprintf(&b, "~ bucket %v %v: %v -> %v\n", FullyQualifiedName(c.Namespace, c.Bucket), c.Field, c.From, c.To)
+		}
+	}
+
+	return b.String()
+}
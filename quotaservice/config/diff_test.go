@@ -0,0 +1,106 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestDiff(t *testing.T) {
+	from := NewDefaultServiceConfig()
+	from.Version = 1
+	changed := NewDefaultNamespaceConfig("changed")
+	helpers.CheckError(t, AddBucket(changed, NewDefaultBucketConfig("resized")))
+	helpers.CheckError(t, AddBucket(changed, NewDefaultBucketConfig("removed")))
+	helpers.CheckError(t, AddNamespace(from, changed))
+	helpers.CheckError(t, AddNamespace(from, NewDefaultNamespaceConfig("removed")))
+
+	to := NewDefaultServiceConfig()
+	to.Version = 2
+	to.GlobalDefaultBucket = NewDefaultBucketConfig(DefaultBucketName)
+	changed = NewDefaultNamespaceConfig("changed")
+	changed.MaxDynamicBuckets = 10
+	resized := NewDefaultBucketConfig("resized")
+	resized.Size = 200
+	helpers.CheckError(t, AddBucket(changed, resized))
+	helpers.CheckError(t, AddBucket(changed, NewDefaultBucketConfig("added")))
+	helpers.CheckError(t, AddNamespace(to, changed))
+	helpers.CheckError(t, AddNamespace(to, NewDefaultNamespaceConfig("added")))
+
+	expected := &ConfigDiff{
+		FromVersion:       1,
+		ToVersion:         2,
+		NamespacesAdded:   []string{"added"},
+		NamespacesRemoved: []string{"removed"},
+		BucketsAdded:      []string{"___GLOBAL___:___DEFAULT_BUCKET___", "changed:added"},
+		BucketsRemoved:    []string{"changed:removed"},
+		Changes: []*FieldChange{
+			{Namespace: "changed", Field: "max_dynamic_buckets", From: 0, To: 10},
+			{Namespace: "changed", Bucket: "resized", Field: "size", From: 100, To: 200}}}
+
+	d := Diff(from, to)
+
+	if !reflect.DeepEqual(expected, d) {
+		t.Fatalf("Expected diff %+v, got %+v", expected, d)
+	}
+
+	if d.String() != `Config version 1 -> 2
++ namespace added
+- namespace removed
++ bucket ___GLOBAL___:___DEFAULT_BUCKET___
++ bucket changed:added
+- bucket changed:removed
+~ namespace changed max_dynamic_buckets: 0 -> 10
+~ bucket changed:resized size: 100 -> 200
+` {
+		t.Errorf("Unexpected human-readable diff:\n%v", d)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	cfg := NewDefaultServiceConfig()
+	helpers.CheckError(t, AddNamespace(cfg, NewDefaultNamespaceConfig("ns")))
+
+	if d := Diff(cfg, cfg); !d.Empty() {
+		t.Fatalf("Expected no differences, got %+v", d)
+	}
+}
+
+func TestDiffBucketDefaults(t *testing.T) {
+	from := NewDefaultServiceConfig()
+	ns := NewDefaultNamespaceConfig("ns")
+	ns.BucketDefaults = &pbconfig.BucketConfig{MaxDebtMillis: 1000}
+	helpers.CheckError(t, AddBucket(ns, &pbconfig.BucketConfig{Name: "b"}))
+	helpers.CheckError(t, AddNamespace(from, ns))
+
+	to := proto.Clone(from).(*pbconfig.ServiceConfig)
+	to.Namespaces["ns"].BucketDefaults.MaxDebtMillis = 2000
+
+	// Declared configs only differ in the defaults ...
+	expected := []*FieldChange{
+		{Namespace: "ns", Bucket: BucketDefaultsName, Field: "max_debt_millis", From: 1000, To: 2000}}
+
+	if d := Diff(from, to); !reflect.DeepEqual(expected, d.Changes) {
+		t.Errorf("Expected changes %+v, got %+v", expected, d.Changes)
+	}
+
+	// ... while effective configs also differ in the buckets inheriting them.
+	expected = append(expected,
+		&FieldChange{Namespace: "ns", Bucket: "b", Field: "max_debt_millis", From: 1000, To: 2000})
+
+	effectiveFrom, err := EffectiveConfig(from)
+	helpers.CheckError(t, err)
+	effectiveTo, err := EffectiveConfig(to)
+	helpers.CheckError(t, err)
+
+	if d := Diff(effectiveFrom, effectiveTo); !reflect.DeepEqual(expected, d.Changes) {
+		t.Errorf("Expected changes %+v, got %+v", expected, d.Changes)
+	}
+}
@@ -4,21 +4,46 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
 )
 
-// DiskConfigPersister is a ConfigPersister that saves configs to the local filesystem.
+// DiskConfigPersister is a ConfigPersister that saves configs to the local filesystem. The location
+// is a symlink to the current config, and is watched so changes made by others, such as a
+// configuration management tool rewriting the file or swapping the symlink, are noticed too.
+// Besides marshalled configs, the location may hold (or link to) a YAML config file, with a .yaml or
+// .yml extension.
 type DiskConfigPersister struct {
-	location string
+	location  string
+	retention RetentionPolicy
 	*Notifier
+
+	// Hash of the contents of the location when it was last read or written, so changes are only
+	// notified once.
+	hash string
+
+	watcher *diskWatcher
+
+	// Serializes writes, so PersistIfVersion can check the current version and persist atomically
+	// with respect to other writers sharing this persister.
+	mu sync.Mutex
 }
 
 // NewDiskConfigPersister creates a new DiskConfigPersister
 func NewDiskConfigPersister(location string) (ConfigPersister, error) {
+	return NewDiskConfigPersisterWithRetention(location, KeepAll)
+}
+
+// NewDiskConfigPersisterWithRetention creates a new DiskConfigPersister that removes historical
+// config files according to retention.
+func NewDiskConfigPersisterWithRetention(location string, retention RetentionPolicy) (ConfigPersister, error) {
 	_, e := os.Stat(location)
 	// This will catch nonexistent paths, as well as passing in a directory instead of a file.
 	// Nonexistent files in an existing path, however, is allowed.
@@ -26,7 +51,17 @@ func NewDiskConfigPersister(location string) (ConfigPersister, error) {
 		return nil, e
 	}
 
-	d := &DiskConfigPersister{location, NewNotifier()}
+	d := &DiskConfigPersister{location: location, retention: retention, Notifier: NewNotifier()}
+
+	if b, e := ioutil.ReadFile(location); e == nil {
+		d.hash = HashConfig(b)
+	}
+
+	d.watcher, e = newDiskWatcher(location, d.reloadIfChanged)
+
+	if e != nil {
+		return nil, e
+	}
 
 	// Notify that we're available for reading
 	d.Notify()
@@ -34,6 +69,26 @@ func NewDiskConfigPersister(location string) (ConfigPersister, error) {
 	return d, nil
 }
 
+// reloadIfChanged notifies of a new config if the contents of the location have changed since they
+// were last read or written.
+func (d *DiskConfigPersister) reloadIfChanged() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, e := ioutil.ReadFile(d.location)
+
+	if e != nil && !os.IsNotExist(e) {
+		logging.Printf("Unable to read config from %v: %v", d.location, e)
+		return
+	}
+
+	if hash := HashConfig(b); hash != d.hash {
+		logging.Printf("Config in %v changed", d.location)
+		d.hash = hash
+		d.Notify()
+	}
+}
+
 func writeFile(path string, bytes []byte) error {
 	f, e := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.ModePerm)
 	if e != nil {
@@ -54,8 +109,46 @@ func (d *DiskConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error
 		return e
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.persistLocked(b)
+}
+
+// PersistIfVersion persists a marshalled configuration passed in, provided the current config is at
+// the expected version.
+func (d *DiskConfigPersister) PersistIfVersion(expected int32, marshalledConfig io.Reader) error {
+	b, e := ioutil.ReadAll(marshalledConfig)
+
+	if e != nil {
+		return e
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, e := d.readCurrent()
+
+	if e != nil && !os.IsNotExist(e) {
+		return e
+	}
+
+	version, e := versionOf(current)
+
+	if e != nil {
+		return e
+	}
+
+	if version != expected {
+		return ErrConcurrentUpdate
+	}
+
+	return d.persistLocked(b)
+}
+
+func (d *DiskConfigPersister) persistLocked(b []byte) error {
 	path := fmt.Sprintf("%s-%s", d.location, HashConfig(b))
-	e = writeFile(path, b)
+	e := writeFile(path, b)
 
 	if e != nil {
 		return e
@@ -75,6 +168,12 @@ func (d *DiskConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error
 		return e
 	}
 
+	d.hash = HashConfig(b)
+
+	if e := d.pruneLocked(path); e != nil {
+		logging.Printf("Unable to prune historical configs in %v: %v", d.location, e)
+	}
+
 	// ... and notify
 	d.Notify()
 
@@ -83,32 +182,118 @@ func (d *DiskConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error
 
 // ReadPersistedConfig provides a reader to a marshalled config previously persisted.
 func (d *DiskConfigPersister) ReadPersistedConfig() (io.Reader, error) {
-	return os.Open(d.location)
+	b, e := d.readCurrent()
+
+	if e != nil {
+		return nil, e
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// readCurrent reads the marshalled config at the location, converting it from YAML if the file it
+// resolves to has a YAML extension.
+func (d *DiskConfigPersister) readCurrent() ([]byte, error) {
+	b, e := ioutil.ReadFile(d.location)
+
+	if e != nil {
+		return nil, e
+	}
+
+	target, e := filepath.EvalSymlinks(d.location)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if ext := filepath.Ext(target); ext != ".yaml" && ext != ".yml" {
+		return b, nil
+	}
+
+	cfg, e := FromYAML(b)
+
+	if e != nil {
+		return nil, fmt.Errorf("Unable to read config from %v: %v", target, e)
+	}
+
+	r, e := Marshal(cfg)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// pruneLocked removes historical config files that aren't retained, other than current.
+func (d *DiskConfigPersister) pruneLocked(current string) error {
+	if d.retention == KeepAll {
+		return nil
+	}
+
+	configs, e := d.readAll()
+
+	if e != nil {
+		return e
+	}
+
+	expired, e := d.retention.prune(configs, current)
+
+	if e != nil {
+		return e
+	}
+
+	for _, path := range expired {
+		if e := os.Remove(path); e != nil {
+			return e
+		}
+	}
+
+	return nil
 }
 
-// ReadHistoricalConfigs returns an array of previously persisted configs
-func (d *DiskConfigPersister) ReadHistoricalConfigs() ([]io.Reader, error) {
+// readAll reads all historical config files, keyed by path.
+func (d *DiskConfigPersister) readAll() (map[string][]byte, error) {
 	files, err := filepath.Glob(fmt.Sprintf("%s-*", d.location))
 
 	if err != nil {
 		return nil, err
 	}
 
-	configs := make([]io.Reader, len(files))
+	configs := make(map[string][]byte, len(files))
 
-	for i, file := range files {
-		reader, e := os.Open(file)
+	for _, file := range files {
+		b, e := ioutil.ReadFile(file)
 
 		if e != nil {
 			return nil, e
 		}
 
-		configs[i] = reader
+		configs[file] = b
 	}
 
 	return configs, nil
 }
 
+// ReadHistoricalConfigs returns an array of previously persisted configs selected by page, newest
+// first.
+func (d *DiskConfigPersister) ReadHistoricalConfigs(page HistoryPage) ([]io.Reader, error) {
+	d.mu.Lock()
+	configs, err := d.readAll()
+	d.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readHistory(configs, page)
+}
+
+// Close stops watching the location for changes.
+func (d *DiskConfigPersister) Close() {
+	d.watcher.close()
+}
+
 // ConfigChangedWatcher returns a channel that is notified whenever configuration changes are
 // detected. Changes are coalesced so that a single notification may be emitted for multiple
 // changes.
@@ -4,8 +4,12 @@
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
 	"github.com/mian-qin/qqs/quotaservice/test/helpers"
@@ -14,6 +18,7 @@ import (
 func TestDiskPersistence(t *testing.T) {
 	persister, e := NewDiskConfigPersister("/tmp/qs_test_persistence")
 	helpers.CheckError(t, e)
+	defer persister.(*DiskConfigPersister).Close()
 
 	select {
 	case <-persister.ConfigChangedWatcher():
@@ -57,7 +62,7 @@ func TestDiskPersistence(t *testing.T) {
 		t.Fatalf("Configs should be equal! %+v != %+v", s, unmarshalled)
 	}
 
-	cfgs, e := persister.ReadHistoricalConfigs()
+	cfgs, e := persister.ReadHistoricalConfigs(AllHistory)
 	helpers.CheckError(t, e)
 
 	if len(cfgs) != 1 {
@@ -71,3 +76,92 @@ func TestDiskPersistence(t *testing.T) {
 		t.Fatalf("Configs should be equal! %+v != %+v", s, unmarshalled)
 	}
 }
+
+func TestDiskPersistIfVersion(t *testing.T) {
+	dir, e := ioutil.TempDir("", "qs_test_persistence")
+	helpers.CheckError(t, e)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	persister, e := NewDiskConfigPersister(filepath.Join(dir, "config"))
+	helpers.CheckError(t, e)
+	defer persister.(*DiskConfigPersister).Close()
+	<-persister.ConfigChangedWatcher()
+
+	testPersistIfVersion(t, persister)
+}
+
+func TestDiskRetention(t *testing.T) {
+	dir, e := ioutil.TempDir("", "qs_test_persistence")
+	helpers.CheckError(t, e)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	location := filepath.Join(dir, "config")
+	persister, e := NewDiskConfigPersisterWithRetention(location, RetentionPolicy{MaxVersions: 2})
+	helpers.CheckError(t, e)
+	defer persister.(*DiskConfigPersister).Close()
+	<-persister.ConfigChangedWatcher()
+
+	testRetention(t, persister)
+
+	files, e := filepath.Glob(location + "-*")
+	helpers.CheckError(t, e)
+
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 config files to be retained, got %v", files)
+	}
+}
+
+func TestDiskExternalChanges(t *testing.T) {
+	dir, e := ioutil.TempDir("", "qs_test_persistence")
+	helpers.CheckError(t, e)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	location := filepath.Join(dir, "config")
+	persister, e := NewDiskConfigPersister(location)
+	helpers.CheckError(t, e)
+	defer persister.(*DiskConfigPersister).Close()
+	<-persister.ConfigChangedWatcher()
+
+	// A deploy swaps the symlink for one to a YAML file in another directory.
+	releaseDir := filepath.Join(dir, "release")
+	helpers.CheckError(t, os.Mkdir(releaseDir, os.ModePerm))
+	yamlFile := filepath.Join(releaseDir, "quotas.yaml")
+	helpers.CheckError(t, ioutil.WriteFile(yamlFile, []byte("version: 3\nnamespaces:\n  foo: {}\n"), os.ModePerm))
+	helpers.CheckError(t, os.Symlink(yamlFile, location))
+
+	waitForNotification(t, persister)
+	checkDiskNamespace(t, persister, "foo")
+
+	// A configuration management tool rewrites the file it links to.
+	helpers.CheckError(t, ioutil.WriteFile(yamlFile, []byte("version: 4\nnamespaces:\n  bar: {}\n"), os.ModePerm))
+
+	waitForNotification(t, persister)
+	checkDiskNamespace(t, persister, "bar")
+
+	// Changes made through the persister are only notified once.
+	cfg := NewDefaultServiceConfig()
+	cfg.Version = 5
+	r, e := Marshal(cfg)
+	helpers.CheckError(t, e)
+	helpers.CheckError(t, persister.PersistIfVersion(4, r))
+	waitForNotification(t, persister)
+
+	select {
+	case <-persister.ConfigChangedWatcher():
+		t.Fatal("Received a second notification for the same change")
+	case <-time.After(diskWatchDebounce * 3):
+	}
+}
+
+func checkDiskNamespace(t *testing.T, p ConfigPersister, namespace string) {
+	// t.Helper()
+
+	r, e := p.ReadPersistedConfig()
+	helpers.CheckError(t, e)
+	cfg, e := Unmarshal(r)
+	helpers.CheckError(t, e)
+
+	if cfg.Namespaces[namespace] == nil {
+		t.Fatalf("Expected namespace %v in %+v", namespace, cfg)
+	}
+}
@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+)
+
+// diskWatchDebounce is how long changes to a watched file need to settle for, before they're acted
+// upon. Tools rewriting files often do so in several steps.
+const diskWatchDebounce = 100 * time.Millisecond
+
+// diskWatcher watches a file for changes, calling a function once changes settle. Rather than the
+// file itself, the directories holding it and the file it links to are watched, so changes are
+// noticed even if the file is replaced, or the link is swapped for one to somewhere else. Since any
+// change in those directories is acted upon, the function should check whether the file actually
+// changed.
+type diskWatcher struct {
+	location string
+	onChange func()
+	watcher  *fsnotify.Watcher
+
+	// Directories currently being watched
+	dirs map[string]bool
+
+	wg sync.WaitGroup
+}
+
+func newDiskWatcher(location string, onChange func()) (*diskWatcher, error) {
+	location, err := filepath.Abs(location)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &diskWatcher{
+		location: location,
+		onChange: onChange,
+		watcher:  watcher,
+		dirs:     make(map[string]bool)}
+
+	if err := w.updateWatches(); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.waitForEvents()
+
+	return w, nil
+}
+
+// updateWatches watches the directories holding the location and the file it currently links to,
+// and stops watching any others. The directory holding the location must exist.
+func (w *diskWatcher) updateWatches() error {
+	dirs := map[string]bool{filepath.Dir(w.location): true}
+
+	// The location may not exist yet, or link to a file that doesn't.
+	if target, err := filepath.EvalSymlinks(w.location); err == nil {
+		dirs[filepath.Dir(target)] = true
+	}
+
+	for dir := range dirs {
+		if !w.dirs[dir] {
+			if err := w.watcher.Add(dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	for dir := range w.dirs {
+		if !dirs[dir] {
+			// Fails if the directory was removed, in which case it is no longer watched anyway.
+			_ = w.watcher.Remove(dir)
+		}
+	}
+
+	w.dirs = dirs
+	return nil
+}
+
+func (w *diskWatcher) waitForEvents() {
+	defer w.wg.Done()
+
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case _, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			settled = time.After(diskWatchDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			logging.Printf("Received error watching %v: %v", w.location, err)
+		case <-settled:
+			settled = nil
+
+			if err := w.updateWatches(); err != nil {
+				logging.Printf("Unable to watch %v: %v", w.location, err)
+			}
+
+			w.onChange()
+		}
+	}
+}
+
+// close stops watching. Changes that haven't settled yet are ignored.
+func (w *diskWatcher) close() {
+	if err := w.watcher.Close(); err != nil {
+		logging.Printf("Received error closing watcher for %v: %v", w.location, err)
+	}
+
+	w.wg.Wait()
+}
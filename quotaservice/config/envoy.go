@@ -0,0 +1,195 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"gopkg.in/yaml.v2"
+)
+
+// envoyUnits are the rate limit units of envoyproxy/ratelimit that are supported, in seconds.
+var envoyUnits = map[string]int64{
+	"second": 1,
+	"minute": 60,
+	"hour":   60 * 60,
+	"day":    24 * 60 * 60,
+	"week":   7 * 24 * 60 * 60,
+}
+
+// envoyConfig is a single domain of an envoyproxy/ratelimit config.
+type envoyConfig struct {
+	Domain      string             `yaml:"domain"`
+	Descriptors []*envoyDescriptor `yaml:"descriptors"`
+}
+
+type envoyDescriptor struct {
+	Key            string             `yaml:"key"`
+	Value          string             `yaml:"value"`
+	RateLimit      *envoyRateLimit    `yaml:"rate_limit"`
+	Descriptors    []*envoyDescriptor `yaml:"descriptors"`
+	ShadowMode     bool               `yaml:"shadow_mode"`
+	DetailedMetric bool               `yaml:"detailed_metric"`
+}
+
+type envoyRateLimit struct {
+	Name            string `yaml:"name"`
+	Unit            string `yaml:"unit"`
+	RequestsPerUnit int64  `yaml:"requests_per_unit"`
+	Unlimited       bool   `yaml:"unlimited"`
+	Replaces        []struct {
+		Name string `yaml:"name"`
+	} `yaml:"replaces"`
+}
+
+// ImportProblem describes part of an imported config that couldn't be mapped exactly. Path
+// identifies it using the names it has in the imported file, e.g. descriptors.0.rate_limit.unit.
+type ImportProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p *ImportProblem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+type envoyImporter struct {
+	ns       *pbconfig.NamespaceConfig
+	problems []*ImportProblem
+}
+
+func (im *envoyImporter) problem(path, format string, args ...interface{}) {
+	im.problems = append(im.problems, &ImportProblem{path, fmt.Sprintf(format, args...)})
+}
+
+// FromEnvoyYAML converts a domain of an envoyproxy/ratelimit config into a namespace of the same
+// name. Descriptors with a value become static buckets, named after the key and value of each
+// descriptor down to them, e.g. database_users.user_bob. Top level descriptors that match any
+// value become the namespace's dynamic bucket template. A bucket holds requests_per_unit tokens,
+// refilled over the unit. Constructs that can't be mapped are skipped or approximated, and each is
+// returned as an ImportProblem.
+func FromEnvoyYAML(y []byte) (*pbconfig.NamespaceConfig, []*ImportProblem, error) {
+	cfg := &envoyConfig{}
+	if err := yaml.Unmarshal(y, cfg); err != nil {
+		return nil, nil, fmt.Errorf("Unable to read YAML. Error: %v", err)
+	}
+
+	if cfg.Domain == "" {
+		return nil, nil, errors.New("Envoy config has no domain")
+	}
+
+	im := &envoyImporter{ns: NewDefaultNamespaceConfig(cfg.Domain)}
+
+	for i, d := range cfg.Descriptors {
+		im.descriptor("descriptors."+strconv.Itoa(i), "", d)
+	}
+
+	return im.ns, im.problems, nil
+}
+
+func (im *envoyImporter) descriptor(path, parent string, d *envoyDescriptor) {
+	if d.Key == "" {
+		im.problem(path+".key", "descriptor has no key; skipped")
+		return
+	}
+
+	name := d.Key + "_" + d.Value
+	if parent != "" {
+		name = parent + "." + name
+	}
+
+	if d.DetailedMetric {
+		im.problem(path+".detailed_metric", "detailed metrics aren't supported; ignored")
+	}
+
+	if d.ShadowMode {
+		im.problem(path+".shadow_mode", "shadow mode isn't supported; skipped the descriptor's rate limit")
+	} else if d.RateLimit != nil {
+		im.rateLimit(path, parent, name, d)
+	}
+
+	for i, child := range d.Descriptors {
+		childPath := path + ".descriptors." + strconv.Itoa(i)
+
+		if d.Value == "" {
+			im.problem(childPath, "nested under %v, which matches any value; skipped", d.Key)
+			continue
+		}
+
+		im.descriptor(childPath, name, child)
+	}
+}
+
+func (im *envoyImporter) rateLimit(path, parent, name string, d *envoyDescriptor) {
+	b := im.bucket(path+".rate_limit", d.RateLimit)
+	if b == nil {
+		return
+	}
+
+	b.Description = "Imported from envoy descriptor " + name
+	if d.RateLimit.Name != "" {
+		b.Description += ", rate limit " + d.RateLimit.Name
+	}
+
+	switch {
+	case d.Value != "":
+		if im.ns.Buckets[name] != nil {
+			im.problem(path, "bucket %v is already defined; skipped", name)
+			return
+		}
+
+		b.Name = name
+		_ = AddBucket(im.ns, b)
+	case parent != "":
+		im.problem(path, "descriptors matching any value are only supported at the top level; skipped")
+	case im.ns.DynamicBucketTemplate != nil:
+		im.problem(path, "a namespace has a single dynamic bucket template, already imported; skipped")
+	default:
+		SetDynamicBucketTemplate(im.ns, b)
+	}
+}
+
+// bucket converts a rate limit into a bucket, or returns nil if it can't be.
+func (im *envoyImporter) bucket(path string, rl *envoyRateLimit) *pbconfig.BucketConfig {
+	if rl.Unlimited {
+		im.problem(path+".unlimited", "unlimited rate limits aren't supported; skipped")
+		return nil
+	}
+
+	if rl.RequestsPerUnit <= 0 {
+		im.problem(path+".requests_per_unit", "must be positive, is %v; skipped", rl.RequestsPerUnit)
+		return nil
+	}
+
+	seconds, ok := envoyUnits[strings.ToLower(rl.Unit)]
+	if !ok {
+		im.problem(path+".unit", "unit %q isn't supported; skipped", rl.Unit)
+		return nil
+	}
+
+	if len(rl.Replaces) > 0 {
+		im.problem(path+".replaces", "replacing other rate limits isn't supported; ignored")
+	}
+
+	// Fill rates are whole tokens per second, so limits over longer units are rounded.
+	fillRate := (rl.RequestsPerUnit + seconds/2) / seconds
+	if fillRate < 1 {
+		fillRate = 1
+	}
+
+	if fillRate*seconds != rl.RequestsPerUnit {
+		im.problem(path+".requests_per_unit", "%v per %v is approximated by a fill rate of %v per second",
+			rl.RequestsPerUnit, strings.ToLower(rl.Unit), fillRate)
+	}
+
+	// A whole unit's worth of requests may be made at once, as with envoy's fixed windows.
+	return &pbconfig.BucketConfig{
+		Size:                rl.RequestsPerUnit,
+		FillRate:            fillRate,
+		MaxTokensPerRequest: rl.RequestsPerUnit}
+}
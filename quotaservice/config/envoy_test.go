@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+const envoyYAML = `
+domain: mongo_cps
+descriptors:
+  - key: database
+    value: users
+    rate_limit:
+      name: users
+      unit: second
+      requests_per_unit: 500
+    descriptors:
+      - key: user
+        value: bob
+        rate_limit:
+          unit: MINUTE
+          requests_per_unit: 90
+      - key: user
+        rate_limit:
+          unit: second
+          requests_per_unit: 5
+  - key: database
+    rate_limit:
+      unit: hour
+      requests_per_unit: 7200
+  - key: remote_address
+    rate_limit:
+      unit: second
+      requests_per_unit: 10
+    descriptors:
+      - key: path
+        value: /login
+        rate_limit:
+          unit: second
+          requests_per_unit: 1
+  - key: client
+    value: shadowed
+    shadow_mode: true
+    rate_limit:
+      unit: second
+      requests_per_unit: 10
+  - key: client
+    value: unlimited
+    rate_limit:
+      unlimited: true
+  - key: client
+    value: monthly
+    rate_limit:
+      unit: month
+      requests_per_unit: 10
+`
+
+func TestFromEnvoyYAML(t *testing.T) {
+	ns, problems, err := FromEnvoyYAML([]byte(envoyYAML))
+	helpers.CheckError(t, err)
+
+	if ns.Name != "mongo_cps" || len(ns.Buckets) != 2 {
+		t.Fatalf("Expected namespace mongo_cps with 2 buckets, got %+v", ns)
+	}
+
+	users := ns.Buckets["database_users"]
+	if users.Size != 500 || users.FillRate != 500 || users.MaxTokensPerRequest != 500 ||
+		users.Description != "Imported from envoy descriptor database_users, rate limit users" {
+		t.Errorf("Unexpected bucket database_users: %+v", users)
+	}
+
+	if bob := ns.Buckets["database_users.user_bob"]; bob.Size != 90 || bob.FillRate != 2 {
+		t.Errorf("Unexpected bucket database_users.user_bob: %+v", bob)
+	}
+
+	if tpl := ns.DynamicBucketTemplate; tpl.Name != DynamicBucketTemplateName || tpl.Size != 7200 || tpl.FillRate != 2 {
+		t.Errorf("Unexpected dynamic bucket template: %+v", tpl)
+	}
+
+	expected := []string{
+		"descriptors.0.descriptors.0.rate_limit.requests_per_unit: 90 per minute is approximated by a fill rate of 2 per second",
+		"descriptors.0.descriptors.1: descriptors matching any value are only supported at the top level; skipped",
+		"descriptors.2: a namespace has a single dynamic bucket template, already imported; skipped",
+		"descriptors.2.descriptors.0: nested under remote_address, which matches any value; skipped",
+		"descriptors.3.shadow_mode: shadow mode isn't supported; skipped the descriptor's rate limit",
+		"descriptors.4.rate_limit.unlimited: unlimited rate limits aren't supported; skipped",
+		"descriptors.5.rate_limit.unit: unit \"month\" isn't supported; skipped"}
+
+	actual := make([]string, len(problems))
+	for i, p := range problems {
+		actual[i] = p.String()
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected problems %v, got %v", expected, actual)
+	}
+
+	// The namespace is served as a valid config.
+	cfg := NewDefaultServiceConfig()
+	helpers.CheckError(t, AddNamespace(cfg, ns))
+	helpers.CheckError(t, Validate(cfg))
+}
+
+func TestFromEnvoyYAMLInvalid(t *testing.T) {
+	for name, y := range map[string]string{
+		"no domain":      "descriptors: []",
+		"not YAML":       "domain: [",
+		"not a YAML map": "- domain: foo"} {
+		if _, _, err := FromEnvoyYAML([]byte(y)); err == nil {
+			t.Errorf("Expected config with %v to fail", name)
+		}
+	}
+
+	// Small limits are rounded up rather than left without a fill rate.
+	ns, problems, err := FromEnvoyYAML([]byte(`
+domain: d
+descriptors:
+  - key: k
+    value: v
+    rate_limit: {unit: day, requests_per_unit: 10}`))
+	helpers.CheckError(t, err)
+
+	if b := ns.Buckets["k_v"]; b.FillRate != 1 || len(problems) != 1 {
+		t.Errorf("Expected a fill rate of 1 and a problem, got %+v and %v", b, problems)
+	}
+}
@@ -0,0 +1,361 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+)
+
+const etcdRequestTimeout = 5 * time.Second
+
+// EtcdConfigPersister persists configs in etcd. Every config is stored under <prefix>/configs/<hash>,
+// and <prefix>/current holds the hash of the current config. Both are updated in a single
+// transaction that only succeeds if the current config hasn't changed in the meantime. Changes to
+// <prefix>/current are watched, so all nodes are notified of new configs.
+type EtcdConfigPersister struct {
+	// Current configuration hash
+	config string
+
+	// Historical configurations, in the order they were first persisted
+	configs []*etcdConfig
+
+	// Revision at which <prefix>/current was last modified, or 0 if it doesn't exist
+	currentRevision int64
+
+	prefix    string
+	retention RetentionPolicy
+	client    *clientv3.Client
+	watcher   chan struct{}
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	sync.RWMutex
+}
+
+type etcdConfig struct {
+	hash     string
+	config   []byte
+	revision int64
+}
+
+// NewEtcdConfigPersister creates a ConfigPersister storing configs in etcd under prefix, connecting
+// to etcd using cfg.
+func NewEtcdConfigPersister(prefix string, cfg clientv3.Config) (ConfigPersister, error) {
+	return NewEtcdConfigPersisterWithRetention(prefix, cfg, KeepAll)
+}
+
+// NewEtcdConfigPersisterWithRetention creates an EtcdConfigPersister that deletes historical configs
+// according to retention, whenever it persists a config.
+func NewEtcdConfigPersisterWithRetention(prefix string, cfg clientv3.Config, retention RetentionPolicy) (ConfigPersister, error) {
+	client, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	persister := &EtcdConfigPersister{
+		prefix:    strings.TrimSuffix(prefix, "/"),
+		retention: retention,
+		client:    client,
+		watcher:   make(chan struct{}, 1),
+		cancel:    cancel}
+
+	// Start watching from the revision configs were loaded at, so no changes are missed.
+	revision, err := persister.reload()
+	if err != nil {
+		cancel()
+		_ = client.Close()
+		return nil, err
+	}
+
+	persister.wg.Add(1)
+	go persister.waitForEvents(ctx, revision)
+
+	return persister, nil
+}
+
+func (e *EtcdConfigPersister) currentKey() string {
+	return e.prefix + "/current"
+}
+
+func (e *EtcdConfigPersister) configsKey() string {
+	return e.prefix + "/configs/"
+}
+
+func (e *EtcdConfigPersister) waitForEvents(ctx context.Context, revision int64) {
+	defer e.wg.Done()
+
+	for {
+		watch := e.client.Watch(ctx, e.currentKey(), clientv3.WithRev(revision+1))
+		for rsp := range watch {
+			if err := rsp.Err(); err != nil {
+				logging.Printf("Received error from etcd watching %v: %+v", e.currentKey(), err)
+				continue
+			}
+
+			var err error
+			if revision, err = e.reload(); err != nil {
+				logging.Printf("Received error from etcd reloading configs: %+v", err)
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// The watch was closed by etcd, for example because the revision was compacted.
+		logging.Printf("Watch on %v closed; re-establishing", e.currentKey())
+		var err error
+		if revision, err = e.reload(); err != nil {
+			logging.Printf("Received error from etcd reloading configs: %+v", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// reload reads all configs and the current config hash from etcd, in a single transaction so they
+// are consistent with one another, and notifies the watcher. Returns the revision read at.
+func (e *EtcdConfigPersister) reload() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	rsp, err := e.client.Txn(ctx).Then(
+		clientv3.OpGet(e.currentKey()),
+		clientv3.OpGet(e.configsKey(), clientv3.WithPrefix())).Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	var current string
+	var currentRevision int64
+	if kvs := rsp.Responses[0].GetResponseRange().Kvs; len(kvs) > 0 {
+		current = string(kvs[0].Value)
+		currentRevision = kvs[0].ModRevision
+	}
+
+	var configs []*etcdConfig
+	for _, kv := range rsp.Responses[1].GetResponseRange().Kvs {
+		configs = append(configs, &etcdConfig{
+			hash:     strings.TrimPrefix(string(kv.Key), e.configsKey()),
+			config:   kv.Value,
+			revision: kv.CreateRevision})
+	}
+
+	sort.Slice(configs, func(i, j int) bool { return configs[i].revision < configs[j].revision })
+
+	e.Lock()
+	defer e.Unlock()
+
+	e.config = current
+	e.currentRevision = currentRevision
+	e.configs = configs
+
+	select {
+	case e.watcher <- struct{}{}:
+		// Notified
+	default:
+		// Doesn't matter; another notification is pending.
+	}
+
+	return rsp.Header.Revision, nil
+}
+
+// PersistAndNotify persists a marshalled configuration passed in. Returns ErrConcurrentUpdate if
+// the current config changed since this persister last saw it.
+func (e *EtcdConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error {
+	b, err := ioutil.ReadAll(marshalledConfig)
+	if err != nil {
+		return err
+	}
+
+	e.RLock()
+	current := e.config
+	currentRevision := e.currentRevision
+	e.RUnlock()
+
+	return e.persist(b, current, currentRevision)
+}
+
+// PersistIfVersion persists a marshalled configuration passed in, provided the current config is at
+// the expected version and hasn't changed since this persister last saw it.
+func (e *EtcdConfigPersister) PersistIfVersion(expected int32, marshalledConfig io.Reader) error {
+	b, err := ioutil.ReadAll(marshalledConfig)
+	if err != nil {
+		return err
+	}
+
+	e.RLock()
+	current := e.config
+	currentRevision := e.currentRevision
+	version, err := versionOf(e.currentConfigLocked())
+	e.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	if version != expected {
+		return ErrConcurrentUpdate
+	}
+
+	return e.persist(b, current, currentRevision)
+}
+
+// persist stores a config and makes it current, provided <prefix>/current is still at
+// currentRevision.
+func (e *EtcdConfigPersister) persist(b []byte, current string, currentRevision int64) error {
+	key := HashConfig(b)
+	if key == current {
+		return nil
+	}
+
+	ops := []clientv3.Op{
+		clientv3.OpPut(e.configsKey()+key, string(b)),
+		clientv3.OpPut(e.currentKey(), key)}
+
+	// Configs that are no longer retained are deleted in the same transaction, so they are gone by
+	// the time the watcher reloads configs.
+	expired := e.expired(key, b)
+	for _, k := range expired {
+		ops = append(ops, clientv3.OpDelete(e.configsKey()+k))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+
+	rsp, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(e.currentKey()), "=", currentRevision)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return err
+	}
+
+	if !rsp.Succeeded {
+		return ErrConcurrentUpdate
+	}
+
+	// The new config is current right away, so further updates from this persister don't conflict
+	// with it before the watcher has seen it. There is no notification, that happens when etcd alerts
+	// the watcher.
+	e.Lock()
+	defer e.Unlock()
+
+	if rsp.Header.Revision > e.currentRevision {
+		e.config = key
+		e.currentRevision = rsp.Header.Revision
+		e.configs = withConfig(e.configs, &etcdConfig{key, b, rsp.Header.Revision}, expired)
+	}
+
+	return nil
+}
+
+// withConfig returns configs without the expired hashes, and with c added if it isn't there yet.
+func withConfig(configs []*etcdConfig, c *etcdConfig, expired []string) []*etcdConfig {
+	isExpired := make(map[string]bool, len(expired))
+	for _, k := range expired {
+		isExpired[k] = true
+	}
+
+	updated := make([]*etcdConfig, 0, len(configs)+1)
+	found := false
+	for _, existing := range configs {
+		if isExpired[existing.hash] {
+			continue
+		}
+
+		found = found || existing.hash == c.hash
+		updated = append(updated, existing)
+	}
+
+	if !found {
+		updated = append(updated, c)
+	}
+
+	return updated
+}
+
+// expired returns the hashes of historical configs that aren't retained once the config with the
+// given key is current.
+func (e *EtcdConfigPersister) expired(key string, current []byte) []string {
+	e.RLock()
+	configs := e.configsLocked()
+	e.RUnlock()
+
+	configs[key] = current
+
+	expired, err := e.retention.prune(configs, key)
+	if err != nil {
+		logging.Printf("Unable to prune historical configs under %v: %+v", e.configsKey(), err)
+	}
+
+	return expired
+}
+
+// configsLocked returns all historical configs, keyed by hash.
+func (e *EtcdConfigPersister) configsLocked() map[string][]byte {
+	configs := make(map[string][]byte, len(e.configs))
+	for _, c := range e.configs {
+		configs[c.hash] = c.config
+	}
+
+	return configs
+}
+
+// ReadPersistedConfig provides a reader to a marshalled config previously persisted.
+func (e *EtcdConfigPersister) ReadPersistedConfig() (io.Reader, error) {
+	e.RLock()
+	defer e.RUnlock()
+
+	return bytes.NewReader(e.currentConfigLocked()), nil
+}
+
+func (e *EtcdConfigPersister) currentConfigLocked() []byte {
+	for _, c := range e.configs {
+		if c.hash == e.config {
+			return c.config
+		}
+	}
+
+	return nil
+}
+
+// ConfigChangedWatcher returns a channel that is notified whenever configuration changes are
+// detected. Changes are coalesced so that a single notification may be emitted for multiple
+// changes.
+func (e *EtcdConfigPersister) ConfigChangedWatcher() <-chan struct{} {
+	return e.watcher
+}
+
+// ReadHistoricalConfigs returns an array of previously persisted configs selected by page, newest
+// first.
+func (e *EtcdConfigPersister) ReadHistoricalConfigs(page HistoryPage) ([]io.Reader, error) {
+	e.RLock()
+	defer e.RUnlock()
+
+	return readHistory(e.configsLocked(), page)
+}
+
+// Close stops watching for changes and closes the connection to etcd.
+func (e *EtcdConfigPersister) Close() {
+	e.cancel()
+	e.wg.Wait()
+
+	close(e.watcher)
+
+	if err := e.client.Close(); err != nil {
+		logging.Printf("Received error closing etcd client: %+v", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestEtcdNew(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersister(t, endpoint)
+	defer p.Close()
+
+	select {
+	case <-p.ConfigChangedWatcher():
+	// this is good
+	default:
+		t.Error("Config channel should not be empty!")
+	}
+
+	cfg, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+
+	cfgArray, err := ioutil.ReadAll(cfg)
+	helpers.CheckError(t, err)
+
+	if len(cfgArray) > 0 {
+		t.Errorf("Received non-empty cfg on new prefix: %+v", cfgArray)
+	}
+}
+
+func TestEtcdSetAndNotify(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersister(t, endpoint)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	other := newEtcdPersister(t, endpoint)
+	defer other.Close()
+	<-other.ConfigChangedWatcher()
+
+	cfg := NewDefaultServiceConfig()
+	cfg.Namespaces["foo"] = NewDefaultNamespaceConfig("foo")
+	r, err := Marshal(cfg)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, p.PersistAndNotify(r))
+
+	// Both persisters are notified.
+	for _, persister := range []*EtcdConfigPersister{p, other} {
+		select {
+		case <-persister.ConfigChangedWatcher():
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Did not receive notification!")
+		}
+
+		ioCfg, err := persister.ReadPersistedConfig()
+		helpers.CheckError(t, err)
+
+		newConfig, err := Unmarshal(ioCfg)
+		helpers.CheckError(t, err)
+
+		if newConfig.Namespaces["foo"] == nil {
+			t.Errorf("Config is not valid: %+v", newConfig)
+		}
+	}
+}
+
+func TestEtcdConcurrentUpdate(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersister(t, endpoint)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	// Simulate a persister that hasn't seen the latest config yet.
+	stale := newEtcdPersister(t, endpoint)
+	defer stale.Close()
+	<-stale.ConfigChangedWatcher()
+
+	persistConfig(t, p, 1, "foo")
+	<-stale.ConfigChangedWatcher()
+	stale.Lock()
+	stale.currentRevision = 0
+	stale.Unlock()
+
+	r, err := Marshal(NewDefaultServiceConfig())
+	helpers.CheckError(t, err)
+
+	if err := stale.PersistAndNotify(r); err != ErrConcurrentUpdate {
+		t.Fatalf("Expected ErrConcurrentUpdate, got %v", err)
+	}
+}
+
+func TestEtcdPersistIfVersion(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersister(t, endpoint)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	testPersistIfVersion(t, p)
+}
+
+func TestEtcdBackToBackPersists(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersister(t, endpoint)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	// The second write doesn't wait for the watcher to see the first one.
+	for i, ns := range []string{"foo", "bar"} {
+		cfg := NewDefaultServiceConfig()
+		cfg.Version = int32(i + 1)
+		cfg.Namespaces[ns] = NewDefaultNamespaceConfig(ns)
+		r, err := Marshal(cfg)
+		helpers.CheckError(t, err)
+		helpers.CheckError(t, p.PersistIfVersion(int32(i), r))
+	}
+
+	ioCfg, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+
+	cfg, err := Unmarshal(ioCfg)
+	helpers.CheckError(t, err)
+
+	if cfg.Version != 2 || cfg.Namespaces["bar"] == nil {
+		t.Errorf("Expected the second config to be current, got %+v", cfg)
+	}
+}
+
+func TestEtcdHistoricalConfigs(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersister(t, endpoint)
+	<-p.ConfigChangedWatcher()
+
+	persistConfig(t, p, 1, "foo")
+	persistConfig(t, p, 2, "bar")
+	p.Close()
+
+	// A new persister sees all configs.
+	p = newEtcdPersister(t, endpoint)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	cfgs, err := p.ReadHistoricalConfigs(AllHistory)
+	helpers.CheckError(t, err)
+
+	if len(cfgs) != 2 {
+		t.Fatalf("Historical configs are not correct: %+v", cfgs)
+	}
+
+	for i, ns := range []string{"bar", "foo"} {
+		cfg, err := Unmarshal(cfgs[i])
+		helpers.CheckError(t, err)
+
+		if cfg.Namespaces[ns] == nil {
+			t.Errorf("Config %v is not valid: %+v", i, cfg)
+		}
+	}
+}
+
+func TestEtcdRetention(t *testing.T) {
+	etcd, endpoint := startEtcd(t)
+	defer stopEtcd(etcd)
+
+	p := newEtcdPersisterWithRetention(t, endpoint, RetentionPolicy{MaxVersions: 2})
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	testRetention(t, p)
+
+	// Pruned configs are gone from etcd, not just this persister.
+	other := newEtcdPersister(t, endpoint)
+	defer other.Close()
+	<-other.ConfigChangedWatcher()
+
+	cfgs, err := other.ReadHistoricalConfigs(AllHistory)
+	helpers.CheckError(t, err)
+
+	if len(cfgs) != 2 {
+		t.Fatalf("Expected 2 configs to be retained, got %v", len(cfgs))
+	}
+}
+
+// persistConfig persists a config with a single namespace, and waits for the persister to see it.
+func persistConfig(t *testing.T, p *EtcdConfigPersister, version int32, namespace string) {
+	// t.Helper()
+
+	cfg := NewDefaultServiceConfig()
+	cfg.Version = version
+	cfg.Namespaces[namespace] = NewDefaultNamespaceConfig(namespace)
+	r, err := Marshal(cfg)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, p.PersistAndNotify(r))
+
+	select {
+	case <-p.ConfigChangedWatcher():
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Did not receive notification!")
+	}
+}
+
+func newEtcdPersister(t *testing.T, endpoint string) *EtcdConfigPersister {
+	// t.Helper()
+
+	return newEtcdPersisterWithRetention(t, endpoint, KeepAll)
+}
+
+func newEtcdPersisterWithRetention(t *testing.T, endpoint string, retention RetentionPolicy) *EtcdConfigPersister {
+	// t.Helper()
+
+	p, err := NewEtcdConfigPersisterWithRetention("/quotaservice", clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: 5 * time.Second}, retention)
+	helpers.CheckError(t, err)
+
+	return p.(*EtcdConfigPersister)
+}
+
+// startEtcd starts an embedded, single node etcd server on random local ports.
+func startEtcd(t *testing.T) (*embed.Etcd, string) {
+	// t.Helper()
+
+	dir, err := ioutil.TempDir("", "qs_etcd")
+	helpers.CheckError(t, err)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+
+	clientURL := localURL(t)
+	peerURL := localURL(t)
+	cfg.ListenClientUrls = []url.URL{*clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{*clientURL}
+	cfg.ListenPeerUrls = []url.URL{*peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	etcd, err := embed.StartEtcd(cfg)
+	helpers.CheckError(t, err)
+
+	select {
+	case <-etcd.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		etcd.Close()
+		t.Fatal("Embedded etcd took too long to start")
+	}
+
+	return etcd, clientURL.Host
+}
+
+func stopEtcd(etcd *embed.Etcd) {
+	etcd.Close()
+	_ = os.RemoveAll(etcd.Config().Dir)
+}
+
+// localURL returns a URL on a free local port.
+func localURL(t *testing.T) *url.URL {
+	// t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.CheckError(t, err)
+	defer func() { _ = lis.Close() }()
+
+	u, err := url.Parse(fmt.Sprintf("http://%v", lis.Addr()))
+	helpers.CheckError(t, err)
+	return u
+}
@@ -0,0 +1,426 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+const gitRemoteName = "origin"
+
+// GitConfigPersister persists configs as YAML files in a git repository, so every change is a
+// commit, authored by the config's user. The history of configs is the history of the file.
+//
+// If the repository has a remote, every commit is pushed to it, and the remote is polled for
+// commits pushed by others, such as other quotaservice nodes or people editing the file by hand.
+// Commits that don't fast-forward the remote fail with ErrConcurrentUpdate. Without a remote, the
+// local repository is polled for commits made to it by others.
+type GitConfigPersister struct {
+	dir  string
+	file string
+	url  string
+
+	repo   *git.Repository
+	branch plumbing.ReferenceName
+
+	// Commit the branch was at when last seen, or the zero hash if it has no commits
+	head plumbing.Hash
+
+	*Notifier
+	stopper chan struct{}
+	wg      sync.WaitGroup
+	sync.Mutex
+}
+
+// NewGitConfigPersister creates a GitConfigPersister storing configs in file, relative to the root
+// of the repository in dir. If url is empty, dir is a local repository, which is created if it
+// doesn't exist. Otherwise, dir is a clone of the repository at url, which is cloned if it doesn't
+// exist. Changes are polled for every pollingDuration.
+func NewGitConfigPersister(dir, url, file string, pollingDuration time.Duration) (ConfigPersister, error) {
+	repo, err := openRepository(dir, url)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if head.Type() != plumbing.SymbolicReference {
+		return nil, fmt.Errorf("HEAD of %v isn't a branch", dir)
+	}
+
+	g := &GitConfigPersister{
+		dir:      dir,
+		file:     filepath.ToSlash(file),
+		url:      url,
+		repo:     repo,
+		branch:   head.Target(),
+		Notifier: NewNotifier(),
+		stopper:  make(chan struct{})}
+
+	if _, err := g.syncLocked(); err != nil {
+		return nil, err
+	}
+
+	g.wg.Add(1)
+	go g.poll(pollingDuration)
+
+	// Notify that we're available for reading
+	g.Notify()
+
+	return g, nil
+}
+
+// openRepository opens the repository in dir, creating or cloning it if it doesn't exist.
+func openRepository(dir, url string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != git.ErrRepositoryNotExists {
+		return repo, err
+	}
+
+	if url == "" {
+		return git.PlainInit(dir, false)
+	}
+
+	repo, err = git.PlainClone(dir, false, &git.CloneOptions{URL: url, RemoteName: gitRemoteName})
+	if err != transport.ErrEmptyRemoteRepository {
+		return repo, err
+	}
+
+	// Nothing to clone; start a repository, which the first commit is pushed from.
+	_ = os.RemoveAll(filepath.Join(dir, git.GitDirName))
+	if repo, err = git.PlainInit(dir, false); err != nil {
+		return nil, err
+	}
+
+	_, err = repo.CreateRemote(&gitconfig.RemoteConfig{Name: gitRemoteName, URLs: []string{url}})
+	return repo, err
+}
+
+func (g *GitConfigPersister) poll(pollingDuration time.Duration) {
+	defer g.wg.Done()
+
+	t := time.NewTicker(pollingDuration)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			g.Lock()
+			moved, err := g.syncLocked()
+			g.Unlock()
+
+			if err != nil {
+				logging.Printf("Received error polling git repository %v: %v", g.dir, err)
+			} else if moved {
+				g.Notify()
+			}
+		case <-g.stopper:
+			return
+		}
+	}
+}
+
+// syncLocked fetches commits from the remote, if there is one, and moves the branch to where the
+// remote's is. Returns true if the branch has moved since it was last seen.
+func (g *GitConfigPersister) syncLocked() (bool, error) {
+	if g.url != "" {
+		err := g.repo.Fetch(&git.FetchOptions{RemoteName: gitRemoteName})
+		if err != nil && err != git.NoErrAlreadyUpToDate && err != transport.ErrEmptyRemoteRepository {
+			return false, err
+		}
+
+		remote, err := g.repo.Reference(plumbing.NewRemoteReferenceName(gitRemoteName, g.branch.Short()), true)
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return false, err
+		}
+
+		if err == nil && remote.Hash() != g.head {
+			if err := g.resetLocked(remote.Hash()); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	head, err := g.repo.Reference(g.branch, true)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return false, err
+	}
+
+	moved := false
+	if err == nil {
+		moved = head.Hash() != g.head
+		g.head = head.Hash()
+	}
+
+	return moved, nil
+}
+
+// resetLocked moves the branch and the working tree to commit, or removes the branch if commit is
+// the zero hash.
+func (g *GitConfigPersister) resetLocked(commit plumbing.Hash) error {
+	if commit.IsZero() {
+		return g.repo.Storer.RemoveReference(g.branch)
+	}
+
+	// The branch may not exist yet, which resetting the working tree requires.
+	if err := g.repo.Storer.SetReference(plumbing.NewHashReference(g.branch, commit)); err != nil {
+		return err
+	}
+
+	wt, err := g.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return wt.Reset(&git.ResetOptions{Commit: commit, Mode: git.HardReset})
+}
+
+// PersistAndNotify commits a marshalled configuration passed in.
+func (g *GitConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error {
+	return g.persist(marshalledConfig, nil)
+}
+
+// PersistIfVersion commits a marshalled configuration passed in, provided the current config is at
+// the expected version.
+func (g *GitConfigPersister) PersistIfVersion(expected int32, marshalledConfig io.Reader) error {
+	return g.persist(marshalledConfig, &expected)
+}
+
+func (g *GitConfigPersister) persist(marshalledConfig io.Reader, expected *int32) error {
+	cfg, err := Unmarshal(marshalledConfig)
+	if err != nil {
+		return err
+	}
+
+	y, err := ToYAML(cfg)
+	if err != nil {
+		return err
+	}
+
+	g.Lock()
+	defer g.Unlock()
+
+	// Build on top of the latest commit.
+	if moved, err := g.syncLocked(); err != nil {
+		return err
+	} else if moved {
+		g.Notify()
+	}
+
+	current, err := g.readLocked(g.head)
+	if err != nil {
+		return err
+	}
+
+	if expected != nil {
+		version, err := versionOf(current)
+		if err != nil {
+			return err
+		}
+
+		if version != *expected {
+			return ErrConcurrentUpdate
+		}
+	}
+
+	commit, err := g.commitLocked(cfg, y)
+	if err != nil {
+		return err
+	}
+
+	if g.url != "" {
+		err := g.repo.Push(&git.PushOptions{
+			RemoteName: gitRemoteName,
+			RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(g.branch + ":" + g.branch)}})
+
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			if e := g.resetLocked(g.head); e != nil {
+				logging.Printf("Unable to reset git repository %v to %v: %v", g.dir, g.head, e)
+			}
+
+			// The remote has moved on since it was fetched.
+			if strings.HasPrefix(err.Error(), "non-fast-forward update") || err == plumbing.ErrObjectNotFound {
+				return ErrConcurrentUpdate
+			}
+
+			return err
+		}
+	}
+
+	g.head = commit
+
+	// ... and notify
+	g.Notify()
+
+	return nil
+}
+
+// commitLocked writes the YAML rendering of cfg to the file, and commits it.
+func (g *GitConfigPersister) commitLocked(cfg *pb.ServiceConfig, y []byte) (plumbing.Hash, error) {
+	path := filepath.Join(g.dir, filepath.FromSlash(g.file))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := ioutil.WriteFile(path, y, 0644); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	wt, err := g.repo.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := wt.Add(g.file); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	user := cfg.User
+	if user == "" {
+		user = "quotaservice"
+	}
+
+	return wt.Commit(fmt.Sprintf("Update config to version %v", cfg.Version), &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author: &object.Signature{
+			Name:  user,
+			Email: user,
+			When:  time.Unix(cfg.Date, 0)}})
+}
+
+// readLocked reads the marshalled config in the file at commit. Returns nil if there is no config.
+func (g *GitConfigPersister) readLocked(commit plumbing.Hash) ([]byte, error) {
+	if commit.IsZero() {
+		return nil, nil
+	}
+
+	c, err := g.repo.CommitObject(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := g.configAt(c)
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+
+	r, err := Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(r)
+}
+
+// configAt reads the config in the file at commit c. Returns nil if the file doesn't exist.
+func (g *GitConfigPersister) configAt(c *object.Commit) (*pb.ServiceConfig, error) {
+	f, err := c.File(g.file)
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := FromYAML([]byte(contents))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read config from %v at %v: %v", g.file, c.Hash, err)
+	}
+
+	return cfg, nil
+}
+
+// ReadPersistedConfig provides a reader to a marshalled config previously persisted.
+func (g *GitConfigPersister) ReadPersistedConfig() (io.Reader, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	b, err := g.readLocked(g.head)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(b), nil
+}
+
+// ReadHistoricalConfigs returns an array of previously persisted configs selected by page, newest
+// first, by walking the history of the file.
+func (g *GitConfigPersister) ReadHistoricalConfigs(page HistoryPage) ([]io.Reader, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.head.IsZero() {
+		return nil, nil
+	}
+
+	commits, err := g.repo.Log(&git.LogOptions{From: g.head, FileName: &g.file})
+	if err != nil {
+		return nil, err
+	}
+
+	var readers []io.Reader
+
+	err = commits.ForEach(func(c *object.Commit) error {
+		if page.Limit > 0 && len(readers) == page.Limit {
+			return storer.ErrStop
+		}
+
+		cfg, err := g.configAt(c)
+		if err != nil || cfg == nil {
+			return err
+		}
+
+		if page.Before > 0 && cfg.Version >= page.Before {
+			return nil
+		}
+
+		r, err := Marshal(cfg)
+		if err != nil {
+			return err
+		}
+
+		readers = append(readers, r)
+		return nil
+	})
+
+	return readers, err
+}
+
+// ConfigChangedWatcher returns a channel that is notified whenever configuration changes are
+// detected. Changes are coalesced so that a single notification may be emitted for multiple
+// changes.
+func (g *GitConfigPersister) ConfigChangedWatcher() <-chan struct{} {
+	return g.Notifier.Watcher
+}
+
+// Close stops polling for changes.
+func (g *GitConfigPersister) Close() {
+	close(g.stopper)
+	g.wg.Wait()
+}
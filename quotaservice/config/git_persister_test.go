@@ -0,0 +1,262 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestGitNew(t *testing.T) {
+	remote := newBareRepository(t)
+	defer func() { _ = os.RemoveAll(remote) }()
+
+	p := newGitPersister(t, remote)
+	defer p.Close()
+
+	select {
+	case <-p.ConfigChangedWatcher():
+	// this is good
+	default:
+		t.Error("Config channel should not be empty!")
+	}
+
+	cfg, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+
+	cfgArray, err := ioutil.ReadAll(cfg)
+	helpers.CheckError(t, err)
+
+	if len(cfgArray) > 0 {
+		t.Errorf("Received non-empty cfg on new repository: %+v", cfgArray)
+	}
+
+	cfgs, err := p.ReadHistoricalConfigs(AllHistory)
+	helpers.CheckError(t, err)
+
+	if len(cfgs) != 0 {
+		t.Errorf("Received historical configs on new repository: %+v", cfgs)
+	}
+}
+
+func TestGitSetAndNotify(t *testing.T) {
+	remote := newBareRepository(t)
+	defer func() { _ = os.RemoveAll(remote) }()
+
+	p := newGitPersister(t, remote)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	other := newGitPersister(t, remote)
+	defer other.Close()
+	<-other.ConfigChangedWatcher()
+
+	persistGitConfig(t, p, 1, "foo")
+
+	// The other persister notices the commit when polling.
+	waitForNotification(t, other)
+	checkGitNamespace(t, other, "foo")
+
+	// ... and builds on top of it.
+	persistGitConfig(t, other, 2, "bar")
+	waitForNotification(t, p)
+	checkGitNamespace(t, p, "bar")
+}
+
+func TestGitConcurrentUpdate(t *testing.T) {
+	remote := newBareRepository(t)
+	defer func() { _ = os.RemoveAll(remote) }()
+
+	p := newGitPersister(t, remote)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	stale := newGitPersister(t, remote)
+	defer stale.Close()
+	<-stale.ConfigChangedWatcher()
+
+	persistGitConfig(t, p, 1, "foo")
+	persistGitConfig(t, p, 2, "bar")
+
+	// The stale persister hasn't polled since version 1, but checks against the latest commit.
+	r, err := Marshal(NewDefaultServiceConfig())
+	helpers.CheckError(t, err)
+
+	if err := stale.PersistIfVersion(1, r); err != ErrConcurrentUpdate {
+		t.Fatalf("Expected ErrConcurrentUpdate, got %v", err)
+	}
+}
+
+func TestGitPersistIfVersion(t *testing.T) {
+	remote := newBareRepository(t)
+	defer func() { _ = os.RemoveAll(remote) }()
+
+	p := newGitPersister(t, remote)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	testPersistIfVersion(t, p)
+}
+
+func TestGitHistoricalConfigs(t *testing.T) {
+	remote := newBareRepository(t)
+	defer func() { _ = os.RemoveAll(remote) }()
+
+	p := newGitPersister(t, remote)
+	<-p.ConfigChangedWatcher()
+
+	for version, user := range []string{"alice", "bob", "carol"} {
+		cfg := NewDefaultServiceConfig()
+		cfg.Version = int32(version + 1)
+		cfg.User = user
+		cfg.Date = time.Now().Unix()
+		r, err := Marshal(cfg)
+		helpers.CheckError(t, err)
+		helpers.CheckError(t, p.PersistAndNotify(r))
+		waitForNotification(t, p)
+	}
+
+	// Commits are authored by the config's user.
+	head, err := p.repo.Head()
+	helpers.CheckError(t, err)
+	commit, err := p.repo.CommitObject(head.Hash())
+	helpers.CheckError(t, err)
+
+	if commit.Author.Name != "carol" {
+		t.Errorf("Expected commit to be authored by carol, was %+v", commit.Author)
+	}
+
+	p.Close()
+
+	// A fresh clone sees all configs.
+	p = newGitPersister(t, remote)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	checkVersions := func(page HistoryPage, expected ...int32) {
+		cfgs, err := p.ReadHistoricalConfigs(page)
+		helpers.CheckError(t, err)
+
+		var versions []int32
+		for _, r := range cfgs {
+			cfg, err := Unmarshal(r)
+			helpers.CheckError(t, err)
+			versions = append(versions, cfg.Version)
+		}
+
+		if !reflect.DeepEqual(versions, expected) {
+			t.Fatalf("Expected versions %v for page %+v, got %v", expected, page, versions)
+		}
+	}
+
+	checkVersions(AllHistory, 3, 2, 1)
+	checkVersions(HistoryPage{Limit: 2}, 3, 2)
+	checkVersions(HistoryPage{Before: 2, Limit: 2}, 1)
+}
+
+func TestGitLocalRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_git")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	persister, err := NewGitConfigPersister(dir, "", "configs/quotaservice.yaml", 10*time.Millisecond)
+	helpers.CheckError(t, err)
+	p := persister.(*GitConfigPersister)
+	defer p.Close()
+	<-p.ConfigChangedWatcher()
+
+	persistGitConfig(t, p, 1, "foo")
+
+	// The config is committed as YAML.
+	b, err := ioutil.ReadFile(filepath.Join(dir, "configs", "quotaservice.yaml"))
+	helpers.CheckError(t, err)
+	cfg, err := FromYAML(b)
+	helpers.CheckError(t, err)
+
+	if cfg.Namespaces["foo"] == nil {
+		t.Fatalf("Config is not valid: %+v", cfg)
+	}
+
+	// Commits made by others are noticed.
+	cfg.Version = 2
+	cfg.Namespaces["bar"] = NewDefaultNamespaceConfig("bar")
+	b, err = ToYAML(cfg)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, ioutil.WriteFile(filepath.Join(dir, "configs", "quotaservice.yaml"), b, 0644))
+
+	repo, err := git.PlainOpen(dir)
+	helpers.CheckError(t, err)
+	wt, err := repo.Worktree()
+	helpers.CheckError(t, err)
+	_, err = wt.Commit("Add bar", &git.CommitOptions{
+		All:    true,
+		Author: &object.Signature{Name: "dave", Email: "dave", When: time.Now()}})
+	helpers.CheckError(t, err)
+
+	waitForNotification(t, p)
+	checkGitNamespace(t, p, "bar")
+}
+
+// persistGitConfig persists a config with a single namespace, and waits for the persister to see it.
+func persistGitConfig(t *testing.T, p *GitConfigPersister, version int32, namespace string) {
+	// t.Helper()
+
+	cfg := NewDefaultServiceConfig()
+	cfg.Version = version
+	cfg.Namespaces[namespace] = NewDefaultNamespaceConfig(namespace)
+	r, err := Marshal(cfg)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, p.PersistAndNotify(r))
+	waitForNotification(t, p)
+}
+
+func checkGitNamespace(t *testing.T, p ConfigPersister, namespace string) {
+	// t.Helper()
+
+	r, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	cfg, err := Unmarshal(r)
+	helpers.CheckError(t, err)
+
+	if cfg.Namespaces[namespace] == nil {
+		t.Fatalf("Expected namespace %v in config: %+v", namespace, cfg)
+	}
+}
+
+// newGitPersister creates a persister in a fresh clone of remote, which polls frequently.
+func newGitPersister(t *testing.T, remote string) *GitConfigPersister {
+	// t.Helper()
+
+	dir, err := ioutil.TempDir("", "qs_git_clone")
+	helpers.CheckError(t, err)
+	// Let the persister clone into the directory.
+	helpers.CheckError(t, os.Remove(dir))
+
+	p, err := NewGitConfigPersister(dir, remote, "quotaservice.yaml", 10*time.Millisecond)
+	helpers.CheckError(t, err)
+
+	return p.(*GitConfigPersister)
+}
+
+// newBareRepository creates an empty bare repository on local disk, to be used as a remote.
+func newBareRepository(t *testing.T) string {
+	// t.Helper()
+
+	dir, err := ioutil.TempDir("", "qs_git_remote")
+	helpers.CheckError(t, err)
+
+	_, err = git.PlainInit(dir, true)
+	helpers.CheckError(t, err)
+
+	return dir
+}
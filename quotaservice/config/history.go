@@ -0,0 +1,164 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// HistoryPage selects a page of historical configs, which are ordered newest first.
+type HistoryPage struct {
+	// Before only selects configs with a version lower than this, if positive. To read the next
+	// page, pass the version of the oldest config on the current page.
+	Before int32
+
+	// Limit is the maximum number of configs to select, if positive.
+	Limit int
+}
+
+// AllHistory selects every historical config.
+var AllHistory = HistoryPage{}
+
+// ErrNoSuchVersion is returned when a historical config is requested by a version that isn't in
+// the history, either because it never existed or because it has been pruned.
+var ErrNoSuchVersion = errors.New("no config with the requested version")
+
+// RetentionPolicy limits the historical configs kept by a persister. Configs are pruned whenever a
+// new config is persisted. The current config is always kept, as is the stable version of a rollout
+// it stages.
+type RetentionPolicy struct {
+	// MaxVersions is the number of most recent configs to keep, if positive.
+	MaxVersions int
+
+	// MaxAge is how long to keep configs for, based on the date they were created, if positive.
+	MaxAge time.Duration
+}
+
+// KeepAll is a RetentionPolicy that never prunes configs.
+var KeepAll = RetentionPolicy{}
+
+// historicalConfig is a marshalled config, along with what's needed to order and prune it. key
+// identifies the config in the persister's storage.
+type historicalConfig struct {
+	key        string
+	marshalled []byte
+	version    int32
+	date       int64
+
+	// The version the rest of the fleet serves, if this config stages a rollout.
+	stableVersion int32
+	staged        bool
+}
+
+// newHistory unmarshals configs keyed by their key in storage, ordering them newest first.
+func newHistory(configs map[string][]byte) ([]*historicalConfig, error) {
+	history := make([]*historicalConfig, 0, len(configs))
+
+	for key, b := range configs {
+		cfg, err := Unmarshal(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		stableVersion, staged := StableVersion(cfg)
+		history = append(history, &historicalConfig{
+			key:           key,
+			marshalled:    b,
+			version:       cfg.Version,
+			date:          cfg.Date,
+			stableVersion: stableVersion,
+			staged:        staged})
+	}
+
+	sort.Slice(history, func(i, j int) bool { return history[i].version > history[j].version })
+
+	return history, nil
+}
+
+// page returns readers of the configs in history, which must be ordered newest first, selected by
+// p.
+func (p HistoryPage) page(history []*historicalConfig) []io.Reader {
+	var readers []io.Reader
+
+	for _, c := range history {
+		if p.Limit > 0 && len(readers) == p.Limit {
+			break
+		}
+
+		if p.Before > 0 && c.version >= p.Before {
+			continue
+		}
+
+		readers = append(readers, bytes.NewReader(c.marshalled))
+	}
+
+	return readers
+}
+
+// readHistory returns readers of the configs selected by page, unmarshalling configs to order them.
+func readHistory(configs map[string][]byte, page HistoryPage) ([]io.Reader, error) {
+	history, err := newHistory(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	return page.page(history), nil
+}
+
+// StableVersion returns the version nodes that aren't canaries keep serving while cfg is staged,
+// and whether cfg stages a rollout that is still in progress.
+func StableVersion(cfg *pb.ServiceConfig) (int32, bool) {
+	if cfg.GetRollout() == nil || cfg.Rollout.Stage != pb.Rollout_CANARY {
+		return 0, false
+	}
+
+	return cfg.Rollout.StableVersion, true
+}
+
+// expired returns the keys of configs in history, which must be ordered newest first, that aren't
+// retained. The config with key current is always retained, along with the stable version of a
+// rollout it stages.
+func (r RetentionPolicy) expired(history []*historicalConfig, current string, now time.Time) []string {
+	var keys []string
+	oldest := now.Add(-r.MaxAge).Unix()
+
+	var staging *historicalConfig
+	for _, c := range history {
+		if c.key == current && c.staged {
+			staging = c
+		}
+	}
+
+	for i, c := range history {
+		if c.key == current || (staging != nil && c.version == staging.stableVersion) {
+			continue
+		}
+
+		if (r.MaxVersions > 0 && i >= r.MaxVersions) || (r.MaxAge > 0 && c.date < oldest) {
+			keys = append(keys, c.key)
+		}
+	}
+
+	return keys
+}
+
+// prune returns the keys of configs, keyed by their key in storage, that aren't retained.
+func (r RetentionPolicy) prune(configs map[string][]byte, current string) ([]string, error) {
+	if r == KeepAll {
+		return nil, nil
+	}
+
+	history, err := newHistory(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.expired(history, current, time.Now()), nil
+}
@@ -0,0 +1,41 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Now()
+	history := []*historicalConfig{
+		{key: "d", version: 4, date: now.Unix()},
+		{key: "c", version: 3, date: now.Add(-time.Minute).Unix()},
+		{key: "b", version: 2, date: now.Add(-time.Hour).Unix()},
+		{key: "a", version: 1, date: now.Add(-2 * time.Hour).Unix()}}
+
+	for _, test := range []struct {
+		retention RetentionPolicy
+		current   string
+		expected  []string
+	}{
+		{KeepAll, "d", nil},
+		{RetentionPolicy{MaxVersions: 2}, "d", []string{"b", "a"}},
+		{RetentionPolicy{MaxAge: 30 * time.Minute}, "d", []string{"b", "a"}},
+		{RetentionPolicy{MaxVersions: 3, MaxAge: 90 * time.Minute}, "d", []string{"a"}},
+		// The current config is always kept.
+		{RetentionPolicy{MaxVersions: 1}, "a", []string{"c", "b"}},
+	} {
+		if expired := test.retention.expired(history, test.current, now); !reflect.DeepEqual(expired, test.expected) {
+			t.Errorf("Expected %+v to expire %v, got %v", test.retention, test.expected, expired)
+		}
+	}
+	// The stable version of a rollout the current config stages is kept too.
+	history[0].staged, history[0].stableVersion = true, 2
+	if expired := (RetentionPolicy{MaxVersions: 1}).expired(history, "d", now); !reflect.DeepEqual(expired, []string{"c", "a"}) {
+		t.Errorf("Expected the stable version to be retained, got %v expired", expired)
+	}
+}
@@ -0,0 +1,64 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// LabelSelector selects namespaces or buckets by their labels. Each key must be present with the
+// given value, or with any value if the value is empty.
+type LabelSelector map[string]string
+
+// ParseLabelSelector parses selectors of the form key=value, or just key to select any value.
+func ParseLabelSelector(selectors []string) (LabelSelector, error) {
+	s := make(LabelSelector, len(selectors))
+
+	for _, selector := range selectors {
+		parts := strings.SplitN(selector, "=", 2)
+
+		if parts[0] == "" {
+			return nil, fmt.Errorf("Invalid label selector %q; expected key=value", selector)
+		}
+
+		if len(parts) == 1 {
+			s[parts[0]] = ""
+		} else {
+			s[parts[0]] = parts[1]
+		}
+	}
+
+	return s, nil
+}
+
+// Matches returns true if labels satisfy every requirement of the selector.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for key, value := range s {
+		actual, exists := labels[key]
+
+		if !exists || (value != "" && actual != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FilterNamespaces returns a copy of cfg only holding the namespaces whose labels match s. The
+// namespace configs themselves are shared with cfg.
+func FilterNamespaces(cfg *pbconfig.ServiceConfig, s LabelSelector) *pbconfig.ServiceConfig {
+	filtered := *cfg
+	filtered.Namespaces = make(map[string]*pbconfig.NamespaceConfig)
+
+	for name, ns := range cfg.Namespaces {
+		if s.Matches(ns.Labels) {
+			filtered.Namespaces[name] = ns
+		}
+	}
+
+	return &filtered
+}
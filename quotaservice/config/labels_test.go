@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+const metadataYaml = `namespaces:
+  payments:
+    owner: payments-team
+    description: Card payment processing
+    contact: payments@example.com
+    labels:
+      team: payments
+      tier: critical
+    buckets:
+      charges:
+        description: Charges made by merchants
+        labels:
+          pci: "true"
+  search:
+    owner: search-team
+    labels:
+      team: search
+`
+
+func TestMetadataRoundTrip(t *testing.T) {
+	cfg, err := FromYAML([]byte(metadataYaml))
+	helpers.CheckError(t, err)
+
+	payments := cfg.Namespaces["payments"]
+	if payments.Owner != "payments-team" || payments.Contact != "payments@example.com" ||
+		payments.Labels["tier"] != "critical" || payments.Buckets["charges"].Labels["pci"] != "true" {
+		t.Fatalf("Metadata was not read: %+v", payments)
+	}
+
+	y, err := ToYAML(cfg)
+	helpers.CheckError(t, err)
+	fromYAML, err := FromYAML(y)
+	helpers.CheckError(t, err)
+
+	if !proto.Equal(cfg, fromYAML) {
+		t.Errorf("Metadata did not survive YAML: %+v != %+v", cfg, fromYAML)
+	}
+
+	r, err := Marshal(cfg)
+	helpers.CheckError(t, err)
+	unmarshalled, err := Unmarshal(r)
+	helpers.CheckError(t, err)
+
+	if !proto.Equal(cfg, unmarshalled) {
+		t.Errorf("Metadata did not survive marshalling: %+v != %+v", cfg, unmarshalled)
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	s, err := ParseLabelSelector([]string{"team=payments", "tier"})
+	helpers.CheckError(t, err)
+
+	for _, c := range []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{map[string]string{"team": "payments", "tier": "critical"}, true},
+		{map[string]string{"team": "payments", "tier": ""}, true},
+		{map[string]string{"team": "payments"}, false},
+		{map[string]string{"team": "search", "tier": "critical"}, false},
+		{nil, false}} {
+		if s.Matches(c.labels) != c.expected {
+			t.Errorf("Expected %v to match %v: %v", s, c.labels, c.expected)
+		}
+	}
+
+	if _, err := ParseLabelSelector([]string{"=payments"}); err == nil {
+		t.Error("Expected a selector without a key to be invalid")
+	}
+}
+
+func TestFilterNamespaces(t *testing.T) {
+	cfg, err := FromYAML([]byte(metadataYaml))
+	helpers.CheckError(t, err)
+
+	s, err := ParseLabelSelector([]string{"team=search"})
+	helpers.CheckError(t, err)
+	filtered := FilterNamespaces(cfg, s)
+
+	if len(filtered.Namespaces) != 1 || filtered.Namespaces["search"] == nil {
+		t.Errorf("Expected only the search namespace, got %+v", filtered.Namespaces)
+	}
+
+	if len(cfg.Namespaces) != 2 {
+		t.Errorf("Filtering should not change the config: %+v", cfg.Namespaces)
+	}
+}
@@ -7,18 +7,30 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"sync"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
 )
 
 type MemoryConfigPersister struct {
-	config  string
-	configs map[string][]byte
+	config    string
+	configs   map[string][]byte
+	retention RetentionPolicy
 	*Notifier
+	sync.RWMutex
 }
 
 func NewMemoryConfigPersister() ConfigPersister {
+	return NewMemoryConfigPersisterWithRetention(KeepAll)
+}
+
+// NewMemoryConfigPersisterWithRetention creates a MemoryConfigPersister that prunes historical
+// configs according to retention.
+func NewMemoryConfigPersisterWithRetention(retention RetentionPolicy) ConfigPersister {
 	p := &MemoryConfigPersister{
-		configs:  make(map[string][]byte),
-		Notifier: NewNotifier()}
+		configs:   make(map[string][]byte),
+		retention: retention,
+		Notifier:  NewNotifier()}
 
 	p.Notify()
 	return p
@@ -31,29 +43,100 @@ func (m *MemoryConfigPersister) PersistAndNotify(marshalledConfig io.Reader) err
 		return err
 	}
 
+	m.Lock()
+	m.persistLocked(b)
+	m.Unlock()
+
+	return nil
+}
+
+// PersistIfVersion persists a marshalled configuration passed in, provided the current config is at
+// the expected version.
+func (m *MemoryConfigPersister) PersistIfVersion(expected int32, marshalledConfig io.Reader) error {
+	b, err := ioutil.ReadAll(marshalledConfig)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	version, err := versionOf(m.configs[m.config])
+	if err != nil {
+		return err
+	}
+
+	if version != expected {
+		return ErrConcurrentUpdate
+	}
+
+	m.persistLocked(b)
+	return nil
+}
+
+func (m *MemoryConfigPersister) persistLocked(b []byte) {
 	m.config = HashConfig(b)
 	m.configs[m.config] = b
 
+	expired, err := m.retention.prune(m.configs, m.config)
+	if err != nil {
+		logging.Printf("Unable to prune historical configs: %v", err)
+	}
+
+	for _, key := range expired {
+		delete(m.configs, key)
+	}
+
 	// ... and notify
 	m.Notify()
-
-	return nil
 }
 
 // ReadPersistedConfig provides a reader to a marshalled config previously persisted.
 func (m *MemoryConfigPersister) ReadPersistedConfig() (io.Reader, error) {
+	m.RLock()
+	defer m.RUnlock()
+
 	return bytes.NewReader(m.configs[m.config]), nil
 }
 
-// ReadHistoricalConfigs returns an array of previously persisted configs
-func (m *MemoryConfigPersister) ReadHistoricalConfigs() ([]io.Reader, error) {
-	var readers []io.Reader
+// ReadHistoricalConfigs returns an array of previously persisted configs selected by page, newest
+// first.
+func (m *MemoryConfigPersister) ReadHistoricalConfigs(page HistoryPage) ([]io.Reader, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	return readHistory(m.configs, page)
+}
+
+// RewriteHistoricalConfigs replaces each historical config with the config rewrite returns for it,
+// if that is different.
+func (m *MemoryConfigPersister) RewriteHistoricalConfigs(rewrite func([]byte) ([]byte, error)) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	rewritten := 0
+
+	for key, b := range m.configs {
+		newB, err := rewrite(b)
+		if err != nil {
+			return rewritten, err
+		}
+
+		if bytes.Equal(b, newB) {
+			continue
+		}
+
+		newKey := HashConfig(newB)
+		delete(m.configs, key)
+		m.configs[newKey] = newB
+		rewritten++
 
-	for _, v := range m.configs {
-		readers = append(readers, bytes.NewReader(v))
+		if key == m.config {
+			m.config = newKey
+		}
 	}
 
-	return readers, nil
+	return rewritten, nil
 }
 
 // ConfigChangedWatcher returns a channel that is notified whenever configuration changes are
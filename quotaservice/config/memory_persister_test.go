@@ -56,7 +56,7 @@ func TestMemoryPersistence(t *testing.T) {
 		t.Fatalf("Configs should be equal! %+v != %+v", s, unmarshalled)
 	}
 
-	cfgs, e := persister.ReadHistoricalConfigs()
+	cfgs, e := persister.ReadHistoricalConfigs(AllHistory)
 	helpers.CheckError(t, e)
 
 	if len(cfgs) != 1 {
@@ -70,3 +70,17 @@ func TestMemoryPersistence(t *testing.T) {
 		t.Fatalf("Configs should be equal! %+v != %+v", s, unmarshalled)
 	}
 }
+
+func TestMemoryPersistIfVersion(t *testing.T) {
+	persister := NewMemoryConfigPersister()
+	<-persister.ConfigChangedWatcher()
+
+	testPersistIfVersion(t, persister)
+}
+
+func TestMemoryRetention(t *testing.T) {
+	persister := NewMemoryConfigPersisterWithRetention(RetentionPolicy{MaxVersions: 2})
+	<-persister.ConfigChangedWatcher()
+
+	testRetention(t, persister)
+}
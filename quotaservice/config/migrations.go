@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// CurrentSchemaVersion is the schema version of configs written by this version of the
+// quotaservice. Configs persisted before schema versions were introduced are at version 0.
+const CurrentSchemaVersion = 1
+
+// Migration upgrades a config, in place, to the schema version after the one it is registered for.
+type Migration func(*pbconfig.ServiceConfig) error
+
+// migrations upgrade configs from the schema version they are keyed by. When a change to
+// configs.proto changes how existing configs must be interpreted, bump CurrentSchemaVersion and
+// register a migration from the previous version.
+var migrations = map[int32]Migration{
+	0: migrateNamesFromKeys,
+}
+
+// ErrHistoryNotRewritable is returned by MigrateHistory for persisters that don't implement
+// HistoryRewriter.
+var ErrHistoryNotRewritable = errors.New("Persister can't rewrite historical configs")
+
+// HistoryRewriter is implemented by ConfigPersisters that can replace historical configs in place.
+type HistoryRewriter interface {
+	// RewriteHistoricalConfigs passes each marshalled historical config to rewrite, replacing it
+	// with the marshalled config returned if that is different. The current config stays current.
+	// Returns the number of configs replaced.
+	RewriteHistoricalConfigs(rewrite func([]byte) ([]byte, error)) (int, error)
+}
+
+// Migrate upgrades a config to CurrentSchemaVersion, applying each migration registered between
+// its schema version and the current one in turn. Returns true if the config was upgraded, or an
+// error if it was written by a newer version of the quotaservice.
+func Migrate(cfg *pbconfig.ServiceConfig) (bool, error) {
+	if cfg.SchemaVersion > CurrentSchemaVersion {
+		return false, fmt.Errorf("Config version %v has schema version %v, newer than supported version %v",
+			cfg.Version, cfg.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	migrated := cfg.SchemaVersion < CurrentSchemaVersion
+
+	for cfg.SchemaVersion < CurrentSchemaVersion {
+		migration, exists := migrations[cfg.SchemaVersion]
+		if !exists {
+			return false, fmt.Errorf("No migration from schema version %v", cfg.SchemaVersion)
+		}
+
+		if err := migration(cfg); err != nil {
+			return false, fmt.Errorf("Unable to migrate config version %v from schema version %v: %v",
+				cfg.Version, cfg.SchemaVersion, err)
+		}
+
+		cfg.SchemaVersion++
+	}
+
+	return migrated, nil
+}
+
+// MigrateHistory upgrades every historical config stored by a persister to CurrentSchemaVersion in
+// place, so configs are no longer migrated each time they're read. Config versions are unchanged.
+// Returns the number of configs upgraded.
+func MigrateHistory(p ConfigPersister) (int, error) {
+	rewriter, ok := p.(HistoryRewriter)
+	if !ok {
+		return 0, ErrHistoryNotRewritable
+	}
+
+	return rewriter.RewriteHistoricalConfigs(func(b []byte) ([]byte, error) {
+		cfg, err := Unmarshal(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		migrated, err := Migrate(cfg)
+		if err != nil || !migrated {
+			return b, err
+		}
+
+		r, err := Marshal(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.ReadAll(r)
+	})
+}
+
+// migrateNamesFromKeys records the names of namespaces and buckets in their configs. Configs
+// written before schema versions could leave them to be inferred from map keys.
+func migrateNamesFromKeys(cfg *pbconfig.ServiceConfig) error {
+	for name, ns := range cfg.Namespaces {
+		if ns == nil {
+			continue
+		}
+
+		if ns.Name == "" {
+			ns.Name = name
+		}
+
+		for bucketName, b := range ns.Buckets {
+			if b == nil {
+				continue
+			}
+
+			if b.Name == "" {
+				b.Name = bucketName
+			}
+
+			if b.Namespace == "" {
+				b.Namespace = ns.Name
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+// unversionedConfig returns a config as written before schema versions, leaving names to be
+// inferred from map keys.
+func unversionedConfig(version int32) *pbconfig.ServiceConfig {
+	return &pbconfig.ServiceConfig{
+		Version: version,
+		Namespaces: map[string]*pbconfig.NamespaceConfig{
+			"ns": {Buckets: map[string]*pbconfig.BucketConfig{"b": {Size: 10}}}}}
+}
+
+func TestMigrationsRegistered(t *testing.T) {
+	for v := int32(0); v < CurrentSchemaVersion; v++ {
+		if migrations[v] == nil {
+			t.Errorf("No migration from schema version %v", v)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	cfg := unversionedConfig(3)
+
+	migrated, err := Migrate(cfg)
+	helpers.CheckError(t, err)
+
+	b := cfg.Namespaces["ns"].Buckets["b"]
+	if !migrated || cfg.SchemaVersion != CurrentSchemaVersion || cfg.Namespaces["ns"].Name != "ns" ||
+		b.Name != "b" || b.Namespace != "ns" {
+		t.Errorf("Expected names to be migrated, got %+v", cfg)
+	}
+
+	// Migrating a current config changes nothing.
+	if migrated, err := Migrate(cfg); err != nil || migrated {
+		t.Errorf("Expected a current config not to be migrated, got %v and %v", migrated, err)
+	}
+
+	cfg.SchemaVersion = CurrentSchemaVersion + 1
+	if _, err := Migrate(cfg); err == nil {
+		t.Error("Expected a config with a newer schema version to fail")
+	}
+}
+
+func TestNewConfigsAreCurrent(t *testing.T) {
+	if v := NewDefaultServiceConfig().SchemaVersion; v != CurrentSchemaVersion {
+		t.Errorf("Expected new configs to have schema version %v, got %v", CurrentSchemaVersion, v)
+	}
+
+	cfg, err := FromYAML([]byte("namespaces:\n  ns:\n    buckets:\n      b:\n        size: 10\n"))
+	helpers.CheckError(t, err)
+
+	if cfg.SchemaVersion != CurrentSchemaVersion || cfg.Namespaces["ns"].Buckets["b"].Name != "b" {
+		t.Errorf("Expected YAML without a schema version to be migrated, got %+v", cfg)
+	}
+}
+
+func TestMigrateHistory(t *testing.T) {
+	p := NewMemoryConfigPersister()
+
+	for _, cfg := range []*pbconfig.ServiceConfig{unversionedConfig(1), unversionedConfig(2), unversionedConfig(3)} {
+		r, err := Marshal(cfg)
+		helpers.CheckError(t, err)
+		helpers.CheckError(t, p.PersistAndNotify(r))
+	}
+
+	migrated, err := MigrateHistory(p)
+	helpers.CheckError(t, err)
+
+	if migrated != 3 {
+		t.Errorf("Expected 3 configs to be migrated, got %v", migrated)
+	}
+
+	readers, err := p.ReadHistoricalConfigs(AllHistory)
+	helpers.CheckError(t, err)
+
+	for i, r := range readers {
+		cfg, err := Unmarshal(r)
+		helpers.CheckError(t, err)
+
+		if cfg.Version != int32(3-i) || cfg.SchemaVersion != CurrentSchemaVersion {
+			t.Errorf("Expected version %v to be migrated in place, got %+v", 3-i, cfg)
+		}
+	}
+
+	// The current config stays current.
+	r, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	persisted, err := Unmarshal(r)
+	helpers.CheckError(t, err)
+
+	if persisted.Version != 3 || persisted.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("Expected version 3 to stay current, got %+v", persisted)
+	}
+
+	if migrated, err := MigrateHistory(p); err != nil || migrated != 0 {
+		t.Errorf("Expected nothing left to migrate, got %v and %v", migrated, err)
+	}
+}
+
+func TestMigrateHistoryNotRewritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_test_persistence")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	p, err := NewDiskConfigPersister(filepath.Join(dir, "config"))
+	helpers.CheckError(t, err)
+	defer p.(*DiskConfigPersister).Close()
+
+	if _, err := MigrateHistory(p); err != ErrHistoryNotRewritable {
+		t.Errorf("Expected ErrHistoryNotRewritable, got %v", err)
+	}
+}
@@ -86,6 +86,9 @@ func DeleteBucket(clonedCfg *pbconfig.ServiceConfig, namespace, name string) err
 		}
 	}
 
+	// A bucket recreated later shouldn't inherit the boost.
+	removeBoost(clonedCfg, namespace, name)
+
 	return nil
 }
 
@@ -95,6 +98,9 @@ func DeleteNamespace(clonedCfg *pbconfig.ServiceConfig, n string) error {
 	}
 
 	delete(clonedCfg.Namespaces, n)
+	filterBoosts(clonedCfg, func(b *pbconfig.BucketBoost) bool {
+		return b.Namespace == n
+	})
 
 	return nil
 }
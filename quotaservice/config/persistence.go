@@ -4,26 +4,46 @@
 package config
 
 import (
+	"bytes"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 )
 
+// ErrConcurrentUpdate is returned when a config couldn't be persisted because the current config
+// was changed by someone else at the same time.
+var ErrConcurrentUpdate = errors.New("current config was changed concurrently")
+
 // ConfigPersister is an interface that persists configs and notifies a channel of changes.
 type ConfigPersister interface {
 	// PersistAndNotify persists a marshalled configuration passed in.
 	PersistAndNotify(io.Reader) error
+	// PersistIfVersion persists a marshalled configuration passed in, provided the currently
+	// persisted configuration is at the expected version. Otherwise, ErrConcurrentUpdate is returned
+	// and nothing is persisted.
+	PersistIfVersion(expected int32, marshalledConfig io.Reader) error
 	// ConfigChangedWatcher returns a channel that is notified whenever configuration changes are
 	// detected. Changes are coalesced so that a single notification may be emitted for multiple
 	// changes.
 	ConfigChangedWatcher() <-chan struct{}
 	// ReadPersistedConfig provides a reader to a marshalled config previously persisted.
 	ReadPersistedConfig() (io.Reader, error)
-	// Returns an array of readers of historical configurations.
-	ReadHistoricalConfigs() ([]io.Reader, error)
+	// Returns an array of readers of the historical configurations selected by page, newest first.
+	ReadHistoricalConfigs(page HistoryPage) ([]io.Reader, error)
 }
 
 // HashConfig returns the MD5 of a config byte array.
 func HashConfig(config []byte) string {
 	return fmt.Sprintf("%x", md5.Sum(config))
 }
+
+// versionOf returns the version of a marshalled config, or 0 if there is no config.
+func versionOf(marshalledConfig []byte) (int32, error) {
+	cfg, err := Unmarshal(bytes.NewReader(marshalledConfig))
+	if err != nil {
+		return 0, err
+	}
+
+	return cfg.Version, nil
+}
@@ -0,0 +1,92 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+// testPersistIfVersion checks that a persister only persists configs when the current config is at
+// the expected version. Any pending notifications must have been consumed beforehand.
+func testPersistIfVersion(t *testing.T, p ConfigPersister) {
+	// t.Helper()
+
+	persistVersion := func(expected, version int32) error {
+		cfg := NewDefaultServiceConfig()
+		cfg.Version = version
+		r, err := Marshal(cfg)
+		helpers.CheckError(t, err)
+		return p.PersistIfVersion(expected, r)
+	}
+
+	helpers.CheckError(t, persistVersion(0, 1))
+	waitForNotification(t, p)
+
+	if err := persistVersion(0, 2); err != ErrConcurrentUpdate {
+		t.Fatalf("Expected ErrConcurrentUpdate, got %v", err)
+	}
+
+	helpers.CheckError(t, persistVersion(1, 2))
+	waitForNotification(t, p)
+
+	r, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+	cfg, err := Unmarshal(r)
+	helpers.CheckError(t, err)
+
+	if cfg.Version != 2 {
+		t.Fatalf("Expected version 2 to be persisted, was %v", cfg.Version)
+	}
+}
+
+// testRetention checks that a persister created with RetentionPolicy{MaxVersions: 2} prunes older
+// configs, and pages through the ones it retains. Any pending notifications must have been
+// consumed beforehand.
+func testRetention(t *testing.T, p ConfigPersister) {
+	// t.Helper()
+
+	for version := int32(1); version <= 4; version++ {
+		cfg := NewDefaultServiceConfig()
+		cfg.Version = version
+		r, err := Marshal(cfg)
+		helpers.CheckError(t, err)
+		helpers.CheckError(t, p.PersistIfVersion(version-1, r))
+		waitForNotification(t, p)
+	}
+
+	checkVersions := func(page HistoryPage, expected ...int32) {
+		cfgs, err := p.ReadHistoricalConfigs(page)
+		helpers.CheckError(t, err)
+
+		var versions []int32
+		for _, r := range cfgs {
+			cfg, err := Unmarshal(r)
+			helpers.CheckError(t, err)
+			versions = append(versions, cfg.Version)
+		}
+
+		if !reflect.DeepEqual(versions, expected) {
+			t.Fatalf("Expected versions %v for page %+v, got %v", expected, page, versions)
+		}
+	}
+
+	checkVersions(AllHistory, 4, 3)
+	checkVersions(HistoryPage{Limit: 1}, 4)
+	checkVersions(HistoryPage{Before: 4, Limit: 1}, 3)
+	checkVersions(HistoryPage{Before: 3})
+}
+
+func waitForNotification(t *testing.T, p ConfigPersister) {
+	// t.Helper()
+
+	select {
+	case <-p.ConfigChangedWatcher():
+	case <-time.After(time.Second * 5):
+		t.Fatalf("Did not receive notification!")
+	}
+}
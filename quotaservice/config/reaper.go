@@ -3,13 +3,20 @@
 
 package config
 
-import "time"
+import (
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/clock"
+)
 
 // ReaperConfig represents the configuration settings for the bucket reaper.
 type ReaperConfig struct {
 	BucketWatcherBuffer int
 	InitSleep           time.Duration
 	MinFrequency        time.Duration
+	// Clock is used to determine how long buckets have been idle for, and which of their schedule
+	// rules are active.
+	Clock clock.Clock
 }
 
 // NewReaperConfig returns a new ReaperConfig with defaults.
@@ -17,5 +24,6 @@ func NewReaperConfig() ReaperConfig {
 	return ReaperConfig{
 		BucketWatcherBuffer: 10000,
 		InitSleep:           10 * time.Second,
-		MinFrequency:        10 * time.Minute}
+		MinFrequency:        10 * time.Minute,
+		Clock:               clock.System}
 }
@@ -0,0 +1,235 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// cronField describes the range of values of one of the fields of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6}}
+
+// cronSpec is a parsed cron expression. Each field is a bitset of the values it matches.
+type cronSpec struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek uint64
+	// As with cron, if both days of the month and days of the week are restricted, a day matches
+	// if either matches.
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+// parseCron parses a cron expression of five fields: minute, hour, day of month, month and day of
+// week. Each field is *, a number, a range a-b, or a comma-separated list of those, optionally
+// followed by a step /n; a number with a step ranges up to the field's maximum. Sunday is day 0 of
+// the week.
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields, has %d", expr, len(cronFields), len(fields))
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expr, err)
+		}
+
+		sets[i] = set
+	}
+
+	return &cronSpec{
+		minutes:       sets[0],
+		hours:         sets[1],
+		daysOfMonth:   sets[2],
+		months:        sets[3],
+		daysOfWeek:    sets[4],
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*"}, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %v %q", f.name, part)
+			}
+
+			part = part[:i]
+		}
+
+		from, to := f.min, f.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid %v %q", f.name, part)
+			}
+
+			if len(bounds) == 1 && step == 1 {
+				to = from
+			} else if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid %v %q", f.name, part)
+				}
+			}
+
+			if from < f.min || to > f.max || from > to {
+				return 0, fmt.Errorf("%v %q is out of range %d-%d", f.name, part, f.min, f.max)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func matches(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	if !matches(c.months, int(t.Month())) {
+		return false
+	}
+
+	dom := matches(c.daysOfMonth, t.Day())
+	dow := matches(c.daysOfWeek, int(t.Weekday()))
+
+	switch {
+	case c.anyDayOfMonth:
+		return dow
+	case c.anyDayOfWeek:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// firedSince tells you whether the expression fired at any minute between earliest and t,
+// inclusive. Minutes are searched backwards from t, skipping days and hours that don't match.
+func (c *cronSpec) firedSince(earliest, t time.Time) bool {
+	loc := t.Location()
+	s := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+
+	for !s.Before(earliest) {
+		switch {
+		case !c.dayMatches(s):
+			// Skip to the last minute of the previous day.
+			s = time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !matches(c.hours, s.Hour()):
+			// Skip to the last minute of the previous hour.
+			s = time.Date(s.Year(), s.Month(), s.Day(), s.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+		case !matches(c.minutes, s.Minute()):
+			s = s.Add(-time.Minute)
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// ruleActive tells you whether a schedule rule is active at t.
+func ruleActive(r *pbconfig.ScheduleRule, t time.Time) (bool, error) {
+	if r.NotBefore != 0 && t.Unix() < r.NotBefore {
+		return false, nil
+	}
+
+	if r.NotAfter != 0 && t.Unix() >= r.NotAfter {
+		return false, nil
+	}
+
+	if r.Cron == "" {
+		return true, nil
+	}
+
+	spec, err := parseCron(r.Cron)
+	if err != nil {
+		return false, err
+	}
+
+	loc := time.UTC
+	if r.TimeZone != "" {
+		if loc, err = time.LoadLocation(r.TimeZone); err != nil {
+			return false, err
+		}
+	}
+
+	t = t.In(loc)
+	duration := time.Duration(r.DurationMillis) * time.Millisecond
+	return spec.firedSince(t.Add(-duration).Add(time.Nanosecond), t), nil
+}
+
+// ActiveScheduleRule returns the first of a bucket's schedule rules that is active at t, or nil if
+// none are. Invalid rules are never active.
+func ActiveScheduleRule(b *pbconfig.BucketConfig, t time.Time) *pbconfig.ScheduleRule {
+	for _, r := range b.GetSchedule() {
+		if active, err := ruleActive(r, t); err == nil && active {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// ScheduledBucketConfig returns the config a bucket is served with at t, along with the schedule
+// rule that is active, if any. If a rule is active, this is a copy of b with the size and fill rate
+// set by the rule; otherwise, it is b itself.
+func ScheduledBucketConfig(b *pbconfig.BucketConfig, t time.Time) (*pbconfig.BucketConfig, *pbconfig.ScheduleRule) {
+	r := ActiveScheduleRule(b, t)
+	if r == nil {
+		return b, nil
+	}
+
+	scheduled := proto.Clone(b).(*pbconfig.BucketConfig)
+	if r.Size > 0 {
+		scheduled.Size = r.Size
+	}
+
+	if r.FillRate > 0 {
+		scheduled.FillRate = r.FillRate
+	}
+
+	return scheduled, r
+}
+
+// SameSchedule returns true if both lists hold the same rules, in the same order.
+func SameSchedule(s1, s2 []*pbconfig.ScheduleRule) bool {
+	if len(s1) != len(s2) {
+		return false
+	}
+
+	for i := range s1 {
+		if !proto.Equal(s1[i], s2[i]) {
+			return false
+		}
+	}
+
+	return true
+}
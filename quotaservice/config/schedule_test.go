@@ -0,0 +1,96 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "0 22 * * *", "*/15 9-17 * * 1-5", "0,30 0 1 1,7 *", "5/10 * * * 0"} {
+		if _, err := parseCron(expr); err != nil {
+			t.Errorf("Expected %q to be valid: %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 7", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expected %q to be invalid", expr)
+		}
+	}
+
+	spec, err := parseCron("5/20 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for minute, expected := range map[int]bool{5: true, 25: true, 45: true, 0: false, 6: false} {
+		if matches(spec.minutes, minute) != expected {
+			t.Errorf("Expected minute %v to match: %v", minute, expected)
+		}
+	}
+}
+
+func TestActiveScheduleRule(t *testing.T) {
+	// Monday, 19 October 2026.
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	overnight := &pbconfig.ScheduleRule{
+		Name:           "overnight",
+		Cron:           "0 22 * * *",
+		DurationMillis: 8 * 3600 * 1000,
+		Size:           1000}
+	weekdays := &pbconfig.ScheduleRule{
+		Name:           "weekdays",
+		Cron:           "0 9 * * 1-5",
+		DurationMillis: 8 * 3600 * 1000,
+		FillRate:       10,
+		TimeZone:       "America/New_York"}
+	migration := &pbconfig.ScheduleRule{
+		Name:      "migration",
+		NotBefore: monday.Add(48 * time.Hour).Unix(),
+		NotAfter:  monday.Add(72 * time.Hour).Unix(),
+		Size:      5000}
+	b := &pbconfig.BucketConfig{Size: 100, FillRate: 50,
+		Schedule: []*pbconfig.ScheduleRule{migration, overnight, weekdays}}
+
+	for offset, expected := range map[time.Duration]string{
+		0:                            "overnight",
+		5*time.Hour + 59*time.Minute: "overnight",
+		6 * time.Hour:                "",
+		12 * time.Hour:               "",
+		// 9am in New York is 1pm UTC.
+		13 * time.Hour:                "weekdays",
+		20*time.Hour + 59*time.Minute: "weekdays",
+		21 * time.Hour:                "",
+		22 * time.Hour:                "overnight",
+		// The migration takes precedence over other rules, and only applies on Wednesday.
+		48 * time.Hour: "migration",
+		61 * time.Hour: "migration",
+		72 * time.Hour: "overnight",
+		// Saturday afternoon.
+		5*24*time.Hour + 13*time.Hour: "",
+	} {
+		rule := ActiveScheduleRule(b, monday.Add(offset))
+		if rule.GetName() != expected {
+			t.Errorf("Expected rule %q to be active at %v, got %q", expected, monday.Add(offset), rule.GetName())
+		}
+	}
+
+	scheduled, rule := ScheduledBucketConfig(b, monday)
+	if rule != overnight || scheduled.Size != 1000 || scheduled.FillRate != 50 {
+		t.Errorf("Expected the overnight size and configured fill rate, got %+v", scheduled)
+	}
+
+	if b.Size != 100 {
+		t.Errorf("Bucket config was modified: %+v", b)
+	}
+
+	if scheduled, rule = ScheduledBucketConfig(b, monday.Add(12*time.Hour)); rule != nil || scheduled != b {
+		t.Errorf("Expected the bucket's own config without an active rule, got %+v", scheduled)
+	}
+}
@@ -0,0 +1,336 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// ValidationError describes a problem with a single field of a config. Path identifies the field
+// using the names it has in YAML and JSON, e.g. namespaces.foo.buckets.bar.fill_rate.
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is the list of problems found by Validate.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	return "Invalid config: " + strings.Join(e.Strings(), "; ")
+}
+
+// Strings returns a description of each problem.
+func (e ValidationErrors) Strings() []string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+
+	return s
+}
+
+func (e *ValidationErrors) add(path, format string, args ...interface{}) {
+	*e = append(*e, &ValidationError{path, fmt.Sprintf(format, args...)})
+}
+
+// Validate checks that a config is well formed, so defaults can be applied to it and it can be
+// served. Buckets are checked as they will be once defaults are applied. If any problems are
+// found, they are all returned as ValidationErrors.
+func Validate(cfg *pbconfig.ServiceConfig) error {
+	var errs ValidationErrors
+
+	if cfg.BucketDefaults != nil {
+		validateBucketDefaults(&errs, "bucket_defaults", cfg.BucketDefaults)
+	}
+
+	if cfg.GlobalDefaultBucket != nil {
+		validateBucket(&errs, "global_default_bucket", cfg.GlobalDefaultBucket, cfg.BucketDefaults)
+	}
+
+	names := NamespaceNames(cfg)
+	sort.Strings(names)
+
+	for _, name := range names {
+		ns := cfg.Namespaces[name]
+		path := "namespaces." + name
+
+		if ns == nil {
+			errs.add(path, "namespace has no config")
+			continue
+		}
+
+		if ns.Name != "" && ns.Name != name {
+			errs.add(path+".name", "namespace is named %v", ns.Name)
+		}
+
+		if ns.MaxDynamicBuckets < 0 {
+			errs.add(path+".max_dynamic_buckets", "must not be negative, is %v", ns.MaxDynamicBuckets)
+		}
+
+		validateLabels(&errs, path, ns.Labels)
+
+		if ns.BucketDefaults != nil {
+			validateBucketDefaults(&errs, path+".bucket_defaults", ns.BucketDefaults)
+		}
+
+		if ns.DefaultBucket != nil && ns.DynamicBucketTemplate != nil {
+			errs.add(path, "namespace is not allowed to have a default bucket as well as allow dynamic buckets")
+		}
+
+		if ns.DefaultBucket != nil {
+			validateBucket(&errs, path+".default_bucket", ns.DefaultBucket, ns.BucketDefaults, cfg.BucketDefaults)
+		}
+
+		if ns.DynamicBucketTemplate != nil {
+			validateBucket(&errs, path+".dynamic_bucket_template", ns.DynamicBucketTemplate, ns.BucketDefaults, cfg.BucketDefaults)
+		}
+
+		bucketNames := make([]string, 0, len(ns.Buckets))
+		for n := range ns.Buckets {
+			bucketNames = append(bucketNames, n)
+		}
+
+		sort.Strings(bucketNames)
+
+		for _, bucketName := range bucketNames {
+			b := ns.Buckets[bucketName]
+			bucketPath := path + ".buckets." + bucketName
+
+			if b == nil {
+				errs.add(bucketPath, "bucket has no config")
+				continue
+			}
+
+			if b.Name != "" && b.Name != bucketName {
+				errs.add(bucketPath+".name", "bucket is named %v", b.Name)
+			}
+
+			validateBucket(&errs, bucketPath, b, ns.BucketDefaults, cfg.BucketDefaults)
+		}
+	}
+
+	validateBoosts(&errs, cfg)
+
+	if cfg.Rollout != nil {
+		validateRollout(&errs, "rollout", cfg.Rollout)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func validateBucket(errs *ValidationErrors, path string, b *pbconfig.BucketConfig, defaults ...*pbconfig.BucketConfig) {
+	// Zero values are inherited from defaults, so check the bucket as it will be served.
+	effective := proto.Clone(b).(*pbconfig.BucketConfig)
+	applyInheritedDefaults(effective, defaults...)
+
+	validateLabels(errs, path, b.Labels)
+
+	if effective.Size < 0 {
+		errs.add(path+".size", "must not be negative, is %v", effective.Size)
+	}
+
+	if effective.FillRate <= 0 {
+		errs.add(path+".fill_rate", "must be positive, is %v", effective.FillRate)
+	}
+
+	// Only configured values are checked, as the built-in default is the fill rate.
+	if maxTokens := configuredMaxTokensPerRequest(b, defaults...); maxTokens < 0 {
+		errs.add(path+".max_tokens_per_request", "must not be negative, is %v", maxTokens)
+	} else if maxTokens > 0 && maxTokens > effective.Size {
+		errs.add(path+".max_tokens_per_request", "must not exceed size %v, is %v", effective.Size, maxTokens)
+	}
+
+	if effective.WaitTimeoutMillis > effective.MaxDebtMillis {
+		errs.add(path+".wait_timeout_millis", "must not exceed max_debt_millis %v, is %v",
+			effective.MaxDebtMillis, effective.WaitTimeoutMillis)
+	}
+
+	names := make(map[string]bool, len(b.Schedule))
+	for i, r := range b.Schedule {
+		rulePath := fmt.Sprintf("%v.schedule.%d", path, i)
+
+		if r == nil {
+			errs.add(rulePath, "rule has no config")
+			continue
+		}
+
+		if r.Name == "" {
+			errs.add(rulePath+".name", "must not be empty")
+		} else if names[r.Name] {
+			errs.add(rulePath+".name", "rule %v is defined more than once", r.Name)
+		}
+
+		names[r.Name] = true
+		validateScheduleRule(errs, rulePath, r, configuredMaxTokensPerRequest(b, defaults...))
+	}
+}
+
+func validateScheduleRule(errs *ValidationErrors, path string, r *pbconfig.ScheduleRule, maxTokens int64) {
+	if r.Cron != "" {
+		if _, err := parseCron(r.Cron); err != nil {
+			errs.add(path+".cron", "%v", err)
+		}
+
+		if r.DurationMillis <= 0 {
+			errs.add(path+".duration_millis", "must be positive, is %v", r.DurationMillis)
+		}
+	} else {
+		if r.DurationMillis != 0 {
+			errs.add(path+".duration_millis", "must not be set without a cron expression")
+		}
+
+		if r.NotBefore == 0 && r.NotAfter == 0 {
+			errs.add(path, "rule without a cron expression must set not_before or not_after")
+		}
+	}
+
+	if r.NotBefore != 0 && r.NotAfter != 0 && r.NotAfter <= r.NotBefore {
+		errs.add(path+".not_after", "must be after not_before %v, is %v", r.NotBefore, r.NotAfter)
+	}
+
+	if r.TimeZone != "" {
+		if _, err := time.LoadLocation(r.TimeZone); err != nil {
+			errs.add(path+".time_zone", "unknown time zone %v", r.TimeZone)
+		}
+	}
+
+	if r.Size < 0 {
+		errs.add(path+".size", "must not be negative, is %v", r.Size)
+	} else if r.Size > 0 && maxTokens > r.Size {
+		errs.add(path+".size", "must not be less than max_tokens_per_request %v, is %v", maxTokens, r.Size)
+	}
+
+	if r.FillRate < 0 {
+		errs.add(path+".fill_rate", "must not be negative, is %v", r.FillRate)
+	}
+
+	if r.Size == 0 && r.FillRate == 0 {
+		errs.add(path, "rule must set size or fill_rate")
+	}
+}
+
+// configuredMaxTokensPerRequest returns the max tokens per request a bucket has or inherits from
+// defaults, or zero if it is left to the built-in default.
+func configuredMaxTokensPerRequest(b *pbconfig.BucketConfig, defaults ...*pbconfig.BucketConfig) int64 {
+	if b.MaxTokensPerRequest != 0 {
+		return b.MaxTokensPerRequest
+	}
+
+	for _, d := range defaults {
+		if d != nil && d.MaxTokensPerRequest != 0 {
+			return d.MaxTokensPerRequest
+		}
+	}
+
+	return 0
+}
+
+// validateBucketDefaults checks bucket defaults, which only hold the fields buckets inherit. The
+// buckets inheriting them are checked as a whole.
+func validateBucketDefaults(errs *ValidationErrors, path string, d *pbconfig.BucketConfig) {
+	for _, f := range bucketFields {
+		if f.value(d) < 0 && f.name != "max_idle_millis" {
+			errs.add(path+"."+f.name, "must not be negative, is %v", f.value(d))
+		}
+	}
+
+	if len(d.Schedule) > 0 {
+		errs.add(path+".schedule", "schedules are not inherited; set them on buckets")
+	}
+}
+
+// validateBoosts checks each boost, and the bucket it boosts as it is served while boosted. Boosts
+// of buckets that don't exist are ignored when the config is served, so they are allowed.
+func validateBoosts(errs *ValidationErrors, cfg *pbconfig.ServiceConfig) {
+	boosted := make(map[string]bool, len(cfg.Boosts))
+	for i, boost := range cfg.Boosts {
+		path := fmt.Sprintf("boosts.%d", i)
+
+		if boost == nil || boost.Config == nil {
+			errs.add(path, "boost has no config")
+			continue
+		}
+
+		if boost.Namespace == "" || boost.BucketName == "" {
+			errs.add(path, "namespace and bucket_name must not be empty")
+			continue
+		}
+
+		fqn := FullyQualifiedName(boost.Namespace, boost.BucketName)
+		if boosted[fqn] {
+			errs.add(path, "bucket %v is boosted more than once", fqn)
+		}
+
+		boosted[fqn] = true
+
+		if boost.Expires <= 0 {
+			errs.add(path+".expires", "must be positive, is %v", boost.Expires)
+		}
+
+		if len(boost.Config.Schedule) > 0 {
+			errs.add(path+".config.schedule", "boosts can't set a schedule")
+		}
+
+		b := boostedBucket(cfg, boost.Namespace, boost.BucketName)
+		if b == nil {
+			continue
+		}
+
+		b = proto.Clone(b).(*pbconfig.BucketConfig)
+		applyBoost(b, boost)
+		b.Labels = nil
+
+		defaults := []*pbconfig.BucketConfig{cfg.BucketDefaults}
+		if boost.Namespace != GlobalNamespace {
+			defaults = []*pbconfig.BucketConfig{cfg.Namespaces[boost.Namespace].BucketDefaults, cfg.BucketDefaults}
+		}
+
+		validateBucket(errs, path+".config", b, defaults...)
+	}
+}
+
+func validateRollout(errs *ValidationErrors, path string, r *pbconfig.Rollout) {
+	if r.StableVersion < 0 {
+		errs.add(path+".stable_version", "must not be negative, is %v", r.StableVersion)
+	}
+
+	if r.BakeMillis < 0 {
+		errs.add(path+".bake_millis", "must not be negative, is %v", r.BakeMillis)
+	}
+
+	if r.MaxRejectionRateIncrease < 0 || r.MaxRejectionRateIncrease > 1 {
+		errs.add(path+".max_rejection_rate_increase", "must be between 0 and 1, is %v", r.MaxRejectionRateIncrease)
+	}
+
+	if r.MinRequests < 0 {
+		errs.add(path+".min_requests", "must not be negative, is %v", r.MinRequests)
+	}
+	if r.DeadlineMillis < 0 {
+		errs.add(path+".deadline_millis", "must not be negative, is %v", r.DeadlineMillis)
+	}
+}
+
+func validateLabels(errs *ValidationErrors, path string, labels map[string]string) {
+	for key := range labels {
+		if key == "" || strings.Contains(key, "=") {
+			errs.add(path+".labels", "label key %q must be non-empty and not contain '='", key)
+		}
+	}
+}
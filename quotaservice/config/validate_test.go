@@ -0,0 +1,133 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package config
+
+import (
+	"testing"
+
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := NewDefaultServiceConfig()
+	cfg.GlobalDefaultBucket = NewDefaultBucketConfig(DefaultBucketName)
+	ns := NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, AddBucket(ns, NewDefaultBucketConfig("b")))
+	helpers.CheckError(t, AddNamespace(cfg, ns))
+
+	helpers.CheckError(t, Validate(cfg))
+}
+
+func TestValidateInvalid(t *testing.T) {
+	for name, breaker := range map[string]func(*pbconfig.NamespaceConfig){
+		"mismatched namespace name": func(ns *pbconfig.NamespaceConfig) { ns.Name = "other" },
+		"mismatched bucket name":    func(ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].Name = "other" },
+		"negative size":             func(ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].Size = -1 },
+		"negative fill rate":        func(ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].FillRate = -1 },
+		"negative dynamic buckets":  func(ns *pbconfig.NamespaceConfig) { ns.MaxDynamicBuckets = -1 },
+		"too many tokens":           func(ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].MaxTokensPerRequest = 101 },
+		"long wait timeout":         func(ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].WaitTimeoutMillis = 10001 },
+		"empty label key":           func(ns *pbconfig.NamespaceConfig) { ns.Labels = map[string]string{"": "x"} },
+		"bucket label key with =":   func(ns *pbconfig.NamespaceConfig) { ns.Buckets["b"].Labels = map[string]string{"a=b": "x"} },
+		"defaulted wait timeout": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].WaitTimeoutMillis = 0
+			ns.Buckets["b"].MaxDebtMillis = 500
+		},
+		"inherited wait timeout": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].MaxDebtMillis = 0
+			ns.BucketDefaults = &pbconfig.BucketConfig{MaxDebtMillis: 500}
+		},
+		"inherited max tokens": func(ns *pbconfig.NamespaceConfig) {
+			ns.BucketDefaults = &pbconfig.BucketConfig{MaxTokensPerRequest: 101}
+		},
+		"negative bucket defaults": func(ns *pbconfig.NamespaceConfig) {
+			ns.BucketDefaults = &pbconfig.BucketConfig{FillRate: -1}
+		},
+		"invalid cron": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", Cron: "0 25 * * *", DurationMillis: 1000, Size: 10}}
+		},
+		"cron without duration": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", Cron: "0 22 * * *", Size: 10}}
+		},
+		"unbounded rule": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", Size: 10}}
+		},
+		"rule without limits": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", NotBefore: 1}}
+		},
+		"unknown time zone": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", Cron: "0 22 * * *", DurationMillis: 1000, TimeZone: "Mars/Olympus", Size: 10}}
+		},
+		"duplicate rule names": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", NotBefore: 1, Size: 10}, {Name: "r", NotBefore: 1, Size: 20}}
+		},
+		"rule smaller than max tokens": func(ns *pbconfig.NamespaceConfig) {
+			ns.Buckets["b"].MaxTokensPerRequest = 50
+			ns.Buckets["b"].Schedule = []*pbconfig.ScheduleRule{{Name: "r", NotBefore: 1, Size: 10}}
+		},
+		"scheduled bucket defaults": func(ns *pbconfig.NamespaceConfig) {
+			ns.BucketDefaults = &pbconfig.BucketConfig{Schedule: []*pbconfig.ScheduleRule{{Name: "r", NotBefore: 1, Size: 10}}}
+		},
+		"default and dynamic": func(ns *pbconfig.NamespaceConfig) {
+			ns.DefaultBucket = NewDefaultBucketConfig(DefaultBucketName)
+			ns.DynamicBucketTemplate = NewDefaultBucketConfig(DynamicBucketTemplateName)
+		}} {
+		cfg := NewDefaultServiceConfig()
+		ns := NewDefaultNamespaceConfig("ns")
+		helpers.CheckError(t, AddBucket(ns, NewDefaultBucketConfig("b")))
+		helpers.CheckError(t, AddNamespace(cfg, ns))
+		breaker(ns)
+
+		if Validate(cfg) == nil {
+			t.Errorf("Expected config with %v to be invalid", name)
+		}
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	cfg := NewDefaultServiceConfig()
+	cfg.GlobalDefaultBucket = &pbconfig.BucketConfig{Size: -1}
+	ns := NewDefaultNamespaceConfig("ns")
+	helpers.CheckError(t, AddBucket(ns, &pbconfig.BucketConfig{Name: "b", FillRate: -1, MaxTokensPerRequest: -1}))
+	helpers.CheckError(t, AddNamespace(cfg, ns))
+
+	errs, ok := Validate(cfg).(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, got %+v", errs)
+	}
+
+	expected := []string{
+		"global_default_bucket.size",
+		"namespaces.ns.buckets.b.fill_rate",
+		"namespaces.ns.buckets.b.max_tokens_per_request"}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %v errors, got %+v", len(expected), errs.Strings())
+	}
+
+	for i, path := range expected {
+		if errs[i].Path != path {
+			t.Errorf("Expected error %v to be for %v, was %v", i, path, errs[i])
+		}
+	}
+}
+
+func TestValidateInvalidRollout(t *testing.T) {
+	for name, r := range map[string]*pbconfig.Rollout{
+		"negative stable version": {StableVersion: -1},
+		"negative bake":           {BakeMillis: -1},
+		"negative deadline":       {DeadlineMillis: -1},
+		"negative min requests":   {MinRequests: -1},
+		"negative rate increase":  {MaxRejectionRateIncrease: -0.1},
+		"rate increase above 1":   {MaxRejectionRateIncrease: 1.5},
+	} {
+		cfg := NewDefaultServiceConfig()
+		cfg.Rollout = r
+
+		if Validate(cfg) == nil {
+			t.Errorf("Expected config with %v to be invalid", name)
+		}
+	}
+}
@@ -33,6 +33,9 @@ type ZkConfigPersister struct {
 	// Current configuration hash
 	config string
 
+	// Version of the znode at path holding the current configuration hash
+	nodeVersion int32
+
 	// Historical map of configurations
 	// hash -> marshalled config
 	configs map[string][]byte
@@ -40,6 +43,8 @@ type ZkConfigPersister struct {
 	// Base Zookeeper path
 	path string
 
+	retention RetentionPolicy
+
 	watcher chan struct{}
 
 	conn  *zk.Conn
@@ -53,6 +58,12 @@ type ZkConfigPersister struct {
 type connOption func(c *zk.Conn)
 
 func NewZkConfigPersister(path string, servers []string, options ...connOption) (ConfigPersister, error) {
+	return NewZkConfigPersisterWithRetention(path, servers, KeepAll, options...)
+}
+
+// NewZkConfigPersisterWithRetention creates a ZkConfigPersister that deletes the nodes of historical
+// configs according to retention, whenever it persists a config.
+func NewZkConfigPersisterWithRetention(path string, servers []string, retention RetentionPolicy, options ...connOption) (ConfigPersister, error) {
 	conn, _, err := zk.Connect(servers, sessionTimeout, func(c *zk.Conn) {
 		c.SetLogger(logging.CurrentLogger())
 
@@ -74,10 +85,11 @@ func NewZkConfigPersister(path string, servers []string, options ...connOption)
 	}
 
 	persister := &ZkConfigPersister{
-		conn:    conn,
-		path:    path,
-		watcher: make(chan struct{}, 1),
-		configs: make(map[string][]byte)}
+		conn:      conn,
+		path:      path,
+		retention: retention,
+		watcher:   make(chan struct{}, 1),
+		configs:   make(map[string][]byte)}
 
 	watch, err := persister.createWatch(persister.currentConfigEventListener)
 
@@ -169,11 +181,14 @@ func (z *ZkConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error {
 		return e
 	}
 
+	key := HashConfig(b)
+
 	z.RLock()
-	defer z.RUnlock()
+	current := z.config
+	expired := z.expiredLocked(key, b)
+	z.RUnlock()
 
-	key := HashConfig(b)
-	if key == z.config {
+	if key == current {
 		return nil
 	}
 
@@ -181,11 +196,134 @@ func (z *ZkConfigPersister) PersistAndNotify(marshalledConfig io.Reader) error {
 		return err
 	}
 
-	_, err := z.conn.Set(z.path, []byte(key), -1)
+	stat, err := z.conn.Set(z.path, []byte(key), -1)
+	if err != nil {
+		return err
+	}
+
+	z.setCurrent(key, b, stat.Version, expired)
+	z.deleteConfigs(expired)
 
 	// There is no notification, that happens when zookeeper alerts the watcher
 
-	return err
+	return nil
+}
+
+// PersistIfVersion persists a marshalled configuration passed in, provided the current config is at
+// the expected version. The config is archived and made current in a single multi-op, conditional
+// on the version of the znode holding the current config hash.
+func (z *ZkConfigPersister) PersistIfVersion(expected int32, marshalledConfig io.Reader) error {
+	b, e := ioutil.ReadAll(marshalledConfig)
+
+	if e != nil {
+		return e
+	}
+
+	key := HashConfig(b)
+
+	z.RLock()
+	version, err := versionOf(z.configs[z.config])
+	nodeVersion := z.nodeVersion
+	_, archived := z.configs[key]
+	expired := z.expiredLocked(key, b)
+	z.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	if version != expected {
+		return ErrConcurrentUpdate
+	}
+
+	var ops []interface{}
+	if !archived {
+		ops = append(ops, &zk.CreateRequest{
+			Path: fmt.Sprintf("%s/%s", z.path, key),
+			Data: b,
+			Acl:  zk.WorldACL(zk.PermAll)})
+	}
+
+	ops = append(ops, &zk.SetDataRequest{Path: z.path, Data: []byte(key), Version: nodeVersion})
+
+	responses, err := z.conn.Multi(ops...)
+	if err == zk.ErrBadVersion {
+		return ErrConcurrentUpdate
+	}
+
+	for _, rsp := range responses {
+		if rsp.Error == zk.ErrBadVersion {
+			return ErrConcurrentUpdate
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The new config is current right away, so further updates from this persister don't conflict
+	// with it before the watcher has seen it. There is no notification, that happens when zookeeper
+	// alerts the watcher.
+	z.setCurrent(key, b, responses[len(responses)-1].Stat.Version, expired)
+	z.deleteConfigs(expired)
+
+	return nil
+}
+
+// setCurrent makes the config with the given key current, as of the given version of the znode at
+// path, unless the watcher has already seen a later version.
+func (z *ZkConfigPersister) setCurrent(key string, current []byte, nodeVersion int32, expired []string) {
+	z.Lock()
+	defer z.Unlock()
+
+	if nodeVersion <= z.nodeVersion {
+		return
+	}
+
+	// The watcher reads configs without holding the lock, so they are replaced rather than updated.
+	configs := make(map[string][]byte, len(z.configs)+1)
+	for k, v := range z.configs {
+		configs[k] = v
+	}
+
+	for _, k := range expired {
+		delete(configs, k)
+	}
+
+	configs[key] = current
+
+	z.configs = configs
+	z.config = key
+	z.nodeVersion = nodeVersion
+}
+
+// expiredLocked returns the keys of historical configs that aren't retained once the config with
+// the given key is current. Must be called with at least a read lock held.
+func (z *ZkConfigPersister) expiredLocked(key string, current []byte) []string {
+	configs := make(map[string][]byte, len(z.configs)+1)
+	for k, v := range z.configs {
+		configs[k] = v
+	}
+
+	configs[key] = current
+
+	expired, err := z.retention.prune(configs, key)
+	if err != nil {
+		logging.Printf("Unable to prune historical configs in %s: %+v", z.path, err)
+		return nil
+	}
+
+	return expired
+}
+
+// deleteConfigs deletes the nodes of historical configs with the given keys.
+func (z *ZkConfigPersister) deleteConfigs(keys []string) {
+	for _, k := range keys {
+		path := fmt.Sprintf("%s/%s", z.path, k)
+		if err := z.conn.Delete(path, -1); err != nil && err != zk.ErrNoNode {
+			logging.Printf("Received error from zookeeper when deleting %s: %+v", path, err)
+		}
+	}
 }
 
 // ReadPersistedConfig provides a reader to a marshalled config previously persisted.
@@ -204,9 +342,19 @@ func (z *ZkConfigPersister) currentConfigEventListener() (<-chan zk.Event, error
 		return nil, err
 	}
 
+	z.RLock()
+	known := z.configs
+	z.RUnlock()
+
 	configs := make(map[string][]byte)
 
 	for _, child := range children {
+		// Configs are keyed by their hash, so never change once created.
+		if data, exists := known[child]; exists {
+			configs[child] = data
+			continue
+		}
+
 		path := fmt.Sprintf("%s/%s", z.path, child)
 		data, _, err := z.conn.Get(path)
 
@@ -218,7 +366,7 @@ func (z *ZkConfigPersister) currentConfigEventListener() (<-chan zk.Event, error
 		configs[child] = data
 	}
 
-	config, _, ch, err := z.conn.GetW(z.path)
+	config, stat, ch, err := z.conn.GetW(z.path)
 
 	if err != nil {
 		logging.Printf("Received error from zookeeper when fetching %s: %+v", z.path, err)
@@ -230,6 +378,7 @@ func (z *ZkConfigPersister) currentConfigEventListener() (<-chan zk.Event, error
 
 	z.configs = configs
 	z.config = string(config)
+	z.nodeVersion = stat.Version
 
 	select {
 	case z.watcher <- struct{}{}:
@@ -247,6 +396,86 @@ func (z *ZkConfigPersister) archiveConfig(key string, config []byte) error {
 	return err
 }
 
+// RewriteHistoricalConfigs replaces each historical config with the config rewrite returns for it,
+// if that is different. Configs are keyed by their hash, so each is replaced by a new node. The
+// changes are made in a single multi-op, which fails with ErrConcurrentUpdate if the current config
+// changed meanwhile.
+func (z *ZkConfigPersister) RewriteHistoricalConfigs(rewrite func([]byte) ([]byte, error)) (int, error) {
+	z.RLock()
+	known := z.configs
+	previous := z.config
+	nodeVersion := z.nodeVersion
+	z.RUnlock()
+
+	var ops []interface{}
+	configs := make(map[string][]byte, len(known))
+	current := previous
+	rewritten := 0
+
+	for key, b := range known {
+		newB, err := rewrite(b)
+		if err != nil {
+			return 0, err
+		}
+
+		if bytes.Equal(b, newB) {
+			configs[key] = b
+			continue
+		}
+
+		newKey := HashConfig(newB)
+		ops = append(ops,
+			&zk.CreateRequest{Path: fmt.Sprintf("%s/%s", z.path, newKey), Data: newB, Acl: zk.WorldACL(zk.PermAll)},
+			&zk.DeleteRequest{Path: fmt.Sprintf("%s/%s", z.path, key), Version: -1})
+		configs[newKey] = newB
+		rewritten++
+
+		if key == previous {
+			current = newKey
+		}
+	}
+
+	if rewritten == 0 {
+		return 0, nil
+	}
+
+	if current != previous {
+		ops = append(ops, &zk.SetDataRequest{Path: z.path, Data: []byte(current), Version: nodeVersion})
+	} else {
+		ops = append(ops, &zk.CheckVersionRequest{Path: z.path, Version: nodeVersion})
+	}
+
+	responses, err := z.conn.Multi(ops...)
+	if err == zk.ErrBadVersion {
+		return 0, ErrConcurrentUpdate
+	}
+
+	for _, rsp := range responses {
+		if rsp.Error == zk.ErrBadVersion {
+			return 0, ErrConcurrentUpdate
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if stat := responses[len(responses)-1].Stat; stat != nil {
+		nodeVersion = stat.Version
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	if nodeVersion >= z.nodeVersion {
+		z.configs = configs
+		z.config = current
+		z.nodeVersion = nodeVersion
+	}
+
+	return rewritten, nil
+}
+
 // ConfigChangedWatcher returns a channel that is notified whenever configuration changes are
 // detected. Changes are coalesced so that a single notification may be emitted for multiple
 // changes.
@@ -254,18 +483,13 @@ func (z *ZkConfigPersister) ConfigChangedWatcher() <-chan struct{} {
 	return z.watcher
 }
 
-// ReadHistoricalConfigs returns an array of previously persisted configs
-func (z *ZkConfigPersister) ReadHistoricalConfigs() ([]io.Reader, error) {
+// ReadHistoricalConfigs returns an array of previously persisted configs selected by page, newest
+// first.
+func (z *ZkConfigPersister) ReadHistoricalConfigs(page HistoryPage) ([]io.Reader, error) {
 	z.RLock()
 	defer z.RUnlock()
 
-	var readers []io.Reader
-
-	for _, config := range z.configs {
-		readers = append(readers, bytes.NewReader(config))
-	}
-
-	return readers, nil
+	return readHistory(z.configs, page)
 }
 
 // Close makes sure all event listeners are done
@@ -164,6 +164,46 @@ func TestSetAndNotify(t *testing.T) {
 	}
 }
 
+func TestPersistIfVersion(t *testing.T) {
+	p, err := NewZkConfigPersister("/conditional", servers)
+	helpers.CheckError(t, err)
+
+	defer p.(*ZkConfigPersister).Close()
+
+	<-p.ConfigChangedWatcher()
+
+	testPersistIfVersion(t, p)
+}
+
+func TestBackToBackPersists(t *testing.T) {
+	p, err := NewZkConfigPersister("/backtoback", servers)
+	helpers.CheckError(t, err)
+
+	defer p.(*ZkConfigPersister).Close()
+
+	<-p.ConfigChangedWatcher()
+
+	// The second write doesn't wait for the watcher to see the first one.
+	for i, ns := range []string{"foo", "bar"} {
+		cfg := NewDefaultServiceConfig()
+		cfg.Version = int32(i + 1)
+		cfg.Namespaces[ns] = NewDefaultNamespaceConfig(ns)
+		r, err := Marshal(cfg)
+		helpers.CheckError(t, err)
+		helpers.CheckError(t, p.PersistIfVersion(int32(i), r))
+	}
+
+	ioCfg, err := p.ReadPersistedConfig()
+	helpers.CheckError(t, err)
+
+	cfg, err := Unmarshal(ioCfg)
+	helpers.CheckError(t, err)
+
+	if cfg.Version != 2 || cfg.Namespaces["bar"] == nil {
+		t.Errorf("Expected the second config to be current, got %+v", cfg)
+	}
+}
+
 func TestHistoricalConfigs(t *testing.T) {
 	p, err := NewZkConfigPersister("/historic", servers)
 	helpers.CheckError(t, err)
@@ -172,7 +212,7 @@ func TestHistoricalConfigs(t *testing.T) {
 
 	<-p.ConfigChangedWatcher()
 
-	cfgs, err := p.ReadHistoricalConfigs()
+	cfgs, err := p.ReadHistoricalConfigs(AllHistory)
 	helpers.CheckError(t, err)
 
 	if len(cfgs) != 1 {
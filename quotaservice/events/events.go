@@ -20,6 +20,7 @@ const (
 	EVENT_BUCKET_MISS
 	EVENT_BUCKET_CREATED
 	EVENT_BUCKET_REMOVED
+	EVENT_SCHEDULE_CHANGED
 )
 
 var eventNames = []string{
@@ -28,7 +29,8 @@ var eventNames = []string{
 	EVENT_TOO_MANY_TOKENS_REQUESTED: "EVENT_TOO_MANY_TOKENS_REQUESTED",
 	EVENT_BUCKET_MISS:               "EVENT_BUCKET_MISS",
 	EVENT_BUCKET_CREATED:            "EVENT_BUCKET_CREATED",
-	EVENT_BUCKET_REMOVED:            "EVENT_BUCKET_REMOVED"}
+	EVENT_BUCKET_REMOVED:            "EVENT_BUCKET_REMOVED",
+	EVENT_SCHEDULE_CHANGED:          "EVENT_SCHEDULE_CHANGED"}
 
 func (et EventType) String() string {
 	name := eventNames[et]
@@ -48,6 +50,14 @@ type Event interface {
 	WaitTime() time.Duration
 }
 
+// ScheduleEvent is an Event with the type EVENT_SCHEDULE_CHANGED, emitted when a bucket's schedule
+// rules change the limits it is served with.
+type ScheduleEvent interface {
+	Event
+	// ScheduleRule is the name of the rule that became active, or empty if no rule is active.
+	ScheduleRule() string
+}
+
 // EventProducer is a hook into the notification system, to inform listeners that certain events
 // take place.
 type EventProducer struct {
@@ -149,6 +159,20 @@ func (t *tokenWaitEvent) WaitTime() time.Duration {
 	return t.waitTime
 }
 
+type scheduleEvent struct {
+	*namedEvent
+	rule string
+}
+
+func (s *scheduleEvent) String() string {
+	return fmt.Sprintf("scheduleEvent{type: %v, namespace: %v, name: %v, dynamic: %v, rule: %v}",
+		s.eventType, s.namespace, s.bucketName, s.dynamic, s.rule)
+}
+
+func (s *scheduleEvent) ScheduleRule() string {
+	return s.rule
+}
+
 // NewTokensServedEvent creates a new event with the type EVENT_TOKENS_SERVED
 func NewTokensServedEvent(namespace, bucketName string, dynamic bool, numTokens int64, waitTime time.Duration) Event {
 	return &tokenWaitEvent{
@@ -187,6 +211,13 @@ func NewBucketRemovedEvent(namespace, bucketName string, dynamic bool) Event {
 	return newNamedEvent(namespace, bucketName, dynamic, EVENT_BUCKET_REMOVED)
 }
 
+// NewScheduleChangedEvent creates a new ScheduleEvent with the type EVENT_SCHEDULE_CHANGED
+func NewScheduleChangedEvent(namespace, bucketName string, dynamic bool, rule string) Event {
+	return &scheduleEvent{
+		namedEvent: newNamedEvent(namespace, bucketName, dynamic, EVENT_SCHEDULE_CHANGED),
+		rule:       rule}
+}
+
 func newNamedEvent(namespace, bucketName string, dynamic bool, eventType EventType) *namedEvent {
 	return &namedEvent{
 		eventType:  eventType,
@@ -17,6 +17,7 @@ var s Server
 var qs QuotaService
 var eventsChan <-chan events.Event
 var mbf *MockBucketFactory
+var clk *helpers.FakeClock
 
 func TestMain(m *testing.M) {
 	setUp()
@@ -56,7 +57,10 @@ func setUp() {
 	mbf = &MockBucketFactory{}
 	me := &MockEndpoint{}
 	p := config.NewMemoryConfig(cfg)
-	s = New(mbf, p, NewReaperConfigForTests(), 0, me)
+	clk = helpers.NewFakeClock(time.Now())
+	reaperCfg := NewReaperConfigForTests()
+	reaperCfg.Clock = clk
+	s = New(mbf, p, reaperCfg, 0, me)
 	ecLocal := make(chan events.Event, 100)
 	s.SetListener(func(e events.Event) {
 		ecLocal <- e
@@ -145,12 +149,16 @@ func TestBucketRemoval(t *testing.T) {
 	}
 	clearEvents(6)
 
-	// GC thread should run every 100ms for this namespace. Make sure it runs at least once.
-	time.Sleep(300 * time.Millisecond)
-
-	for i := 0; i < 3; i++ {
-		e := <-eventsChan
-		checkEvent("dyn_gc", e.BucketName(), true, events.EVENT_BUCKET_REMOVED, 0, 0, e, t)
+	// GC thread should run every 100ms for this namespace. Keep moving the clock forward until it has
+	// removed all buckets; the reaper runs asynchronously, so give it a chance to catch up each time.
+	for i := 0; i < 3; {
+		select {
+		case e := <-eventsChan:
+			checkEvent("dyn_gc", e.BucketName(), true, events.EVENT_BUCKET_REMOVED, 0, 0, e, t)
+			i++
+		case <-time.After(5 * time.Millisecond):
+			clk.Advance(100 * time.Millisecond)
+		}
 	}
 }
 
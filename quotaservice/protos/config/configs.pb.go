@@ -12,6 +12,9 @@ It has these top-level messages:
 	ServiceConfig
 	NamespaceConfig
 	BucketConfig
+	ScheduleRule
+	BucketBoost
+	Rollout
 */
 package quotaservice_configs
 
@@ -30,6 +33,30 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type Rollout_Stage int32
+
+const (
+	Rollout_CANARY      Rollout_Stage = 0
+	Rollout_PROMOTED    Rollout_Stage = 1
+	Rollout_ROLLED_BACK Rollout_Stage = 2
+)
+
+var Rollout_Stage_name = map[int32]string{
+	0: "CANARY",
+	1: "PROMOTED",
+	2: "ROLLED_BACK",
+}
+var Rollout_Stage_value = map[string]int32{
+	"CANARY":      0,
+	"PROMOTED":    1,
+	"ROLLED_BACK": 2,
+}
+
+func (x Rollout_Stage) String() string {
+	return proto.EnumName(Rollout_Stage_name, int32(x))
+}
+func (Rollout_Stage) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{5, 0} }
+
 // Representations of configuration elements, for persisting and sharing across nodes.
 type ServiceConfig struct {
 	GlobalDefaultBucket *BucketConfig               `protobuf:"bytes,1,opt,name=global_default_bucket,json=globalDefaultBucket" json:"global_default_bucket,omitempty" yaml:"global_default_bucket"`
@@ -38,6 +65,14 @@ type ServiceConfig struct {
 	Version int32  `protobuf:"varint,3,opt,name=version" json:"version,omitempty" yaml:"version"`
 	User    string `protobuf:"bytes,4,opt,name=user" json:"user,omitempty" yaml:"user"`
 	Date    int64  `protobuf:"varint,5,opt,name=date" json:"date,omitempty" yaml:"date"`
+	// Defaults for unset fields of every bucket, overridden by namespaces' bucket defaults
+	BucketDefaults *BucketConfig `protobuf:"bytes,6,opt,name=bucket_defaults,json=bucketDefaults" json:"bucket_defaults,omitempty" yaml:"bucket_defaults"`
+	// Temporary changes to buckets, removed once they expire
+	Boosts []*BucketBoost `protobuf:"bytes,7,rep,name=boosts" json:"boosts,omitempty" yaml:"boosts"`
+	// A staged rollout of this configuration, if it was first applied to canary nodes
+	Rollout *Rollout `protobuf:"bytes,8,opt,name=rollout" json:"rollout,omitempty" yaml:"rollout"`
+	// Version of the schema the configuration was written with, upgraded by migrations on read
+	SchemaVersion int32 `protobuf:"varint,9,opt,name=schema_version,json=schemaVersion" json:"schema_version,omitempty" yaml:"schema_version"`
 }
 
 func (m *ServiceConfig) Reset()                    { *m = ServiceConfig{} }
@@ -80,12 +115,47 @@ func (m *ServiceConfig) GetDate() int64 {
 	return 0
 }
 
+func (m *ServiceConfig) GetBucketDefaults() *BucketConfig {
+	if m != nil {
+		return m.BucketDefaults
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetBoosts() []*BucketBoost {
+	if m != nil {
+		return m.Boosts
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetRollout() *Rollout {
+	if m != nil {
+		return m.Rollout
+	}
+	return nil
+}
+
+func (m *ServiceConfig) GetSchemaVersion() int32 {
+	if m != nil {
+		return m.SchemaVersion
+	}
+	return 0
+}
+
 type NamespaceConfig struct {
 	Name                  string                   `protobuf:"bytes,1,opt,name=name" json:"name,omitempty" yaml:"name"`
 	DefaultBucket         *BucketConfig            `protobuf:"bytes,2,opt,name=default_bucket,json=defaultBucket" json:"default_bucket,omitempty" yaml:"default_bucket"`
 	DynamicBucketTemplate *BucketConfig            `protobuf:"bytes,3,opt,name=dynamic_bucket_template,json=dynamicBucketTemplate" json:"dynamic_bucket_template,omitempty" yaml:"dynamic_bucket_template"`
 	MaxDynamicBuckets     int32                    `protobuf:"varint,4,opt,name=max_dynamic_buckets,json=maxDynamicBuckets" json:"max_dynamic_buckets,omitempty" yaml:"max_dynamic_buckets"`
 	Buckets               map[string]*BucketConfig `protobuf:"bytes,5,rep,name=buckets" json:"buckets,omitempty" yaml:"buckets" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Metadata for the namespace, which doesn't affect quotas
+	Owner       string            `protobuf:"bytes,6,opt,name=owner" json:"owner,omitempty" yaml:"owner"`
+	Description string            `protobuf:"bytes,7,opt,name=description" json:"description,omitempty" yaml:"description"`
+	Contact     string            `protobuf:"bytes,8,opt,name=contact" json:"contact,omitempty" yaml:"contact"`
+	Labels      map[string]string `protobuf:"bytes,9,rep,name=labels" json:"labels,omitempty" yaml:"labels" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Defaults for unset fields of the namespace's buckets
+	BucketDefaults *BucketConfig `protobuf:"bytes,10,opt,name=bucket_defaults,json=bucketDefaults" json:"bucket_defaults,omitempty" yaml:"bucket_defaults"`
 }
 
 func (m *NamespaceConfig) Reset()                    { *m = NamespaceConfig{} }
@@ -128,6 +198,41 @@ func (m *NamespaceConfig) GetBuckets() map[string]*BucketConfig {
 	return nil
 }
 
+func (m *NamespaceConfig) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *NamespaceConfig) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *NamespaceConfig) GetContact() string {
+	if m != nil {
+		return m.Contact
+	}
+	return ""
+}
+
+func (m *NamespaceConfig) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *NamespaceConfig) GetBucketDefaults() *BucketConfig {
+	if m != nil {
+		return m.BucketDefaults
+	}
+	return nil
+}
+
 type BucketConfig struct {
 	Name                string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty" yaml:"name"`
 	Namespace           string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty" yaml:"namespace"`
@@ -137,6 +242,13 @@ type BucketConfig struct {
 	MaxIdleMillis       int64  `protobuf:"varint,6,opt,name=max_idle_millis,json=maxIdleMillis" json:"max_idle_millis,omitempty" yaml:"max_idle_millis"`
 	MaxDebtMillis       int64  `protobuf:"varint,7,opt,name=max_debt_millis,json=maxDebtMillis" json:"max_debt_millis,omitempty" yaml:"max_debt_millis"`
 	MaxTokensPerRequest int64  `protobuf:"varint,8,opt,name=max_tokens_per_request,json=maxTokensPerRequest" json:"max_tokens_per_request,omitempty" yaml:"max_tokens_per_request"`
+	// Metadata for the bucket, which doesn't affect quotas
+	Owner       string            `protobuf:"bytes,9,opt,name=owner" json:"owner,omitempty" yaml:"owner"`
+	Description string            `protobuf:"bytes,10,opt,name=description" json:"description,omitempty" yaml:"description"`
+	Contact     string            `protobuf:"bytes,11,opt,name=contact" json:"contact,omitempty" yaml:"contact"`
+	Labels      map[string]string `protobuf:"bytes,12,rep,name=labels" json:"labels,omitempty" yaml:"labels" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Rules overriding the size and fill rate at certain times. The first active rule applies.
+	Schedule []*ScheduleRule `protobuf:"bytes,13,rep,name=schedule" json:"schedule,omitempty" yaml:"schedule"`
 }
 
 func (m *BucketConfig) Reset()                    { *m = BucketConfig{} }
@@ -200,46 +312,342 @@ func (m *BucketConfig) GetMaxTokensPerRequest() int64 {
 	return 0
 }
 
+func (m *BucketConfig) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *BucketConfig) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *BucketConfig) GetContact() string {
+	if m != nil {
+		return m.Contact
+	}
+	return ""
+}
+
+func (m *BucketConfig) GetLabels() map[string]string {
+	if m != nil {
+		return m.Labels
+	}
+	return nil
+}
+
+func (m *BucketConfig) GetSchedule() []*ScheduleRule {
+	if m != nil {
+		return m.Schedule
+	}
+	return nil
+}
+
+// A window of time in which a bucket is served with a different size and fill rate.
+type ScheduleRule struct {
+	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty" yaml:"name"`
+	// A cron expression - minute hour day-of-month month day-of-week - at which the window opens.
+	// If empty, the rule is active for as long as it is within not_before and not_after.
+	Cron string `protobuf:"bytes,2,opt,name=cron" json:"cron,omitempty" yaml:"cron"`
+	// How long the window stays open for, after each time it opens.
+	DurationMillis int64 `protobuf:"varint,3,opt,name=duration_millis,json=durationMillis" json:"duration_millis,omitempty" yaml:"duration_millis"`
+	// Unix timestamps, in seconds, bounding when the rule applies at all. Unbounded if 0.
+	NotBefore int64 `protobuf:"varint,4,opt,name=not_before,json=notBefore" json:"not_before,omitempty" yaml:"not_before"`
+	NotAfter  int64 `protobuf:"varint,5,opt,name=not_after,json=notAfter" json:"not_after,omitempty" yaml:"not_after"`
+	// The IANA time zone the cron expression is evaluated in. Defaults to UTC.
+	TimeZone string `protobuf:"bytes,6,opt,name=time_zone,json=timeZone" json:"time_zone,omitempty" yaml:"time_zone"`
+	// Replace the bucket's size and fill rate while the rule is active, unless 0.
+	Size     int64 `protobuf:"varint,7,opt,name=size" json:"size,omitempty" yaml:"size"`
+	FillRate int64 `protobuf:"varint,8,opt,name=fill_rate,json=fillRate" json:"fill_rate,omitempty" yaml:"fill_rate"`
+}
+
+func (m *ScheduleRule) Reset()                    { *m = ScheduleRule{} }
+func (m *ScheduleRule) String() string            { return proto.CompactTextString(m) }
+func (*ScheduleRule) ProtoMessage()               {}
+func (*ScheduleRule) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *ScheduleRule) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ScheduleRule) GetCron() string {
+	if m != nil {
+		return m.Cron
+	}
+	return ""
+}
+
+func (m *ScheduleRule) GetDurationMillis() int64 {
+	if m != nil {
+		return m.DurationMillis
+	}
+	return 0
+}
+
+func (m *ScheduleRule) GetNotBefore() int64 {
+	if m != nil {
+		return m.NotBefore
+	}
+	return 0
+}
+
+func (m *ScheduleRule) GetNotAfter() int64 {
+	if m != nil {
+		return m.NotAfter
+	}
+	return 0
+}
+
+func (m *ScheduleRule) GetTimeZone() string {
+	if m != nil {
+		return m.TimeZone
+	}
+	return ""
+}
+
+func (m *ScheduleRule) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *ScheduleRule) GetFillRate() int64 {
+	if m != nil {
+		return m.FillRate
+	}
+	return 0
+}
+
+// A temporary change to a bucket, reverted once it expires. While boosted, a bucket's schedule is
+// ignored.
+type BucketBoost struct {
+	Namespace  string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty" yaml:"namespace"`
+	BucketName string `protobuf:"bytes,2,opt,name=bucket_name,json=bucketName" json:"bucket_name,omitempty" yaml:"bucket_name"`
+	// Fields set override the bucket's
+	Config *BucketConfig `protobuf:"bytes,3,opt,name=config" json:"config,omitempty" yaml:"config"`
+	// Unix timestamp, in seconds, at which the boost is reverted
+	Expires int64 `protobuf:"varint,4,opt,name=expires" json:"expires,omitempty" yaml:"expires"`
+	// Who boosted the bucket, and why
+	User   string `protobuf:"bytes,5,opt,name=user" json:"user,omitempty" yaml:"user"`
+	Reason string `protobuf:"bytes,6,opt,name=reason" json:"reason,omitempty" yaml:"reason"`
+}
+
+func (m *BucketBoost) Reset()                    { *m = BucketBoost{} }
+func (m *BucketBoost) String() string            { return proto.CompactTextString(m) }
+func (*BucketBoost) ProtoMessage()               {}
+func (*BucketBoost) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *BucketBoost) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *BucketBoost) GetBucketName() string {
+	if m != nil {
+		return m.BucketName
+	}
+	return ""
+}
+
+func (m *BucketBoost) GetConfig() *BucketConfig {
+	if m != nil {
+		return m.Config
+	}
+	return nil
+}
+
+func (m *BucketBoost) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *BucketBoost) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *BucketBoost) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+// A configuration rolled out to canary nodes first. The rest of the fleet keeps serving the stable
+// version until the canaries' rejection rate has been compared against theirs, and the rollout is
+// promoted or rolled back.
+type Rollout struct {
+	Stage Rollout_Stage `protobuf:"varint,1,opt,name=stage,enum=quotaservice.configs.Rollout_Stage" json:"stage,omitempty" yaml:"stage"`
+	// Version served by nodes that aren't canaries while the rollout is in progress
+	StableVersion int32 `protobuf:"varint,2,opt,name=stable_version,json=stableVersion" json:"stable_version,omitempty" yaml:"stable_version"`
+	// Unix timestamp, in seconds, at which the rollout started
+	Started int64 `protobuf:"varint,3,opt,name=started" json:"started,omitempty" yaml:"started"`
+	// How long canaries serve the configuration before their health is compared
+	BakeMillis int64 `protobuf:"varint,4,opt,name=bake_millis,json=bakeMillis" json:"bake_millis,omitempty" yaml:"bake_millis"`
+	// How much higher, as a fraction of requests, the canaries' rejection rate may be than the rest
+	// of the fleet's before the rollout is rolled back
+	MaxRejectionRateIncrease float64 `protobuf:"fixed64,5,opt,name=max_rejection_rate_increase,json=maxRejectionRateIncrease" json:"max_rejection_rate_increase,omitempty" yaml:"max_rejection_rate_increase"`
+	// How many requests canaries must have served before their health is compared
+	MinRequests int64 `protobuf:"varint,6,opt,name=min_requests,json=minRequests" json:"min_requests,omitempty" yaml:"min_requests"`
+	// Why the rollout was promoted or rolled back
+	Reason string `protobuf:"bytes,7,opt,name=reason" json:"reason,omitempty" yaml:"reason"`
+	// How long canaries have, once baked, to serve min_requests before the rollout is rolled back
+	DeadlineMillis int64 `protobuf:"varint,8,opt,name=deadline_millis,json=deadlineMillis" json:"deadline_millis,omitempty" yaml:"deadline_millis"`
+}
+
+func (m *Rollout) Reset()                    { *m = Rollout{} }
+func (m *Rollout) String() string            { return proto.CompactTextString(m) }
+func (*Rollout) ProtoMessage()               {}
+func (*Rollout) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *Rollout) GetStage() Rollout_Stage {
+	if m != nil {
+		return m.Stage
+	}
+	return Rollout_CANARY
+}
+
+func (m *Rollout) GetStableVersion() int32 {
+	if m != nil {
+		return m.StableVersion
+	}
+	return 0
+}
+
+func (m *Rollout) GetStarted() int64 {
+	if m != nil {
+		return m.Started
+	}
+	return 0
+}
+
+func (m *Rollout) GetBakeMillis() int64 {
+	if m != nil {
+		return m.BakeMillis
+	}
+	return 0
+}
+
+func (m *Rollout) GetMaxRejectionRateIncrease() float64 {
+	if m != nil {
+		return m.MaxRejectionRateIncrease
+	}
+	return 0
+}
+
+func (m *Rollout) GetMinRequests() int64 {
+	if m != nil {
+		return m.MinRequests
+	}
+	return 0
+}
+
+func (m *Rollout) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *Rollout) GetDeadlineMillis() int64 {
+	if m != nil {
+		return m.DeadlineMillis
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*ServiceConfig)(nil), "quotaservice.configs.ServiceConfig")
 	proto.RegisterType((*NamespaceConfig)(nil), "quotaservice.configs.NamespaceConfig")
 	proto.RegisterType((*BucketConfig)(nil), "quotaservice.configs.BucketConfig")
+	proto.RegisterType((*ScheduleRule)(nil), "quotaservice.configs.ScheduleRule")
+	proto.RegisterType((*BucketBoost)(nil), "quotaservice.configs.BucketBoost")
+	proto.RegisterType((*Rollout)(nil), "quotaservice.configs.Rollout")
+	proto.RegisterEnum("quotaservice.configs.Rollout_Stage", Rollout_Stage_name, Rollout_Stage_value)
 }
 
 func init() { proto.RegisterFile("protos/config/configs.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 509 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x8c, 0x54, 0x4d, 0x6f, 0xd3, 0x40,
-	0x10, 0x95, 0xed, 0xa4, 0x69, 0xa6, 0x84, 0xd2, 0x2d, 0x05, 0xab, 0xe5, 0x10, 0x45, 0x02, 0xe5,
-	0x64, 0xa4, 0xe4, 0x52, 0xc1, 0x0d, 0xc2, 0xa1, 0x12, 0x20, 0xb4, 0x8d, 0x38, 0x70, 0xc0, 0xda,
-	0xc4, 0x93, 0x6a, 0x95, 0xb5, 0x9d, 0x7a, 0xd7, 0x21, 0xe1, 0x07, 0x71, 0xe0, 0x77, 0xf1, 0x43,
-	0xd0, 0x7e, 0x38, 0xd8, 0x55, 0x84, 0x72, 0xca, 0x64, 0xde, 0x9b, 0x37, 0xbb, 0xef, 0xad, 0x0c,
-	0x57, 0xab, 0x22, 0x57, 0xb9, 0x7c, 0x3d, 0xcf, 0xb3, 0x05, 0xbf, 0x73, 0x3f, 0x32, 0x32, 0x5d,
-	0xf2, 0xf4, 0xbe, 0xcc, 0x15, 0x93, 0x58, 0xac, 0xf9, 0x1c, 0x23, 0x87, 0x0d, 0xfe, 0xf8, 0xd0,
-	0xbb, 0xb5, 0xbd, 0xf7, 0xa6, 0x45, 0xbe, 0xc2, 0xc5, 0x9d, 0xc8, 0x67, 0x4c, 0xc4, 0x09, 0x2e,
-	0x58, 0x29, 0x54, 0x3c, 0x2b, 0xe7, 0x4b, 0x54, 0xa1, 0xd7, 0xf7, 0x86, 0x27, 0xa3, 0x41, 0xb4,
-	0x4f, 0x27, 0x7a, 0x67, 0x38, 0x56, 0x82, 0x9e, 0x5b, 0x81, 0x89, 0x9d, 0xb7, 0x10, 0xb9, 0x05,
-	0xc8, 0x58, 0x8a, 0x72, 0xc5, 0xe6, 0x28, 0x43, 0xbf, 0x1f, 0x0c, 0x4f, 0x46, 0xe3, 0xfd, 0x62,
-	0x8d, 0x03, 0x45, 0x9f, 0x77, 0x53, 0x1f, 0x32, 0x55, 0x6c, 0x69, 0x4d, 0x86, 0x84, 0xd0, 0x59,
-	0x63, 0x21, 0x79, 0x9e, 0x85, 0x41, 0xdf, 0x1b, 0xb6, 0x69, 0xf5, 0x97, 0x10, 0x68, 0x95, 0x12,
-	0x8b, 0xb0, 0xd5, 0xf7, 0x86, 0x5d, 0x6a, 0x6a, 0xdd, 0x4b, 0x98, 0xc2, 0xb0, 0xdd, 0xf7, 0x86,
-	0x01, 0x35, 0xf5, 0x65, 0x02, 0xa7, 0x0f, 0x16, 0x90, 0x27, 0x10, 0x2c, 0x71, 0x6b, 0xee, 0xdb,
-	0xa5, 0xba, 0x24, 0x6f, 0xa1, 0xbd, 0x66, 0xa2, 0xc4, 0xd0, 0x37, 0x1e, 0xbc, 0xdc, 0x7f, 0xec,
-	0x9d, 0x8e, 0xb3, 0xc1, 0xce, 0xbc, 0xf1, 0xaf, 0xbd, 0xc1, 0xef, 0xa0, 0xb6, 0xc6, 0x19, 0x4d,
-	0xa0, 0xa5, 0x6f, 0xe2, 0xf6, 0x98, 0x9a, 0xdc, 0xc0, 0xe3, 0x07, 0xae, 0xfb, 0x07, 0xbb, 0xde,
-	0x4b, 0x1a, 0x7e, 0x7f, 0x83, 0xe7, 0xc9, 0x36, 0x63, 0x29, 0x9f, 0x3b, 0xa9, 0x58, 0x61, 0xba,
-	0x12, 0xfa, 0xfe, 0xc1, 0xc1, 0x9a, 0x17, 0x4e, 0xc2, 0x36, 0xa7, 0x4e, 0x80, 0x44, 0x70, 0x9e,
-	0xb2, 0x4d, 0xdc, 0xd4, 0x97, 0xc6, 0xeb, 0x36, 0x3d, 0x4b, 0xd9, 0x66, 0x52, 0x1f, 0x93, 0xe4,
-	0x23, 0x74, 0x2a, 0x4e, 0xdb, 0x04, 0x3f, 0x3a, 0xc8, 0x41, 0x77, 0x16, 0x97, 0x7b, 0x25, 0x71,
-	0xf9, 0x1d, 0x1e, 0xd5, 0x81, 0x3d, 0x79, 0x5d, 0x37, 0xf3, 0x3a, 0xe4, 0xa6, 0xb5, 0xb0, 0x7e,
-	0xf9, 0xd5, 0x82, 0xff, 0x24, 0xf5, 0x02, 0xba, 0xbb, 0x77, 0x68, 0xd6, 0x74, 0xe9, 0xbf, 0x86,
-	0x9e, 0x90, 0xfc, 0xa7, 0x75, 0x3a, 0xa0, 0xa6, 0x26, 0x57, 0xd0, 0x5d, 0x70, 0x21, 0xe2, 0x42,
-	0x47, 0xd0, 0x32, 0xc0, 0xb1, 0x6e, 0x50, 0xe7, 0xe8, 0x0f, 0xc6, 0x55, 0xac, 0x78, 0x8a, 0x79,
-	0xa9, 0xe2, 0x94, 0x0b, 0xc1, 0xa5, 0x7b, 0xa9, 0x67, 0x1a, 0x9a, 0x5a, 0xe4, 0x93, 0x01, 0xc8,
-	0x2b, 0x38, 0xd5, 0x09, 0xf0, 0x44, 0x60, 0xc5, 0x3d, 0x32, 0xdc, 0x5e, 0xca, 0x36, 0x37, 0x89,
-	0xc0, 0x26, 0x2f, 0xc1, 0xd9, 0x4e, 0xb3, 0xb3, 0xe3, 0x4d, 0x70, 0x56, 0xe9, 0x8d, 0xe1, 0x99,
-	0xe6, 0xa9, 0x7c, 0x89, 0x99, 0x8c, 0x57, 0x58, 0xc4, 0x05, 0xde, 0x97, 0x28, 0x55, 0x78, 0x6c,
-	0xe8, 0x3a, 0xef, 0xa9, 0x01, 0xbf, 0x60, 0x41, 0x2d, 0x34, 0x3b, 0x32, 0x5f, 0x96, 0xf1, 0xdf,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x29, 0xba, 0x7e, 0x7d, 0x78, 0x04, 0x00, 0x00,
+	// 1050 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xa4, 0x96, 0xdd, 0x6e, 0xdb, 0x36,
+	0x14, 0xc7, 0x27, 0xdb, 0xb2, 0xad, 0x63, 0x27, 0x4e, 0xd9, 0xb4, 0x13, 0x92, 0x15, 0x73, 0x3d,
+	0x74, 0xcb, 0x95, 0x87, 0x25, 0x17, 0x6b, 0x3a, 0x6c, 0x40, 0xbe, 0x06, 0x04, 0x4d, 0x9b, 0x82,
+	0x09, 0x0a, 0xac, 0x17, 0x13, 0x68, 0x89, 0xce, 0xb4, 0x48, 0xa2, 0x4b, 0x52, 0xa9, 0xd3, 0x57,
+	0xdb, 0x2b, 0x0c, 0xdb, 0x73, 0xec, 0x21, 0x06, 0x0c, 0xfc, 0x90, 0x22, 0x07, 0x6a, 0xe6, 0xad,
+	0x17, 0x41, 0xc8, 0xf3, 0xf1, 0x37, 0x79, 0xce, 0x8f, 0xa4, 0x60, 0x73, 0xc6, 0x99, 0x64, 0xe2,
+	0xeb, 0x90, 0x65, 0xd3, 0xf8, 0xc2, 0xfe, 0x13, 0x63, 0x6d, 0x45, 0xeb, 0x6f, 0x73, 0x26, 0x89,
+	0xa0, 0xfc, 0x2a, 0x0e, 0xe9, 0xd8, 0xfa, 0x46, 0xbf, 0xb7, 0x60, 0xe5, 0xcc, 0xd8, 0x0e, 0xb4,
+	0x09, 0xbd, 0x86, 0x07, 0x17, 0x09, 0x9b, 0x90, 0x24, 0x88, 0xe8, 0x94, 0xe4, 0x89, 0x0c, 0x26,
+	0x79, 0x78, 0x49, 0xa5, 0xef, 0x0c, 0x9d, 0xad, 0xde, 0xf6, 0x68, 0x5c, 0xa7, 0x33, 0xde, 0xd7,
+	0x31, 0x46, 0x02, 0xdf, 0x37, 0x02, 0x87, 0x26, 0xdf, 0xb8, 0xd0, 0x19, 0x40, 0x46, 0x52, 0x2a,
+	0x66, 0x24, 0xa4, 0xc2, 0x6f, 0x0c, 0x9b, 0x5b, 0xbd, 0xed, 0x9d, 0x7a, 0xb1, 0x85, 0x05, 0x8d,
+	0x5f, 0x96, 0x59, 0x47, 0x99, 0xe4, 0xd7, 0xb8, 0x22, 0x83, 0x7c, 0xe8, 0x5c, 0x51, 0x2e, 0x62,
+	0x96, 0xf9, 0xcd, 0xa1, 0xb3, 0xe5, 0xe2, 0x62, 0x8a, 0x10, 0xb4, 0x72, 0x41, 0xb9, 0xdf, 0x1a,
+	0x3a, 0x5b, 0x1e, 0xd6, 0x63, 0x65, 0x8b, 0x88, 0xa4, 0xbe, 0x3b, 0x74, 0xb6, 0x9a, 0x58, 0x8f,
+	0xd1, 0x73, 0x18, 0x98, 0xfd, 0x15, 0xdb, 0x15, 0x7e, 0x7b, 0xe9, 0x8d, 0xae, 0x9a, 0x54, 0xbb,
+	0x51, 0x81, 0x76, 0xa1, 0x3d, 0x61, 0x4c, 0x48, 0xe1, 0x77, 0xf4, 0xfe, 0x1e, 0xdf, 0xa5, 0xb1,
+	0xaf, 0x22, 0xb1, 0x4d, 0x40, 0xdf, 0x42, 0x87, 0xb3, 0x24, 0x61, 0xb9, 0xf4, 0xbb, 0xfa, 0xf7,
+	0x1f, 0xd5, 0xe7, 0x62, 0x13, 0x84, 0x8b, 0x68, 0xf4, 0x04, 0x56, 0x45, 0xf8, 0x0b, 0x4d, 0x49,
+	0x50, 0x54, 0xc2, 0xd3, 0x95, 0x58, 0x31, 0xd6, 0xd7, 0xc6, 0xb8, 0x11, 0xc1, 0xe0, 0x56, 0x21,
+	0xd1, 0x1a, 0x34, 0x2f, 0xe9, 0xb5, 0xee, 0xab, 0x87, 0xd5, 0x10, 0x7d, 0x07, 0xee, 0x15, 0x49,
+	0x72, 0xea, 0x37, 0xf4, 0x12, 0x9e, 0xd4, 0x2f, 0xa1, 0xd4, 0xb1, 0x55, 0x30, 0x39, 0xcf, 0x1a,
+	0x4f, 0x9d, 0xd1, 0x9f, 0x2e, 0x0c, 0x6e, 0xb9, 0x55, 0xd5, 0x55, 0xc7, 0xec, 0xef, 0xe8, 0x31,
+	0x3a, 0x86, 0xd5, 0x5b, 0x74, 0x35, 0x96, 0x2e, 0xfa, 0x4a, 0xb4, 0xc0, 0xd5, 0x1b, 0xf8, 0x34,
+	0xba, 0xce, 0x48, 0x1a, 0x87, 0x56, 0x2a, 0x90, 0x34, 0x9d, 0x25, 0xaa, 0xcf, 0xcd, 0xa5, 0x35,
+	0x1f, 0x58, 0x09, 0x63, 0x3c, 0xb7, 0x02, 0x68, 0x0c, 0xf7, 0x53, 0x32, 0x0f, 0x16, 0xf5, 0x85,
+	0x66, 0xca, 0xc5, 0xf7, 0x52, 0x32, 0x3f, 0xac, 0xa6, 0x09, 0x74, 0x02, 0x9d, 0x22, 0xc6, 0xd5,
+	0x00, 0x6c, 0x2f, 0x55, 0x41, 0xbb, 0x16, 0xcb, 0x77, 0x21, 0x81, 0xd6, 0xc1, 0x65, 0xef, 0x32,
+	0xca, 0x35, 0x90, 0x1e, 0x36, 0x13, 0x34, 0x84, 0x5e, 0x44, 0x45, 0xc8, 0xe3, 0x99, 0x54, 0xcd,
+	0xee, 0x68, 0x5f, 0xd5, 0xa4, 0x0e, 0x45, 0xc8, 0x32, 0x49, 0x42, 0x83, 0x92, 0x87, 0x8b, 0x29,
+	0x3a, 0x86, 0x76, 0x42, 0x26, 0x34, 0x11, 0xbe, 0xa7, 0x97, 0xf7, 0xcd, 0x72, 0xcb, 0x3b, 0xd1,
+	0x39, 0x66, 0x75, 0x56, 0xa0, 0xee, 0xdc, 0xc0, 0xff, 0x3d, 0x37, 0x1b, 0x3f, 0x43, 0xbf, 0x5a,
+	0x82, 0x1a, 0x32, 0x9f, 0x2e, 0x92, 0xb9, 0xcc, 0x8f, 0xdc, 0x60, 0xb9, 0xb1, 0x0b, 0xbd, 0xca,
+	0x1e, 0x6a, 0xe4, 0xd7, 0xab, 0xf2, 0x5e, 0x95, 0xe8, 0xdf, 0x5a, 0xd0, 0xaf, 0xca, 0xd6, 0xe2,
+	0xfc, 0x19, 0x78, 0xe5, 0xa5, 0x64, 0x25, 0x6e, 0x0c, 0x2a, 0x43, 0xc4, 0xef, 0x0d, 0x8e, 0x4d,
+	0xac, 0xc7, 0x68, 0x13, 0xbc, 0x69, 0x9c, 0x24, 0x01, 0x57, 0x9c, 0xb6, 0xb4, 0xa3, 0xab, 0x0c,
+	0xd8, 0x62, 0xf7, 0x8e, 0xc4, 0x32, 0x90, 0x71, 0x4a, 0x59, 0x2e, 0x83, 0x34, 0x4e, 0x92, 0x58,
+	0xd8, 0x6b, 0xeb, 0x9e, 0x72, 0x9d, 0x1b, 0xcf, 0x0b, 0xed, 0x40, 0x5f, 0xc2, 0x40, 0x61, 0x1a,
+	0x47, 0x09, 0x2d, 0x62, 0xdb, 0x3a, 0x76, 0x25, 0x25, 0xf3, 0xe3, 0x28, 0xa1, 0x8b, 0x71, 0x11,
+	0x9d, 0x94, 0x9a, 0x9d, 0x32, 0xee, 0x90, 0x4e, 0x0a, 0xbd, 0x1d, 0x78, 0xa8, 0xe2, 0x24, 0xbb,
+	0xa4, 0x99, 0x08, 0x66, 0x94, 0x07, 0x9c, 0xbe, 0xcd, 0xa9, 0x30, 0x3c, 0x35, 0xb1, 0x3a, 0x14,
+	0xe7, 0xda, 0xf9, 0x8a, 0x72, 0x6c, 0x5c, 0x37, 0xb4, 0x7a, 0x77, 0xd0, 0x0a, 0x77, 0xd2, 0xda,
+	0x5b, 0xa4, 0xf5, 0xc7, 0x92, 0xd6, 0xbe, 0xa6, 0x75, 0xfc, 0xef, 0x4d, 0xaf, 0x45, 0xf5, 0x07,
+	0xe8, 0xaa, 0xbb, 0x30, 0xca, 0x13, 0xea, 0xaf, 0x0c, 0x9b, 0x1f, 0xc6, 0xe7, 0xcc, 0x46, 0x61,
+	0xf5, 0x57, 0xe6, 0x7c, 0x0c, 0x3d, 0x7f, 0x39, 0xd0, 0xaf, 0xaa, 0xd6, 0xd2, 0x83, 0xa0, 0x15,
+	0x72, 0x96, 0xd9, 0x6c, 0x3d, 0x46, 0x5f, 0xc1, 0x20, 0xca, 0x39, 0x51, 0x15, 0x2a, 0x5a, 0x65,
+	0xf0, 0x59, 0x2d, 0xcc, 0xb6, 0x57, 0x8f, 0x00, 0x32, 0x26, 0x83, 0x09, 0x9d, 0x32, 0x5e, 0x90,
+	0xe4, 0x65, 0x4c, 0xee, 0x6b, 0x83, 0xe2, 0x4c, 0xb9, 0xc9, 0x54, 0x52, 0x6e, 0x01, 0xea, 0x66,
+	0x4c, 0xee, 0xa9, 0xb9, 0x72, 0x2a, 0xc4, 0x82, 0xf7, 0x2c, 0xa3, 0xf6, 0x92, 0xe9, 0x2a, 0xc3,
+	0x1b, 0x96, 0xdd, 0x50, 0xdb, 0xf9, 0x10, 0xb5, 0xdd, 0x45, 0x6a, 0x47, 0x7f, 0x38, 0xd0, 0xab,
+	0xbc, 0x6c, 0x8b, 0x87, 0xc2, 0xb9, 0x7d, 0x28, 0x3e, 0x87, 0x9e, 0xbd, 0x3f, 0x74, 0x3d, 0xcc,
+	0xde, 0xc1, 0x98, 0xd4, 0xfd, 0x83, 0x9e, 0x41, 0xdb, 0xf4, 0xe5, 0x3f, 0x5c, 0xe3, 0x36, 0x43,
+	0x31, 0x45, 0xe7, 0xb3, 0x98, 0x53, 0x61, 0x2b, 0x52, 0x4c, 0xcb, 0xcf, 0x02, 0xb7, 0xf2, 0x59,
+	0xf0, 0x10, 0xda, 0x9c, 0x12, 0xc1, 0x32, 0x5b, 0x03, 0x3b, 0x1b, 0xfd, 0xdd, 0x80, 0x8e, 0x7d,
+	0x6e, 0xd1, 0x2e, 0xb8, 0x42, 0x92, 0x0b, 0xb3, 0x91, 0xd5, 0xed, 0x2f, 0xee, 0x7c, 0x9c, 0xc7,
+	0x67, 0x2a, 0x14, 0x9b, 0x0c, 0xfd, 0x40, 0x4b, 0x32, 0x49, 0x68, 0xf9, 0x40, 0x37, 0xec, 0x03,
+	0xad, 0xad, 0xf6, 0x81, 0x56, 0x6b, 0x16, 0x92, 0x70, 0x49, 0x23, 0xdb, 0xe9, 0x62, 0xaa, 0x4b,
+	0x45, 0x2e, 0xcb, 0xa3, 0x6d, 0x76, 0x04, 0xca, 0x64, 0x19, 0xf8, 0x1e, 0x36, 0xd5, 0x79, 0xe5,
+	0xf4, 0x57, 0x1a, 0x6a, 0x62, 0x54, 0x7f, 0x82, 0x38, 0x0b, 0xd5, 0x46, 0xcc, 0xe7, 0x8e, 0x83,
+	0xfd, 0x94, 0xcc, 0x71, 0x11, 0xa1, 0x1a, 0x76, 0x6c, 0xfd, 0xe8, 0x31, 0xf4, 0xd3, 0x38, 0x2b,
+	0xce, 0x78, 0x71, 0x77, 0xf4, 0xd2, 0x38, 0xb3, 0x67, 0x5b, 0x54, 0x4a, 0xd4, 0xa9, 0x96, 0x48,
+	0x63, 0x4a, 0x49, 0x94, 0xc4, 0x59, 0xb9, 0xbc, 0xae, 0xc5, 0xd4, 0x9a, 0xcd, 0x12, 0x47, 0xdb,
+	0xe0, 0xea, 0xa2, 0x20, 0x80, 0xf6, 0xc1, 0xde, 0xcb, 0x3d, 0xfc, 0xd3, 0xda, 0x27, 0xa8, 0x0f,
+	0xdd, 0x57, 0xf8, 0xf4, 0xc5, 0xe9, 0xf9, 0xd1, 0xe1, 0x9a, 0x83, 0x06, 0xd0, 0xc3, 0xa7, 0x27,
+	0x27, 0x47, 0x87, 0xc1, 0xfe, 0xde, 0xc1, 0xf3, 0xb5, 0xc6, 0xa4, 0xad, 0x3f, 0x5c, 0x77, 0xfe,
+	0x19, 0x00, 0xbd, 0x51, 0x76, 0x92, 0xd7, 0x0a, 0x00, 0x00,
 }
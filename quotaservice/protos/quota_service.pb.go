@@ -49,6 +49,7 @@ const (
 	AllowResponse_REJECTED_TOO_MANY_TOKENS_REQUESTED AllowResponse_Status = 4
 	AllowResponse_REJECTED_INVALID_REQUEST           AllowResponse_Status = 5
 	AllowResponse_REJECTED_SERVER_ERROR              AllowResponse_Status = 6
+	AllowResponse_REJECTED_PERMISSION_DENIED         AllowResponse_Status = 7
 )
 
 var AllowResponse_Status_name = map[int32]string{
@@ -59,6 +60,7 @@ var AllowResponse_Status_name = map[int32]string{
 	4: "REJECTED_TOO_MANY_TOKENS_REQUESTED",
 	5: "REJECTED_INVALID_REQUEST",
 	6: "REJECTED_SERVER_ERROR",
+	7: "REJECTED_PERMISSION_DENIED",
 }
 var AllowResponse_Status_value = map[string]int32{
 	"OK":                                 0,
@@ -68,6 +70,7 @@ var AllowResponse_Status_value = map[string]int32{
 	"REJECTED_TOO_MANY_TOKENS_REQUESTED": 4,
 	"REJECTED_INVALID_REQUEST":           5,
 	"REJECTED_SERVER_ERROR":              6,
+	"REJECTED_PERMISSION_DENIED":         7,
 }
 
 func (x AllowResponse_Status) String() string {
@@ -78,10 +81,11 @@ func (AllowResponse_Status) EnumDescriptor() ([]byte, []int) { return fileDescri
 type UpdateResponse_Status int32
 
 const (
-	UpdateResponse_OK                       UpdateResponse_Status = 0
-	UpdateResponse_REJECTED_TIMEOUT         UpdateResponse_Status = 1
-	UpdateResponse_REJECTED_INVALID_REQUEST UpdateResponse_Status = 2
-	UpdateResponse_REJECTED_SERVER_ERROR    UpdateResponse_Status = 3
+	UpdateResponse_OK                         UpdateResponse_Status = 0
+	UpdateResponse_REJECTED_TIMEOUT           UpdateResponse_Status = 1
+	UpdateResponse_REJECTED_INVALID_REQUEST   UpdateResponse_Status = 2
+	UpdateResponse_REJECTED_SERVER_ERROR      UpdateResponse_Status = 3
+	UpdateResponse_REJECTED_PERMISSION_DENIED UpdateResponse_Status = 4
 )
 
 var UpdateResponse_Status_name = map[int32]string{
@@ -89,12 +93,14 @@ var UpdateResponse_Status_name = map[int32]string{
 	1: "REJECTED_TIMEOUT",
 	2: "REJECTED_INVALID_REQUEST",
 	3: "REJECTED_SERVER_ERROR",
+	4: "REJECTED_PERMISSION_DENIED",
 }
 var UpdateResponse_Status_value = map[string]int32{
-	"OK":                       0,
-	"REJECTED_TIMEOUT":         1,
-	"REJECTED_INVALID_REQUEST": 2,
-	"REJECTED_SERVER_ERROR":    3,
+	"OK":                         0,
+	"REJECTED_TIMEOUT":           1,
+	"REJECTED_INVALID_REQUEST":   2,
+	"REJECTED_SERVER_ERROR":      3,
+	"REJECTED_PERMISSION_DENIED": 4,
 }
 
 func (x UpdateResponse_Status) String() string {
@@ -105,11 +111,12 @@ func (UpdateResponse_Status) EnumDescriptor() ([]byte, []int) { return fileDescr
 type InfoResponse_Status int32
 
 const (
-	InfoResponse_OK                       InfoResponse_Status = 0
-	InfoResponse_REJECTED_TIMEOUT         InfoResponse_Status = 1
-	InfoResponse_REJECTED_NO_BUCKET       InfoResponse_Status = 2
-	InfoResponse_REJECTED_INVALID_REQUEST InfoResponse_Status = 3
-	InfoResponse_REJECTED_SERVER_ERROR    InfoResponse_Status = 4
+	InfoResponse_OK                         InfoResponse_Status = 0
+	InfoResponse_REJECTED_TIMEOUT           InfoResponse_Status = 1
+	InfoResponse_REJECTED_NO_BUCKET         InfoResponse_Status = 2
+	InfoResponse_REJECTED_INVALID_REQUEST   InfoResponse_Status = 3
+	InfoResponse_REJECTED_SERVER_ERROR      InfoResponse_Status = 4
+	InfoResponse_REJECTED_PERMISSION_DENIED InfoResponse_Status = 5
 )
 
 var InfoResponse_Status_name = map[int32]string{
@@ -118,13 +125,15 @@ var InfoResponse_Status_name = map[int32]string{
 	2: "REJECTED_NO_BUCKET",
 	3: "REJECTED_INVALID_REQUEST",
 	4: "REJECTED_SERVER_ERROR",
+	5: "REJECTED_PERMISSION_DENIED",
 }
 var InfoResponse_Status_value = map[string]int32{
-	"OK":                       0,
-	"REJECTED_TIMEOUT":         1,
-	"REJECTED_NO_BUCKET":       2,
-	"REJECTED_INVALID_REQUEST": 3,
-	"REJECTED_SERVER_ERROR":    4,
+	"OK":                         0,
+	"REJECTED_TIMEOUT":           1,
+	"REJECTED_NO_BUCKET":         2,
+	"REJECTED_INVALID_REQUEST":   3,
+	"REJECTED_SERVER_ERROR":      4,
+	"REJECTED_PERMISSION_DENIED": 5,
 }
 
 func (x InfoResponse_Status) String() string {
@@ -316,6 +325,8 @@ type InfoResponse struct {
 	Size              int64               `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
 	FillRate          int64               `protobuf:"varint,3,opt,name=fill_rate,json=fillRate" json:"fill_rate,omitempty"`
 	WaitTimeoutMillis int64               `protobuf:"varint,4,opt,name=wait_timeout_millis,json=waitTimeoutMillis" json:"wait_timeout_millis,omitempty"`
+	// The name of the bucket's active schedule rule, if any
+	ScheduleRule string `protobuf:"bytes,5,opt,name=schedule_rule,json=scheduleRule" json:"schedule_rule,omitempty"`
 }
 
 func (m *InfoResponse) Reset()                    { *m = InfoResponse{} }
@@ -351,6 +362,13 @@ func (m *InfoResponse) GetWaitTimeoutMillis() int64 {
 	return 0
 }
 
+func (m *InfoResponse) GetScheduleRule() string {
+	if m != nil {
+		return m.ScheduleRule
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*AllowRequest)(nil), "quotaservice.AllowRequest")
 	proto.RegisterType((*AllowResponse)(nil), "quotaservice.AllowResponse")
@@ -504,44 +522,47 @@ var _QuotaService_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("quota_service.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 616 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x4b, 0x4f, 0x13, 0x41,
-	0x1c, 0xef, 0x6e, 0x1f, 0xc2, 0x9f, 0x82, 0xeb, 0x1f, 0x21, 0xe5, 0x61, 0xc4, 0x31, 0x1a, 0xbc,
-	0xf4, 0x00, 0x07, 0xa3, 0x9e, 0x78, 0x4c, 0x48, 0x05, 0xba, 0x61, 0xba, 0xc5, 0x78, 0x9a, 0x0c,
-	0x30, 0x98, 0x0d, 0xdd, 0x6e, 0xd9, 0x9d, 0x52, 0xe2, 0xd7, 0xf1, 0xae, 0xdf, 0xc0, 0x4f, 0xe1,
-	0xd5, 0xab, 0x9f, 0xc3, 0xec, 0xec, 0xec, 0x42, 0x2b, 0x6d, 0x48, 0xe4, 0xb6, 0xf9, 0xfd, 0x1f,
-	0x99, 0xdf, 0x63, 0x66, 0x61, 0xfe, 0xb2, 0x1f, 0x2a, 0xc1, 0x63, 0x19, 0x5d, 0xf9, 0xa7, 0xb2,
-	0xde, 0x8b, 0x42, 0x15, 0x62, 0x55, 0x83, 0x06, 0x23, 0x7f, 0x2c, 0xa8, 0x6e, 0x75, 0x3a, 0xe1,
-	0x80, 0xc9, 0xcb, 0xbe, 0x8c, 0x15, 0xae, 0xc2, 0x74, 0x57, 0x04, 0x32, 0xee, 0x89, 0x53, 0x59,
-	0xb3, 0xd6, 0xac, 0xf5, 0x69, 0x76, 0x03, 0xe0, 0x73, 0x98, 0x39, 0xe9, 0x9f, 0x5e, 0x48, 0xc5,
-	0x13, 0xac, 0x66, 0xeb, 0x3a, 0xa4, 0x50, 0x53, 0x04, 0x12, 0xdf, 0x80, 0xa3, 0xc2, 0x0b, 0xd9,
-	0x8d, 0x79, 0x94, 0x2e, 0x94, 0x67, 0xb5, 0xe2, 0x9a, 0xb5, 0x5e, 0x64, 0x8f, 0x53, 0x9c, 0x65,
-	0x30, 0xbe, 0x85, 0x5a, 0x20, 0xae, 0xf9, 0x40, 0xf8, 0x8a, 0x07, 0x7e, 0xa7, 0xe3, 0xc7, 0x3c,
-	0xbc, 0x92, 0x51, 0xe4, 0x9f, 0xc9, 0x5a, 0x49, 0x8f, 0x2c, 0x04, 0xe2, 0xfa, 0x93, 0xf0, 0xd5,
-	0xa1, 0xae, 0xba, 0xa6, 0x88, 0x9b, 0xb0, 0x98, 0x0f, 0x2a, 0x3f, 0x90, 0x37, 0x63, 0xe5, 0x35,
-	0x6b, 0x7d, 0x8a, 0xcd, 0x9b, 0x31, 0xcf, 0x0f, 0x64, 0x36, 0x44, 0x7e, 0xd9, 0x30, 0x6b, 0x88,
-	0xc6, 0xbd, 0xb0, 0x1b, 0x4b, 0x7c, 0x0f, 0x95, 0x58, 0x09, 0xd5, 0x8f, 0x35, 0xcd, 0xb9, 0x0d,
-	0x52, 0xbf, 0xad, 0x4c, 0x7d, 0xa8, 0xb9, 0xde, 0xd2, 0x9d, 0xcc, 0x4c, 0xe0, 0x2b, 0x98, 0x33,
-	0x34, 0xbf, 0x44, 0xa2, 0x9b, 0x90, 0xb4, 0xf5, 0x89, 0x67, 0x53, 0x74, 0x2f, 0x05, 0x13, 0xb9,
-	0x6e, 0xd1, 0x33, 0x42, 0xc0, 0x20, 0xa7, 0x44, 0x7e, 0x5a, 0x50, 0x49, 0x57, 0x63, 0x05, 0x6c,
-	0x77, 0xdf, 0x29, 0xe0, 0x53, 0x70, 0x18, 0xfd, 0x48, 0x77, 0x3c, 0xba, 0xcb, 0xbd, 0xc6, 0x21,
-	0x75, 0xdb, 0x9e, 0x63, 0xe1, 0x22, 0x60, 0x8e, 0x36, 0x5d, 0xbe, 0xdd, 0xde, 0xd9, 0xa7, 0x9e,
-	0x63, 0xe3, 0x33, 0x58, 0xba, 0xe9, 0x76, 0x5d, 0x7e, 0xb8, 0xd5, 0xfc, 0x6c, 0xaa, 0x2d, 0xa7,
-	0x88, 0xaf, 0x81, 0xfc, 0x5b, 0xf6, 0xdc, 0x7d, 0xda, 0x6c, 0x71, 0x46, 0x8f, 0xda, 0xb4, 0xe5,
-	0xd1, 0x5d, 0xa7, 0x84, 0xab, 0x50, 0xcb, 0xfb, 0x1a, 0xcd, 0xe3, 0xad, 0x83, 0xc6, 0x6e, 0x56,
-	0x77, 0xca, 0xb8, 0x04, 0x0b, 0x79, 0xb5, 0x45, 0xd9, 0x31, 0x65, 0x9c, 0x32, 0xe6, 0x32, 0xa7,
-	0x42, 0x7e, 0x58, 0x30, 0xdb, 0xee, 0x9d, 0x09, 0x25, 0x1f, 0x28, 0x40, 0x08, 0xa5, 0xd8, 0xff,
-	0x2a, 0x8d, 0x56, 0xfa, 0x1b, 0x57, 0x60, 0xfa, 0xdc, 0xef, 0x74, 0x78, 0x24, 0x54, 0x16, 0x8d,
-	0xa9, 0x04, 0x60, 0x42, 0x49, 0xac, 0xc3, 0x7c, 0x9e, 0x84, 0xb0, 0x9f, 0x6b, 0x5d, 0xd6, 0x6d,
-	0x4f, 0x06, 0x26, 0x07, 0x61, 0x3f, 0x93, 0xfc, 0xbb, 0x05, 0x73, 0xd9, 0x89, 0x4d, 0x12, 0x3e,
-	0x8c, 0x24, 0xe1, 0xe5, 0x70, 0x12, 0x86, 0xbb, 0x47, 0xa2, 0x40, 0xf8, 0x3d, 0x1d, 0x9c, 0x24,
-	0xb1, 0x3d, 0x5e, 0xe2, 0x22, 0x39, 0x80, 0x99, 0x46, 0xf7, 0x3c, 0x7c, 0x18, 0x7d, 0xc9, 0x37,
-	0x1b, 0xaa, 0xe9, 0x3a, 0x43, 0xfe, 0xdd, 0x08, 0xf9, 0x17, 0xc3, 0xe4, 0x6f, 0xf7, 0x8e, 0xde,
-	0x82, 0xcc, 0x2b, 0x7b, 0x9c, 0x57, 0xc5, 0xfb, 0x79, 0x55, 0x1a, 0xe7, 0xd5, 0xe0, 0x3f, 0x6f,
-	0xc7, 0x24, 0xcd, 0x8b, 0xe3, 0x35, 0x2f, 0x6d, 0xfc, 0xb6, 0xa0, 0x7a, 0x94, 0xc8, 0xd0, 0x4a,
-	0x65, 0xc0, 0x6d, 0x28, 0xeb, 0x07, 0x01, 0x97, 0xef, 0x7c, 0x25, 0xb4, 0x35, 0xcb, 0x2b, 0x13,
-	0x5e, 0x10, 0x52, 0x40, 0x0a, 0x95, 0x34, 0x4a, 0xb8, 0x72, 0x77, 0xc0, 0xd2, 0x2d, 0xab, 0x93,
-	0xd2, 0x47, 0x0a, 0xb8, 0x0d, 0x8f, 0xf6, 0xa4, 0x4a, 0x7c, 0xc1, 0xa5, 0xbb, 0xbc, 0x4a, 0xb7,
-	0x2c, 0x8f, 0xb7, 0x91, 0x14, 0x4e, 0x2a, 0xfa, 0x5f, 0xb0, 0xf9, 0x37, 0x00, 0x00, 0xff, 0xff,
-	0x90, 0xc4, 0x34, 0x3c, 0x22, 0x06, 0x00, 0x00,
+	// 671 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x55, 0xcd, 0x4e, 0xdb, 0x5a,
+	0x10, 0x8e, 0x9d, 0x1f, 0xc8, 0x90, 0x70, 0x7d, 0x87, 0x0b, 0x0a, 0x81, 0x7b, 0x2f, 0x35, 0x6a,
+	0x45, 0x37, 0x59, 0xc0, 0xa2, 0x6a, 0xbb, 0x02, 0x72, 0x84, 0x52, 0x88, 0x5d, 0x8e, 0x1d, 0xaa,
+	0xae, 0x8e, 0x4c, 0x72, 0x68, 0x2d, 0xec, 0x38, 0xd8, 0xc7, 0x04, 0x75, 0xd3, 0xc7, 0xe8, 0x63,
+	0xf4, 0x4d, 0xfa, 0x06, 0xed, 0xb2, 0x52, 0xf7, 0x7d, 0x80, 0x2a, 0xfe, 0x83, 0xa4, 0x24, 0x20,
+	0x95, 0x5d, 0xf4, 0x7d, 0x33, 0x23, 0xcf, 0xf7, 0x7d, 0x67, 0x02, 0x4b, 0x17, 0xa1, 0x27, 0x2c,
+	0x16, 0x70, 0xff, 0xd2, 0xee, 0xf2, 0xc6, 0xc0, 0xf7, 0x84, 0x87, 0x95, 0x08, 0x4c, 0x30, 0xf5,
+	0xbb, 0x04, 0x95, 0x5d, 0xc7, 0xf1, 0x86, 0x94, 0x5f, 0x84, 0x3c, 0x10, 0xb8, 0x0e, 0xe5, 0xbe,
+	0xe5, 0xf2, 0x60, 0x60, 0x75, 0x79, 0x4d, 0xda, 0x90, 0xb6, 0xca, 0xf4, 0x1a, 0xc0, 0xff, 0x61,
+	0xe1, 0x34, 0xec, 0x9e, 0x73, 0xc1, 0x46, 0x58, 0x4d, 0x8e, 0x78, 0x88, 0x21, 0xcd, 0x72, 0x39,
+	0x3e, 0x05, 0x45, 0x78, 0xe7, 0xbc, 0x1f, 0x30, 0x3f, 0x1e, 0xc8, 0x7b, 0xb5, 0xfc, 0x86, 0xb4,
+	0x95, 0xa7, 0x7f, 0xc5, 0x38, 0x4d, 0x61, 0x7c, 0x06, 0x35, 0xd7, 0xba, 0x62, 0x43, 0xcb, 0x16,
+	0xcc, 0xb5, 0x1d, 0xc7, 0x0e, 0x98, 0x77, 0xc9, 0x7d, 0xdf, 0xee, 0xf1, 0x5a, 0x21, 0x6a, 0x59,
+	0x76, 0xad, 0xab, 0x37, 0x96, 0x2d, 0xda, 0x11, 0xab, 0x27, 0x24, 0xee, 0xc0, 0x4a, 0xd6, 0x28,
+	0x6c, 0x97, 0x5f, 0xb7, 0x15, 0x37, 0xa4, 0xad, 0x79, 0xba, 0x94, 0xb4, 0x99, 0xb6, 0xcb, 0xd3,
+	0x26, 0xf5, 0xa7, 0x0c, 0xd5, 0x64, 0xd1, 0x60, 0xe0, 0xf5, 0x03, 0x8e, 0x2f, 0xa0, 0x14, 0x08,
+	0x4b, 0x84, 0x41, 0xb4, 0xe6, 0xe2, 0xb6, 0xda, 0xb8, 0xa9, 0x4c, 0x63, 0xac, 0xb8, 0x61, 0x44,
+	0x95, 0x34, 0xe9, 0xc0, 0xc7, 0xb0, 0x98, 0xac, 0xf9, 0xce, 0xb7, 0xfa, 0xa3, 0x25, 0xe5, 0xe8,
+	0x8b, 0xab, 0x31, 0x7a, 0x10, 0x83, 0x23, 0xb9, 0x6e, 0xac, 0x97, 0x08, 0x01, 0xc3, 0x6c, 0x25,
+	0xf5, 0x9b, 0x04, 0xa5, 0x78, 0x34, 0x96, 0x40, 0xd6, 0x0f, 0x95, 0x1c, 0xfe, 0x03, 0x0a, 0x25,
+	0xaf, 0xc8, 0xbe, 0x49, 0x9a, 0xcc, 0x6c, 0xb5, 0x89, 0xde, 0x31, 0x15, 0x09, 0x57, 0x00, 0x33,
+	0x54, 0xd3, 0xd9, 0x5e, 0x67, 0xff, 0x90, 0x98, 0x8a, 0x8c, 0xff, 0xc2, 0xea, 0x75, 0xb5, 0xae,
+	0xb3, 0xf6, 0xae, 0xf6, 0x36, 0x61, 0x0d, 0x25, 0x8f, 0x4f, 0x40, 0xfd, 0x9d, 0x36, 0xf5, 0x43,
+	0xa2, 0x19, 0x8c, 0x92, 0xe3, 0x0e, 0x31, 0x4c, 0xd2, 0x54, 0x0a, 0xb8, 0x0e, 0xb5, 0xac, 0xae,
+	0xa5, 0x9d, 0xec, 0x1e, 0xb5, 0x9a, 0x29, 0xaf, 0x14, 0x71, 0x15, 0x96, 0x33, 0xd6, 0x20, 0xf4,
+	0x84, 0x50, 0x46, 0x28, 0xd5, 0xa9, 0x52, 0xc2, 0xff, 0xa0, 0x9e, 0x51, 0xaf, 0x09, 0x6d, 0xb7,
+	0x0c, 0xa3, 0xa5, 0x6b, 0xac, 0x49, 0xb4, 0x16, 0x69, 0x2a, 0x73, 0xea, 0x67, 0x09, 0xaa, 0x9d,
+	0x41, 0xcf, 0x12, 0xfc, 0x81, 0x02, 0x86, 0x50, 0x08, 0xec, 0x0f, 0x3c, 0xd1, 0x32, 0xfa, 0x8d,
+	0x6b, 0x50, 0x3e, 0xb3, 0x1d, 0x87, 0xf9, 0x96, 0x48, 0xa3, 0x33, 0x3f, 0x02, 0xa8, 0x25, 0x38,
+	0x36, 0x60, 0x29, 0x4b, 0x8a, 0x17, 0x66, 0x5e, 0x14, 0xa3, 0xb2, 0xbf, 0x87, 0x49, 0x4e, 0xbc,
+	0x30, 0xb5, 0xe4, 0x8b, 0x04, 0x8b, 0xe9, 0x17, 0x27, 0x49, 0x79, 0x39, 0x91, 0x94, 0xcd, 0xf1,
+	0xa4, 0x8c, 0x57, 0x4f, 0x44, 0x45, 0xfd, 0x78, 0x4f, 0x87, 0x67, 0x59, 0x20, 0x4f, 0xb7, 0x20,
+	0x7f, 0x87, 0x05, 0x05, 0xf5, 0x08, 0x16, 0x5a, 0xfd, 0x33, 0xef, 0x61, 0xf4, 0x57, 0x7f, 0xc8,
+	0x50, 0x89, 0xc7, 0x25, 0xe2, 0x3c, 0x9f, 0x10, 0xe7, 0xd1, 0xb8, 0x38, 0x37, 0x6b, 0x27, 0x5f,
+	0x51, 0xea, 0xa5, 0x3c, 0xcd, 0xcb, 0xfc, 0xfd, 0xbc, 0x2c, 0x4c, 0xf1, 0x12, 0x37, 0xa1, 0x1a,
+	0x74, 0xdf, 0xf3, 0x5e, 0xe8, 0x70, 0xe6, 0x87, 0x4e, 0x7c, 0x20, 0xca, 0xb4, 0x92, 0x82, 0x34,
+	0x74, 0xb8, 0xfa, 0xe9, 0x4f, 0xdf, 0xe0, 0x2c, 0xe7, 0xf2, 0xd3, 0x9d, 0x2b, 0xdc, 0xe1, 0x5c,
+	0x71, 0xfb, 0xab, 0x04, 0x95, 0xe3, 0x91, 0x98, 0x46, 0x2c, 0x26, 0xee, 0x41, 0x31, 0x3a, 0x4b,
+	0x58, 0xbf, 0xf5, 0x56, 0x45, 0x06, 0xd7, 0xd7, 0x66, 0xdc, 0x31, 0x35, 0x87, 0x04, 0x4a, 0x71,
+	0x60, 0x71, 0xed, 0xf6, 0x18, 0xc7, 0x53, 0xd6, 0x67, 0x65, 0x5c, 0xcd, 0xe1, 0x1e, 0xcc, 0x1d,
+	0x70, 0x31, 0x72, 0x17, 0x57, 0x6f, 0x73, 0x3c, 0x9e, 0x52, 0x9f, 0x1e, 0x06, 0x35, 0x77, 0x5a,
+	0x8a, 0xfe, 0x91, 0x76, 0x7e, 0x0d, 0x00, 0xae, 0x72, 0x8d, 0x73, 0xa8, 0x06, 0x00, 0x00,
 }
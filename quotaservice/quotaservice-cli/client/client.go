@@ -11,9 +11,14 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mian-qin/qqs/quotaservice/config"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -22,11 +27,14 @@ var (
 	verbose = app.Flag("verbose", "Verbose output").Short('v').Default("false").Bool()
 	host    = app.Flag("host", "Host address").Short('h').Default("localhost").String()
 	port    = app.Flag("port", "Host port").Short('p').Default("80").Int()
+	token   = app.Flag("token", "Bearer token authenticating to the admin API.").Envar("QUOTASERVICE_TOKEN").String()
+	user    = app.Flag("user", "User and password authenticating to the admin API, as user:password.").Envar("QUOTASERVICE_USER").String()
 
 	// show
 	show          = app.Command("show", "Show configuration for the entire service, optionally filtered by namespace and/or bucket name.")
 	showGDB       = show.Flag("globaldefault", "Only show configs for the global default bucket.").Short('g').Default("false").Bool()
 	output        = show.Flag("out", "Send output to file.").Short('o').String()
+	showLabels    = show.Flag("label", "Only show namespaces with a label, as key=value, or key for any value. May be repeated.").Short('l').Strings()
 	showNamespace = show.Arg("namespace", "Only show configs for a given namespace.").String()
 	showBucket    = show.Arg("bucket", "Only show configs for a given bucket in a given namespace.").String()
 
@@ -49,13 +57,56 @@ var (
 	updateFile      = update.Flag("file", "File from which to read configs.").Short('f').String()
 	updateNamespace = update.Arg("namespace", "Namespace to update.").String()
 	updateBucket    = update.Arg("bucket", "Bucket to update.").String()
+
+	// rollback
+	rollback        = app.Command("rollback", "Rolls back to a historical configuration, which is persisted as a new version.")
+	rollbackVersion = rollback.Arg("version", "Version to roll back to.").Required().Int()
+
+	// migrate
+	migrate = app.Command("migrate", "Upgrades every historical configuration to the current schema version, in place.")
+
+	// diff
+	diff     = app.Command("diff", "Shows the differences between two historical configurations.")
+	diffJSON = diff.Flag("json", "Output the diff as JSON.").Short('j').Default("false").Bool()
+	diffFrom = diff.Arg("from", "Version to diff from.").Required().Int()
+	diffTo   = diff.Arg("to", "Version to diff to.").Required().Int()
+
+	// plan
+	plan     = app.Command("plan", "Shows the changes applying a YAML configuration file would make to the running configuration.")
+	planFile = plan.Flag("file", "YAML file from which to read the configuration.").Short('f').Required().String()
+
+	// apply
+	apply     = app.Command("apply", "Replaces the running configuration with a YAML configuration file, unless it was changed concurrently.")
+	applyFile = apply.Flag("file", "YAML file from which to read the configuration.").Short('f').Required().String()
+
+	// validate
+	validateCmd  = app.Command("validate", "Checks a YAML configuration file, listing every problem found.")
+	validateFile = validateCmd.Flag("file", "YAML file from which to read the configuration.").Short('f').Required().String()
+
+	// boost
+	boost            = app.Command("boost", "Temporarily overrides the limits of a bucket, which are reverted when the boost expires.")
+	boostGDB         = boost.Flag("globaldefault", "Boosts the global default bucket.").Short('g').Default("false").Bool()
+	boostSize        = boost.Flag("size", "Boosted bucket size.").Int64()
+	boostFillRate    = boost.Flag("fill-rate", "Boosted fill rate.").Int64()
+	boostWaitTimeout = boost.Flag("wait-timeout-millis", "Boosted wait timeout in milliseconds.").Int64()
+	boostFor         = boost.Flag("for", "How long the boost lasts, e.g. 2h.").Duration()
+	boostReason      = boost.Flag("reason", "Why the bucket is boosted.").String()
+	boostRevert      = boost.Flag("revert", "Reverts the boost before it expires.").Default("false").Bool()
+	boostNamespace   = boost.Arg("namespace", "Namespace of the bucket to boost.").String()
+	boostBucket      = boost.Arg("bucket", "Bucket to boost.").String()
+
+	// import
+	importCmd    = app.Command("import", "Converts rate limit configs of other services into a YAML configuration file.")
+	importFormat = importCmd.Flag("format", "Format of the files to import.").Required().Enum("envoy")
+	importOutput = importCmd.Flag("out", "Send output to file.").Short('o').String()
+	importFiles  = importCmd.Arg("files", "Files to import; each envoy file becomes a namespace.").Required().Strings()
 )
 
 func RunClient(args []string) {
 	switch kingpin.MustParse(app.Parse(args)) {
 	// List
 	case show.FullCommand():
-		doShow(*showGDB, *showNamespace, *showBucket)
+		doShow(*showGDB, *showNamespace, *showBucket, *showLabels)
 		break
 	case add.FullCommand():
 		doAdd(*addGDB, *addNamespace, *addBucket)
@@ -66,31 +117,54 @@ func RunClient(args []string) {
 	case update.FullCommand():
 		doUpdate(*updateGDB, *updateNamespace, *updateBucket)
 		break
+	case rollback.FullCommand():
+		doRollback(*rollbackVersion)
+		break
+	case migrate.FullCommand():
+		doMigrate()
+		break
+	case diff.FullCommand():
+		doDiff(*diffFrom, *diffTo, *diffJSON)
+		break
+	case plan.FullCommand():
+		doPlan(*planFile)
+		break
+	case apply.FullCommand():
+		doApply(*applyFile)
+		break
+	case validateCmd.FullCommand():
+		doValidate(*validateFile)
+		break
+	case boost.FullCommand():
+		doBoost(*boostGDB, *boostNamespace, *boostBucket)
+		break
+	case importCmd.FullCommand():
+		doImport(*importFormat, *importFiles)
+		break
 	default:
 		kingpin.FatalUsage("Unknown command; should never happen.")
 	}
 }
 
-func doShow(gdb bool, namespace, bucket string) {
+func doShow(gdb bool, namespace, bucket string, labels []string) {
 	validate(gdb, namespace, bucket)
-	logf("Called show(gdb=%v, namespace=%v, bucket=%v)\n", gdb, namespace, bucket)
+	logf("Called show(gdb=%v, namespace=%v, bucket=%v, labels=%v)\n", gdb, namespace, bucket, labels)
+
+	if len(labels) > 0 && (gdb || namespace != "") {
+		kingpin.Fatalf("Labels can only be used to filter the entire service configuration.")
+	}
+
 	url := createUrl(gdb, namespace, bucket)
+	if len(labels) > 0 {
+		url += "?" + neturl.Values{"label": labels}.Encode()
+	}
+
 	resp := connectToServer("GET", url)
 	defer func() { _ = resp.Body.Close() }()
 	body, e := ioutil.ReadAll(resp.Body)
 	kingpin.FatalIfError(e, "Error reading HTTP response")
 
-	if *output == "" {
-		fmt.Print(string(body))
-	} else {
-		logf("Writing to %v\n", *output)
-		f, err := os.Create(*output)
-		kingpin.FatalIfError(err, "Cannot write to file %v", *output)
-		_, err = f.WriteString(string(body))
-		kingpin.FatalIfError(err, "Cannot write to file %v", *output)
-		err = f.Close()
-		kingpin.FatalIfError(err, "Cannot write to file %v", *output)
-	}
+	writeOutput(*output, body)
 }
 
 func doAdd(gdb bool, namespace, bucket string) {
@@ -119,6 +193,218 @@ func doUpdate(gdb bool, namespace, bucket string) {
 	_ = resp.Body.Close()
 }
 
+func doRollback(version int) {
+	logf("Called rollback(version=%v)\n", version)
+	url := fmt.Sprintf("http://%v:%v/api/configs/%v/rollback", *host, *port, version)
+	logf("Connecting to URL %v\n", url)
+	resp := connectToServer("POST", url)
+	_ = resp.Body.Close()
+}
+
+func doMigrate() {
+	logf("Called migrate()\n")
+	url := fmt.Sprintf("http://%v:%v/api/configs/migrate", *host, *port)
+	logf("Connecting to URL %v\n", url)
+	resp := connectToServer("POST", url)
+	defer func() { _ = resp.Body.Close() }()
+	body, e := ioutil.ReadAll(resp.Body)
+	kingpin.FatalIfError(e, "Error reading HTTP response")
+
+	var migrated struct {
+		Migrated      int   `json:"migrated"`
+		SchemaVersion int32 `json:"schema_version"`
+	}
+
+	kingpin.FatalIfError(json.Unmarshal(body, &migrated), "Error reading response")
+	fmt.Printf("Migrated %v configs to schema version %v\n", migrated.Migrated, migrated.SchemaVersion)
+}
+
+func doDiff(from, to int, asJSON bool) {
+	logf("Called diff(from=%v, to=%v, json=%v)\n", from, to, asJSON)
+	url := fmt.Sprintf("http://%v:%v/api/configs/diff?from=%v&to=%v", *host, *port, from, to)
+	logf("Connecting to URL %v\n", url)
+	resp := connectToServer("GET", url)
+	defer func() { _ = resp.Body.Close() }()
+	body, e := ioutil.ReadAll(resp.Body)
+	kingpin.FatalIfError(e, "Error reading HTTP response")
+
+	if asJSON {
+		fmt.Println(string(body))
+		return
+	}
+
+	d := &config.ConfigDiff{}
+	kingpin.FatalIfError(json.Unmarshal(body, d), "Error reading diff")
+	fmt.Print(d)
+}
+
+func doPlan(f string) {
+	logf("Called plan(file=%v)\n", f)
+	_, d := planCfg(f)
+	fmt.Print(d)
+}
+
+func doApply(f string) {
+	logf("Called apply(file=%v)\n", f)
+	desired, d := planCfg(f)
+	fmt.Print(d)
+
+	if d.Empty() {
+		return
+	}
+
+	cfgBytes, e := json.Marshal(desired)
+	kingpin.FatalIfError(e, "Could not serialize config")
+
+	// The config is only replaced if it is still at the version the plan was made against.
+	url := createUrl(false, "", "")
+	r, e := http.NewRequest("POST", url, bytes.NewReader(cfgBytes))
+	kingpin.FatalIfError(e, "HTTP error")
+	r.Header.Set("Version", strconv.Itoa(int(d.FromVersion)))
+
+	resp := doRequest(r)
+	_ = resp.Body.Close()
+	fmt.Printf("Applied version %v\n", d.ToVersion)
+}
+
+func doValidate(f string) {
+	logf("Called validate(file=%v)\n", f)
+	cfgBytes, e := ioutil.ReadFile(f)
+	kingpin.FatalIfError(e, "Could not read config from %v", f)
+
+	_, e = config.FromYAML(cfgBytes)
+	if errs, ok := e.(config.ValidationErrors); ok {
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+
+		kingpin.Fatalf("%v problems found in %v", len(errs), f)
+	}
+
+	kingpin.FatalIfError(e, "Invalid config in %v", f)
+	fmt.Printf("%v is valid\n", f)
+}
+
+func doBoost(gdb bool, namespace, bucket string) {
+	validate(gdb, namespace, bucket)
+	logf("Called boost(gdb=%v, namespace=%v, bucket=%v, revert=%v)\n", gdb, namespace, bucket, *boostRevert)
+
+	if gdb {
+		namespace, bucket = config.GlobalNamespace, config.DefaultBucketName
+	} else if bucket == "" {
+		kingpin.FatalUsage("A bucket, or --globaldefault, is required.")
+	}
+
+	url := fmt.Sprintf("http://%v:%v/api/boosts/%v/%v", *host, *port, namespace, bucket)
+	logf("Connecting to URL %v\n", url)
+
+	if *boostRevert {
+		resp := connectToServer("DELETE", url)
+		_ = resp.Body.Close()
+		return
+	}
+
+	if *boostFor <= 0 {
+		kingpin.FatalUsage("--for is required to boost a bucket.")
+	}
+
+	b := &pb.BucketBoost{
+		Config: &pb.BucketConfig{
+			Size:              *boostSize,
+			FillRate:          *boostFillRate,
+			WaitTimeoutMillis: *boostWaitTimeout},
+		Expires: time.Now().Add(*boostFor).Unix(),
+		Reason:  *boostReason}
+
+	cfgBytes, e := json.Marshal(b)
+	kingpin.FatalIfError(e, "Could not serialize boost")
+
+	resp := connectToServer("POST", url, cfgBytes)
+	_ = resp.Body.Close()
+	fmt.Printf("Boosted %v until %v\n", config.FullyQualifiedName(namespace, bucket), time.Unix(b.Expires, 0))
+}
+
+func doImport(format string, files []string) {
+	logf("Called import(format=%v, files=%v)\n", format, files)
+	cfg := config.NewDefaultServiceConfig()
+	problems := 0
+
+	for _, f := range files {
+		cfgBytes, e := ioutil.ReadFile(f)
+		kingpin.FatalIfError(e, "Could not read config from %v", f)
+
+		ns, importProblems, e := config.FromEnvoyYAML(cfgBytes)
+		kingpin.FatalIfError(e, "Invalid envoy config in %v", f)
+
+		if cfg.Namespaces[ns.Name] != nil {
+			kingpin.Fatalf("Domain %v is imported more than once", ns.Name)
+		}
+
+		kingpin.FatalIfError(config.AddNamespace(cfg, ns), "Invalid envoy config in %v", f)
+
+		for _, p := range importProblems {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", f, p)
+		}
+
+		problems += len(importProblems)
+	}
+
+	kingpin.FatalIfError(config.Validate(cfg), "Imported config is invalid")
+
+	y, e := config.ToYAML(cfg)
+	kingpin.FatalIfError(e, "Could not serialize config")
+	writeOutput(*importOutput, y)
+
+	if problems > 0 {
+		fmt.Fprintf(os.Stderr, "%v constructs could not be mapped exactly\n", problems)
+	}
+}
+
+// writeOutput writes to a file, or to stdout if f is empty.
+func writeOutput(f string, body []byte) {
+	if f == "" {
+		fmt.Print(string(body))
+		return
+	}
+
+	logf("Writing to %v\n", f)
+	out, err := os.Create(f)
+	kingpin.FatalIfError(err, "Cannot write to file %v", f)
+	_, err = out.Write(body)
+	kingpin.FatalIfError(err, "Cannot write to file %v", f)
+	err = out.Close()
+	kingpin.FatalIfError(err, "Cannot write to file %v", f)
+}
+
+// planCfg reads the config in a YAML file, and diffs it against the running config.
+func planCfg(f string) (*pb.ServiceConfig, *config.ConfigDiff) {
+	cfgBytes, e := ioutil.ReadFile(f)
+	kingpin.FatalIfError(e, "Could not read config from %v", f)
+
+	desired, e := config.FromYAML(cfgBytes)
+	kingpin.FatalIfError(e, "Invalid config in %v", f)
+
+	resp := connectToServer("GET", createUrl(false, "", ""))
+	defer func() { _ = resp.Body.Close() }()
+	body, e := ioutil.ReadAll(resp.Body)
+	kingpin.FatalIfError(e, "Error reading HTTP response")
+
+	running, e := config.FromJSON(body)
+	kingpin.FatalIfError(e, "Error reading running config")
+
+	// Effective configs are compared, so the plan shows every bucket affected by a change to bucket
+	// defaults.
+	desired.Version = running.Version + 1
+
+	effectiveRunning, e := config.EffectiveConfig(running)
+	kingpin.FatalIfError(e, "Invalid running config")
+
+	effectiveDesired, e := config.EffectiveConfig(desired)
+	kingpin.FatalIfError(e, "Invalid config in %v", f)
+
+	return desired, config.Diff(effectiveRunning, effectiveDesired)
+}
+
 func readCfg(f, namespace, bucket string) []byte {
 	var cfgBytes []byte
 	var e error
@@ -202,6 +488,21 @@ func connectToServer(method, url string, data ...[]byte) *http.Response {
 	r, e := http.NewRequest(method, url, dataReader)
 	kingpin.FatalIfError(e, "HTTP error")
 
+	return doRequest(r)
+}
+
+func doRequest(r *http.Request) *http.Response {
+	if *token != "" {
+		r.Header.Set("Authorization", "Bearer "+*token)
+	} else if *user != "" {
+		credentials := strings.SplitN(*user, ":", 2)
+		if len(credentials) != 2 {
+			kingpin.Fatalf("User must be given as user:password")
+		}
+
+		r.SetBasicAuth(credentials[0], credentials[1])
+	}
+
 	client := &http.Client{}
 	resp, e := client.Do(r)
 	kingpin.FatalIfError(e, "HTTP error")
@@ -6,6 +6,7 @@ package quotaservice
 import (
 	"time"
 
+	"github.com/mian-qin/qqs/quotaservice/clock"
 	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/logging"
 	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
@@ -69,6 +70,15 @@ func (r *reapableBucket) Destroy() {
 	r.Bucket.Destroy()
 }
 
+// Reconfigure is forwarded to the delegate bucket, if it can be reconfigured.
+func (r *reapableBucket) Reconfigure(cfg *pbconfig.BucketConfig) bool {
+	if rb, ok := r.Bucket.(ReconfigurableBucket); ok {
+		return rb.Reconfigure(cfg)
+	}
+
+	return false
+}
+
 func createWatcher(ns, bucketName string, maxIdle time.Duration, activityChannel <-chan struct{}) *watcher {
 	return &watcher{
 		ns:         ns,
@@ -85,6 +95,10 @@ type reaper struct {
 }
 
 func newReaper(bc *bucketContainer, r config.ReaperConfig) *reaper {
+	if r.Clock == nil {
+		r.Clock = clock.System
+	}
+
 	watcherChannel := make(chan *watcher, r.BucketWatcherBuffer)
 	reaper := &reaper{
 		cfg:         r,
@@ -103,13 +117,13 @@ func (r *reaper) stop() {
 
 func (r *reaper) addNewWatcher(w *watcher) {
 	r.watchers[w.identifier] = w
-	w.lastActivity = time.Now()
+	w.lastActivity = r.cfg.Clock.Now()
 }
 
 // checkExpirations checks all watches registered with the reaper, and destroys idle buckets, updating the reaper
 // accordingly. Returns the duration after which it should run again.
 func (r *reaper) checkExpirations(bc *bucketContainer) time.Duration {
-	now := time.Now()
+	now := r.cfg.Clock.Now()
 	newSleep := r.cfg.MinFrequency
 	var reaped uint64
 	for id, w := range r.watchers {
@@ -133,7 +147,7 @@ func (r *reaper) checkExpirations(bc *bucketContainer) time.Duration {
 func (r *reaper) reapIdleBuckets(bc *bucketContainer, newWatchers <-chan *watcher) {
 	sleep := r.cfg.InitSleep
 	logging.Printf("reapIdleBuckets started. Initial sleep %v", sleep)
-	ticker := time.NewTicker(sleep)
+	ticker := r.cfg.Clock.NewTicker(sleep)
 
 	// Watch on a ticker, or a new watch being created.
 	for {
@@ -148,14 +162,14 @@ func (r *reaper) reapIdleBuckets(bc *bucketContainer, newWatchers <-chan *watche
 				return
 			}
 
-		case <-ticker.C:
+		case <-ticker.C():
 			newSleep := r.checkExpirations(bc)
 
 			if newSleep != sleep {
 				logging.Printf("Adjusting ticker to run with duration %v", newSleep)
 				// We need a new ticker.
 				ticker.Stop()
-				ticker = time.NewTicker(newSleep)
+				ticker = r.cfg.Clock.NewTicker(newSleep)
 				sleep = newSleep
 			}
 		}
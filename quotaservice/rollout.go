@@ -0,0 +1,300 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/events"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/stats"
+)
+
+const (
+	// healthReportInterval is how often nodes report their health, and check whether a staged
+	// rollout is ready to be promoted or rolled back.
+	healthReportInterval = 10 * time.Second
+	// staleHealthReport is how old a node's health can be before it is left out of comparisons.
+	staleHealthReport = 3 * healthReportInterval
+	// defaultBakeMillis is how long canaries serve a staged config for, unless a rollout says
+	// otherwise.
+	defaultBakeMillis = int64(5 * time.Minute / time.Millisecond)
+	// defaultDeadlineMillis is how long canaries have, once baked, to serve enough requests to be
+	// judged by, unless a rollout says otherwise.
+	defaultDeadlineMillis = int64(time.Hour / time.Millisecond)
+)
+
+// ErrNoRollout is returned when promoting or rolling back a rollout that isn't in progress.
+var ErrNoRollout = errors.New("No rollout in progress")
+
+// nodeHealth counts the requests this node has served and rejected since it started serving its
+// current config version.
+type nodeHealth struct {
+	version    int32
+	requests   int64
+	rejections int64
+	sync.Mutex // Embedded mutex
+}
+
+func (h *nodeHealth) handleEvent(e events.Event) {
+	rejected := false
+
+	switch e.EventType() {
+	case events.EVENT_TOKENS_SERVED:
+	case events.EVENT_TIMEOUT_SERVING_TOKENS, events.EVENT_TOO_MANY_TOKENS_REQUESTED, events.EVENT_BUCKET_MISS:
+		rejected = true
+	default:
+		return
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.requests++
+	if rejected {
+		h.rejections++
+	}
+}
+
+// reset starts counting afresh if version isn't the version already being served.
+func (h *nodeHealth) reset(version int32) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.version != version {
+		h.version = version
+		h.requests = 0
+		h.rejections = 0
+	}
+}
+
+func (h *nodeHealth) report(node string, canary bool, now time.Time) *stats.NodeHealth {
+	h.Lock()
+	defer h.Unlock()
+
+	return &stats.NodeHealth{
+		Node:       node,
+		Canary:     canary,
+		Version:    h.version,
+		Requests:   h.requests,
+		Rejections: h.rejections,
+		Reported:   now.Unix()}
+}
+
+// rolloutInProgress returns true if cfg is being rolled out to canaries only.
+func rolloutInProgress(cfg *pb.ServiceConfig) bool {
+	_, staged := config.StableVersion(cfg)
+	return staged
+}
+
+// replaceConfig replaces clonedCfg with c, keeping the rollout clonedCfg records. Replacing the
+// config during a rollout stages the replacement along with it, rather than promoting it to the
+// whole fleet or reviving the rollout c was persisted with.
+func replaceConfig(clonedCfg, c *pb.ServiceConfig) {
+	rollout := clonedCfg.Rollout
+	*clonedCfg = *c
+	clonedCfg.Rollout = rollout
+}
+
+// servedConfig returns the config this node serves when newConfig is persisted. Nodes that aren't
+// canaries keep serving the stable version while a staged rollout is in progress.
+func (s *server) servedConfig(newConfig *pb.ServiceConfig) (*pb.ServiceConfig, error) {
+	if s.canary || !rolloutInProgress(newConfig) {
+		return newConfig, nil
+	}
+
+	return s.historicalConfig(newConfig.Rollout.StableVersion)
+}
+
+// StageConfig replaces the config on canary nodes only, and promotes it to the rest of the fleet
+// or rolls it back once the canaries' health has been compared against theirs. Further updates
+// while the rollout is in progress are staged along with it.
+func (s *server) StageConfig(c *pb.ServiceConfig, r *pb.Rollout, actor audit.Actor) error {
+	rollout := &pb.Rollout{}
+	if r != nil {
+		rollout = proto.Clone(r).(*pb.Rollout)
+	}
+
+	rollout.Stage = pb.Rollout_CANARY
+	rollout.Started = s.reaperClock().Now().Unix()
+	rollout.Reason = ""
+
+	if rollout.BakeMillis == 0 {
+		rollout.BakeMillis = defaultBakeMillis
+	}
+
+	if rollout.DeadlineMillis == 0 {
+		rollout.DeadlineMillis = defaultDeadlineMillis
+	}
+
+	return s.updateConfig(&audit.Record{Actor: actor, Operation: "StageConfig"}, func(clonedCfg *pb.ServiceConfig) error {
+		// Staging again before a rollout completes keeps the fleet on the same stable version.
+		rollout.StableVersion = clonedCfg.Version
+		if rolloutInProgress(clonedCfg) {
+			rollout.StableVersion = clonedCfg.Rollout.StableVersion
+		}
+
+		*clonedCfg = *c
+		clonedCfg.Rollout = rollout
+		return nil
+	})
+}
+
+// PromoteRollout serves the config being rolled out on every node, without waiting for the
+// canaries' health to be compared.
+func (s *server) PromoteRollout(actor audit.Actor) error {
+	return s.promoteRollout(actor, nil, "Promoted by "+actor.User)
+}
+
+// RollBackRollout replaces the config being rolled out with the stable version.
+func (s *server) RollBackRollout(actor audit.Actor) error {
+	return s.rollBackRollout(actor, nil, "Rolled back by "+actor.User)
+}
+
+// FleetHealth returns the health every node last reported, or nil if this node doesn't report its
+// health.
+func (s *server) FleetHealth() ([]*stats.NodeHealth, error) {
+	if s.healthStore == nil {
+		return nil, nil
+	}
+
+	return s.healthStore.FleetHealth()
+}
+
+func (s *server) promoteRollout(actor audit.Actor, expected *int32, reason string) error {
+	change := &audit.Record{Actor: actor, Operation: "PromoteRollout"}
+	return s.updateConfigIfVersion(change, expected, func(clonedCfg *pb.ServiceConfig) error {
+		if !rolloutInProgress(clonedCfg) {
+			return ErrNoRollout
+		}
+
+		clonedCfg.Rollout.Stage = pb.Rollout_PROMOTED
+		clonedCfg.Rollout.Reason = reason
+		return nil
+	})
+}
+
+func (s *server) rollBackRollout(actor audit.Actor, expected *int32, reason string) error {
+	change := &audit.Record{Actor: actor, Operation: "RollBackRollout"}
+	return s.updateConfigIfVersion(change, expected, func(clonedCfg *pb.ServiceConfig) error {
+		if !rolloutInProgress(clonedCfg) {
+			return ErrNoRollout
+		}
+
+		rollout := clonedCfg.Rollout
+		stable, err := s.historicalConfig(rollout.StableVersion)
+
+		if err != nil {
+			return err
+		}
+
+		*clonedCfg = *stable
+		clonedCfg.Rollout = rollout
+		clonedCfg.Rollout.Stage = pb.Rollout_ROLLED_BACK
+		clonedCfg.Rollout.Reason = reason
+		return nil
+	})
+}
+
+func (s *server) monitorRollout() {
+	c := s.reaperClock()
+	ticker := c.NewTicker(healthReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			now := c.Now()
+			if err := s.healthStore.ReportHealth(s.health.report(s.node, s.canary, now)); err != nil {
+				logging.Printf("Unable to report health: %v", err)
+			}
+
+			s.checkRollout(now)
+		case <-s.stopper:
+			return
+		}
+	}
+}
+
+// checkRollout promotes or rolls back a staged rollout once the canaries have served it for long
+// enough, depending on how their rejection rate compares against the rest of the fleet's. Rollouts
+// whose canaries haven't served enough requests by the deadline are rolled back, rather than keeping
+// the rest of the fleet on the stable version indefinitely. Like boosts, whichever node gets there
+// first updates the config.
+func (s *server) checkRollout(now time.Time) {
+	cfg := s.Configs()
+
+	if !rolloutInProgress(cfg) {
+		return
+	}
+
+	r := cfg.Rollout
+
+	baked := time.Unix(r.Started, 0).Add(time.Duration(r.BakeMillis) * time.Millisecond)
+	if now.Before(baked) {
+		return
+	}
+
+	fleet, err := s.healthStore.FleetHealth()
+
+	if err != nil {
+		logging.Printf("Unable to read fleet health: %v", err)
+		return
+	}
+
+	canaries := sumHealth(fleet, true, cfg.Version, now)
+	rest := sumHealth(fleet, false, r.StableVersion, now)
+	version := cfg.Version
+
+	if canaries.Requests == 0 || canaries.Requests < r.MinRequests {
+		// Not enough traffic to judge the canaries by yet.
+		if r.DeadlineMillis > 0 && !now.Before(baked.Add(time.Duration(r.DeadlineMillis)*time.Millisecond)) {
+			reason := fmt.Sprintf("Canaries served %v requests by the deadline, of the %v required", canaries.Requests, r.MinRequests)
+			logging.Printf("Rolling back config version %v. %v", version, reason)
+			err = s.rollBackRollout(audit.Actor{User: serverUser}, &version, reason)
+			if err != nil && err != config.ErrConcurrentUpdate {
+				logging.Printf("Unable to complete rollout of config version %v: %v", version, err)
+			}
+		}
+
+		return
+	}
+
+	reason := fmt.Sprintf("Canary rejection rate %.4f, against %.4f for the rest of the fleet",
+		canaries.RejectionRate(), rest.RejectionRate())
+
+	if canaries.RejectionRate()-rest.RejectionRate() > r.MaxRejectionRateIncrease {
+		logging.Printf("Rolling back config version %v. %v", version, reason)
+		err = s.rollBackRollout(audit.Actor{User: serverUser}, &version, reason)
+	} else {
+		logging.Printf("Promoting config version %v. %v", version, reason)
+		err = s.promoteRollout(audit.Actor{User: serverUser}, &version, reason)
+	}
+
+	if err != nil && err != config.ErrConcurrentUpdate {
+		logging.Printf("Unable to complete rollout of config version %v: %v", version, err)
+	}
+}
+
+// sumHealth adds up the recent health of the canaries, or the rest of the fleet, serving version.
+func sumHealth(fleet []*stats.NodeHealth, canary bool, version int32, now time.Time) *stats.NodeHealth {
+	sum := &stats.NodeHealth{Canary: canary, Version: version, Reported: now.Unix()}
+	oldest := now.Add(-staleHealthReport).Unix()
+
+	for _, h := range fleet {
+		if h.Canary == canary && h.Version == version && h.Reported >= oldest {
+			sum.Requests += h.Requests
+			sum.Rejections += h.Rejections
+		}
+	}
+
+	return sum
+}
@@ -0,0 +1,274 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/events"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/stats"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+var rolloutStart = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// rolloutBaked is when rollouts staged by stageWithoutBatch have baked for long enough.
+var rolloutBaked = rolloutStart.Add(time.Minute)
+
+// startRolloutServer starts a server whose config has buckets partners:batch and partners:api.
+// Its clock isn't advanced, so health is only reported and rollouts checked when tests do so.
+func startRolloutServer(t *testing.T, canary bool, store stats.HealthStore) *server {
+	// t.Helper()
+
+	cfg := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("partners")
+	helpers.CheckError(t, config.AddBucket(ns, config.NewDefaultBucketConfig("batch")))
+	helpers.CheckError(t, config.AddBucket(ns, config.NewDefaultBucketConfig("api")))
+	helpers.CheckError(t, config.AddNamespace(cfg, ns))
+
+	r := NewReaperConfigForTests()
+	r.Clock = helpers.NewFakeClock(rolloutStart)
+	s := New(&MockBucketFactory{}, config.NewMemoryConfig(cfg), r, 0, &MockEndpoint{}).(*server)
+	s.SetRolloutNode("node", canary, store)
+	// Health is counted from events, which are dropped if the buffer is full.
+	s.SetListener(func(events.Event) {}, 100)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+
+	return s
+}
+
+// stageWithoutBatch stages a config that deletes partners:batch and resizes partners:api.
+func stageWithoutBatch(t *testing.T, s *server) {
+	// t.Helper()
+
+	staged := proto.Clone(s.Configs()).(*pb.ServiceConfig)
+	helpers.CheckError(t, config.DeleteBucket(staged, "partners", "batch"))
+	staged.Namespaces["partners"].Buckets["api"].Size = 500
+
+	helpers.CheckError(t, s.StageConfig(staged, &pb.Rollout{BakeMillis: 60000, MinRequests: 10}, audit.Actor{User: "stager"}))
+	waitForVersion(t, s, 1)
+}
+
+func checkAPISize(t *testing.T, s *server, expected int64) {
+	// t.Helper()
+
+	size, _, _, _, err := s.GetInfo("partners", "api")
+	helpers.CheckError(t, err)
+
+	if size != expected {
+		t.Errorf("Expected partners:api to be served with size %v, got %v", expected, size)
+	}
+}
+
+// allowN requests tokens from a bucket count times, and waits for the requests to be counted.
+func allowN(t *testing.T, s *server, bucket string, count int) {
+	// t.Helper()
+
+	before := s.health.report("", false, rolloutStart).Requests
+
+	for i := 0; i < count; i++ {
+		_, _, _ = s.Allow("partners", bucket, 1, 0, false)
+	}
+
+	start := time.Now()
+	for s.health.report("", false, rolloutStart).Requests < before+int64(count) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Timeout waiting for %v requests to be counted", count)
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestRolloutWaitsForPromotion(t *testing.T) {
+	s := startRolloutServer(t, false, stats.NewMemoryHealthStore())
+	defer stopServer(t, s)
+
+	stageWithoutBatch(t, s)
+
+	// Nodes that aren't canaries keep serving the stable version.
+	checkAPISize(t, s, 100)
+
+	if s.Configs().Rollout.StableVersion != 0 || s.Configs().Rollout.Stage != pb.Rollout_CANARY {
+		t.Fatalf("Expected version 0 to be stable during the rollout, got %+v", s.Configs().Rollout)
+	}
+
+	// No canaries have served any requests, so the rollout can't be judged.
+	s.checkRollout(rolloutStart.Add(time.Hour))
+	if s.Configs().Version != 1 {
+		t.Fatalf("Expected the rollout to wait for canary traffic, got version %v", s.Configs().Version)
+	}
+
+	helpers.CheckError(t, s.PromoteRollout(audit.Actor{User: "promoter"}))
+	waitForVersion(t, s, 2)
+	checkAPISize(t, s, 500)
+
+	if r := s.Configs().Rollout; r.Stage != pb.Rollout_PROMOTED || r.Reason != "Promoted by promoter" {
+		t.Errorf("Expected the rollout to be promoted, got %+v", r)
+	}
+
+	if err := s.RollBackRollout(audit.Actor{User: "test"}); err != ErrNoRollout {
+		t.Errorf("Expected rolling back a completed rollout to fail with ErrNoRollout, got %v", err)
+	}
+}
+
+func TestRolloutRolledBack(t *testing.T) {
+	store := stats.NewMemoryHealthStore()
+	helpers.CheckError(t, store.ReportHealth(&stats.NodeHealth{
+		Node:       "stable",
+		Version:    0,
+		Requests:   1000,
+		Rejections: 10,
+		Reported:   rolloutBaked.Unix()}))
+
+	s := startRolloutServer(t, true, store)
+	defer stopServer(t, s)
+
+	stageWithoutBatch(t, s)
+
+	// Canaries serve the staged config, and now reject requests for partners:batch.
+	checkAPISize(t, s, 500)
+	allowN(t, s, "api", 10)
+	allowN(t, s, "batch", 10)
+	helpers.CheckError(t, store.ReportHealth(s.health.report("canary", true, rolloutBaked)))
+
+	// The canaries haven't baked for long enough yet.
+	s.checkRollout(rolloutStart.Add(time.Second))
+	if s.Configs().Version != 1 {
+		t.Fatalf("Expected the rollout to wait until the canaries have baked, got version %v", s.Configs().Version)
+	}
+
+	s.checkRollout(rolloutBaked)
+	waitForVersion(t, s, 2)
+	checkAPISize(t, s, 100)
+
+	cfg := s.Configs()
+	if cfg.Rollout.Stage != pb.Rollout_ROLLED_BACK || cfg.Namespaces["partners"].Buckets["batch"] == nil {
+		t.Errorf("Expected the stable config to be restored, got %+v", cfg)
+	}
+
+	if cfg.User != serverUser {
+		t.Errorf("Expected the rollback to be attributed to %v, got %v", serverUser, cfg.User)
+	}
+}
+
+func TestRolloutPromoted(t *testing.T) {
+	store := stats.NewMemoryHealthStore()
+	s := startRolloutServer(t, true, store)
+	defer stopServer(t, s)
+
+	stageWithoutBatch(t, s)
+
+	allowN(t, s, "api", 5)
+	helpers.CheckError(t, store.ReportHealth(s.health.report("canary", true, rolloutBaked)))
+
+	// Fewer requests than the rollout's minimum have been served.
+	s.checkRollout(rolloutBaked)
+	if s.Configs().Version != 1 {
+		t.Fatalf("Expected the rollout to wait for enough canary traffic, got version %v", s.Configs().Version)
+	}
+
+	allowN(t, s, "api", 5)
+	helpers.CheckError(t, store.ReportHealth(s.health.report("canary", true, rolloutBaked)))
+
+	// Health reported too long ago is ignored.
+	s.checkRollout(rolloutStart.Add(time.Hour))
+	if s.Configs().Version != 1 {
+		t.Fatalf("Expected stale health to be ignored, got version %v", s.Configs().Version)
+	}
+
+	s.checkRollout(rolloutBaked)
+	waitForVersion(t, s, 2)
+	checkAPISize(t, s, 500)
+
+	if r := s.Configs().Rollout; r.Stage != pb.Rollout_PROMOTED {
+		t.Errorf("Expected the rollout to be promoted, got %+v", r)
+	}
+}
+
+func TestRolloutDeadline(t *testing.T) {
+	s := startRolloutServer(t, false, stats.NewMemoryHealthStore())
+	defer stopServer(t, s)
+
+	stageWithoutBatch(t, s)
+
+	// No canaries ever serve any requests.
+	s.checkRollout(rolloutBaked.Add(time.Duration(defaultDeadlineMillis) * time.Millisecond))
+	waitForVersion(t, s, 2)
+	checkAPISize(t, s, 100)
+
+	if r := s.Configs().Rollout; r.Stage != pb.Rollout_ROLLED_BACK {
+		t.Errorf("Expected the rollout to be rolled back once past its deadline, got %+v", r)
+	}
+}
+
+func TestUpdatesStagedWithRollout(t *testing.T) {
+	s := startRolloutServer(t, false, stats.NewMemoryHealthStore())
+	defer stopServer(t, s)
+
+	stageWithoutBatch(t, s)
+
+	// Replacing the config during the rollout stages the replacement.
+	updated := proto.Clone(s.Configs()).(*pb.ServiceConfig)
+	updated.Rollout = nil
+	updated.Namespaces["partners"].Buckets["api"].Size = 600
+	helpers.CheckError(t, s.UpdateConfigIfVersion(updated, 1, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 2)
+	checkAPISize(t, s, 100)
+
+	if r := s.Configs().Rollout; r.GetStage() != pb.Rollout_CANARY || r.GetStableVersion() != 0 {
+		t.Fatalf("Expected the update to be staged with the rollout, got %+v", r)
+	}
+
+	helpers.CheckError(t, s.PromoteRollout(audit.Actor{User: "promoter"}))
+	waitForVersion(t, s, 3)
+	checkAPISize(t, s, 600)
+
+	// Rolling back to a staged version doesn't revive its rollout.
+	helpers.CheckError(t, s.Rollback(1, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 4)
+	checkAPISize(t, s, 500)
+
+	if r := s.Configs().Rollout; r.GetStage() != pb.Rollout_PROMOTED {
+		t.Errorf("Expected the completed rollout to be kept, got %+v", r)
+	}
+}
+
+func TestRolloutStableVersionRetained(t *testing.T) {
+	p := config.NewMemoryConfigPersisterWithRetention(config.RetentionPolicy{MaxVersions: 2})
+	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	s.SetRolloutNode("node", false, stats.NewMemoryHealthStore())
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	cfg := config.NewDefaultServiceConfig()
+	ns := config.NewDefaultNamespaceConfig("partners")
+	helpers.CheckError(t, config.AddBucket(ns, config.NewDefaultBucketConfig("api")))
+	helpers.CheckError(t, config.AddNamespace(cfg, ns))
+	helpers.CheckError(t, s.UpdateConfig(cfg, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 1)
+
+	staged := proto.Clone(s.Configs()).(*pb.ServiceConfig)
+	staged.Namespaces["partners"].Buckets["api"].Size = 500
+	helpers.CheckError(t, s.StageConfig(staged, nil, audit.Actor{User: "stager"}))
+	waitForVersion(t, s, 2)
+
+	// Further changes would otherwise prune the stable version.
+	helpers.CheckError(t, s.UpdateBucket("partners", staged.Namespaces["partners"].Buckets["api"], audit.Actor{User: "test"}))
+	waitForVersion(t, s, 3)
+	checkAPISize(t, s, 100)
+
+	if _, err := s.historicalConfig(1); err != nil {
+		t.Errorf("Expected the stable version to be retained, got %v", err)
+	}
+}
@@ -3,7 +3,11 @@
 
 package quotaservice
 
-import "time"
+import (
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/audit"
+)
 
 // QuotaService is the interface used by RPC subsystems when fielding remote requests for quotas.
 type QuotaService interface {
@@ -17,9 +21,13 @@ type QuotaService interface {
 	// quotaservice.QoutaServiceError.
 	Allow(namespace, name string, tokensRequested int64, maxWaitMillisOverride int64, maxWaitTimeOverride bool) (waitTime time.Duration, dynamic bool, err error)
 
-	Update(namespace, name string, size, fillRate, WaitTimeoutMillis int64) error
+	// Update changes the limits of a bucket, creating it if it doesn't exist. Limits of 0 are left
+	// unchanged. The change is recorded in the audit log as made by actor.
+	Update(namespace, name string, size, fillRate, WaitTimeoutMillis int64, actor audit.Actor) error
 
-	GetInfo(namespace, name string) (size, fillRate, WaitTimeoutMillis int64, err error)
+	// GetInfo returns the limits a bucket is currently served with, and the name of its active
+	// schedule rule, if any.
+	GetInfo(namespace, name string) (size, fillRate, WaitTimeoutMillis int64, scheduleRule string, err error)
 }
 
 // RpcEndpoint defines a subsystem that listens on a network socket for external systems to
@@ -0,0 +1,233 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+	pb "github.com/mian-qin/qqs/quotaservice/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrUnauthenticated is returned by Authenticators for calls without valid credentials.
+var ErrUnauthenticated = errors.New("No valid credentials")
+
+// Authenticator identifies the caller of an RPC.
+type Authenticator interface {
+	// Authenticate returns the identity of the caller of an RPC, or ErrUnauthenticated.
+	Authenticate(ctx context.Context) (string, error)
+}
+
+type tokenAuthenticator struct {
+	// Identities keyed by token
+	identities map[string]string
+}
+
+// NewTokenAuthenticator creates an Authenticator for static tokens, passed in the "authorization"
+// metadata as "Bearer {token}". tokens maps each token to the identity it authenticates.
+func NewTokenAuthenticator(tokens map[string]string) Authenticator {
+	identities := make(map[string]string, len(tokens))
+	for token, identity := range tokens {
+		identities[token] = identity
+	}
+
+	return &tokenAuthenticator{identities}
+}
+
+func (t *tokenAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return "", ErrUnauthenticated
+	}
+
+	token := []byte(strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer ")))
+	identity := ""
+
+	// Every token is compared, so the time taken doesn't depend on which one matches.
+	for candidate, i := range t.identities {
+		if subtle.ConstantTimeCompare(token, []byte(candidate)) == 1 {
+			identity = i
+		}
+	}
+
+	if identity == "" {
+		return "", ErrUnauthenticated
+	}
+
+	return identity, nil
+}
+
+type peerCertAuthenticator struct{}
+
+// NewPeerCertAuthenticator creates an Authenticator for TLS client certificates, identifying callers
+// by the common name of the certificate's subject. Only certificates verified by the endpoint's TLS
+// config are accepted.
+func NewPeerCertAuthenticator() Authenticator {
+	return &peerCertAuthenticator{}
+}
+
+func (p *peerCertAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	caller, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+
+	tlsInfo, ok := caller.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", ErrUnauthenticated
+	}
+
+	identity := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	if identity == "" {
+		return "", ErrUnauthenticated
+	}
+
+	return identity, nil
+}
+
+type chainAuthenticator []Authenticator
+
+// NewChainAuthenticator creates an Authenticator accepting the credentials of any of the given
+// Authenticators, tried in turn.
+func NewChainAuthenticator(authenticators ...Authenticator) Authenticator {
+	return chainAuthenticator(authenticators)
+}
+
+func (c chainAuthenticator) Authenticate(ctx context.Context) (string, error) {
+	for _, a := range c {
+		identity, err := a.Authenticate(ctx)
+		if err != ErrUnauthenticated {
+			return identity, err
+		}
+	}
+
+	return "", ErrUnauthenticated
+}
+
+// Any matches every authenticated identity, or every namespace, in an ACL.
+const Any = "*"
+
+// ACL lists the namespaces each identity may call RPCs against. Identities may request tokens from,
+// and read the buckets of, the namespaces they are allowed. Updating buckets is granted separately.
+type ACL struct {
+	// Namespaces keyed by identity
+	Allow  map[string][]string `yaml:"allow"`
+	Update map[string][]string `yaml:"update"`
+}
+
+// ACLFromYAML reads an ACL from YAML, such as:
+//
+//	allow:
+//	  checkout: [payments, orders]
+//	  "*": [public]
+//	update:
+//	  quota-admin: ["*"]
+func ACLFromYAML(y []byte) (*ACL, error) {
+	acl := &ACL{}
+	if err := yaml.UnmarshalStrict(y, acl); err != nil {
+		return nil, err
+	}
+
+	return acl, nil
+}
+
+// MayAllow returns true if an identity may request tokens from, and read the buckets of, a
+// namespace. A nil ACL allows every identity everything.
+func (a *ACL) MayAllow(identity, namespace string) bool {
+	return a == nil || granted(a.Allow, identity, namespace)
+}
+
+// MayUpdate returns true if an identity may update the buckets of a namespace. A nil ACL allows
+// every identity everything.
+func (a *ACL) MayUpdate(identity, namespace string) bool {
+	return a == nil || granted(a.Update, identity, namespace)
+}
+
+func granted(grants map[string][]string, identity, namespace string) bool {
+	for _, i := range []string{identity, Any} {
+		for _, ns := range grants[i] {
+			if ns == namespace || ns == Any {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// authInterceptor authenticates the callers of RPCs, rejecting those without valid credentials
+// with codes.Unauthenticated, and responds to calls the ACL doesn't permit with a
+// REJECTED_PERMISSION_DENIED status.
+func authInterceptor(authenticator Authenticator, acl *ACL) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := authenticator.Authenticate(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		var denied interface{}
+
+		switch r := req.(type) {
+		case *pb.AllowRequest:
+			if !acl.MayAllow(identity, r.Namespace) {
+				denied = &pb.AllowResponse{Status: pb.AllowResponse_REJECTED_PERMISSION_DENIED}
+			}
+		case *pb.InfoRequest:
+			if !acl.MayAllow(identity, r.Namespace) {
+				denied = &pb.InfoResponse{Status: pb.InfoResponse_REJECTED_PERMISSION_DENIED}
+			}
+		case *pb.UpdateRequest:
+			if !acl.MayUpdate(identity, r.Namespace) {
+				denied = &pb.UpdateResponse{Status: pb.UpdateResponse_REJECTED_PERMISSION_DENIED}
+			}
+		default:
+			return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("Unknown method %v", info.FullMethod))
+		}
+
+		if denied != nil {
+			logging.Printf("Denied %v to %v", info.FullMethod, identity)
+			return denied, nil
+		}
+
+		return handler(context.WithValue(ctx, identityKey, identity), req)
+	}
+}
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// getActor returns who an RPC is made by, for the audit log. Callers are "default_user" unless an
+// Authenticator identified them.
+func getActor(ctx context.Context) audit.Actor {
+	actor := audit.Actor{User: "default_user"}
+
+	if identity, ok := ctx.Value(identityKey).(string); ok {
+		actor.User = identity
+	}
+
+	if caller, ok := peer.FromContext(ctx); ok && caller.Addr != nil {
+		actor.SourceIP = caller.Addr.String()
+		if host, _, err := net.SplitHostPort(actor.SourceIP); err == nil {
+			actor.SourceIP = host
+		}
+	}
+
+	return actor
+}
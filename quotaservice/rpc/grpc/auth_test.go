@@ -0,0 +1,153 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/audit"
+	pb "github.com/mian-qin/qqs/quotaservice/protos"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := NewTokenAuthenticator(map[string]string{"s3cret": "checkout"})
+
+	if _, err := a.Authenticate(context.Background()); err != ErrUnauthenticated {
+		t.Errorf("Expected a call without a token to be unauthenticated, got %v", err)
+	}
+
+	if _, err := a.Authenticate(withToken("wrong")); err != ErrUnauthenticated {
+		t.Errorf("Expected a call with a wrong token to be unauthenticated, got %v", err)
+	}
+
+	if identity, err := a.Authenticate(withToken("s3cret")); err != nil || identity != "checkout" {
+		t.Errorf("Expected checkout, got %v and %v", identity, err)
+	}
+}
+
+func TestPeerCertAuthenticator(t *testing.T) {
+	a := NewChainAuthenticator(NewTokenAuthenticator(nil), NewPeerCertAuthenticator())
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "batch"}}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+
+	// Certificates the endpoint didn't verify aren't trusted.
+	if _, err := a.Authenticate(ctx); err != ErrUnauthenticated {
+		t.Errorf("Expected an unverified certificate to be unauthenticated, got %v", err)
+	}
+
+	state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	ctx = peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+
+	if identity, err := a.Authenticate(ctx); err != nil || identity != "batch" {
+		t.Errorf("Expected batch, got %v and %v", identity, err)
+	}
+}
+
+func TestACL(t *testing.T) {
+	acl, err := ACLFromYAML([]byte(`
+allow:
+  checkout: [payments, orders]
+  "*": [public]
+update:
+  quota-admin: ["*"]
+`))
+	helpers.CheckError(t, err)
+
+	for _, tc := range []struct {
+		identity, namespace string
+		allow, update       bool
+	}{
+		{"checkout", "payments", true, false},
+		{"checkout", "public", true, false},
+		{"checkout", "other", false, false},
+		{"batch", "public", true, false},
+		{"quota-admin", "payments", false, true}} {
+		if allow := acl.MayAllow(tc.identity, tc.namespace); allow != tc.allow {
+			t.Errorf("Expected %v allowed against %v to be %v", tc.identity, tc.namespace, tc.allow)
+		}
+
+		if update := acl.MayUpdate(tc.identity, tc.namespace); update != tc.update {
+			t.Errorf("Expected %v updating %v to be %v", tc.identity, tc.namespace, tc.update)
+		}
+	}
+
+	var nilACL *ACL
+	if !nilACL.MayAllow("anyone", "payments") || !nilACL.MayUpdate("anyone", "payments") {
+		t.Error("Expected a nil ACL to permit everything")
+	}
+
+	if _, err := ACLFromYAML([]byte("allowed: {checkout: [payments]}")); err == nil {
+		t.Error("Expected an ACL with an unknown field to fail")
+	}
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	interceptor := authInterceptor(NewTokenAuthenticator(map[string]string{"c": "checkout", "a": "quota-admin"}),
+		&ACL{Allow: map[string][]string{"checkout": {"payments"}}, Update: map[string][]string{"quota-admin": {Any}}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/quotaservice.QuotaService/Allow"}
+	handled := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "handled", nil
+	}
+
+	if _, err := interceptor(context.Background(), &pb.AllowRequest{Namespace: "payments"}, info, handled); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected an unauthenticated call to be rejected, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		token    string
+		req      interface{}
+		expected interface{}
+	}{
+		{"c", &pb.AllowRequest{Namespace: "payments"}, "handled"},
+		{"c", &pb.AllowRequest{Namespace: "orders"}, &pb.AllowResponse{Status: pb.AllowResponse_REJECTED_PERMISSION_DENIED}},
+		{"c", &pb.InfoRequest{Namespace: "payments"}, "handled"},
+		{"a", &pb.InfoRequest{Namespace: "payments"}, &pb.InfoResponse{Status: pb.InfoResponse_REJECTED_PERMISSION_DENIED}},
+		{"c", &pb.UpdateRequest{Namespace: "payments"}, &pb.UpdateResponse{Status: pb.UpdateResponse_REJECTED_PERMISSION_DENIED}},
+		{"a", &pb.UpdateRequest{Namespace: "payments"}, "handled"}} {
+		rsp, err := interceptor(withToken(tc.token), tc.req, info, handled)
+		helpers.CheckError(t, err)
+
+		if !reflect.DeepEqual(rsp, tc.expected) {
+			t.Errorf("Expected %+v with token %v to respond %+v, got %+v", tc.req, tc.token, tc.expected, rsp)
+		}
+	}
+}
+
+func TestGetActor(t *testing.T) {
+	interceptor := authInterceptor(NewTokenAuthenticator(map[string]string{"a": "quota-admin"}), nil)
+	info := &grpc.UnaryServerInfo{FullMethod: "/quotaservice.QuotaService/Update"}
+	actor := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return getActor(ctx), nil
+	}
+
+	if a := getActor(context.Background()); a != (audit.Actor{User: "default_user"}) {
+		t.Errorf("Expected an unidentified caller to be default_user, got %+v", a)
+	}
+
+	ctx := peer.NewContext(withToken("a"), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}})
+	rsp, err := interceptor(ctx, &pb.UpdateRequest{Namespace: "payments"}, info, actor)
+	helpers.CheckError(t, err)
+
+	if expected := (audit.Actor{User: "quota-admin", SourceIP: "10.0.0.1"}); rsp != expected {
+		t.Errorf("Expected the authenticated caller %+v, got %+v", expected, rsp)
+	}
+}
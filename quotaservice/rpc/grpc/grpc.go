@@ -16,6 +16,7 @@ import (
 	"github.com/mian-qin/qqs/quotaservice/logging"
 	pb "github.com/mian-qin/qqs/quotaservice/protos"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/grpclog"
 )
 
@@ -24,16 +25,56 @@ type GrpcEndpoint struct {
 	grpcServer    *grpc.Server
 	currentStatus lifecycle.Status
 	qs            quotaservice.QuotaService
+	authenticator Authenticator
+	acl           *ACL
+	certFile      string
+	keyFile       string
+	clientCAFile  string
+}
+
+// Option configures a GrpcEndpoint.
+type Option func(*GrpcEndpoint)
+
+// WithAuth authenticates the callers of every RPC with authenticator, and permits calls according to
+// acl. If acl is nil, every authenticated caller is permitted everything.
+func WithAuth(authenticator Authenticator, acl *ACL) Option {
+	return func(g *GrpcEndpoint) {
+		g.authenticator = authenticator
+		g.acl = acl
+	}
+}
+
+// WithTLS serves TLS with the certificate and key in PEM files. The files are read again whenever
+// they change, so certificates can be rotated without restarting.
+func WithTLS(certFile, keyFile string) Option {
+	return func(g *GrpcEndpoint) {
+		g.certFile = certFile
+		g.keyFile = keyFile
+	}
+}
+
+// WithClientCAs requires callers to present a certificate signed by one of the CAs in a PEM file,
+// which is also read again whenever it changes. It has no effect without WithTLS.
+func WithClientCAs(caFile string) Option {
+	return func(g *GrpcEndpoint) {
+		g.clientCAFile = caFile
+	}
 }
 
 // New creates a new GrpcEndpoint, listening on hostport. Hostport is a string in the form
 // "host:port"
-func New(hostport string) *GrpcEndpoint {
+func New(hostport string, opts ...Option) *GrpcEndpoint {
 	if !strings.Contains(hostport, ":") {
 		panic(fmt.Sprintf("hostport should be in the format 'host:port', but is currently %v",
 			hostport))
 	}
-	return &GrpcEndpoint{hostport: hostport}
+
+	g := &GrpcEndpoint{hostport: hostport}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
 }
 
 func (g *GrpcEndpoint) Init(qs quotaservice.QuotaService) {
@@ -45,9 +86,24 @@ func (g *GrpcEndpoint) Start() {
 	if err != nil {
 		logging.Fatalf("Cannot start server on port %v. Error %v", g.hostport, err)
 	}
+	g.hostport = lis.Addr().String()
 
 	grpclog.SetLogger(logging.CurrentLogger())
-	g.grpcServer = grpc.NewServer()
+	var opts []grpc.ServerOption
+	if g.authenticator != nil {
+		opts = append(opts, grpc.UnaryInterceptor(authInterceptor(g.authenticator, g.acl)))
+	}
+
+	if g.certFile != "" {
+		reloader, err := newCertReloader(g.certFile, g.keyFile, g.clientCAFile)
+		if err != nil {
+			logging.Fatalf("Cannot load TLS certificates. Error %v", err)
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.tlsConfig())))
+	}
+
+	g.grpcServer = grpc.NewServer(opts...)
 	// Each service should be registered
 	pb.RegisterQuotaServiceServer(g.grpcServer, g)
 	go func() {
@@ -61,9 +117,18 @@ func (g *GrpcEndpoint) Start() {
 }
 
 func (g *GrpcEndpoint) Stop() {
+	if g.grpcServer != nil {
+		g.grpcServer.Stop()
+	}
 	g.currentStatus = lifecycle.Stopped
 }
 
+// Addr returns the address the endpoint listens on. If it was created with port 0, the port is only
+// known once started.
+func (g *GrpcEndpoint) Addr() string {
+	return g.hostport
+}
+
 func (g *GrpcEndpoint) Allow(ctx context.Context, req *pb.AllowRequest) (*pb.AllowResponse, error) {
 	rsp := new(pb.AllowResponse)
 	if invalid(req) {
@@ -104,7 +169,7 @@ func (g *GrpcEndpoint) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.U
 		return rsp, nil
 	}
 
-	err := g.qs.Update(req.Namespace, req.BucketName, req.Size, req.FillRate, req.WaitTimeoutMillis)
+	err := g.qs.Update(req.Namespace, req.BucketName, req.Size, req.FillRate, req.WaitTimeoutMillis, getActor(ctx))
 	if err != nil {
 		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
 			rsp.Status = toPBStatusUpdate(qsErr)
@@ -130,7 +195,7 @@ func (g *GrpcEndpoint) GetInfo(ctx context.Context, req *pb.InfoRequest) (*pb.In
 	}
 
 	var err error
-	rsp.Size, rsp.FillRate, rsp.WaitTimeoutMillis, err = g.qs.GetInfo(req.Namespace, req.BucketName)
+	rsp.Size, rsp.FillRate, rsp.WaitTimeoutMillis, rsp.ScheduleRule, err = g.qs.GetInfo(req.Namespace, req.BucketName)
 	if err != nil {
 		if qsErr, ok := err.(quotaservice.QuotaServiceError); ok {
 			rsp.Status = toPBStatusInfo(qsErr)
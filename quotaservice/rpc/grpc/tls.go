@@ -0,0 +1,130 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+)
+
+// fileVersion identifies the contents of a file on disk, without reading it.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// certReloader serves a certificate, and optionally the CAs client certificates must be signed by,
+// read from PEM files. The files are read again whenever they change on disk, so certificates can
+// be rotated without restarting the endpoint.
+type certReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	cert       *tls.Certificate
+	clientCAs  *x509.CertPool
+	versions   map[string]fileVersion
+	sync.Mutex // Embedded mutex
+}
+
+func newCertReloader(certFile, keyFile, caFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+
+	if _, err := r.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+
+	return files
+}
+
+// reloadIfChanged reads the files again if any changed since they were last read. If they can't be
+// read, the certificates read before are kept. Returns true if the certificates were reloaded.
+func (r *certReloader) reloadIfChanged() (bool, error) {
+	versions := make(map[string]fileVersion)
+	changed := false
+
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return false, err
+		}
+
+		versions[f] = fileVersion{info.ModTime(), info.Size()}
+		if versions[f] != r.versions[f] {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		pem, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return false, err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("No certificates found in %v", r.caFile)
+		}
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.versions = versions
+	return true, nil
+}
+
+// configForClient returns the TLS config for a connection, with the certificates currently on disk.
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	reloaded, err := r.reloadIfChanged()
+	if err != nil {
+		logging.Printf("Unable to reload TLS certificates, serving the previous ones. Error %v", err)
+	} else if reloaded {
+		logging.Printf("Reloaded TLS certificate %v", r.certFile)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{*r.cert},
+		MinVersion:   tls.VersionTLS12,
+		// gRPC clients require HTTP/2 to be negotiated.
+		NextProtos: []string{"h2"}}
+
+	if r.clientCAs != nil {
+		cfg.ClientCAs = r.clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{GetConfigForClient: r.configForClient, MinVersion: tls.VersionTLS12}
+}
@@ -0,0 +1,82 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+// servedCert returns the certificate a reloader serves to a new connection.
+func servedCert(t *testing.T, r *certReloader) *x509.Certificate {
+	// t.Helper()
+
+	cfg, err := r.configForClient(&tls.ClientHelloInfo{})
+	helpers.CheckError(t, err)
+
+	cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	helpers.CheckError(t, err)
+	return cert
+}
+
+// touch moves the modification time of files forward, so changes are seen even within the
+// resolution of file timestamps.
+func touch(t *testing.T, files ...string) {
+	// t.Helper()
+
+	later := time.Now().Add(time.Minute)
+	for _, f := range files {
+		helpers.CheckError(t, os.Chtimes(f, later, later))
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qs_test_tls")
+	helpers.CheckError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	ca := helpers.NewTestCA(t, dir)
+	certFile, keyFile := ca.Issue(t, "server")
+
+	r, err := newCertReloader(certFile, keyFile, ca.CertFile)
+	helpers.CheckError(t, err)
+
+	cfg, err := r.configForClient(&tls.ClientHelloInfo{})
+	helpers.CheckError(t, err)
+
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs == nil {
+		t.Errorf("Expected client certificates to be required, got %+v", cfg)
+	}
+
+	original := servedCert(t, r)
+
+	// Rotated certificates are served to new connections.
+	ca.Issue(t, "server")
+	touch(t, certFile, keyFile)
+
+	rotated := servedCert(t, r)
+	if rotated.SerialNumber.Cmp(original.SerialNumber) == 0 {
+		t.Errorf("Expected the rotated certificate to be served, got serial %v", rotated.SerialNumber)
+	}
+
+	// Unreadable certificates are ignored, serving the previous ones.
+	helpers.CheckError(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	touch(t, keyFile)
+
+	if served := servedCert(t, r); served.SerialNumber.Cmp(rotated.SerialNumber) != 0 {
+		t.Errorf("Expected the previous certificate to be served, got serial %v", served.SerialNumber)
+	}
+}
+
+func TestCertReloaderMissingFiles(t *testing.T) {
+	if _, err := newCertReloader("/nonexistent/cert.pem", "/nonexistent/key.pem", ""); err == nil {
+		t.Error("Expected missing certificates to fail")
+	}
+}
@@ -0,0 +1,124 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/clock"
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/events"
+	"github.com/mian-qin/qqs/quotaservice/logging"
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+)
+
+// scheduleCheckInterval is how often buckets are checked for schedule rules becoming active or
+// inactive. Rules open on minute boundaries.
+const scheduleCheckInterval = 10 * time.Second
+
+// scheduler periodically switches buckets to the size and fill rate of their active schedule rule,
+// so limits change without a new config being pushed.
+type scheduler struct {
+	clock   clock.Clock
+	stopper chan struct{}
+}
+
+func newScheduler(bc *bucketContainer, c clock.Clock) *scheduler {
+	if c == nil {
+		c = clock.System
+	}
+
+	s := &scheduler{clock: c, stopper: make(chan struct{})}
+	go s.applySchedules(bc)
+
+	return s
+}
+
+func (s *scheduler) stop() {
+	close(s.stopper)
+}
+
+// scheduledConfig returns the config a bucket with the given config is served with right now.
+func (s *scheduler) scheduledConfig(cfg *pbconfig.BucketConfig) *pbconfig.BucketConfig {
+	scheduled, _ := config.ScheduledBucketConfig(cfg, s.clock.Now())
+	return scheduled
+}
+
+func (s *scheduler) applySchedules(bc *bucketContainer) {
+	ticker := s.clock.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			bc.reschedule(s.clock.Now())
+		case <-s.stopper:
+			return
+		}
+	}
+}
+
+// reschedule switches every bucket whose schedule calls for different limits at now.
+func (bc *bucketContainer) reschedule(now time.Time) {
+	bc.Lock()
+	defer bc.Unlock()
+
+	if bc.cfg == nil {
+		// Not initialized yet.
+		return
+	}
+
+	if bc.defaultBucket != nil {
+		bc.defaultBucket = bc.rescheduleBucket(config.GlobalNamespace, config.DefaultBucketName,
+			bc.defaultBucket, bc.cfg.GlobalDefaultBucket, now)
+	}
+
+	for _, ns := range bc.namespaces {
+		ns.Lock()
+		if ns.defaultBucket != nil {
+			ns.defaultBucket = bc.rescheduleBucket(ns.name, config.DefaultBucketName, ns.defaultBucket,
+				ns.cfg.DefaultBucket, now)
+		}
+
+		for name, bucket := range ns.buckets {
+			cfg := ns.cfg.Buckets[name]
+			if bucket.Dynamic() {
+				cfg = ns.cfg.DynamicBucketTemplate
+			}
+
+			ns.buckets[name] = bc.rescheduleBucket(ns.name, name, bucket, cfg, now)
+		}
+		ns.Unlock()
+	}
+}
+
+// rescheduleBucket returns the bucket to serve in place of bucket, which was created from cfg. If
+// cfg's schedule calls for different limits at now, the bucket is reconfigured if possible, or
+// replaced otherwise.
+func (bc *bucketContainer) rescheduleBucket(namespace, name string, bucket Bucket, cfg *pbconfig.BucketConfig, now time.Time) Bucket {
+	if cfg == nil || len(cfg.Schedule) == 0 {
+		return bucket
+	}
+
+	scheduled, rule := config.ScheduledBucketConfig(cfg, now)
+	if !config.DifferentBucketConfigs(bucket.Config(), scheduled) {
+		return bucket
+	}
+
+	ruleName := rule.GetName()
+	logging.Printf("Switching bucket %v to schedule rule %q", config.FullyQualifiedName(namespace, name), ruleName)
+	bc.n.Emit(events.NewScheduleChangedEvent(namespace, name, bucket.Dynamic(), ruleName))
+
+	if rb, ok := bucket.(ReconfigurableBucket); ok && rb.Reconfigure(scheduled) {
+		return bucket
+	}
+
+	replacement := bc.bf.NewBucket(namespace, name, scheduled, bucket.Dynamic())
+	if bucket.Dynamic() {
+		replacement, _ = bc.r.applyWatch(replacement, namespace, name, cfg)
+	}
+
+	bucket.Destroy()
+	return replacement
+}
@@ -0,0 +1,142 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package quotaservice
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/config"
+	"github.com/mian-qin/qqs/quotaservice/events"
+	pbconfig "github.com/mian-qin/qqs/quotaservice/protos/config"
+	"github.com/mian-qin/qqs/quotaservice/test/helpers"
+)
+
+// scheduleStart is a Monday at noon, outside of overnightRule's window.
+var scheduleStart = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+var overnightRule = &pbconfig.ScheduleRule{
+	Name:           "overnight",
+	Cron:           "0 22 * * *",
+	DurationMillis: 8 * 3600 * 1000,
+	Size:           1000,
+	FillRate:       500}
+
+func scheduledConfig() *pbconfig.ServiceConfig {
+	cfg := config.NewDefaultServiceConfig()
+
+	ns := config.NewDefaultNamespaceConfig("partners")
+	b := config.NewDefaultBucketConfig("batch")
+	b.Schedule = []*pbconfig.ScheduleRule{overnightRule}
+	helpers.PanicError(config.AddBucket(ns, b))
+	helpers.PanicError(config.AddNamespace(cfg, ns))
+
+	ns = config.NewDefaultNamespaceConfig("dyn")
+	tpl := config.NewDefaultBucketConfig("")
+	tpl.Schedule = []*pbconfig.ScheduleRule{overnightRule}
+	config.SetDynamicBucketTemplate(ns, tpl)
+	helpers.PanicError(config.AddNamespace(cfg, ns))
+
+	return cfg
+}
+
+func TestReschedule(t *testing.T) {
+	r := NewReaperConfigForTests()
+	// The clock isn't advanced, so the scheduler's goroutine doesn't interfere with the test.
+	r.Clock = helpers.NewFakeClock(scheduleStart)
+	e := &MockEmitter{}
+	bc := NewBucketContainer(&MockBucketFactory{}, e, r)
+	bc.Init(scheduledConfig())
+	defer bc.Stop()
+
+	checkSize := func(namespace, name string, expected int64) Bucket {
+		b, err := bc.FindBucket(namespace, name)
+		helpers.CheckError(t, err)
+
+		if b.Config().Size != expected {
+			t.Fatalf("Expected %v:%v to have size %v, got %+v", namespace, name, expected, b.Config())
+		}
+
+		return b
+	}
+
+	daytime := checkSize("partners", "batch", 100)
+	checkSize("dyn", "d", 100)
+
+	e.Events = make(chan events.Event, 10)
+
+	// The overnight window opens at 10pm.
+	bc.reschedule(scheduleStart.Add(10 * time.Hour))
+	if checkSize("partners", "batch", 1000) == daytime {
+		t.Error("Expected bucket that can't be reconfigured to be replaced")
+	}
+
+	if b := checkSize("dyn", "d", 1000); !b.Dynamic() {
+		t.Error("Expected replaced bucket to remain dynamic")
+	}
+
+	checkScheduleEvents(t, e, "overnight", 2)
+
+	// Nothing changes while the window is open.
+	bc.reschedule(scheduleStart.Add(12 * time.Hour))
+	checkScheduleEvents(t, e, "", 0)
+
+	// The window closes at 6am.
+	bc.reschedule(scheduleStart.Add(18 * time.Hour))
+	checkSize("partners", "batch", 100)
+	checkSize("dyn", "d", 100)
+	checkScheduleEvents(t, e, "", 2)
+}
+
+func TestGetInfoScheduled(t *testing.T) {
+	r := NewReaperConfigForTests()
+	// 11pm, within the overnight window.
+	r.Clock = helpers.NewFakeClock(scheduleStart.Add(11 * time.Hour))
+	s := New(&MockBucketFactory{}, config.NewMemoryConfig(scheduledConfig()), r, 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	size, fillRate, _, rule, err := s.GetInfo("partners", "batch")
+	helpers.CheckError(t, err)
+
+	if size != 1000 || fillRate != 500 || rule != "overnight" {
+		t.Errorf("Expected size 1000 and fill rate 500 of the overnight rule, got %v, %v and rule %q",
+			size, fillRate, rule)
+	}
+
+	// New buckets are created with the limits of the active rule.
+	s.RLock()
+	b, err := s.bucketContainer.FindBucket("dyn", "d")
+	s.RUnlock()
+	helpers.CheckError(t, err)
+
+	if b.Config().Size != 1000 {
+		t.Errorf("Expected new bucket to have size 1000, got %+v", b.Config())
+	}
+}
+
+// checkScheduleEvents checks that exactly count EVENT_SCHEDULE_CHANGED events for rule were emitted,
+// ignoring other events.
+func checkScheduleEvents(t *testing.T, e *MockEmitter, rule string, count int) {
+	// t.Helper()
+
+	received := 0
+	for len(e.Events) > 0 {
+		event := <-e.Events
+		if event.EventType() != events.EVENT_SCHEDULE_CHANGED {
+			continue
+		}
+
+		received++
+		if actual := event.(events.ScheduleEvent).ScheduleRule(); actual != rule {
+			t.Errorf("Expected event for rule %q, got %q", rule, actual)
+		}
+	}
+
+	if received != count {
+		t.Errorf("Expected %v schedule events, got %v", count, received)
+	}
+}
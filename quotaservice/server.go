@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/mian-qin/qqs/quotaservice/admin"
+	"github.com/mian-qin/qqs/quotaservice/audit"
 	"github.com/mian-qin/qqs/quotaservice/events"
 	"github.com/mian-qin/qqs/quotaservice/lifecycle"
 	"github.com/mian-qin/qqs/quotaservice/logging"
@@ -23,6 +24,9 @@ import (
 	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 )
 
+// serverUser is the user config changes made by the server itself are attributed to.
+const serverUser = "quotaservice"
+
 // Implements the quotaservice.Server interface
 type server struct {
 	currentStatus     lifecycle.Status
@@ -37,6 +41,15 @@ type server struct {
 	cfgs              *pb.ServiceConfig
 	persister         config.ConfigPersister
 	reaperConfig      config.ReaperConfig
+	node              string
+	canary            bool
+	healthStore       stats.HealthStore
+	auditSink         audit.Sink
+	adminAuth         admin.Authenticator
+	adminPolicy       *admin.Policy
+	adminProxies      admin.TrustedProxies
+	health            nodeHealth
+	stopper           chan struct{}
 	sync.RWMutex      // Embedded mutex
 }
 
@@ -60,12 +73,22 @@ func (s *server) Start() (bool, error) {
 		if s.statsListener != nil {
 			s.statsListener.HandleEvent(e)
 		}
+
+		if s.healthStore != nil {
+			s.health.handleEvent(e)
+		}
 	}, bufSize)
 
 	s.createBucketContainer()
 	<-s.persister.ConfigChangedWatcher()
 	s.readUpdatedConfig(0)
 	go s.configListener(s.persister.ConfigChangedWatcher())
+	s.stopper = make(chan struct{})
+	go s.revertBoosts()
+
+	if s.healthStore != nil {
+		go s.monitorRollout()
+	}
 
 	// Start the RPC servers
 	for _, rpcServer := range s.rpcEndpoints {
@@ -85,6 +108,10 @@ func (s *server) Stop() (bool, error) {
 		rpcServer.Stop()
 	}
 
+	if s.stopper != nil {
+		close(s.stopper)
+	}
+
 	// Referencing s.bucketContainer should be guarded
 	s.RLock()
 	defer s.RUnlock()
@@ -137,57 +164,70 @@ func (s *server) Allow(namespace, name string, tokensRequested int64, maxWaitMil
 	return w, b.Dynamic(), nil
 }
 
-func (s *server) Update(namespace, name string, size, fr, wt int64) error {
+// Update changes the limits passed in as positive, keeping the rest of the bucket as declared, such
+// as its schedule and labels. Fields left unset are still inherited from bucket defaults.
+func (s *server) Update(namespace, name string, size, fr, wt int64, actor audit.Actor) error {
 	if len(namespace) == 0 || len(name) == 0 {
 		return fmt.Errorf("empty namespace or name:%s/%s", namespace, name)
 	}
 
-	var current pb.BucketConfig
-	if ns, ok := s.Configs().Namespaces[namespace]; ok {
-		if b, ok := ns.GetBuckets()[name]; ok && b != nil {
-			current = *b
+	change := &audit.Record{Actor: actor, Operation: "UpdateBucket", Namespace: namespace, Bucket: name}
+	return s.updateConfig(change, func(clonedCfg *pb.ServiceConfig) error {
+		b := &pb.BucketConfig{Name: name}
+		if declared := clonedCfg.Namespaces[namespace].GetBuckets()[name]; declared != nil {
+			b = proto.Clone(declared).(*pb.BucketConfig)
 		}
-	}
 
-	b := config.NewDefaultBucketConfig(name)
-	if size > 0 {
-		b.Size = size
-	} else {
-		b.Size = current.GetSize()
-	}
+		if size > 0 {
+			b.Size = size
+		}
 
-	if fr > 0 {
-		b.FillRate = fr
-	} else {
-		b.FillRate = current.GetFillRate()
-	}
+		if fr > 0 {
+			b.FillRate = fr
+		}
 
-	if wt > 0 {
-		b.WaitTimeoutMillis = wt
-	} else {
-		b.WaitTimeoutMillis = current.GetWaitTimeoutMillis()
-	}
+		if wt > 0 {
+			b.WaitTimeoutMillis = wt
+		}
 
-	return s.UpdateBucket(namespace, b, "default_user")
+		return config.UpdateBucket(clonedCfg, namespace, b)
+	})
 }
 
-func (s *server) GetInfo(namespace, name string) (size, fillRate, WaitTimeoutMillis int64, err error) {
+func (s *server) GetInfo(namespace, name string) (size, fillRate, WaitTimeoutMillis int64, scheduleRule string, err error) {
+	// Report the bucket as it is served, including the fields it inherits and the limits of its
+	// active schedule rule.
+	s.RLock()
+	bc := s.bucketContainer
+	effective := bc.cfg
+	s.RUnlock()
+
 	var current *pb.BucketConfig
-	if ns, ok := s.Configs().Namespaces[namespace]; ok {
+	if ns, ok := effective.GetNamespaces()[namespace]; ok {
 		if b, ok := ns.GetBuckets()[name]; ok && b != nil {
 			current = b
 		}
 	}
 
 	if current == nil {
-		return 0, 0, 0, newError(fmt.Sprintf("%s/%s does not exist", namespace, name), ER_NO_BUCKET)
+		return 0, 0, 0, "", newError(fmt.Sprintf("%s/%s does not exist", namespace, name), ER_NO_BUCKET)
 	}
 
-	return current.GetSize(), current.GetFillRate(), current.GetWaitTimeoutMillis(), nil
+	scheduled, rule := config.ScheduledBucketConfig(current, bc.s.clock.Now())
+	return scheduled.GetSize(), scheduled.GetFillRate(), scheduled.GetWaitTimeoutMillis(), rule.GetName(), nil
 }
 
 func (s *server) ServeAdminConsole(mux *http.ServeMux, assetsDir string, development bool) {
-	admin.ServeAdminConsole(s, mux, assetsDir, development)
+	admin.ServeSecureAdminConsole(s, mux, assetsDir, development, s.adminAuth, s.adminPolicy, s.adminProxies)
+}
+
+func (s *server) SetAdminAuth(authenticator admin.Authenticator, policy *admin.Policy) {
+	s.adminAuth = authenticator
+	s.adminPolicy = policy
+}
+
+func (s *server) SetAdminProxies(proxies admin.TrustedProxies) {
+	s.adminProxies = proxies
 }
 
 func (s *server) SetLogger(logger logging.Logger) {
@@ -205,6 +245,24 @@ func (s *server) SetStatsListener(listener stats.Listener) {
 	s.statsListener = listener
 }
 
+func (s *server) SetRolloutNode(node string, canary bool, store stats.HealthStore) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set rollout node after server has started!")
+	}
+
+	s.node = node
+	s.canary = canary
+	s.healthStore = store
+}
+
+func (s *server) SetAuditSink(sink audit.Sink) {
+	if s.currentStatus == lifecycle.Started {
+		panic("Cannot set audit sink after server has started!")
+	}
+
+	s.auditSink = sink
+}
+
 func (s *server) SetListener(listener events.Listener, eventQueueBufSize int) {
 	if s.currentStatus == lifecycle.Started {
 		panic("Cannot add listener after server has started!")
@@ -250,11 +308,30 @@ func (s *server) readUpdatedConfig(jitter time.Duration) {
 		return
 	}
 
+	if _, err := config.Migrate(newConfig); err != nil {
+		logging.Println("error migrating config", err)
+		return
+	}
+
+	served, err := s.servedConfig(newConfig)
+
+	if err != nil {
+		logging.Println("error reading stable config", err)
+		return
+	}
+
+	effective, err := config.EffectiveConfig(served)
+
+	if err != nil {
+		logging.Println("error applying config defaults", err)
+		return
+	}
+
 	if jitter != 0 {
 		time.Sleep(jitter)
 	}
 
-	s.updateBucketContainer(newConfig)
+	s.updateBucketContainer(newConfig, effective)
 }
 
 func (s *server) createBucketContainer() {
@@ -267,36 +344,38 @@ func (s *server) createBucketContainer() {
 	s.bucketContainer = NewBucketContainer(s.bucketFactory, s, s.reaperConfig)
 }
 
-func (s *server) updateBucketContainer(newConfig *pb.ServiceConfig) {
+// updateBucketContainer switches to a new config, serving buckets from effective. This is the
+// effective config of the new config itself, unless this node is waiting out a staged rollout of it.
+func (s *server) updateBucketContainer(newConfig, effective *pb.ServiceConfig) {
 	s.Lock()
 	defer s.Unlock()
 	s.bucketContainer.Lock()
 	defer s.bucketContainer.Unlock()
 
+	// The config is kept as declared, so changes to bucket defaults are inherited by buckets that
+	// don't override them. Buckets are served from the effective config.
+	s.cfgs = newConfig
+	newConfig = effective
+	s.health.reset(newConfig.Version)
+
 	// Initialize buckets
 	s.bucketFactory.Init(newConfig)
 
 	// If there is no existing config, then this bucket container is brand-new and hasn't been used before.
 	firstTime := s.bucketContainer.cfg == nil
 
-	// Set the new config on the the server
-	s.cfgs = newConfig
-
 	if firstTime {
 		s.bucketContainer.initLocked(newConfig)
 		return
 	}
 
+	oldConfig := s.bucketContainer.cfg
 	s.bucketContainer.cfg = newConfig
 	// Diff existing configs, buckets and namespaces against the new config and see what needs to be evicted
 
-	// Start with the globalDefaultBucket
-	var currentDefaultBucketCfg *pb.BucketConfig
-	if s.bucketContainer.defaultBucket != nil {
-		currentDefaultBucketCfg = s.bucketContainer.defaultBucket.Config()
-	}
-
-	if config.DifferentBucketConfigs(currentDefaultBucketCfg, newConfig.GlobalDefaultBucket) {
+	// Start with the globalDefaultBucket. Its config is compared as configured, since the bucket
+	// itself may be serving the limits of a schedule rule.
+	if config.DifferentBucketConfigs(oldConfig.GlobalDefaultBucket, newConfig.GlobalDefaultBucket) {
 		if s.bucketContainer.defaultBucket != nil {
 			// We need to destroy existing buckets even if we are replacing them.
 			s.bucketContainer.defaultBucket.Destroy()
@@ -305,7 +384,7 @@ func (s *server) updateBucketContainer(newConfig *pb.ServiceConfig) {
 		if newConfig.GlobalDefaultBucket == nil {
 			s.bucketContainer.defaultBucket = nil
 		} else {
-			s.bucketContainer.createGlobalDefaultBucketLocked(s.cfgs.GlobalDefaultBucket)
+			s.bucketContainer.createGlobalDefaultBucketLocked(newConfig.GlobalDefaultBucket)
 		}
 	}
 
@@ -341,21 +420,40 @@ func (s *server) updateBucketContainer(newConfig *pb.ServiceConfig) {
 	}
 }
 
-func (s *server) updateConfig(user string, updater func(*pb.ServiceConfig) error) error {
+func (s *server) updateConfig(change *audit.Record, updater func(*pb.ServiceConfig) error) error {
+	return s.updateConfigIfVersion(change, nil, updater)
+}
+
+// updateConfigIfVersion updates the config, provided the current config is at the expected version.
+// If expected is nil, the current config is updated regardless of its version. Once persisted, the
+// change is recorded in the audit sink, attributed to its actor.
+func (s *server) updateConfigIfVersion(change *audit.Record, expected *int32, updater func(*pb.ServiceConfig) error) error {
 	s.Lock()
-	clonedCfg := proto.Clone(s.cfgs).(*pb.ServiceConfig)
+	currentCfg := s.cfgs
+	clonedCfg := proto.Clone(currentCfg).(*pb.ServiceConfig)
 	currentVersion := clonedCfg.Version
 	s.Unlock()
 
+	if expected != nil && *expected != currentVersion {
+		return config.ErrConcurrentUpdate
+	}
+
 	err := updater(clonedCfg)
 
 	if err != nil {
 		return err
 	}
 
-	config.ApplyDefaults(clonedCfg)
+	// Updaters may replace the config with one written to an older schema.
+	if _, err := config.Migrate(clonedCfg); err != nil {
+		return err
+	}
+
+	if err := config.Validate(clonedCfg); err != nil {
+		return err
+	}
 
-	clonedCfg.User = user
+	clonedCfg.User = change.User
 	clonedCfg.Date = time.Now().Unix()
 	clonedCfg.Version = currentVersion + 1
 
@@ -365,7 +463,38 @@ func (s *server) updateConfig(user string, updater func(*pb.ServiceConfig) error
 		return e
 	}
 
-	return s.persister.PersistAndNotify(r)
+	if e := s.persister.PersistIfVersion(currentVersion, r); e != nil {
+		return e
+	}
+
+	s.recordChange(change, currentCfg, clonedCfg)
+	return nil
+}
+
+// recordChange writes an audit record of a change from one config to another, if there is an audit
+// sink. The change is already persisted, so failing to record it is only logged.
+func (s *server) recordChange(change *audit.Record, from, to *pb.ServiceConfig) {
+	if s.auditSink == nil {
+		return
+	}
+
+	change.Time = to.Date
+	change.Version = to.Version
+	effectiveFrom, err := config.EffectiveConfig(from)
+	if err == nil {
+		var effectiveTo *pb.ServiceConfig
+		if effectiveTo, err = config.EffectiveConfig(to); err == nil {
+			change.Diff = config.Diff(effectiveFrom, effectiveTo)
+		}
+	}
+
+	if err != nil {
+		logging.Printf("Unable to diff configs for audit record of %v: %v", change.Operation, err)
+	}
+
+	if err := s.auditSink.Write(change); err != nil {
+		logging.Printf("Unable to write audit record of %v by %v: %v", change.Operation, change.User, err)
+	}
 }
 
 // Implements admin.Administrable
@@ -375,45 +504,71 @@ func (s *server) Configs() *pb.ServiceConfig {
 	return s.cfgs
 }
 
-func (s *server) UpdateConfig(c *pb.ServiceConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
-		*clonedCfg = *c
+func (s *server) UpdateConfig(c *pb.ServiceConfig, actor audit.Actor) error {
+	return s.updateConfig(&audit.Record{Actor: actor, Operation: "UpdateConfig"}, func(clonedCfg *pb.ServiceConfig) error {
+		replaceConfig(clonedCfg, c)
+		return nil
+	})
+}
+
+// UpdateConfigIfVersion replaces the config, provided the current config is at the expected
+// version. Otherwise, config.ErrConcurrentUpdate is returned.
+func (s *server) UpdateConfigIfVersion(c *pb.ServiceConfig, expected int32, actor audit.Actor) error {
+	return s.updateConfigIfVersion(&audit.Record{Actor: actor, Operation: "UpdateConfig"}, &expected, func(clonedCfg *pb.ServiceConfig) error {
+		replaceConfig(clonedCfg, c)
 		return nil
 	})
 }
 
-func (s *server) AddBucket(namespace string, b *pb.BucketConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+// Rollback re-persists a historical config as a new version, so the history of changes is kept.
+func (s *server) Rollback(version int32, actor audit.Actor) error {
+	target, err := s.historicalConfig(version)
+
+	if err != nil {
+		return err
+	}
+
+	return s.updateConfig(&audit.Record{Actor: actor, Operation: "Rollback"}, func(clonedCfg *pb.ServiceConfig) error {
+		replaceConfig(clonedCfg, target)
+		return nil
+	})
+}
+
+func (s *server) AddBucket(namespace string, b *pb.BucketConfig, actor audit.Actor) error {
+	change := &audit.Record{Actor: actor, Operation: "AddBucket", Namespace: namespace, Bucket: b.Name}
+	return s.updateConfig(change, func(clonedCfg *pb.ServiceConfig) error {
 		return config.CreateBucket(clonedCfg, namespace, b)
 	})
 }
 
-func (s *server) UpdateBucket(namespace string, b *pb.BucketConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+func (s *server) UpdateBucket(namespace string, b *pb.BucketConfig, actor audit.Actor) error {
+	change := &audit.Record{Actor: actor, Operation: "UpdateBucket", Namespace: namespace, Bucket: b.Name}
+	return s.updateConfig(change, func(clonedCfg *pb.ServiceConfig) error {
 		return config.UpdateBucket(clonedCfg, namespace, b)
 	})
 }
 
-func (s *server) DeleteBucket(namespace, name, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+func (s *server) DeleteBucket(namespace, name string, actor audit.Actor) error {
+	change := &audit.Record{Actor: actor, Operation: "DeleteBucket", Namespace: namespace, Bucket: name}
+	return s.updateConfig(change, func(clonedCfg *pb.ServiceConfig) error {
 		return config.DeleteBucket(clonedCfg, namespace, name)
 	})
 }
 
-func (s *server) AddNamespace(n *pb.NamespaceConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+func (s *server) AddNamespace(n *pb.NamespaceConfig, actor audit.Actor) error {
+	return s.updateConfig(&audit.Record{Actor: actor, Operation: "AddNamespace", Namespace: n.Name}, func(clonedCfg *pb.ServiceConfig) error {
 		return config.CreateNamespace(clonedCfg, n)
 	})
 }
 
-func (s *server) UpdateNamespace(n *pb.NamespaceConfig, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+func (s *server) UpdateNamespace(n *pb.NamespaceConfig, actor audit.Actor) error {
+	return s.updateConfig(&audit.Record{Actor: actor, Operation: "UpdateNamespace", Namespace: n.Name}, func(clonedCfg *pb.ServiceConfig) error {
 		return config.UpdateNamespace(clonedCfg, n)
 	})
 }
 
-func (s *server) DeleteNamespace(n, user string) error {
-	return s.updateConfig(user, func(clonedCfg *pb.ServiceConfig) error {
+func (s *server) DeleteNamespace(n string, actor audit.Actor) error {
+	return s.updateConfig(&audit.Record{Actor: actor, Operation: "DeleteNamespace", Namespace: n}, func(clonedCfg *pb.ServiceConfig) error {
 		return config.DeleteNamespace(clonedCfg, n)
 	})
 }
@@ -442,8 +597,39 @@ func (s *server) DynamicBucketStats(namespace, bucket string) *stats.BucketScore
 	return s.statsListener.Get(namespace, bucket)
 }
 
-func (s *server) HistoricalConfigs() ([]*pb.ServiceConfig, error) {
-	configs, err := s.persister.ReadHistoricalConfigs()
+// historicalConfig returns the config with the given version.
+func (s *server) historicalConfig(version int32) (*pb.ServiceConfig, error) {
+	configs, err := s.HistoricalConfigs(config.AllHistory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range configs {
+		if c.Version == version {
+			return c, nil
+		}
+	}
+
+	return nil, config.ErrNoSuchVersion
+}
+
+// AuditRecords returns the audit records selected by f, newest first.
+func (s *server) AuditRecords(f audit.Filter) ([]*audit.Record, error) {
+	if s.auditSink == nil {
+		return nil, audit.ErrNoSink
+	}
+
+	return s.auditSink.Query(f)
+}
+
+// MigrateHistory upgrades every historical config to the current schema version in place.
+func (s *server) MigrateHistory() (int, error) {
+	return config.MigrateHistory(s.persister)
+}
+
+func (s *server) HistoricalConfigs(page config.HistoryPage) ([]*pb.ServiceConfig, error) {
+	configs, err := s.persister.ReadHistoricalConfigs(page)
 
 	if err != nil {
 		return nil, err
@@ -458,6 +644,10 @@ func (s *server) HistoricalConfigs() ([]*pb.ServiceConfig, error) {
 			return nil, err
 		}
 
+		if _, err := config.Migrate(unmarshalledConfig); err != nil {
+			return nil, err
+		}
+
 		unmarshalledConfigs[i] = unmarshalledConfig
 	}
 
@@ -4,10 +4,14 @@
 package quotaservice
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/mian-qin/qqs/quotaservice/audit"
 	"github.com/mian-qin/qqs/quotaservice/config"
+	pb "github.com/mian-qin/qqs/quotaservice/protos/config"
 	"github.com/mian-qin/qqs/quotaservice/test/helpers"
 )
 
@@ -45,7 +49,7 @@ func TestUpdateConfig(t *testing.T) {
 
 	newConfig := config.NewDefaultServiceConfig()
 
-	if err := s.UpdateConfig(newConfig, "test"); err != nil {
+	if err := s.UpdateConfig(newConfig, audit.Actor{User: "test"}); err != nil {
 		t.Fatal("Error when updating config", err)
 	}
 
@@ -74,6 +78,308 @@ func TestUpdateConfig(t *testing.T) {
 	}
 }
 
+func TestUpdateConfigConflict(t *testing.T) {
+	p := config.NewMemoryConfigPersister()
+	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	// Another node updates the config before this one sees it.
+	newConfig := config.NewDefaultServiceConfig()
+	newConfig.Version = s.Configs().Version + 1
+	r, err := config.Marshal(newConfig)
+	helpers.CheckError(t, err)
+	helpers.CheckError(t, p.PersistIfVersion(s.Configs().Version, r))
+
+	s.Lock()
+	s.cfgs = config.NewDefaultServiceConfig()
+	s.Unlock()
+
+	if err := s.UpdateConfig(config.NewDefaultServiceConfig(), audit.Actor{User: "test"}); err != config.ErrConcurrentUpdate {
+		t.Fatalf("Expected ErrConcurrentUpdate, got %v", err)
+	}
+}
+
+func TestUpdateConfigIfVersion(t *testing.T) {
+	p := config.NewMemoryConfigPersister()
+	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	newConfig := config.NewDefaultServiceConfig()
+	newConfig.Namespaces["foo"] = config.NewDefaultNamespaceConfig("foo")
+
+	if err := s.UpdateConfigIfVersion(newConfig, 3, audit.Actor{User: "test"}); err != config.ErrConcurrentUpdate {
+		t.Fatalf("Expected ErrConcurrentUpdate, got %v", err)
+	}
+
+	helpers.CheckError(t, s.UpdateConfigIfVersion(newConfig, 0, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 1)
+
+	if s.Configs().Namespaces["foo"] == nil {
+		t.Errorf("Config was not updated: %+v", s.Configs())
+	}
+}
+
+func TestUpdateConfigInvalid(t *testing.T) {
+	p := config.NewMemoryConfigPersister()
+	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	ns := config.NewDefaultNamespaceConfig("foo")
+	ns.DefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+	ns.DynamicBucketTemplate = config.NewDefaultBucketConfig(config.DynamicBucketTemplateName)
+
+	if _, ok := s.AddNamespace(ns, audit.Actor{User: "test"}).(config.ValidationErrors); !ok {
+		t.Fatal("Expected a namespace with a default and dynamic bucket to be invalid")
+	}
+
+	newConfig := config.NewDefaultServiceConfig()
+	newConfig.GlobalDefaultBucket = config.NewDefaultBucketConfig(config.DefaultBucketName)
+	newConfig.GlobalDefaultBucket.MaxTokensPerRequest = newConfig.GlobalDefaultBucket.Size + 1
+
+	if _, ok := s.UpdateConfig(newConfig, audit.Actor{User: "test"}).(config.ValidationErrors); !ok {
+		t.Fatal("Expected a bucket allowing more tokens per request than its size to be invalid")
+	}
+
+	if s.Configs().Version != 0 {
+		t.Errorf("Config was updated: %+v", s.Configs())
+	}
+}
+
+func TestBucketDefaultsInherited(t *testing.T) {
+	p := config.NewMemoryConfigPersister()
+	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	ns := config.NewDefaultNamespaceConfig("foo")
+	ns.BucketDefaults = &pb.BucketConfig{Size: 500, WaitTimeoutMillis: 2000}
+	helpers.CheckError(t, config.AddBucket(ns, &pb.BucketConfig{Name: "inherits"}))
+	helpers.CheckError(t, config.AddBucket(ns, &pb.BucketConfig{Name: "overrides", Size: 10, FillRate: 5}))
+	helpers.CheckError(t, s.AddNamespace(ns, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 1)
+
+	// Changing the namespace's defaults is a single edit...
+	helpers.CheckError(t, s.updateConfig(&audit.Record{Actor: audit.Actor{User: "test"}, Operation: "UpdateConfig"}, func(clonedCfg *pb.ServiceConfig) error {
+		clonedCfg.Namespaces["foo"].BucketDefaults.Size = 1000
+		return nil
+	}))
+	waitForVersion(t, s, 2)
+
+	// ... that buckets not overriding them inherit.
+	size, fillRate, waitTimeout, _, err := s.GetInfo("foo", "inherits")
+	helpers.CheckError(t, err)
+
+	if size != 1000 || fillRate != 50 || waitTimeout != 2000 {
+		t.Errorf("Expected inherited size 1000, fill rate 50 and wait timeout 2000, got %v, %v and %v",
+			size, fillRate, waitTimeout)
+	}
+
+	size, fillRate, waitTimeout, _, err = s.GetInfo("foo", "overrides")
+	helpers.CheckError(t, err)
+
+	if size != 10 || fillRate != 5 || waitTimeout != 2000 {
+		t.Errorf("Expected size 10, fill rate 5 and inherited wait timeout 2000, got %v, %v and %v",
+			size, fillRate, waitTimeout)
+	}
+
+	// The config is kept as declared.
+	if s.Configs().Namespaces["foo"].Buckets["inherits"].Size != 0 {
+		t.Errorf("Inherited fields should not be persisted: %+v", s.Configs().Namespaces["foo"])
+	}
+}
+
+func TestRollback(t *testing.T) {
+	p := config.NewMemoryConfigPersister()
+	s := New(&MockBucketFactory{}, p, NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	helpers.CheckError(t, s.AddNamespace(config.NewDefaultNamespaceConfig("foo"), audit.Actor{User: "test"}))
+	waitForVersion(t, s, 1)
+
+	helpers.CheckError(t, s.DeleteNamespace("foo", audit.Actor{User: "test"}))
+	waitForVersion(t, s, 2)
+
+	if err := s.Rollback(7, audit.Actor{User: "test"}); err != config.ErrNoSuchVersion {
+		t.Fatalf("Expected rolling back to a nonexistent version to fail with ErrNoSuchVersion. Got %v", err)
+	}
+
+	helpers.CheckError(t, s.Rollback(1, audit.Actor{User: "rollbacker"}))
+	waitForVersion(t, s, 3)
+
+	cfg := s.Configs()
+
+	if cfg.Namespaces["foo"] == nil {
+		t.Errorf("Namespace foo was not restored: %+v", cfg)
+	}
+
+	if cfg.User != "rollbacker" {
+		t.Errorf("User %+v does not match passed in user \"rollbacker\"", cfg.User)
+	}
+}
+
+func TestUpdateKeepsDeclaredBucket(t *testing.T) {
+	s := New(&MockBucketFactory{}, config.NewMemoryConfigPersister(), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	declared := &pb.BucketConfig{
+		Name:                "bar",
+		Size:                10,
+		MaxTokensPerRequest: 5,
+		Owner:               "payments-team",
+		Labels:              map[string]string{"tier": "1"},
+		Schedule:            []*pb.ScheduleRule{{Name: "sale", NotBefore: 1, Size: 1000}}}
+	ns := config.NewDefaultNamespaceConfig("foo")
+	ns.BucketDefaults = &pb.BucketConfig{MaxDebtMillis: 5000}
+	helpers.CheckError(t, config.AddBucket(ns, declared))
+	helpers.CheckError(t, s.AddNamespace(ns, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 1)
+
+	helpers.CheckError(t, s.Update("foo", "bar", 0, 20, 0, audit.Actor{User: "test"}))
+	waitForVersion(t, s, 2)
+
+	expected := proto.Clone(declared).(*pb.BucketConfig)
+	expected.FillRate = 20
+	if updated := s.Configs().Namespaces["foo"].Buckets["bar"]; !proto.Equal(updated, expected) {
+		t.Errorf("Expected only the fill rate to change, got %+v", updated)
+	}
+
+	// The schedule still applies.
+	size, fillRate, _, rule, err := s.GetInfo("foo", "bar")
+	helpers.CheckError(t, err)
+
+	if size != 1000 || fillRate != 20 || rule != "sale" {
+		t.Errorf("Expected scheduled size 1000 and fill rate 20 under rule sale, got %v, %v and %v", size, fillRate, rule)
+	}
+
+	// Fields left unset are still inherited.
+	s.RLock()
+	maxDebt := s.bucketContainer.cfg.Namespaces["foo"].Buckets["bar"].MaxDebtMillis
+	s.RUnlock()
+
+	if maxDebt != 5000 {
+		t.Errorf("Expected max debt to be inherited from bucket defaults, got %v", maxDebt)
+	}
+}
+
+func TestChangesAudited(t *testing.T) {
+	sink := audit.NewMemorySink()
+	s := New(&MockBucketFactory{}, config.NewMemoryConfigPersister(), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	s.SetAuditSink(sink)
+
+	if _, err := s.AuditRecords(audit.Filter{}); err != nil {
+		t.Fatal("Error when querying audit records", err)
+	}
+
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	alice := audit.Actor{User: "alice", SourceIP: "10.0.0.1"}
+	ns := config.NewDefaultNamespaceConfig("foo")
+	helpers.CheckError(t, config.AddBucket(ns, config.NewDefaultBucketConfig("first")))
+	helpers.CheckError(t, s.AddNamespace(ns, alice))
+	waitForVersion(t, s, 1)
+
+	helpers.CheckError(t, s.AddBucket("foo", config.NewDefaultBucketConfig("bar"), audit.Actor{User: "bob"}))
+	waitForVersion(t, s, 2)
+
+	// Failed changes aren't recorded.
+	if err := s.AddNamespace(config.NewDefaultNamespaceConfig("foo"), alice); err == nil {
+		t.Fatal("Expected adding an existing namespace to fail")
+	}
+
+	records, err := s.AuditRecords(audit.Filter{})
+	helpers.CheckError(t, err)
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 audit records, got %+v", records)
+	}
+
+	added := records[1]
+	if added.Actor != alice || added.Operation != "AddNamespace" || added.Namespace != "foo" || added.Version != 1 ||
+		!reflect.DeepEqual(added.Diff.NamespacesAdded, []string{"foo"}) || added.Diff.FromVersion != 0 {
+		t.Errorf("Unexpected record of the namespace added: %+v", added)
+	}
+
+	bucket := records[0]
+	if bucket.User != "bob" || bucket.Operation != "AddBucket" || bucket.Bucket != "bar" || bucket.Version != 2 ||
+		bucket.Time != s.Configs().Date || !reflect.DeepEqual(bucket.Diff.BucketsAdded, []string{"foo:bar"}) {
+		t.Errorf("Unexpected record of the bucket added: %+v", bucket)
+	}
+
+	if records, _ := s.AuditRecords(audit.Filter{User: "bob"}); len(records) != 1 {
+		t.Errorf("Expected a single record by bob, got %+v", records)
+	}
+}
+
+func TestAuditRecordsNoSink(t *testing.T) {
+	s := New(&MockBucketFactory{}, config.NewMemoryConfigPersister(), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+
+	if _, err := s.AuditRecords(audit.Filter{}); err != audit.ErrNoSink {
+		t.Errorf("Expected ErrNoSink, got %v", err)
+	}
+}
+
+func TestOlderSchemaMigrated(t *testing.T) {
+	// Persisted before schema versions, without the names of namespaces and buckets.
+	cfg := &pb.ServiceConfig{Namespaces: map[string]*pb.NamespaceConfig{
+		"foo": {Buckets: map[string]*pb.BucketConfig{"bar": {Size: 10}}}}}
+
+	s := New(&MockBucketFactory{}, config.NewMemoryConfig(cfg), NewReaperConfigForTests(), 0, &MockEndpoint{}).(*server)
+	_, err := s.Start()
+	helpers.CheckError(t, err)
+	defer stopServer(t, s)
+
+	if c := s.Configs(); c.SchemaVersion != config.CurrentSchemaVersion || c.Namespaces["foo"].Buckets["bar"].Name != "bar" {
+		t.Errorf("Expected the served config to be migrated, got %+v", c)
+	}
+
+	configs, err := s.HistoricalConfigs(config.AllHistory)
+	helpers.CheckError(t, err)
+
+	if configs[0].SchemaVersion != config.CurrentSchemaVersion || configs[0].Namespaces["foo"].Name != "foo" {
+		t.Errorf("Expected historical configs to be migrated, got %+v", configs[0])
+	}
+
+	migrated, err := s.MigrateHistory()
+	helpers.CheckError(t, err)
+
+	if migrated != 1 {
+		t.Errorf("Expected the stored config to be migrated, got %v", migrated)
+	}
+}
+
+func waitForVersion(t *testing.T, s *server, version int32) {
+	// t.Helper()
+
+	start := time.Now()
+
+	for s.Configs().Version != version {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Timeout waiting for config version %v!", version)
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
 func TestTooManyTokensRequested(t *testing.T) {
 	cfg := config.NewDefaultServiceConfig()
 	nsc := config.NewDefaultNamespaceConfig("dummy")
@@ -0,0 +1,150 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package stats
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/redis.v5"
+
+	"github.com/mian-qin/qqs/quotaservice/logging"
+)
+
+// healthKey is the redis hash holding each node's health, keyed by node.
+const healthKey = "rollout:health"
+
+// healthExpiry is how long nodes' health is kept in redis after the last report, so nodes that
+// have gone away are eventually forgotten.
+const healthExpiry = time.Hour
+
+// NodeHealth stores the requests a node rejected while serving a config version. Rejections are
+// requests that timed out, asked for too many tokens or didn't match a bucket.
+type NodeHealth struct {
+	Node       string `json:"node"`
+	Canary     bool   `json:"canary"`
+	Version    int32  `json:"version"`
+	Requests   int64  `json:"requests"`
+	Rejections int64  `json:"rejections"`
+	// Unix timestamp, in seconds, of the report
+	Reported int64 `json:"reported"`
+}
+
+// RejectionRate returns the fraction of requests that were rejected.
+func (h *NodeHealth) RejectionRate() float64 {
+	if h.Requests == 0 {
+		return 0
+	}
+
+	return float64(h.Rejections) / float64(h.Requests)
+}
+
+// HealthStore shares the health of every node in a fleet, so canary nodes can be compared against
+// the rest.
+type HealthStore interface {
+	ReportHealth(*NodeHealth) error
+	FleetHealth() ([]*NodeHealth, error)
+}
+
+// NodeHealthArray implements a NodeHealth array sortable by node.
+type NodeHealthArray []*NodeHealth
+
+func (h NodeHealthArray) Len() int {
+	return len(h)
+}
+
+func (h NodeHealthArray) Less(i, j int) bool {
+	return h[i].Node < h[j].Node
+}
+
+func (h NodeHealthArray) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+type memoryHealthStore struct {
+	nodes        map[string]NodeHealth
+	sync.RWMutex // Embedded mutex
+}
+
+// NewMemoryHealthStore creates an in-memory health store, for nodes in the same process.
+func NewMemoryHealthStore() HealthStore {
+	return &memoryHealthStore{nodes: make(map[string]NodeHealth)}
+}
+
+func (s *memoryHealthStore) ReportHealth(h *NodeHealth) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.nodes[h.Node] = *h
+	return nil
+}
+
+func (s *memoryHealthStore) FleetHealth() ([]*NodeHealth, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	fleet := make(NodeHealthArray, 0, len(s.nodes))
+	for _, h := range s.nodes {
+		h := h
+		fleet = append(fleet, &h)
+	}
+
+	sort.Sort(fleet)
+	return fleet, nil
+}
+
+type redisHealthStore struct {
+	client *redis.Client
+}
+
+// NewRedisHealthStore creates a redis-backed health store, shared by every node using the passed
+// in redis.Options.
+func NewRedisHealthStore(redisOpts *redis.Options) HealthStore {
+	client := redis.NewClient(redisOpts)
+	_, err := client.Ping().Result()
+
+	if err != nil {
+		logging.Fatalf("RedisHealthStore: cannot connect to Redis, %v", err)
+	}
+
+	return &redisHealthStore{client}
+}
+
+func (s *redisHealthStore) ReportHealth(h *NodeHealth) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.Pipelined(func(pipe *redis.Pipeline) error {
+		pipe.HSet(healthKey, h.Node, string(b))
+		pipe.Expire(healthKey, healthExpiry)
+		return nil
+	})
+
+	return err
+}
+
+func (s *redisHealthStore) FleetHealth() ([]*NodeHealth, error) {
+	results, err := s.client.HGetAll(healthKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	fleet := make(NodeHealthArray, 0, len(results))
+	for node, value := range results {
+		h := &NodeHealth{}
+		if err := json.Unmarshal([]byte(value), h); err != nil {
+			logging.Printf("RedisHealthStore.FleetHealth error (%s) %v", node, err)
+			continue
+		}
+
+		fleet = append(fleet, h)
+	}
+
+	sort.Sort(fleet)
+	return fleet, nil
+}
@@ -0,0 +1,40 @@
+// Licensed under the Apache License, Version 2.0
+// Details: https://raw.githubusercontent.com/square/quotaservice/master/LICENSE
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/mian-qin/qqs/quotaservice/stats"
+)
+
+func TestMemoryHealthStore(t *testing.T) {
+	store := stats.NewMemoryHealthStore()
+
+	for _, h := range []*stats.NodeHealth{
+		{Node: "b", Version: 1, Requests: 10, Rejections: 1},
+		{Node: "a", Canary: true, Version: 2, Requests: 4, Rejections: 1},
+		{Node: "b", Version: 1, Requests: 20, Rejections: 1}} {
+		if err := store.ReportHealth(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fleet, err := store.FleetHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fleet) != 2 || fleet[0].Node != "a" || fleet[1].Requests != 20 {
+		t.Fatalf("Expected the latest health of nodes a and b, got %+v", fleet)
+	}
+
+	if rate := fleet[0].RejectionRate(); rate != 0.25 {
+		t.Errorf("Expected rejection rate 0.25, got %v", rate)
+	}
+
+	if rate := (&stats.NodeHealth{}).RejectionRate(); rate != 0 {
+		t.Errorf("Expected rejection rate 0 without requests, got %v", rate)
+	}
+}
@@ -0,0 +1,95 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCA is a self-signed certificate authority, issuing certificates for tests into a directory.
+type TestCA struct {
+	// CertFile is the PEM file of the CA's own certificate.
+	CertFile string
+
+	dir    string
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+// NewTestCA creates a certificate authority writing its certificates into dir.
+func NewTestCA(t *testing.T, dir string) *TestCA {
+	// t.Helper()
+
+	ca := &TestCA{dir: dir, serial: 1}
+	template := ca.template("Test CA")
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	CheckError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	CheckError(t, err)
+
+	ca.cert, err = x509.ParseCertificate(der)
+	CheckError(t, err)
+
+	ca.key = key
+	ca.CertFile = filepath.Join(dir, "ca.pem")
+	writePEM(t, ca.CertFile, "CERTIFICATE", der)
+	return ca
+}
+
+// Issue writes a certificate and key for a common name, valid for both servers on localhost and
+// clients. Issuing the same name again replaces its files. Returns the certificate and key files.
+func (ca *TestCA) Issue(t *testing.T, commonName string) (certFile, keyFile string) {
+	// t.Helper()
+
+	template := ca.template(commonName)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	template.DNSNames = []string{"localhost"}
+	template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	CheckError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	CheckError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	CheckError(t, err)
+
+	certFile = filepath.Join(ca.dir, commonName+".pem")
+	keyFile = filepath.Join(ca.dir, commonName+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func (ca *TestCA) template(commonName string) *x509.Certificate {
+	ca.serial++
+
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour)}
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	// t.Helper()
+
+	CheckError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+}
@@ -3,7 +3,11 @@ package helpers
 import (
 	"fmt"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/mian-qin/qqs/quotaservice/clock"
 )
 
 // ExpectingPanic indicates that a function passed in should panic. If it does, no errors are
@@ -38,3 +42,80 @@ func PanicError(e error) {
 		panic(fmt.Sprintf("Not expecting error %+v", e))
 	}
 }
+
+// FakeClock is a clock.Clock whose time only moves when Advance() is called.
+type FakeClock struct {
+	now     time.Time
+	tickers []*fakeTicker
+	sync.Mutex
+}
+
+// NewFakeClock creates a FakeClock, starting at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) clock.Ticker {
+	c.Lock()
+	defer c.Unlock()
+
+	t := &fakeTicker{c: make(chan time.Time, 1), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing any tickers that are due. Like a time.Ticker, ticks
+// are dropped if the receiver hasn't consumed the previous tick.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.tickers {
+		t.fire(c.now)
+	}
+}
+
+type fakeTicker struct {
+	c       chan time.Time
+	period  time.Duration
+	next    time.Time
+	stopped bool
+	sync.Mutex
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.stopped = true
+}
+
+func (t *fakeTicker) fire(now time.Time) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.stopped || now.Before(t.next) {
+		return
+	}
+
+	select {
+	case t.c <- now:
+	default:
+	}
+
+	for !now.Before(t.next) {
+		t.next = t.next.Add(t.period)
+	}
+}
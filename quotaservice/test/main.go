@@ -11,6 +11,7 @@ import (
 	"syscall"
 
 	"github.com/mian-qin/qqs/quotaservice"
+	"github.com/mian-qin/qqs/quotaservice/audit"
 	"github.com/mian-qin/qqs/quotaservice/buckets/memory"
 	"github.com/mian-qin/qqs/quotaservice/config"
 	"github.com/mian-qin/qqs/quotaservice/logging"
@@ -46,6 +47,7 @@ func main() {
 		0,
 		grpc.New(gRPCServer))
 	server.SetStatsListener(stats.NewMemoryStatsListener())
+	server.SetAuditSink(audit.NewMemorySink())
 	if _, e := server.Start(); e != nil {
 		panic(e)
 	}